@@ -9,6 +9,7 @@ import (
 	"moff.io/moff-social/internal/database"
 	"moff.io/moff-social/internal/databus"
 	"moff.io/moff-social/internal/discord"
+	"moff.io/moff-social/internal/export"
 	"moff.io/moff-social/internal/google"
 	"moff.io/moff-social/internal/http"
 	"moff.io/moff-social/internal/starter"
@@ -45,7 +46,14 @@ func startApp() {
 		//discord.NewUnbelievaboatHandler(),
 		discord.NewQuizGameManager(),
 		discord.NewSingleWriteStorageEngine(),
+		discord.NewCampaignAnnouncer(),
+		discord.NewExpDecayer(),
+		discord.NewVoiceExpTracker(),
+		twitter.NewClient(),
+		twitter.NewAuthorizationPool(),
 		twitter.NewSpaceManager(),
+		twitter.NewTweetSnapshotManager(),
+		export.NewRetentionSweeper(),
 	)
 
 	moralis.Init(config.Global.MoralisAPIKey)
@@ -7,7 +7,6 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
 	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
@@ -91,17 +90,6 @@ func (s *Clients) PutFileToS3(ctx context.Context, key string, file io.Reader) e
 	return errors.WrapAndReport(err, "put object to s3")
 }
 
-func (s *Clients) PutFileToS3WithPublicRead(ctx context.Context, bucket, key string, file io.Reader) error {
-	input := &s3.PutObjectInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(key),
-		ACL:    types.ObjectCannedACLPublicRead,
-		Body:   file,
-	}
-	_, err := s.s3Client.PutObject(ctx, input)
-	return errors.WrapAndReport(err, "put object to s3")
-}
-
 func (s *Clients) DeleteFileFromS3(ctx context.Context, key string) error {
 	input := &s3.DeleteObjectInput{
 		Bucket: aws.String(s.bucketName),
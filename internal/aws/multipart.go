@@ -0,0 +1,135 @@
+package aws
+
+import (
+	"bytes"
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"moff.io/moff-social/pkg/errors"
+	"moff.io/moff-social/pkg/log"
+)
+
+const (
+	// s3要求除最后一片外每片至少5MB
+	minMultipartPartSize = 5 * 1024 * 1024
+)
+
+// MultipartUploadWriter 将写入内容按片上传至s3，内存占用不超过单片大小.
+// 内容不足一片时在Close时退化为普通上传.
+type MultipartUploadWriter struct {
+	ctx      context.Context
+	client   *Clients
+	key      string
+	partSize int
+	buf      bytes.Buffer
+	uploadID *string
+	parts    []types.CompletedPart
+	closed   bool
+}
+
+func (s *Clients) NewMultipartUploadWriter(ctx context.Context, key string) *MultipartUploadWriter {
+	return &MultipartUploadWriter{
+		ctx:      ctx,
+		client:   s,
+		key:      key,
+		partSize: minMultipartPartSize,
+	}
+}
+
+func (in *MultipartUploadWriter) Write(p []byte) (int, error) {
+	if in.closed {
+		return 0, errors.New("write to closed multipart upload")
+	}
+	written := 0
+	for len(p) > 0 {
+		n := in.partSize - in.buf.Len()
+		if n > len(p) {
+			n = len(p)
+		}
+		in.buf.Write(p[:n])
+		written += n
+		p = p[n:]
+		if in.buf.Len() >= in.partSize {
+			if err := in.flushPart(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+func (in *MultipartUploadWriter) flushPart() error {
+	if in.uploadID == nil {
+		output, err := in.client.s3Client.CreateMultipartUpload(in.ctx, &s3.CreateMultipartUploadInput{
+			Bucket: aws.String(in.client.bucketName),
+			Key:    aws.String(in.key),
+		})
+		if err != nil {
+			return errors.WrapAndReport(err, "create s3 multipart upload")
+		}
+		in.uploadID = output.UploadId
+	}
+	partNumber := int32(len(in.parts) + 1)
+	output, err := in.client.s3Client.UploadPart(in.ctx, &s3.UploadPartInput{
+		Bucket:     aws.String(in.client.bucketName),
+		Key:        aws.String(in.key),
+		UploadId:   in.uploadID,
+		PartNumber: partNumber,
+		Body:       bytes.NewReader(in.buf.Bytes()),
+	})
+	if err != nil {
+		return errors.WrapAndReport(err, "upload s3 part")
+	}
+	in.parts = append(in.parts, types.CompletedPart{
+		ETag:       output.ETag,
+		PartNumber: partNumber,
+	})
+	in.buf.Reset()
+	return nil
+}
+
+// Close 上传剩余内容并完成上传
+func (in *MultipartUploadWriter) Close() error {
+	if in.closed {
+		return nil
+	}
+	in.closed = true
+	if in.uploadID == nil {
+		return in.client.PutFileToS3(in.ctx, in.key, bytes.NewReader(in.buf.Bytes()))
+	}
+	if in.buf.Len() > 0 {
+		if err := in.flushPart(); err != nil {
+			in.Abort()
+			return err
+		}
+	}
+	_, err := in.client.s3Client.CompleteMultipartUpload(in.ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(in.client.bucketName),
+		Key:             aws.String(in.key),
+		UploadId:        in.uploadID,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: in.parts},
+	})
+	if err != nil {
+		in.Abort()
+		return errors.WrapAndReport(err, "complete s3 multipart upload")
+	}
+	return nil
+}
+
+// Abort 放弃上传，已上传的分片由s3删除
+func (in *MultipartUploadWriter) Abort() {
+	in.closed = true
+	in.buf.Reset()
+	if in.uploadID == nil {
+		return
+	}
+	_, err := in.client.s3Client.AbortMultipartUpload(context.Background(), &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(in.client.bucketName),
+		Key:      aws.String(in.key),
+		UploadId: in.uploadID,
+	})
+	if err != nil {
+		log.Error(errors.WrapAndReport(err, "abort s3 multipart upload"))
+	}
+}
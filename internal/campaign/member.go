@@ -0,0 +1,133 @@
+package campaign
+
+import (
+	"fmt"
+	"moff.io/moff-social/internal/database"
+	"moff.io/moff-social/pkg/errors"
+	"strings"
+)
+
+// evaluateWhitelist 用户的discord账号、twitter账号或已验证钱包任一在白名单中即满足，args形如{"whitelist_id":"xxx"}
+func evaluateWhitelist(subject *Subject, args map[string]interface{}) (bool, string, error) {
+	whitelistID := stringArg(args, "whitelist_id")
+	if whitelistID == "" {
+		return false, "Invalid whitelist requirement", errors.WithMessage(ErrorInvalidRequirement, "whitelist without whitelist_id")
+	}
+	desc := fmt.Sprintf("On whitelist `%v`", whitelistID)
+	twitterID, err := subject.twitterID()
+	if err != nil {
+		return false, "", err
+	}
+	wallets, err := subject.walletAddrs()
+	if err != nil {
+		return false, "", err
+	}
+	var identities = map[database.CommunityQuestWhitelistUserIdentityType][]string{
+		database.CommunityQuestWhitelistUserIdentityTypeDiscordIds:  {subject.DiscordID},
+		database.CommunityQuestWhitelistUserIdentityTypeWalletAddrs: wallets,
+	}
+	if twitterID != "" {
+		identities[database.CommunityQuestWhitelistUserIdentityTypeTwitterIds] = []string{twitterID}
+	}
+	for identityType, ids := range identities {
+		ok, err := database.CommunityQuestWhitelistUser{}.Contains(whitelistID, identityType, ids)
+		if err != nil {
+			return false, "", err
+		}
+		if ok {
+			return true, desc, nil
+		}
+	}
+	var entities = map[database.WhitelistEntityType][]string{
+		database.WhitelistEntityTypeDiscordID:  {subject.DiscordID},
+		database.WhitelistEntityTypeWalletAddr: wallets,
+	}
+	if twitterID != "" {
+		entities[database.WhitelistEntityTypeTwitterID] = []string{twitterID}
+	}
+	for entityType, ids := range entities {
+		ok, err := database.Whitelist{}.Contains(whitelistID, entityType, ids)
+		if err != nil {
+			return false, "", err
+		}
+		if ok {
+			return true, desc, nil
+		}
+	}
+	return false, desc + ": you're not on it yet", nil
+}
+
+// evaluateDiscordRole 拥有任一角色即满足，args形如{"role_id":"xxx"}或{"role_ids":["xxx"]}
+func evaluateDiscordRole(subject *Subject, args map[string]interface{}) (bool, string, error) {
+	roleIDs := stringsArg(args, "role_id", "role_ids")
+	if len(roleIDs) == 0 {
+		return false, "Invalid role requirement", errors.WithMessage(ErrorInvalidRequirement, "discord_role without role_id")
+	}
+	mentions := make([]string, len(roleIDs))
+	for idx, roleID := range roleIDs {
+		mentions[idx] = fmt.Sprintf("<@&%v>", roleID)
+	}
+	desc := fmt.Sprintf("Have role %v", strings.Join(mentions, " or "))
+	roles := subject.Roles
+	if roles == nil {
+		member, err := subject.discordMember()
+		if err != nil {
+			return false, "", err
+		}
+		if member != nil {
+			for _, role := range member.Roles {
+				roles = append(roles, fmt.Sprint(role))
+			}
+		}
+	}
+	for _, role := range roles {
+		for _, roleID := range roleIDs {
+			if role == roleID {
+				return true, desc, nil
+			}
+		}
+	}
+	return false, desc + ": you don't have it yet", nil
+}
+
+// evaluateLevel 等级达到要求即满足，args形如{"min_level":5}
+func evaluateLevel(subject *Subject, args map[string]interface{}) (bool, string, error) {
+	minLevel, ok := intArg(args, "min_level")
+	if !ok {
+		return false, "Invalid level requirement", errors.WithMessage(ErrorInvalidRequirement, "level without min_level")
+	}
+	desc := fmt.Sprintf("Reach level %v", minLevel)
+	member, err := subject.discordMember()
+	if err != nil {
+		return false, "", err
+	}
+	var level int64
+	if member != nil {
+		level = int64(member.Level)
+	}
+	if level < minLevel {
+		return false, fmt.Sprintf("%v: you're level %v", desc, level), nil
+	}
+	return true, desc, nil
+}
+
+// evaluateInvites 按服务器规则合格的邀请数达到要求即满足，args形如{"min_invites":3}
+func evaluateInvites(subject *Subject, args map[string]interface{}) (bool, string, error) {
+	minInvites, ok := intArg(args, "min_invites")
+	if !ok {
+		return false, "Invalid invites requirement", errors.WithMessage(ErrorInvalidRequirement, "invites without min_invites")
+	}
+	desc := fmt.Sprintf("Invite %v members", minInvites)
+	leaderboards, err := database.DiscordGuildMemberInvites{}.UserTotalInvites(subject.GuildID, subject.DiscordID)
+	if err != nil {
+		return false, "", err
+	}
+	var invites int64
+	for _, leaderboard := range leaderboards {
+		invites += leaderboard.GetValidInvitesCount()
+	}
+	if invites < minInvites {
+		return false, fmt.Sprintf("%v: you have %v qualified invites", desc, invites), nil
+	}
+	return true, desc, nil
+}
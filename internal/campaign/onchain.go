@@ -0,0 +1,71 @@
+package campaign
+
+import (
+	"fmt"
+	"math/big"
+	"moff.io/moff-social/internal/chains/moralis"
+	"moff.io/moff-social/pkg/errors"
+	"strings"
+)
+
+// evaluateNFT 已验证的钱包合计持有数量达到要求即满足，
+// args形如{"chain":"eth","contract":"0x...","token_id":"1","min_amount":1}，token_id为空时统计合约下全部token
+func evaluateNFT(subject *Subject, args map[string]interface{}) (bool, string, error) {
+	var (
+		chain    = stringArg(args, "chain", "chain_name")
+		contract = strings.ToLower(stringArg(args, "contract", "contract_address", "token_address"))
+		tokenID  = stringArg(args, "token_id")
+	)
+	if chain == "" || contract == "" {
+		return false, "Invalid NFT requirement", errors.WithMessage(ErrorInvalidRequirement, "nft without chain or contract")
+	}
+	minAmount, ok := intArg(args, "min_amount")
+	if !ok || minAmount <= 0 {
+		minAmount = 1
+	}
+	desc := fmt.Sprintf("Hold %v NFT of `%v` on %v", minAmount, contract, chain)
+	if tokenID != "" {
+		desc = fmt.Sprintf("Hold %v of token #%v of `%v` on %v", minAmount, tokenID, contract, chain)
+	}
+	wallets, err := subject.walletAddrs()
+	if err != nil {
+		return false, "", err
+	}
+	if len(wallets) == 0 {
+		return false, desc + ": verify your wallet first", nil
+	}
+	total := new(big.Int)
+	for _, wallet := range wallets {
+		req := &moralis.GetAddressNFTRequest{
+			ChainName:      chain,
+			Limit:          100,
+			Format:         "decimal",
+			TokenAddresses: []string{contract},
+			OwnerAddress:   wallet,
+		}
+		for {
+			response, err := moralis.NewClient().GetAddressNfts(req)
+			if err != nil {
+				return false, "", err
+			}
+			for _, nft := range response.Result {
+				if tokenID != "" && !strings.EqualFold(nft.TokenID, tokenID) {
+					continue
+				}
+				amount, ok := new(big.Int).SetString(nft.Amount, 10)
+				if !ok {
+					amount = big.NewInt(1)
+				}
+				total.Add(total, amount)
+			}
+			if total.Cmp(big.NewInt(minAmount)) >= 0 {
+				return true, desc, nil
+			}
+			if len(response.Result) == 0 || response.Cursor == "" {
+				break
+			}
+			req.Cursor = response.Cursor
+		}
+	}
+	return false, fmt.Sprintf("%v: your verified wallets hold %v", desc, total), nil
+}
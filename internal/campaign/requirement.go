@@ -0,0 +1,260 @@
+package campaign
+
+import (
+	"fmt"
+	"moff.io/moff-social/internal/database"
+	"moff.io/moff-social/pkg/errors"
+	"moff.io/moff-social/pkg/log"
+	"strings"
+)
+
+const (
+	RequirementWhitelist     = "whitelist"
+	RequirementTwitterFollow = "twitter_follow"
+	RequirementDiscordRole   = "discord_role"
+	RequirementLevel         = "level"
+	RequirementInvites       = "invites"
+	RequirementNFT           = "nft"
+	RequirementSnapshot      = "snapshot"
+
+	OperatorAnd = "and"
+	OperatorOr  = "or"
+)
+
+var (
+	ErrorUnsupportedRequirement = errors.New("unsupported campaign requirement")
+	ErrorInvalidRequirement     = errors.New("invalid campaign requirement")
+)
+
+// Subject 检查活动要求的用户，未提供的twitter账号、钱包及成员信息按需查询并缓存
+type Subject struct {
+	GuildID   string
+	DiscordID string
+	TwitterID string
+	// Roles 用户当前的discord角色，为空时使用数据库中记录的角色
+	Roles []string
+
+	wallets       []string
+	walletsLoaded bool
+	member        *database.DiscordMember
+	memberLoaded  bool
+}
+
+func (in *Subject) twitterID() (string, error) {
+	if in.TwitterID != "" || in.DiscordID == "" {
+		return in.TwitterID, nil
+	}
+	links, err := database.IdentityLinks{}.SelectByDiscordIDs(database.CommunityQuestWhitelistUserIdentityTypeTwitterIds,
+		[]string{in.DiscordID})
+	if err != nil {
+		return "", err
+	}
+	if len(links) > 0 {
+		in.TwitterID = links[len(links)-1].Identity
+	}
+	return in.TwitterID, nil
+}
+
+// walletAddrs 已验证的钱包地址，统一为小写
+func (in *Subject) walletAddrs() ([]string, error) {
+	if in.walletsLoaded || in.DiscordID == "" {
+		return in.wallets, nil
+	}
+	links, err := database.IdentityLinks{}.SelectByDiscordIDs(database.CommunityQuestWhitelistUserIdentityTypeWalletAddrs,
+		[]string{in.DiscordID})
+	if err != nil {
+		return nil, err
+	}
+	for _, link := range links {
+		in.wallets = append(in.wallets, strings.ToLower(link.Identity))
+	}
+	in.walletsLoaded = true
+	return in.wallets, nil
+}
+
+// discordMember 用户在服务器中的成员记录，未加入时返回nil
+func (in *Subject) discordMember() (*database.DiscordMember, error) {
+	if in.memberLoaded {
+		return in.member, nil
+	}
+	member, err := database.DiscordMember{}.SelectOne(in.GuildID, in.DiscordID)
+	if err != nil {
+		return nil, err
+	}
+	in.member, in.memberLoaded = member, true
+	return member, nil
+}
+
+// Evaluator 检查用户是否满足一种类型的活动要求，args为要求中的参数；
+// reason说明要求内容及用户的实际情况，无论是否满足都需返回
+type Evaluator func(subject *Subject, args map[string]interface{}) (passed bool, reason string, err error)
+
+var evaluators = map[string]Evaluator{
+	RequirementWhitelist:     evaluateWhitelist,
+	RequirementTwitterFollow: evaluateTwitterFollow,
+	RequirementDiscordRole:   evaluateDiscordRole,
+	RequirementLevel:         evaluateLevel,
+	RequirementInvites:       evaluateInvites,
+	RequirementNFT:           evaluateNFT,
+	RequirementSnapshot:      evaluateSnapshot,
+}
+
+// Result 要求树的检查结果，and/or节点的Children为各分支的结果
+type Result struct {
+	Operator string
+	Type     string
+	Passed   bool
+	Reason   string
+	Children []*Result
+	Err      error
+}
+
+// Evaluate 检查用户是否满足形如{"and":[{"type":"level","args":{...}},{"or":[...]}]}的要求树，
+// 为了完整说明不满足的原因，所有分支都会检查；空要求视为满足，同时包含多个操作符的节点视为不满足
+func Evaluate(subject *Subject, requirements map[string]interface{}) *Result {
+	if len(requirements) == 0 {
+		return &Result{Passed: true, Reason: "No requirements"}
+	}
+	// 每个节点只能是and、or或单个要求之一，同时包含多个时无法确定组合方式
+	var keys []string
+	for _, key := range []string{OperatorAnd, OperatorOr, "type"} {
+		if _, ok := requirements[key]; ok {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) > 1 {
+		return &Result{
+			Reason: fmt.Sprintf("Invalid requirement with `%v`", strings.Join(keys, "`, `")),
+			Err:    errors.WithMessage(ErrorInvalidRequirement, "requirement node with multiple operators"),
+		}
+	}
+	for _, operator := range []string{OperatorAnd, OperatorOr} {
+		v, ok := requirements[operator]
+		if !ok {
+			continue
+		}
+		result := &Result{Operator: operator, Passed: operator == OperatorAnd}
+		arr, _ := v.([]interface{})
+		for _, ele := range arr {
+			require, ok := ele.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			child := Evaluate(subject, require)
+			result.Children = append(result.Children, child)
+			if operator == OperatorAnd {
+				result.Passed = result.Passed && child.Passed
+			} else {
+				result.Passed = result.Passed || child.Passed
+			}
+		}
+		return result
+	}
+	return EvaluateRequirement(subject, requirements)
+}
+
+// EvaluateRequirement 检查形如{"type":"twitter_follow","args":{...}}的单个要求，检查出错时视为不满足
+func EvaluateRequirement(subject *Subject, requirement map[string]interface{}) *Result {
+	requirementType, _ := requirement["type"].(string)
+	result := &Result{Type: requirementType}
+	evaluator, ok := evaluators[requirementType]
+	if !ok {
+		result.Err = errors.WithMessage(ErrorUnsupportedRequirement, requirementType)
+		result.Reason = fmt.Sprintf("Unsupported requirement `%v`", requirementType)
+		return result
+	}
+	args, _ := requirement["args"].(map[string]interface{})
+	result.Passed, result.Reason, result.Err = evaluator(subject, args)
+	if result.Err != nil {
+		result.Passed = false
+		if !errors.Is(result.Err, ErrorInvalidRequirement) {
+			log.Error(errors.WithMessage(result.Err, fmt.Sprintf("evaluate requirement %v", requirementType)))
+		}
+		if result.Reason == "" {
+			result.Reason = fmt.Sprintf("Unable to check `%v` right now, please try again later", requirementType)
+		}
+	}
+	return result
+}
+
+// Failed 不满足的叶子要求
+func (in *Result) Failed() []*Result {
+	if in.Passed {
+		return nil
+	}
+	if len(in.Children) == 0 {
+		return []*Result{in}
+	}
+	var failed []*Result
+	for _, child := range in.Children {
+		failed = append(failed, child.Failed()...)
+	}
+	return failed
+}
+
+// Explain 逐行展示各分支是否满足
+func (in *Result) Explain() string {
+	var lines []string
+	in.explain(0, &lines)
+	return strings.Join(lines, "\n")
+}
+
+func (in *Result) explain(depth int, lines *[]string) {
+	mark := "❌"
+	if in.Passed {
+		mark = "✅"
+	}
+	text := in.Reason
+	switch in.Operator {
+	case OperatorAnd:
+		text = "**All of:**"
+	case OperatorOr:
+		text = "**Any of:**"
+	}
+	*lines = append(*lines, fmt.Sprintf("%v%v %v", strings.Repeat("　", depth), mark, text))
+	for _, child := range in.Children {
+		child.explain(depth+1, lines)
+	}
+}
+
+func stringArg(args map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		switch v := args[key].(type) {
+		case string:
+			if v = strings.TrimSpace(v); v != "" {
+				return v
+			}
+		case float64:
+			return fmt.Sprint(int64(v))
+		}
+	}
+	return ""
+}
+
+func stringsArg(args map[string]interface{}, single, multiple string) []string {
+	var values []string
+	if v := stringArg(args, single); v != "" {
+		values = append(values, v)
+	}
+	arr, _ := args[multiple].([]interface{})
+	for _, ele := range arr {
+		if v, ok := ele.(string); ok && strings.TrimSpace(v) != "" {
+			values = append(values, strings.TrimSpace(v))
+		}
+	}
+	return values
+}
+
+// intArg 数字参数，兼容字符串形式
+func intArg(args map[string]interface{}, key string) (int64, bool) {
+	switch v := args[key].(type) {
+	case float64:
+		return int64(v), true
+	case string:
+		var n int64
+		if _, err := fmt.Sscan(strings.TrimSpace(v), &n); err == nil {
+			return n, true
+		}
+	}
+	return 0, false
+}
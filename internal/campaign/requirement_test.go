@@ -0,0 +1,72 @@
+package campaign
+
+import (
+	"moff.io/moff-social/pkg/errors"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	evaluators["test_pass"] = func(*Subject, map[string]interface{}) (bool, string, error) {
+		return true, "pass", nil
+	}
+	evaluators["test_fail"] = func(*Subject, map[string]interface{}) (bool, string, error) {
+		return false, "fail", nil
+	}
+	defer func() {
+		delete(evaluators, "test_pass")
+		delete(evaluators, "test_fail")
+	}()
+	var (
+		pass = map[string]interface{}{"type": "test_pass"}
+		fail = map[string]interface{}{"type": "test_fail"}
+	)
+	tests := []struct {
+		name         string
+		requirements map[string]interface{}
+		passed       bool
+		failed       int
+		invalid      bool
+	}{
+		{name: "empty", requirements: map[string]interface{}{}, passed: true},
+		{name: "single pass", requirements: pass, passed: true},
+		{name: "single fail", requirements: fail, failed: 1},
+		{name: "and all pass", requirements: map[string]interface{}{"and": []interface{}{pass, pass}}, passed: true},
+		{name: "and one fail", requirements: map[string]interface{}{"and": []interface{}{pass, fail}}, failed: 1},
+		{name: "or one pass", requirements: map[string]interface{}{"or": []interface{}{fail, pass}}, passed: true},
+		{name: "or all fail", requirements: map[string]interface{}{"or": []interface{}{fail, fail}}, failed: 2},
+		{name: "empty or", requirements: map[string]interface{}{"or": []interface{}{}}, failed: 1},
+		{name: "nested and in or", requirements: map[string]interface{}{"or": []interface{}{
+			map[string]interface{}{"and": []interface{}{pass, fail}},
+			map[string]interface{}{"and": []interface{}{pass, pass}},
+		}}, passed: true},
+		{name: "nested or in and", requirements: map[string]interface{}{"and": []interface{}{
+			pass,
+			map[string]interface{}{"or": []interface{}{fail, fail}},
+		}}, failed: 2},
+		{name: "and with or", requirements: map[string]interface{}{
+			"and": []interface{}{pass},
+			"or":  []interface{}{pass},
+		}, failed: 1, invalid: true},
+		{name: "operator with type", requirements: map[string]interface{}{
+			"and":  []interface{}{pass},
+			"type": "test_pass",
+		}, failed: 1, invalid: true},
+		{name: "nested invalid", requirements: map[string]interface{}{"or": []interface{}{
+			map[string]interface{}{"and": []interface{}{pass}, "or": []interface{}{pass}},
+		}}, failed: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Evaluate(&Subject{}, tt.requirements)
+			if result.Passed != tt.passed {
+				t.Errorf("Evaluate().Passed = %v, want %v\n%v", result.Passed, tt.passed, result.Explain())
+			}
+			if got := len(result.Failed()); got != tt.failed {
+				t.Errorf("len(Evaluate().Failed()) = %v, want %v\n%v", got, tt.failed, result.Explain())
+			}
+			if invalid := errors.Is(result.Err, ErrorInvalidRequirement); invalid != tt.invalid {
+				t.Errorf("Evaluate().Err = %v, want invalid %v", result.Err, tt.invalid)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package campaign
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"moff.io/moff-social/internal/database"
+	"moff.io/moff-social/internal/twitter"
+	"moff.io/moff-social/pkg/errors"
+	"strings"
+)
+
+// evaluateSnapshot 用户在快照中达标即满足，args为以下之一：
+//
+//	{"space_id":"xxx"}：twitter space达到服务器设置的参与要求
+//	{"tweet_id":"xxx"}或{"tweet_url":"..."}：完成推文快照要求的全部互动
+//	{"snapshot_id":"xxx"}：discord语音或文字频道快照的白名单
+func evaluateSnapshot(subject *Subject, args map[string]interface{}) (bool, string, error) {
+	if spaceID := stringArg(args, "space_id", "twitter_space_id"); spaceID != "" {
+		return evaluateSpaceSnapshot(subject, spaceID)
+	}
+	tweetID := stringArg(args, "tweet_id")
+	if tweetID == "" {
+		tweetID = twitter.TweetIDFromURL(stringArg(args, "tweet_url"))
+	}
+	if tweetID != "" {
+		return evaluateTweetSnapshot(subject, tweetID)
+	}
+	if snapshotID := stringArg(args, "snapshot_id"); snapshotID != "" {
+		return evaluateDiscordSnapshot(subject, snapshotID)
+	}
+	return false, "Invalid snapshot requirement", errors.WithMessage(ErrorInvalidRequirement, "snapshot without id")
+}
+
+func evaluateSpaceSnapshot(subject *Subject, spaceID string) (bool, string, error) {
+	desc := fmt.Sprintf("Attend [Twitter Space](%v%v)", database.TwitterSpaceURLPrefix, spaceID)
+	owner, err := database.TwitterSpaceOwnerships{}.SelectOne(subject.GuildID, spaceID)
+	if err != nil {
+		return false, "", err
+	}
+	if owner == nil {
+		return false, desc + ": the space was not snapshotted in this server", nil
+	}
+	twitterID, err := subject.twitterID()
+	if err != nil {
+		return false, "", err
+	}
+	if twitterID == "" {
+		return false, desc + ": link your Twitter account with `/link-twitter` first", nil
+	}
+	records, err := database.TwitterSpaceParticipantRoles{}.SelectByTwitterID(twitterID)
+	if err != nil {
+		return false, "", err
+	}
+	for _, record := range records {
+		if record.SpaceID != spaceID {
+			continue
+		}
+		if twitter.IsQualifiedSpaceParticipant(owner, record) {
+			return true, desc, nil
+		}
+		return false, desc + ": you didn't stay or speak long enough", nil
+	}
+	return false, desc + ": you were not in the space", nil
+}
+
+func evaluateTweetSnapshot(subject *Subject, tweetID string) (bool, string, error) {
+	snapshot, err := database.TweetSnapshots{}.SelectOne(subject.GuildID, tweetID)
+	if err != nil {
+		return false, "", err
+	}
+	if snapshot == nil {
+		return false, fmt.Sprintf("Engage with tweet `%v`: the tweet was not snapshotted in this server", tweetID), nil
+	}
+	desc := fmt.Sprintf("Engage with [the tweet](%v)", snapshot.TweetURL)
+	if snapshot.Status != database.TweetSnapshotStatusFinished {
+		return false, fmt.Sprintf("%v: results are collected <t:%v:R>", desc, snapshot.CutoffAt.Unix()), nil
+	}
+	twitterID, err := subject.twitterID()
+	if err != nil {
+		return false, "", err
+	}
+	if twitterID == "" {
+		return false, desc + ": link your Twitter account with `/link-twitter` first", nil
+	}
+	engagements, err := database.TweetEngagements{}.SelectByTwitterID(snapshot.ID, twitterID)
+	if err != nil {
+		return false, "", err
+	}
+	qualified := make(map[database.TweetEngagementAction]bool, len(engagements))
+	for _, engagement := range engagements {
+		if engagement.Qualified {
+			qualified[engagement.Action] = true
+		}
+	}
+	// 未指定互动时与收集时的规则一致，任一合格互动即满足
+	actions := snapshot.Actions()
+	if len(actions) == 0 {
+		if len(qualified) == 0 {
+			return false, desc + ": you haven't engaged with it yet", nil
+		}
+		return true, desc, nil
+	}
+	var missing []string
+	for _, action := range actions {
+		if !qualified[action] {
+			missing = append(missing, string(action))
+		}
+	}
+	if len(missing) > 0 {
+		return false, fmt.Sprintf("%v: missing %v", desc, strings.Join(missing, ", ")), nil
+	}
+	return true, desc, nil
+}
+
+func evaluateDiscordSnapshot(subject *Subject, snapshotID string) (bool, string, error) {
+	snapshot, err := database.DiscordSnapshot{}.SelectOne(snapshotID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, fmt.Sprintf("Attend snapshot `%v`: snapshot not found", snapshotID), nil
+	}
+	if err != nil {
+		return false, "", err
+	}
+	// 与twitter快照一致，仅认可本服务器的快照
+	if snapshot.GuildID != subject.GuildID {
+		return false, fmt.Sprintf("Attend snapshot `%v`: the snapshot was not taken in this server", snapshotID), nil
+	}
+	desc := fmt.Sprintf("Attend the event in <#%v>", snapshot.ChannelID)
+	if snapshot.FinishedAt == nil {
+		return false, desc + ": the snapshot is still running", nil
+	}
+	for _, member := range snapshot.Whitelist {
+		if fmt.Sprint(member) == subject.DiscordID {
+			return true, desc, nil
+		}
+	}
+	return false, desc + ": you were not qualified", nil
+}
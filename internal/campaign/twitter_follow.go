@@ -0,0 +1,79 @@
+package campaign
+
+import (
+	"fmt"
+	"moff.io/moff-social/internal/database"
+	"moff.io/moff-social/internal/twitter"
+	"moff.io/moff-social/pkg/errors"
+	"strings"
+)
+
+// TwitterFollowAccounts 解析需关注的账号，args形如{"accounts":["moff_io"]}或{"account":"moff_io"}
+func TwitterFollowAccounts(args map[string]interface{}) []string {
+	var accounts []string
+	if account, ok := args["account"].(string); ok && twitter.NormalizeUsername(account) != "" {
+		accounts = append(accounts, twitter.NormalizeUsername(account))
+	}
+	arr, _ := args["accounts"].([]interface{})
+	for _, ele := range arr {
+		if account, ok := ele.(string); ok && twitter.NormalizeUsername(account) != "" {
+			accounts = append(accounts, twitter.NormalizeUsername(account))
+		}
+	}
+	return accounts
+}
+
+// CampaignTwitterFollowAccounts 活动要求树中全部需关注的账号
+func CampaignTwitterFollowAccounts(requirements map[string]interface{}) []string {
+	var (
+		accounts []string
+		seen     = make(map[string]bool)
+	)
+	for _, requirement := range database.FindCampaignRequirements(requirements, RequirementTwitterFollow) {
+		args, _ := requirement["args"].(map[string]interface{})
+		for _, account := range TwitterFollowAccounts(args) {
+			if !seen[account] {
+				seen[account] = true
+				accounts = append(accounts, account)
+			}
+		}
+	}
+	return accounts
+}
+
+// evaluateTwitterFollow 用户需关注全部账号，未关联twitter账号时不满足
+func evaluateTwitterFollow(subject *Subject, args map[string]interface{}) (bool, string, error) {
+	accounts := TwitterFollowAccounts(args)
+	if len(accounts) == 0 {
+		return false, "Invalid Twitter follow requirement", errors.WithMessage(ErrorInvalidRequirement, "twitter_follow without accounts")
+	}
+	names := make([]string, len(accounts))
+	for idx, account := range accounts {
+		names[idx] = "@" + account
+	}
+	desc := fmt.Sprintf("Follow %v on Twitter", strings.Join(names, ", "))
+	twitterID, err := subject.twitterID()
+	if err != nil {
+		return false, "", err
+	}
+	if twitterID == "" {
+		return false, desc + ": link your Twitter account with `/link-twitter` first", nil
+	}
+	missing, err := twitter.NewClient().VerifyFollows(twitterID, accounts)
+	if errors.Is(err, twitter.ErrorTwitterApiRateLimited) {
+		return false, desc + ": Twitter is busy right now, please try again later", err
+	}
+	if errors.Is(err, twitter.ErrorTwitterFollowingUnknown) {
+		return false, desc + ": unable to verify, you are following too many accounts", err
+	}
+	if err != nil {
+		return false, "", err
+	}
+	if len(missing) > 0 {
+		for idx, account := range missing {
+			missing[idx] = "@" + account
+		}
+		return false, fmt.Sprintf("%v: not following %v yet", desc, strings.Join(missing, ", ")), nil
+	}
+	return true, desc, nil
+}
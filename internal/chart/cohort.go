@@ -0,0 +1,88 @@
+package chart
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"moff.io/moff-social/internal/fonts"
+	"moff.io/moff-social/pkg/errors"
+)
+
+const (
+	cohortCellWidth  = 64
+	cohortCellHeight = 32
+	cohortLabelWidth = 150
+	cohortTop        = 80
+	cohortPadding    = 24
+)
+
+// Cohort 留存热力图的一行，Rates[k]为第k期的留存率(0-1)
+type Cohort struct {
+	Label string
+	Size  int64
+	Rates []float64
+}
+
+// Cohorts 留存热力图，每行为一组同期加入的成员，颜色越深留存越高
+type Cohorts struct {
+	Title string
+	// PeriodLabel 列标题前缀，如W表示第几周
+	PeriodLabel string
+	Rows        []Cohort
+}
+
+func (c Cohorts) Render(w io.Writer) error {
+	if len(c.Rows) == 0 {
+		return errors.New("no cohorts to render")
+	}
+	regular, bold, err := fonts.Load()
+	if err != nil {
+		return err
+	}
+	periods := 0
+	for _, row := range c.Rows {
+		if len(row.Rates) > periods {
+			periods = len(row.Rates)
+		}
+	}
+	width := cohortPadding*2 + cohortLabelWidth + periods*cohortCellWidth
+	if width < defaultWidth {
+		width = defaultWidth
+	}
+	height := cohortTop + len(c.Rows)*cohortCellHeight + cohortPadding
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(backgroundColor), image.Point{}, draw.Src)
+
+	if err := drawText(img, bold, 18, titleColor, c.Title, cohortPadding, 34); err != nil {
+		return err
+	}
+	left := cohortPadding + cohortLabelWidth
+	for k := 0; k < periods; k++ {
+		label := fmt.Sprintf("%v%v", c.PeriodLabel, k)
+		x := left + k*cohortCellWidth + (cohortCellWidth-textWidth(regular, 12, label))/2
+		if err := drawText(img, regular, 12, labelColor, label, x, cohortTop-12); err != nil {
+			return err
+		}
+	}
+	for idx, row := range c.Rows {
+		top := cohortTop + idx*cohortCellHeight
+		label := fmt.Sprintf("%v (%v)", row.Label, formatCount(int(row.Size)))
+		if err := drawText(img, regular, 13, labelColor, label, cohortPadding, top+21); err != nil {
+			return err
+		}
+		for k, rate := range row.Rates {
+			cell := image.Rect(left+k*cohortCellWidth+1, top+1, left+(k+1)*cohortCellWidth-1, top+cohortCellHeight-1)
+			fillRect(img, cell, gridColor)
+			fillRect(img, cell, color.NRGBA{R: 88, G: 101, B: 242, A: uint8(40 + rate*215)})
+			text := fmt.Sprintf("%.0f%%", rate*100)
+			x := cell.Min.X + (cell.Dx()-textWidth(regular, 12, text))/2
+			if err := drawText(img, regular, 12, titleColor, text, x, top+21); err != nil {
+				return err
+			}
+		}
+	}
+	return errors.WrapAndReport(png.Encode(w, img), "encode cohorts chart")
+}
@@ -0,0 +1,153 @@
+package chart
+
+import (
+	"fmt"
+	"github.com/golang/freetype"
+	"github.com/golang/freetype/truetype"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"math"
+	"moff.io/moff-social/pkg/errors"
+	"time"
+)
+
+const (
+	defaultWidth  = 800
+	defaultHeight = 400
+	marginLeft    = 64
+	marginRight   = 24
+	marginTop     = 56
+	marginBottom  = 40
+	yTicks        = 4
+	xTicks        = 5
+)
+
+var (
+	backgroundColor = color.RGBA{R: 47, G: 49, B: 54, A: 255}
+	gridColor       = color.RGBA{R: 64, G: 68, B: 75, A: 255}
+	labelColor      = color.RGBA{R: 185, G: 187, B: 190, A: 255}
+	titleColor      = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	lineColor       = color.RGBA{R: 88, G: 101, B: 242, A: 255}
+	areaColor       = color.NRGBA{R: 88, G: 101, B: 242, A: 64}
+)
+
+// Point X为unix毫秒
+type Point struct {
+	X int64
+	Y float64
+}
+
+// Line 单条折线图，横轴为时间
+type Line struct {
+	Title  string
+	Points []Point
+	Width  int
+	Height int
+	// XFormat 横轴标签格式，默认为UTC时分
+	XFormat func(ms int64) string
+}
+
+// Render 按仅含一条折线的Lines绘制
+func (c Line) Render(w io.Writer) error {
+	xFormat := c.XFormat
+	if xFormat == nil {
+		xFormat = func(ms int64) string {
+			return time.UnixMilli(ms).UTC().Format("15:04")
+		}
+	}
+	return Lines{
+		Title:   c.Title,
+		Series:  []Series{{Points: c.Points}},
+		Width:   c.Width,
+		Height:  c.Height,
+		XFormat: xFormat,
+	}.Render(w)
+}
+
+func drawText(dst draw.Image, f *truetype.Font, size float64, c color.Color, text string, x, y int) error {
+	ctx := freetype.NewContext()
+	ctx.SetDPI(72)
+	ctx.SetFont(f)
+	ctx.SetFontSize(size)
+	ctx.SetClip(dst.Bounds())
+	ctx.SetDst(dst)
+	ctx.SetSrc(image.NewUniform(c))
+	_, err := ctx.DrawString(text, freetype.Pt(x, y))
+	return errors.WrapAndReport(err, "draw chart text")
+}
+
+func fillRect(dst draw.Image, r image.Rectangle, c color.Color) {
+	draw.Draw(dst, r, image.NewUniform(c), image.Point{}, draw.Over)
+}
+
+// drawLine Bresenham画线，线宽2像素
+func drawLine(dst draw.Image, x0, y0, x1, y1 int, c color.Color) {
+	dx, dy := absInt(x1-x0), -absInt(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	e := dx + dy
+	for {
+		fillRect(dst, image.Rect(x0, y0, x0+2, y0+2), c)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * e
+		if e2 >= dy {
+			e += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+// niceCeil 取不小于v的1、2、5倍数
+func niceCeil(v float64) float64 {
+	if v <= 0 {
+		return 1
+	}
+	magnitude := math.Pow(10, math.Floor(math.Log10(v)))
+	for _, step := range []float64{1, 2, 5, 10} {
+		if step*magnitude >= v {
+			return step * magnitude
+		}
+	}
+	return 10 * magnitude
+}
+
+func formatValue(v float64) string {
+	if v == math.Trunc(v) {
+		return fmt.Sprintf("%.0f", v)
+	}
+	return fmt.Sprintf("%.1f", v)
+}
+
+func minInt64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func absInt(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,156 @@
+package chart
+
+import (
+	"github.com/golang/freetype/truetype"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"moff.io/moff-social/internal/fonts"
+	"moff.io/moff-social/pkg/errors"
+	"time"
+)
+
+var (
+	// seriesColors 多条折线依次使用的颜色
+	seriesColors = []color.Color{
+		lineColor,
+		color.RGBA{R: 87, G: 242, B: 135, A: 255},
+		color.RGBA{R: 237, G: 66, B: 69, A: 255},
+		color.RGBA{R: 254, G: 231, B: 92, A: 255},
+	}
+)
+
+// Series 折线图中的一条折线
+type Series struct {
+	Name   string
+	Points []Point
+}
+
+// Lines 多条共用坐标轴的折线图，横轴为时间，标题右侧显示图例
+type Lines struct {
+	Title  string
+	Series []Series
+	Width  int
+	Height int
+	// XFormat 横轴标签格式，默认为UTC月日
+	XFormat func(ms int64) string
+}
+
+func (c Lines) Render(w io.Writer) error {
+	var points []Point
+	for _, s := range c.Series {
+		points = append(points, s.Points...)
+	}
+	if len(points) == 0 {
+		return errors.New("no points to render")
+	}
+	regular, bold, err := fonts.Load()
+	if err != nil {
+		return err
+	}
+	width, height := c.Width, c.Height
+	if width == 0 || height == 0 {
+		width, height = defaultWidth, defaultHeight
+	}
+	xFormat := c.XFormat
+	if xFormat == nil {
+		xFormat = func(ms int64) string {
+			return time.UnixMilli(ms).UTC().Format("01-02")
+		}
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(backgroundColor), image.Point{}, draw.Src)
+	plot := image.Rect(marginLeft, marginTop, width-marginRight, height-marginBottom)
+
+	minX, maxX, maxY := points[0].X, points[0].X, points[0].Y
+	for _, p := range points {
+		minX = minInt64(minX, p.X)
+		maxX = maxInt64(maxX, p.X)
+		maxY = math.Max(maxY, p.Y)
+	}
+	if maxX == minX {
+		maxX = minX + 1
+	}
+	yMax := niceCeil(maxY)
+	project := func(p Point) (int, int) {
+		x := plot.Min.X + int(float64(plot.Dx())*float64(p.X-minX)/float64(maxX-minX))
+		y := plot.Max.Y - int(float64(plot.Dy())*p.Y/yMax)
+		return x, y
+	}
+
+	// 网格及纵轴标签
+	for i := 0; i <= yTicks; i++ {
+		value := yMax * float64(i) / yTicks
+		y := plot.Max.Y - int(float64(plot.Dy())*float64(i)/yTicks)
+		fillRect(img, image.Rect(plot.Min.X, y, plot.Max.X, y+1), gridColor)
+		if err := drawText(img, regular, 12, labelColor, formatValue(value), 8, y+4); err != nil {
+			return err
+		}
+	}
+	// 横轴标签
+	for i := 0; i < xTicks; i++ {
+		ms := minX + (maxX-minX)*int64(i)/(xTicks-1)
+		x, _ := project(Point{X: ms})
+		if err := drawText(img, regular, 12, labelColor, xFormat(ms), x-16, plot.Max.Y+24); err != nil {
+			return err
+		}
+	}
+
+	for idx, s := range c.Series {
+		lc := seriesColors[idx%len(seriesColors)]
+		for i := 1; i < len(s.Points); i++ {
+			x0, y0 := project(s.Points[i-1])
+			x1, y1 := project(s.Points[i])
+			// 仅一条折线时填充下方面积，相邻线段共用端点，仅最后一段包含右端点
+			if len(c.Series) == 1 {
+				end := x1
+				if i < len(s.Points)-1 {
+					end--
+				}
+				for x := x0; x <= end; x++ {
+					y := y0
+					if x1 > x0 {
+						y = y0 + (y1-y0)*(x-x0)/(x1-x0)
+					}
+					fillRect(img, image.Rect(x, y, x+1, plot.Max.Y), areaColor)
+				}
+			}
+			drawLine(img, x0, y0, x1, y1, lc)
+		}
+		if len(s.Points) == 1 {
+			x, y := project(s.Points[0])
+			fillRect(img, image.Rect(x-2, y-2, x+3, y+3), lc)
+		}
+	}
+
+	if err := drawText(img, bold, 18, titleColor, c.Title, marginLeft, 34); err != nil {
+		return err
+	}
+	if err := c.drawLegend(img, regular, width-marginRight); err != nil {
+		return err
+	}
+	return errors.WrapAndReport(png.Encode(w, img), "encode line chart")
+}
+
+// drawLegend 图例从right向左排列，未命名的折线不显示图例
+func (c Lines) drawLegend(img draw.Image, f *truetype.Font, right int) error {
+	x := right
+	for idx := len(c.Series) - 1; idx >= 0; idx-- {
+		name := c.Series[idx].Name
+		if name == "" {
+			continue
+		}
+		x -= textWidth(f, 13, name)
+		if err := drawText(img, f, 13, labelColor, name, x, 34); err != nil {
+			return err
+		}
+		x -= 16
+		fillRect(img, image.Rect(x, 25, x+10, 35), seriesColors[idx%len(seriesColors)])
+		x -= 16
+	}
+	return nil
+}
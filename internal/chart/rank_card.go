@@ -0,0 +1,139 @@
+package chart
+
+import (
+	"fmt"
+	"github.com/anthonynsimon/bild/transform"
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"moff.io/moff-social/internal/fonts"
+	"moff.io/moff-social/pkg/errors"
+)
+
+const (
+	rankCardWidth  = 934
+	rankCardHeight = 282
+	rankCardAvatar = 180
+	rankCardLeft   = 260
+	rankCardRight  = 40
+)
+
+var (
+	cardPanelColor    = color.RGBA{R: 32, G: 34, B: 37, A: 255}
+	progressBackColor = color.RGBA{R: 72, G: 75, B: 78, A: 255}
+)
+
+// RankCard 成员等级卡片，Avatar为空时使用纯色头像
+type RankCard struct {
+	Avatar       image.Image
+	Username     string
+	Rank         int64
+	Level        int
+	Exp          int
+	ExpToLevelUp int
+}
+
+func (c RankCard) Render(w io.Writer) error {
+	regular, bold, err := fonts.Load()
+	if err != nil {
+		return err
+	}
+	img := image.NewRGBA(image.Rect(0, 0, rankCardWidth, rankCardHeight))
+	draw.Draw(img, img.Bounds(), image.NewUniform(backgroundColor), image.Point{}, draw.Src)
+	fillRect(img, image.Rect(20, 20, rankCardWidth-20, rankCardHeight-20), cardPanelColor)
+
+	// 圆形头像
+	avatarTop := (rankCardHeight - rankCardAvatar) / 2
+	avatarRect := image.Rect(40, avatarTop, 40+rankCardAvatar, avatarTop+rankCardAvatar)
+	var avatar image.Image = image.NewUniform(lineColor)
+	if c.Avatar != nil {
+		avatar = transform.Resize(c.Avatar, rankCardAvatar, rankCardAvatar, transform.Linear)
+	}
+	draw.DrawMask(img, avatarRect, avatar, image.Point{}, circleMask{r: rankCardAvatar / 2}, image.Point{}, draw.Over)
+
+	// 名次及等级靠右对齐
+	right := rankCardWidth - rankCardRight
+	level := fmt.Sprintf("%v", c.Level)
+	right -= textWidth(bold, 48, level)
+	if err := drawText(img, bold, 48, lineColor, level, right, 96); err != nil {
+		return err
+	}
+	right -= textWidth(regular, 22, "LEVEL ") + 4
+	if err := drawText(img, regular, 22, lineColor, "LEVEL ", right, 96); err != nil {
+		return err
+	}
+	if c.Rank > 0 {
+		rank := fmt.Sprintf("#%v", c.Rank)
+		right -= textWidth(bold, 48, rank) + 24
+		if err := drawText(img, bold, 48, titleColor, rank, right, 96); err != nil {
+			return err
+		}
+		right -= textWidth(regular, 22, "RANK ") + 4
+		if err := drawText(img, regular, 22, titleColor, "RANK ", right, 96); err != nil {
+			return err
+		}
+	}
+
+	// 用户名及经验
+	username := c.Username
+	for len(username) > 0 && textWidth(bold, 32, username) > rankCardWidth-rankCardRight-rankCardLeft-220 {
+		username = string([]rune(username)[:len([]rune(username))-1])
+	}
+	if err := drawText(img, bold, 32, titleColor, username, rankCardLeft, 168); err != nil {
+		return err
+	}
+	exp := fmt.Sprintf("%v / %v XP", formatCount(c.Exp), formatCount(c.ExpToLevelUp))
+	if err := drawText(img, regular, 22, labelColor, exp, rankCardWidth-rankCardRight-textWidth(regular, 22, exp), 168); err != nil {
+		return err
+	}
+
+	// 进度条
+	bar := image.Rect(rankCardLeft, 188, rankCardWidth-rankCardRight, 224)
+	fillRect(img, bar, progressBackColor)
+	if c.ExpToLevelUp > 0 && c.Exp > 0 {
+		filled := bar.Dx() * c.Exp / c.ExpToLevelUp
+		if filled > bar.Dx() {
+			filled = bar.Dx()
+		}
+		fillRect(img, image.Rect(bar.Min.X, bar.Min.Y, bar.Min.X+filled, bar.Max.Y), lineColor)
+	}
+	return errors.WrapAndReport(png.Encode(w, img), "encode rank card")
+}
+
+type circleMask struct {
+	r int
+}
+
+func (c circleMask) ColorModel() color.Model {
+	return color.AlphaModel
+}
+
+func (c circleMask) Bounds() image.Rectangle {
+	return image.Rect(0, 0, 2*c.r, 2*c.r)
+}
+
+func (c circleMask) At(x, y int) color.Color {
+	dx, dy := float64(x-c.r)+0.5, float64(y-c.r)+0.5
+	if dx*dx+dy*dy <= float64(c.r*c.r) {
+		return color.Alpha{A: 255}
+	}
+	return color.Alpha{}
+}
+
+func textWidth(f *truetype.Font, size float64, text string) int {
+	face := truetype.NewFace(f, &truetype.Options{Size: size, DPI: 72})
+	defer face.Close()
+	return font.MeasureString(face, text).Ceil()
+}
+
+// formatCount 大于一千的数值以K展示
+func formatCount(v int) string {
+	if v >= 1000 {
+		return fmt.Sprintf("%.1fK", float64(v)/1000)
+	}
+	return fmt.Sprintf("%v", v)
+}
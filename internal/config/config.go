@@ -38,6 +38,9 @@ type Configuration struct {
 	Google           Google         `yaml:"google"`
 	Twitter          Twitter        `yaml:"twitter"`
 	KafkaServer      string         `yaml:"kafka-server"`
+	Export           Export         `yaml:"export"`
+	Identity         Identity       `yaml:"identity"`
+	Analytics        Analytics      `yaml:"analytics"`
 }
 
 type DiscordExpRule struct {
@@ -46,6 +49,8 @@ type DiscordExpRule struct {
 	OnTenCharMessage    int `yaml:"on_ten_char_message"`
 	OnTwentyCharMessage int `yaml:"on_twenty_char_message"`
 	OnThirtyCharMessage int `yaml:"on_thirty_char_message"`
+	// OnVoiceInterval 语音中每个计时周期获得的经验，服务器未设置时使用
+	OnVoiceInterval int `yaml:"on_voice_interval"`
 }
 
 type DiscordBot struct {
@@ -116,6 +121,29 @@ type Twitter struct {
 	ApiKey          string `yaml:"api_key"`
 	ApiSecret       string `yaml:"api_secret"`
 	RefreshTokenURL string `yaml:"refresh_token_url"`
+	// 用户授权关联twitter账号
+	OAuthClientID     string `yaml:"oauth_client_id"`
+	OAuthClientSecret string `yaml:"oauth_client_secret"`
+	OAuthRedirectURL  string `yaml:"oauth_redirect_url"`
+	// 网页登录凭证池
+	AdminToken                  string `yaml:"admin_token"`
+	MaxSpacesPerAuthorization   int    `yaml:"max_spaces_per_authorization"`
+	AuthorizationAlertThreshold int    `yaml:"authorization_alert_threshold"`
+}
+
+type Export struct {
+	ApiToken                 string `yaml:"api_token"`
+	DefaultRetentionDays     int    `yaml:"default_retention_days"`
+	DefaultLinkExpireMinutes int    `yaml:"default_link_expire_minutes"`
+}
+
+type Identity struct {
+	ApiToken string `yaml:"api_token"`
+}
+
+// Analytics 社区数据分析接口
+type Analytics struct {
+	ApiToken string `yaml:"api_token"`
 }
 
 // aws conf
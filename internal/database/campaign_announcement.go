@@ -0,0 +1,104 @@
+package database
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"moff.io/moff-social/pkg/errors"
+	"time"
+)
+
+type CampaignAnnouncementKind string
+
+const (
+	CampaignAnnouncementStart  = CampaignAnnouncementKind("start")
+	CampaignAnnouncementEnding = CampaignAnnouncementKind("ending")
+	CampaignAnnouncementEnd    = CampaignAnnouncementKind("end")
+)
+
+// CampaignAnnouncementSettings 白标应用服务器的活动公告设置，模板为空时使用默认模板
+type CampaignAnnouncementSettings struct {
+	ID             int64     `gorm:"primaryKey"`
+	GuildID        string    `gorm:"type:varchar(100);uniqueIndex"`
+	ChannelID      string    `gorm:"type:varchar(100)"`
+	RoleID         string    `gorm:"type:varchar(100)"`
+	Enabled        bool      `gorm:"type:bool"`
+	StartTemplate  string    `gorm:"type:text"`
+	EndingTemplate string    `gorm:"type:text"`
+	EndTemplate    string    `gorm:"type:text"`
+	UpdatedBy      string    `gorm:"type:varchar(100)"`
+	CreatedAt      time.Time `gorm:"type:timestamptz"`
+	UpdatedAt      time.Time `gorm:"type:timestamptz"`
+}
+
+func (in CampaignAnnouncementSettings) Template(kind CampaignAnnouncementKind) string {
+	switch kind {
+	case CampaignAnnouncementStart:
+		return in.StartTemplate
+	case CampaignAnnouncementEnding:
+		return in.EndingTemplate
+	case CampaignAnnouncementEnd:
+		return in.EndTemplate
+	}
+	return ""
+}
+
+func (in *CampaignAnnouncementSettings) Upsert() error {
+	now := time.Now()
+	in.CreatedAt, in.UpdatedAt = now, now
+	err := CommunityPostgres.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "guild_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"channel_id", "role_id", "enabled", "start_template",
+			"ending_template", "end_template", "updated_by", "updated_at"}),
+	}).Create(in).Error
+	return errors.WrapAndReport(err, "upsert campaign announcement settings")
+}
+
+func (CampaignAnnouncementSettings) SelectOne(guildID string) (*CampaignAnnouncementSettings, error) {
+	var entity CampaignAnnouncementSettings
+	err := CommunityPostgres.Where("guild_id = ?", guildID).First(&entity).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WrapAndReport(err, "query campaign announcement settings")
+	}
+	return &entity, nil
+}
+
+func (CampaignAnnouncementSettings) SelectEnabled() ([]*CampaignAnnouncementSettings, error) {
+	var entities []*CampaignAnnouncementSettings
+	err := CommunityPostgres.Where("enabled = true AND channel_id <> ''").Find(&entities).Error
+	return entities, errors.WrapAndReport(err, "query enabled campaign announcement settings")
+}
+
+// CampaignAnnouncements 已发送的活动公告，同一服务器同一活动的每种公告仅发送一次
+type CampaignAnnouncements struct {
+	ID         int64                    `gorm:"primaryKey"`
+	GuildID    string                   `gorm:"type:varchar(100);uniqueIndex:idx_campaign_announcement"`
+	CampaignID string                   `gorm:"type:varchar(100);uniqueIndex:idx_campaign_announcement"`
+	Kind       CampaignAnnouncementKind `gorm:"type:varchar(20);uniqueIndex:idx_campaign_announcement"`
+	ChannelID  string                   `gorm:"type:varchar(100)"`
+	MessageID  string                   `gorm:"type:varchar(100)"`
+	CreatedAt  time.Time                `gorm:"type:timestamptz"`
+}
+
+// Claim 发送前占用公告，重启或多个实例同时检查时仅一个成功
+func (in *CampaignAnnouncements) Claim() (bool, error) {
+	in.CreatedAt = time.Now()
+	result := CommunityPostgres.Clauses(clause.OnConflict{DoNothing: true}).Create(in)
+	if result.Error != nil {
+		return false, errors.WrapAndReport(result.Error, "claim campaign announcement")
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// Release 发送失败时释放占用，下次检查时重试
+func (in CampaignAnnouncements) Release() error {
+	err := CommunityPostgres.Where("id = ?", in.ID).Delete(&CampaignAnnouncements{}).Error
+	return errors.WrapAndReport(err, "release campaign announcement")
+}
+
+func (in CampaignAnnouncements) UpdateMessageID(messageID string) error {
+	err := CommunityPostgres.Model(&CampaignAnnouncements{}).Where("id = ?", in.ID).Update("message_id", messageID).Error
+	return errors.WrapAndReport(err, "update campaign announcement message")
+}
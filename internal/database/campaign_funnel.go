@@ -0,0 +1,83 @@
+package database
+
+import (
+	"moff.io/moff-social/pkg/errors"
+	"strconv"
+	"time"
+)
+
+// DiscordCampaignFunnel 活动邀请链接的转化漏斗，各阶段均为通过该链接加入的成员数
+type DiscordCampaignFunnel struct {
+	InviteCode     string    `json:"invite_code"`
+	CampaignName   string    `json:"campaign_name"`
+	CampaignSource string    `json:"campaign_source"`
+	CreatedTime    time.Time `json:"created_time"`
+	Joins          int64     `json:"joins"`
+	// DayNEligible 加入已满N天的成员数，DayNRetained 其中N天后仍在服务器的成员数
+	Day1Eligible  int64 `json:"day_1_eligible"`
+	Day1Retained  int64 `json:"day_1_retained"`
+	Day7Eligible  int64 `json:"day_7_eligible"`
+	Day7Retained  int64 `json:"day_7_retained"`
+	Day30Eligible int64 `json:"day_30_eligible"`
+	Day30Retained int64 `json:"day_30_retained"`
+	// ReachedLevel 等级达到指定等级的成员数
+	ReachedLevel int64 `json:"reached_level"`
+	// WalletVerified 验证过钱包地址的成员数
+	WalletVerified int64 `json:"wallet_verified"`
+	// SnapshotParticipated 及 QuizParticipated 加入后参与过文字、语音、twitter space或推文快照及答题的成员数
+	SnapshotParticipated int64 `json:"snapshot_participated"`
+	QuizParticipated     int64 `json:"quiz_participated"`
+}
+
+// retentionSelect 加入满days天及其中days天后仍在服务器的成员数
+func retentionSelect(days int, now time.Time) string {
+	period := strconv.FormatInt(int64(days)*int64(time.Hour*24/time.Millisecond), 10)
+	cutoff := strconv.FormatInt(now.UnixMilli(), 10) + " - " + period
+	d := strconv.Itoa(days)
+	return "count(i.id) FILTER (WHERE i.invitee_joined_at <= " + cutoff + ") day" + d + "_eligible,\n" +
+		"count(i.id) FILTER (WHERE i.invitee_joined_at <= " + cutoff + " AND (i.invitee_left_at IS NULL OR " +
+		"i.invitee_left_at - i.invitee_joined_at >= " + period + ")) day" + d + "_retained,\n"
+}
+
+// snapshotParticipationSelect 加入后出现在文字或语音频道快照、twitter space或推文互动快照中，twitter通过已验证的关联匹配
+const snapshotParticipationSelect = "SELECT 1 FROM community.discord_text_channel_presences p " +
+	"WHERE p.guild_id = i.guild_id AND p.discord_id = i.invitee_id AND p.created_at >= i.invitee_joined_at\n" +
+	"UNION ALL SELECT 1 FROM community.discord_voice_channel_presences v " +
+	"WHERE v.guild_id = i.guild_id AND v.discord_id = i.invitee_id AND v.joined_at >= i.invitee_joined_at\n" +
+	"UNION ALL SELECT 1 FROM community.identity_links tl JOIN community.twitter_space_participant_roles r ON r.twitter_id = tl.identity " +
+	"WHERE tl.discord_id = i.invitee_id AND tl.identity_type = ? AND r.created_at >= to_timestamp(i.invitee_joined_at / 1000.0)\n" +
+	"UNION ALL SELECT 1 FROM community.identity_links tl JOIN community.tweet_engagements e ON e.twitter_id = tl.identity " +
+	"JOIN community.tweet_snapshots ts ON ts.id = e.snapshot_id AND ts.guild_id = i.guild_id " +
+	"WHERE tl.discord_id = i.invitee_id AND tl.identity_type = ? AND e.created_at >= to_timestamp(i.invitee_joined_at / 1000.0)"
+
+// SelectFunnels 按创建时间倒序查询服务器活动邀请链接的转化漏斗，inviteCode不为空时仅查询该链接
+func (DiscordCampaignFunnel) SelectFunnels(guildID, inviteCode string, level, offset, limit int) ([]*DiscordCampaignFunnel, error) {
+	now := time.Now()
+	sql := "SELECT dci.invite_code, dci.campaign_name, dci.campaign_source, dci.created_time, count(i.id) joins,\n" +
+		retentionSelect(1, now) + retentionSelect(7, now) + retentionSelect(30, now) +
+		"count(i.id) FILTER (WHERE m.level >= ?) reached_level,\n" +
+		"count(i.id) FILTER (WHERE EXISTS (SELECT 1 FROM community.identity_links l " +
+		"WHERE l.discord_id = i.invitee_id AND l.identity_type = ?)) wallet_verified,\n" +
+		"count(i.id) FILTER (WHERE EXISTS (" + snapshotParticipationSelect + ")) snapshot_participated,\n" +
+		"count(i.id) FILTER (WHERE EXISTS (SELECT 1 FROM community.discord_quiz_games q " +
+		"WHERE q.guild_id = i.guild_id AND q.participants @> jsonb_build_array(i.invitee_id) " +
+		"AND q.send_quiz_at >= to_timestamp(i.invitee_joined_at / 1000.0))) quiz_participated\n" +
+		"FROM community.discord_campaign_invites dci\n" +
+		"LEFT JOIN community.discord_guild_member_invites i ON i.invite_code = dci.invite_code AND i.guild_id = ?\n" +
+		"LEFT JOIN community.discord_members m ON m.guild_id = i.guild_id AND m.discord_id = i.invitee_id\n" +
+		"WHERE (dci.invite_code IN (SELECT invite_code FROM community.discord_guild_invites WHERE guild_id = ?) OR i.id IS NOT NULL)\n"
+	args := []interface{}{level, CommunityQuestWhitelistUserIdentityTypeWalletAddrs,
+		CommunityQuestWhitelistUserIdentityTypeTwitterIds, CommunityQuestWhitelistUserIdentityTypeTwitterIds, guildID, guildID}
+	if inviteCode != "" {
+		sql += "AND dci.invite_code = ?\n"
+		args = append(args, inviteCode)
+	}
+	sql += "GROUP BY dci.id ORDER BY dci.created_time DESC LIMIT ? OFFSET ?"
+	args = append(args, limit, offset)
+
+	var entities []*DiscordCampaignFunnel
+	if err := CommunityPostgres.Raw(sql, args...).Scan(&entities).Error; err != nil {
+		return nil, errors.WrapAndReport(err, "query discord campaign funnels")
+	}
+	return entities, nil
+}
@@ -30,40 +30,68 @@ type Campaigns struct {
 	ParticipateLink string
 }
 
-func FindCampaignWhitelistID(requirements map[string]interface{}) string {
-	for k, v := range requirements {
-		switch k {
-		case "and", "or":
-			arr, ok := v.([]interface{})
-			if !ok {
-				return ""
-			}
-			for _, ele := range arr {
-				require, ok := ele.(map[string]interface{})
-				if !ok {
-					return ""
-				}
-				if result := FindCampaignWhitelistID(require); result != "" {
-					return result
-				}
-			}
-		case "type":
-			if v != "whitelist" {
-				return ""
+// FindCampaignRequirements 查找要求树中指定类型的全部要求，按出现顺序返回
+func FindCampaignRequirements(requirements map[string]interface{}, requirementType string) []map[string]interface{} {
+	var found []map[string]interface{}
+	for _, operator := range []string{"and", "or"} {
+		arr, _ := requirements[operator].([]interface{})
+		for _, ele := range arr {
+			if require, ok := ele.(map[string]interface{}); ok {
+				found = append(found, FindCampaignRequirements(require, requirementType)...)
 			}
-			args := requirements["args"]
-			m, ok := args.(map[string]interface{})
-			if !ok {
-				return ""
-			}
-			return m["whitelist_id"].(string)
-		default:
-			continue
 		}
 	}
+	if requirements["type"] == requirementType {
+		found = append(found, requirements)
+	}
+	return found
+}
+
+// campaignWhitelistIDs 要求树中全部白名单要求的白名单ID
+func campaignWhitelistIDs(requirements map[string]interface{}) []string {
+	var ids []string
+	for _, require := range FindCampaignRequirements(requirements, "whitelist") {
+		args, _ := require["args"].(map[string]interface{})
+		if id, _ := args["whitelist_id"].(string); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// FindCampaignWhitelistID 要求树中第一个白名单要求的白名单ID
+func FindCampaignWhitelistID(requirements map[string]interface{}) string {
+	if ids := campaignWhitelistIDs(requirements); len(ids) > 0 {
+		return ids[0]
+	}
 	return ""
 }
 
+// ContainsCampaignWhitelistID 活动要求中是否包含该白名单
+func ContainsCampaignWhitelistID(requirements map[string]interface{}, whitelistID string) bool {
+	for _, id := range campaignWhitelistIDs(requirements) {
+		if id == whitelistID {
+			return true
+		}
+	}
+	return false
+}
+
+// AppOwnsWhitelist 白名单是否被应用下的活动使用
+func (in Campaigns) AppOwnsWhitelist(appID, whitelistID string) (bool, error) {
+	var campaigns []*Campaigns
+	err := PublicPostgres.Select("campaign_id,required").Where("app_id = ?", appID).Find(&campaigns).Error
+	if err != nil {
+		return false, errors.WrapAndReport(err, "query app campaign requirements")
+	}
+	for _, c := range campaigns {
+		if ContainsCampaignWhitelistID(c.Required, whitelistID) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 func (in Campaigns) SpaceID() string {
 	if in.ParticipateLink == "" {
 		return ""
@@ -86,36 +114,81 @@ func (Campaigns) SelectOne(campaignID string) (*Campaigns, error) {
 	return &camp, nil
 }
 
-func (in Campaigns) QueryOngoing(limit, offset int) ([]*Campaigns, error) {
+func (in Campaigns) QueryUpcomingTwitterSpace() ([]*Campaigns, error) {
 	var campaigns []*Campaigns
 	now := time.Now().UnixMilli()
-	err := PublicPostgres.Where("start_date <= ? and end_date > ? AND hidden = false and status = 'reviewed'", now, now).
-		Order("end_date asc").Limit(limit).Offset(offset).Find(&campaigns).Error
+	err := PublicPostgres.Select("participate_link,required,campaign_id,app_id,name").
+		Where("end_date > ? and status = 'reviewed' and participate_link like '%/spaces%'",
+			now).Find(&campaigns).Error
 	if err != nil {
 		return nil, errors.WrapAndReport(err, "query ongoing campaigns")
 	}
 	return campaigns, nil
 }
 
-func (in Campaigns) QueryUpcomingTwitterSpace() ([]*Campaigns, error) {
+func (in Campaigns) QueryOngoingTweets() ([]*Campaigns, error) {
 	var campaigns []*Campaigns
 	now := time.Now().UnixMilli()
-	err := PublicPostgres.Select("participate_link,required,campaign_id,app_id,name").
-		Where("end_date > ? and status = 'reviewed' and participate_link like '%/spaces%'",
+	err := PublicPostgres.Select("participate_link,required,campaign_id,app_id,name,end_date").
+		Where("end_date > ? and status = 'reviewed' and participate_link like '%/status/%'",
 			now).Find(&campaigns).Error
 	if err != nil {
-		return nil, errors.WrapAndReport(err, "query ongoing campaigns")
+		return nil, errors.WrapAndReport(err, "query ongoing tweet campaigns")
 	}
 	return campaigns, nil
 }
 
-func (in Campaigns) QueryUpcoming(limit, offset int) ([]*Campaigns, error) {
+// QueryLifecycle 查询应用下since之后开始或结束，以及until之前结束的活动，用于活动公告
+func (in Campaigns) QueryLifecycle(appIDs []string, since, until time.Time) ([]*Campaigns, error) {
 	var campaigns []*Campaigns
 	now := time.Now().UnixMilli()
-	err := PublicPostgres.Where("start_date > ? AND hidden = false and status = 'reviewed'", now).
-		Order("end_date asc").Limit(limit).Offset(offset).Find(&campaigns).Error
+	err := PublicPostgres.
+		Where("app_id IN ? AND hidden = false AND status = 'reviewed'", appIDs).
+		Where("((start_date > ? AND start_date <= ?) OR (end_date > ? AND end_date <= ?))",
+			since.UnixMilli(), now, since.UnixMilli(), until.UnixMilli()).
+		Order("start_date asc").Find(&campaigns).Error
+	if err != nil {
+		return nil, errors.WrapAndReport(err, "query campaign lifecycle")
+	}
+	return campaigns, nil
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// CampaignEventsFilter 活动列表的查询条件，AppID及Game为空时不过滤
+type CampaignEventsFilter struct {
+	Upcoming bool
+	AppID    string
+	// Game 游戏ID或名称
+	Game string
+}
+
+func (in Campaigns) QueryEvents(filter *CampaignEventsFilter, limit, offset int) ([]*Campaigns, error) {
+	var (
+		campaigns []*Campaigns
+		now       = time.Now().UnixMilli()
+		db        = PublicPostgres.Where("hidden = false and status = 'reviewed'")
+	)
+	// 即将开始的活动按开始时间排序，进行中的按结束时间排序
+	if filter.Upcoming {
+		db = db.Where("start_date > ?", now).Order("start_date asc")
+	} else {
+		db = db.Where("start_date <= ? and end_date > ?", now, now).Order("end_date asc")
+	}
+	if filter.AppID != "" {
+		db = db.Where("app_id = ?", filter.AppID)
+	}
+	if filter.Game != "" {
+		db = db.Where("(game_id = ? OR game_name ILIKE ?)", filter.Game, "%"+escapeLike(filter.Game)+"%")
+	}
+	err := db.Order("campaign_id").Limit(limit).Offset(offset).Find(&campaigns).Error
 	if err != nil {
-		return nil, errors.WrapAndReport(err, "query upcoming campaigns")
+		return nil, errors.WrapAndReport(err, "query campaign events")
 	}
 	return campaigns, nil
 }
+
+// escapeLike 转义LIKE模式中的通配符，使用postgres默认的转义字符
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
@@ -0,0 +1,51 @@
+package database
+
+import (
+	"testing"
+)
+
+func TestEscapeLike(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "moff", want: "moff"},
+		{in: "100%", want: `100\%`},
+		{in: "a_b", want: `a\_b`},
+		{in: `c:\game`, want: `c:\\game`},
+	}
+	for _, tt := range tests {
+		if got := escapeLike(tt.in); got != tt.want {
+			t.Errorf("escapeLike(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestContainsCampaignWhitelistID(t *testing.T) {
+	whitelist := func(id string) map[string]interface{} {
+		return map[string]interface{}{"type": "whitelist", "args": map[string]interface{}{"whitelist_id": id}}
+	}
+	tests := []struct {
+		name         string
+		requirements map[string]interface{}
+		want         bool
+	}{
+		{name: "empty", requirements: map[string]interface{}{}, want: false},
+		{name: "single", requirements: whitelist("wl"), want: true},
+		{name: "other", requirements: whitelist("other"), want: false},
+		{name: "not whitelist", requirements: map[string]interface{}{"type": "twitter_follow"}, want: false},
+		{name: "second of or", requirements: map[string]interface{}{
+			"or": []interface{}{whitelist("other"), whitelist("wl")},
+		}, want: true},
+		{name: "nested", requirements: map[string]interface{}{
+			"and": []interface{}{map[string]interface{}{"or": []interface{}{whitelist("wl")}}},
+		}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ContainsCampaignWhitelistID(tt.requirements, "wl"); got != tt.want {
+				t.Errorf("ContainsCampaignWhitelistID() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
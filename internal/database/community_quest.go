@@ -1,5 +1,10 @@
 package database
 
+import (
+	"gorm.io/gorm"
+	"moff.io/moff-social/pkg/errors"
+)
+
 type CommunityQuestTemplateRequirementsType string
 
 const (
@@ -44,3 +49,61 @@ type CommunityQuestWhitelistUser struct {
 	IdentityType CommunityQuestWhitelistUserIdentityType
 	Identity     string
 }
+
+func (CommunityQuestWhitelistUser) SelectByWhitelistID(whitelistID string) ([]*CommunityQuestWhitelistUser, error) {
+	var entities []*CommunityQuestWhitelistUser
+	err := PublicPostgres.Where("whitelist_id = ?", whitelistID).Find(&entities).Error
+	return entities, errors.WrapAndReport(err, "query community quest whitelist users")
+}
+
+// Contains 任务白名单是否包含任一身份
+func (CommunityQuestWhitelistUser) Contains(whitelistID string, identityType CommunityQuestWhitelistUserIdentityType,
+	identities []string) (bool, error) {
+	if len(identities) == 0 {
+		return false, nil
+	}
+	var count int64
+	err := PublicPostgres.Model(&CommunityQuestWhitelistUser{}).
+		Where("whitelist_id = ? AND identity_type = ? AND identity IN ?", whitelistID, identityType, identities).
+		Count(&count).Error
+	if err != nil {
+		return false, errors.WrapAndReport(err, "query community quest whitelist user")
+	}
+	return count > 0, nil
+}
+
+func (CommunityQuestTemplate) SelectOne(questID string) (*CommunityQuestTemplate, error) {
+	var entity CommunityQuestTemplate
+	err := PublicPostgres.Where("quest_id = ?", questID).First(&entity).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WrapAndReport(err, "query community quest template")
+	}
+	return &entity, nil
+}
+
+// AddDiscordIDs 将用户加入任务白名单，已存在的用户不重复添加
+func (CommunityQuestWhitelistUser) AddDiscordIDs(whitelistID string, discordIDs []string) error {
+	var users []*CommunityQuestWhitelistUser
+	for _, discordID := range discordIDs {
+		ok, err := CommunityQuestWhitelistUser{}.Contains(whitelistID, CommunityQuestWhitelistUserIdentityTypeDiscordIds,
+			[]string{discordID})
+		if err != nil {
+			return err
+		}
+		if !ok {
+			users = append(users, &CommunityQuestWhitelistUser{
+				WhitelistID:  whitelistID,
+				IdentityType: CommunityQuestWhitelistUserIdentityTypeDiscordIds,
+				Identity:     discordID,
+			})
+		}
+	}
+	if len(users) == 0 {
+		return nil
+	}
+	err := PublicPostgres.Create(&users).Error
+	return errors.WrapAndReport(err, "add community quest whitelist users")
+}
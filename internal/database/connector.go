@@ -40,6 +40,7 @@ func InitCommunityPostgres(conf *config.DBCredential) {
 	}
 	log.Info("Connected to community postgres...")
 
+	backfillDiscordMemberVoiceExp()
 	err = CommunityPostgres.AutoMigrate(
 		&DiscordGuildInvites{},
 		&DiscordEvents{},
@@ -62,13 +63,81 @@ func InitCommunityPostgres(conf *config.DBCredential) {
 		&DiscordUserTrace{},
 		&DiscordCampaignInvite{},
 		&UserGuild{},
+		&ExportObjects{},
+		&DiscordExportPolicy{},
+		&TwitterSpaceSnapshotSources{},
+		&TwitterSpaceParticipantRoles{},
+		&TwitterSpaceRoleTransitions{},
+		&TwitterSpaceWhitelistRequirements{},
+		&TwitterWebAuthorizationStates{},
+		&TwitterSpaceCheckpoints{},
+		&TwitterSpaceMonitorGaps{},
+		&IdentityLinks{},
+		&IdentityLinkAudits{},
+		&TwitterSpaceAttendanceRoles{},
+		&TweetSnapshots{},
+		&TweetEngagements{},
+		&TwitterFollowGates{},
+		&CampaignAnnouncementSettings{},
+		&CampaignAnnouncements{},
+		&DiscordLevelSettings{},
+		&DiscordLevelRewards{},
+		&DiscordExpEvents{},
+		&DiscordExpPolicies{},
+		&DiscordExpMultipliers{},
+		&DiscordExpManagerRoles{},
+		&DiscordInviteQualityRules{},
+		&DiscordInviteRewards{},
+		&DiscordInviteRewardGrants{},
 	)
 	if err != nil {
 		log.Fatalf("autoMigrate tables:%v", err)
 	}
+	migrateTwitterSpaceSnapshots()
+	migrateDiscordInviteRewardGrants()
 	initDiscordTempRole()
 }
 
+// migrateTwitterSpaceSnapshots 快照表由其他服务创建，仅补充出席统计字段
+func migrateTwitterSpaceSnapshots() {
+	migrator := CommunityPostgres.Migrator()
+	fields := []string{"PeakConcurrency", "AvgConcurrency", "UniqueListeners", "Retention5m", "Retention15m",
+		"Retention30m", "ConcurrencySeries"}
+	for _, field := range fields {
+		if migrator.HasColumn(&TwitterSpaceSnapshots{}, field) {
+			continue
+		}
+		if err := migrator.AddColumn(&TwitterSpaceSnapshots{}, field); err != nil {
+			log.Fatalf("add twitter space snapshots column %v:%v", field, err)
+		}
+	}
+}
+
+// backfillDiscordMemberVoiceExp 语音经验字段添加时没有默认值，设置为非空前将旧数据的NULL补为0
+func backfillDiscordMemberVoiceExp() {
+	migrator := CommunityPostgres.Migrator()
+	for _, column := range []string{"exp_component_voice_num", "exp_component_voice_exp"} {
+		if !migrator.HasColumn(&DiscordMember{}, column) {
+			continue
+		}
+		err := CommunityPostgres.Model(&DiscordMember{}).Where(column+" IS NULL").UpdateColumn(column, 0).Error
+		if err != nil {
+			log.Fatalf("backfill discord members %v:%v", column, err)
+		}
+	}
+}
+
+// migrateDiscordInviteRewardGrants 发放记录区分任务及角色后，删除不包含类型的旧唯一索引
+func migrateDiscordInviteRewardGrants() {
+	migrator := CommunityPostgres.Migrator()
+	if !migrator.HasIndex(&DiscordInviteRewardGrants{}, "idx_discord_invite_reward_grant") {
+		return
+	}
+	if err := migrator.DropIndex(&DiscordInviteRewardGrants{}, "idx_discord_invite_reward_grant"); err != nil {
+		log.Fatalf("drop discord invite reward grants index:%v", err)
+	}
+}
+
 func InitPublicPostgres(conf *config.DBCredential) {
 	cli, err := gorm.Open(postgres.Open(conf.Dsn()), &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Error),
@@ -41,9 +41,12 @@ type DiscordInviteEvent struct {
 	InviteeId   string
 	InviteeName string
 	InviteCode  string
-	RawEvent    string
-	EventTime   string
-	TotalMember int
+	// InviteSource 及 Confidence 加入来源与邀请关系的可信度
+	InviteSource string
+	Confidence   string
+	RawEvent     string
+	EventTime    string
+	TotalMember  int
 }
 
 type DiscordMemberRemoveEvent struct {
@@ -0,0 +1,338 @@
+package database
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"moff.io/moff-social/pkg/errors"
+	"time"
+)
+
+const (
+	DiscordExpActionReaction    = "exp:discord_reaction"
+	DiscordExpActionInteraction = "exp:discord_interaction"
+	DiscordExpActionMessage     = "exp:discord_send_message"
+	DiscordExpActionVoice       = "exp:discord_voice"
+	DiscordExpActionDecay       = "exp:discord_decay"
+	DiscordExpActionAdminGrant  = "exp:admin_grant"
+	DiscordExpActionAdminTake   = "exp:admin_take"
+	DiscordExpActionAdminRevoke = "exp:admin_revoke"
+	DiscordExpActionAdminSet    = "exp:admin_set"
+	DiscordExpActionAdminReset  = "exp:admin_reset"
+	// DiscordExpActionOpeningBalance 启用流水前成员已有的经验，重新计算时补录
+	DiscordExpActionOpeningBalance = "exp:opening_balance"
+)
+
+// discordExpComponents 各行为累计的经验及次数字段
+var discordExpComponents = map[string][2]string{
+	DiscordExpActionReaction:    {"exp_component_reaction_exp", "exp_component_reaction_num"},
+	DiscordExpActionInteraction: {"exp_component_interaction_exp", "exp_component_interaction_num"},
+	DiscordExpActionMessage:     {"exp_component_message_exp", "exp_component_message_num"},
+	DiscordExpActionVoice:       {"exp_component_voice_exp", "exp_component_voice_num"},
+}
+
+// DiscordExpEvents 成员经验流水，只追加不修改，EventID保证同一事件只计算一次
+type DiscordExpEvents struct {
+	ID int64 `gorm:"primaryKey"`
+	// EventID 幂等键，由事件来源生成，如消息ID
+	EventID   string `gorm:"type:varchar(200);uniqueIndex"`
+	GuildID   string `gorm:"type:varchar(100);index:idx_discord_exp_event_time"`
+	DiscordID string `gorm:"type:varchar(100);index"`
+	Action    string `gorm:"type:varchar(100)"`
+	// Exp 实际变动的经验，扣除时不超过成员已有经验
+	Exp int `gorm:"type:int"`
+	// OperatorID 管理员调整经验时的操作人
+	OperatorID string    `gorm:"type:varchar(100)"`
+	Reason     string    `gorm:"type:varchar(500)"`
+	CreatedAt  time.Time `gorm:"type:timestamptz;index:idx_discord_exp_event_time"`
+	// TargetExp 不为空时将总经验设置为该值，Exp在锁定成员后按差值计算
+	TargetExp *int `gorm:"-"`
+}
+
+// DiscordExpResult 经验入账后的成员及入账前的等级，成员不存在且未增加经验时Member为空
+type DiscordExpResult struct {
+	Member    *DiscordMember
+	FromLevel int
+	// Duplicated 事件已入账，本次未做任何修改
+	Duplicated bool
+}
+
+// Apply 在同一事务中写入流水并锁定成员行更新经验及等级，profile用于创建成员及刷新头像、用户名
+func (in *DiscordExpEvents) Apply(profile *DiscordMember, settings *DiscordLevelSettings) (*DiscordExpResult, error) {
+	if in.EventID == "" {
+		return nil, errors.ErrorfAndReport("apply exp event of guild %v member %v without event id", in.GuildID, in.DiscordID)
+	}
+	if in.CreatedAt.IsZero() {
+		in.CreatedAt = time.Now()
+	}
+	result := &DiscordExpResult{}
+	err := CommunityPostgres.Transaction(func(tx *gorm.DB) error {
+		inserted := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "event_id"}},
+			DoNothing: true,
+		}).Create(in)
+		if inserted.Error != nil {
+			return inserted.Error
+		}
+		if inserted.RowsAffected == 0 {
+			result.Duplicated = true
+			return nil
+		}
+		now := time.Now()
+		if in.createsMember() {
+			err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&DiscordMember{
+				GuildID:       in.GuildID,
+				DiscordID:     in.DiscordID,
+				Avatar:        profile.Avatar,
+				Discriminator: profile.Discriminator,
+				Username:      profile.Username,
+				JoinedAt:      in.CreatedAt,
+				UpdatedAt:     now,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		var member DiscordMember
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("guild_id = ? AND discord_id = ?", in.GuildID, in.DiscordID).First(&member).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			in.Exp = 0
+			return tx.Model(in).Update("exp", 0).Error
+		}
+		if err != nil {
+			return err
+		}
+		result.FromLevel = member.Level
+		requested := in.Exp
+		updates := in.applyTo(&member, profile, settings, now)
+		if in.Exp != requested {
+			if err := tx.Model(in).Update("exp", in.Exp).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&DiscordMember{}).Where("id = ?", member.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+		result.Member = &member
+		return nil
+	})
+	if err != nil {
+		return nil, errors.WrapAndReport(err, "apply discord exp event")
+	}
+	return result, nil
+}
+
+// createsMember 扣除、衰减及清零不为不存在的成员创建记录
+func (in *DiscordExpEvents) createsMember() bool {
+	return in.Exp > 0 || (in.TargetExp != nil && *in.TargetExp > 0)
+}
+
+// applyTo 将流水计入已锁定的成员，Exp修正为实际变动的经验，返回需要更新的成员字段
+func (in *DiscordExpEvents) applyTo(member, profile *DiscordMember, settings *DiscordLevelSettings, now time.Time) map[string]interface{} {
+	// 总经验不低于0，流水记录实际扣除的经验
+	totalExp := member.TotalExp + in.Exp
+	if in.TargetExp != nil {
+		totalExp = *in.TargetExp
+	}
+	if totalExp < 0 {
+		totalExp = 0
+	}
+	in.Exp = totalExp - member.TotalExp
+	member.TotalExp = totalExp
+	member.Level, member.Exp = settings.Level(totalExp)
+	member.UpdatedAt = now
+	updates := map[string]interface{}{
+		"total_exp":  member.TotalExp,
+		"level":      member.Level,
+		"exp":        member.Exp,
+		"updated_at": now,
+	}
+	if component, ok := discordExpComponents[in.Action]; ok {
+		// 后添加的字段在旧数据中可能为NULL
+		updates[component[0]] = gorm.Expr(fmt.Sprintf("coalesce(%v, 0) + ?", component[0]), in.Exp)
+		updates[component[1]] = gorm.Expr(fmt.Sprintf("coalesce(%v, 0) + 1", component[1]))
+		// 成员仍在服务器中活跃，重新加入的成员不再标记为已离开
+		member.LeftAt = nil
+		updates["left_at"] = nil
+	}
+	if profile.Username != "" {
+		member.Avatar, member.Discriminator, member.Username = profile.Avatar, profile.Discriminator, profile.Username
+		updates["avatar"], updates["discriminator"], updates["username"] = profile.Avatar, profile.Discriminator, profile.Username
+	}
+	return updates
+}
+
+func (DiscordExpEvents) SelectOne(eventID string) (*DiscordExpEvents, error) {
+	var entity DiscordExpEvents
+	err := CommunityPostgres.Where("event_id = ?", eventID).First(&entity).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WrapAndReport(err, "query discord exp event")
+	}
+	return &entity, nil
+}
+
+// SelectByMember 成员最近的经验流水
+func (DiscordExpEvents) SelectByMember(guildID, discordID string, limit int) ([]*DiscordExpEvents, error) {
+	var entities []*DiscordExpEvents
+	err := CommunityPostgres.Where("guild_id = ? AND discord_id = ?", guildID, discordID).
+		Order("id DESC").Limit(limit).Find(&entities).Error
+	return entities, errors.WrapAndReport(err, "query discord member exp events")
+}
+
+// CreateOpeningBalances 为没有期初流水的成员补录期初经验，使流水合计与成员总经验一致，discordID为空时处理整个服务器
+func (DiscordExpEvents) CreateOpeningBalances(guildID, discordID string) error {
+	query := "INSERT INTO community.discord_exp_events (event_id, guild_id, discord_id, action, exp, operator_id, reason, created_at)\n" +
+		"SELECT 'opening:' || m.guild_id || ':' || m.discord_id, m.guild_id, m.discord_id, ?, " +
+		"m.total_exp - coalesce((SELECT sum(e.exp) FROM community.discord_exp_events e WHERE e.guild_id = m.guild_id AND e.discord_id = m.discord_id), 0), " +
+		"'', 'balance before exp ledger', now()\n" +
+		"FROM community.discord_members m WHERE m.guild_id = ?"
+	args := []interface{}{DiscordExpActionOpeningBalance, guildID}
+	if discordID != "" {
+		query += " AND m.discord_id = ?"
+		args = append(args, discordID)
+	}
+	query += "\nON CONFLICT (event_id) DO NOTHING"
+	err := CommunityPostgres.Exec(query, args...).Error
+	return errors.WrapAndReport(err, "create discord exp opening balances")
+}
+
+// SumByMember 成员流水合计，discordID为空时查询整个服务器
+func (DiscordExpEvents) SumByMember(guildID, discordID string) (map[string]int, error) {
+	var rows []struct {
+		DiscordID string
+		Exp       int
+	}
+	db := CommunityPostgres.Model(&DiscordExpEvents{}).Select("discord_id, sum(exp) exp").Where("guild_id = ?", guildID)
+	if discordID != "" {
+		db = db.Where("discord_id = ?", discordID)
+	}
+	if err := db.Group("discord_id").Scan(&rows).Error; err != nil {
+		return nil, errors.WrapAndReport(err, "sum discord exp events")
+	}
+	sums := make(map[string]int, len(rows))
+	for _, row := range rows {
+		sums[row.DiscordID] = row.Exp
+	}
+	return sums, nil
+}
+
+// Recompute 按流水合计重新计算成员的总经验及等级，不触发升级奖励，返回修正的成员数，discordID为空时处理整个服务器
+func (DiscordExpEvents) Recompute(guildID, discordID string, settings *DiscordLevelSettings) (int, error) {
+	if err := (DiscordExpEvents{}).CreateOpeningBalances(guildID, discordID); err != nil {
+		return 0, err
+	}
+	sums, err := DiscordExpEvents{}.SumByMember(guildID, discordID)
+	if err != nil {
+		return 0, err
+	}
+	var (
+		lastID    int64
+		corrected int
+	)
+	for {
+		members, err := DiscordMember{}.SelectByGuild(guildID, discordID, lastID, recomputeBatchSize)
+		if err != nil {
+			return corrected, err
+		}
+		for _, member := range members {
+			lastID = member.ID
+			level, exp := settings.Level(sums[member.DiscordID])
+			if member.TotalExp == sums[member.DiscordID] && member.Level == level && member.Exp == exp {
+				continue
+			}
+			if err := recomputeMember(member.ID, settings); err != nil {
+				return corrected, err
+			}
+			corrected++
+		}
+		if len(members) < recomputeBatchSize {
+			return corrected, nil
+		}
+	}
+}
+
+const recomputeBatchSize = 500
+
+// recomputeMember 锁定成员后重新合计流水，避免覆盖同时入账的经验
+func recomputeMember(memberID int64, settings *DiscordLevelSettings) error {
+	err := CommunityPostgres.Transaction(func(tx *gorm.DB) error {
+		var member DiscordMember
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", memberID).First(&member).Error
+		if err != nil {
+			return err
+		}
+		var totalExp int
+		err = tx.Model(&DiscordExpEvents{}).Select("coalesce(sum(exp), 0)").
+			Where("guild_id = ? AND discord_id = ?", member.GuildID, member.DiscordID).Scan(&totalExp).Error
+		if err != nil {
+			return err
+		}
+		if totalExp < 0 {
+			totalExp = 0
+		}
+		level, exp := settings.Level(totalExp)
+		return tx.Model(&DiscordMember{}).Where("id = ?", memberID).Updates(map[string]interface{}{
+			"total_exp":  totalExp,
+			"level":      level,
+			"exp":        exp,
+			"updated_at": time.Now(),
+		}).Error
+	})
+	return errors.WrapAndReport(err, "recompute discord member exp")
+}
+
+// DiscordExpLeaderboard 排行榜中成员的经验
+type DiscordExpLeaderboard struct {
+	DiscordID string
+	Username  string
+	Exp       int
+}
+
+// QueryLeaderboard since为nil时按总经验排行，否则统计since之后获得的经验
+func (DiscordExpEvents) QueryLeaderboard(guildID string, since *time.Time, offset, limit int) ([]*DiscordExpLeaderboard, error) {
+	var entities []*DiscordExpLeaderboard
+	if since == nil {
+		err := CommunityPostgres.Model(&DiscordMember{}).Select("discord_id, username, total_exp exp").
+			Where("guild_id = ? AND total_exp > 0 AND left_at IS NULL", guildID).
+			Order("total_exp DESC").Offset(offset).Limit(limit).Scan(&entities).Error
+		return entities, errors.WrapAndReport(err, "query total exp leaderboard")
+	}
+	// 与总经验排行一致，排除已离开服务器的成员
+	err := CommunityPostgres.Raw("SELECT e.discord_id, m.username, sum(e.exp) exp FROM community.discord_exp_events e\n"+
+		"JOIN community.discord_members m ON m.guild_id = e.guild_id AND m.discord_id = e.discord_id AND m.left_at IS NULL\n"+
+		"WHERE e.guild_id = ? AND e.created_at >= ? AND e.action <> ?\n"+
+		"GROUP BY e.discord_id, m.username HAVING sum(e.exp) > 0 ORDER BY exp DESC LIMIT ? OFFSET ?",
+		guildID, *since, DiscordExpActionOpeningBalance, limit, offset).Scan(&entities).Error
+	return entities, errors.WrapAndReport(err, "query exp leaderboard")
+}
+
+// QueryRank 成员在排行榜中的名次及经验，没有经验时名次为0
+func (DiscordExpEvents) QueryRank(guildID, discordID string, since *time.Time) (rank int64, exp int, err error) {
+	if since == nil {
+		member, err := DiscordMember{}.SelectOne(guildID, discordID)
+		if err != nil || member == nil || member.TotalExp == 0 {
+			return 0, 0, err
+		}
+		err = CommunityPostgres.Model(&DiscordMember{}).
+			Where("guild_id = ? AND total_exp > ? AND left_at IS NULL", guildID, member.TotalExp).Count(&rank).Error
+		return rank + 1, member.TotalExp, errors.WrapAndReport(err, "query total exp rank")
+	}
+	err = CommunityPostgres.Raw("SELECT coalesce(sum(exp), 0) FROM community.discord_exp_events WHERE guild_id = ? AND discord_id = ? AND created_at >= ? AND action <> ?",
+		guildID, discordID, *since, DiscordExpActionOpeningBalance).Scan(&exp).Error
+	if err != nil {
+		return 0, 0, errors.WrapAndReport(err, "query member exp")
+	}
+	if exp <= 0 {
+		return 0, exp, nil
+	}
+	err = CommunityPostgres.Raw("SELECT count(*) FROM (\n"+
+		"SELECT e.discord_id FROM community.discord_exp_events e\n"+
+		"JOIN community.discord_members m ON m.guild_id = e.guild_id AND m.discord_id = e.discord_id AND m.left_at IS NULL\n"+
+		"WHERE e.guild_id = ? AND e.created_at >= ? AND e.action <> ?\n"+
+		"GROUP BY e.discord_id HAVING sum(e.exp) > ?\n) t", guildID, *since, DiscordExpActionOpeningBalance, exp).Scan(&rank).Error
+	return rank + 1, exp, errors.WrapAndReport(err, "query exp rank")
+}
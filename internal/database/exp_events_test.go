@@ -0,0 +1,118 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDiscordExpEventsCreatesMember(t *testing.T) {
+	target := func(exp int) *int { return &exp }
+	tests := []struct {
+		name  string
+		event DiscordExpEvents
+		want  bool
+	}{
+		{name: "message exp", event: DiscordExpEvents{Action: DiscordExpActionMessage, Exp: 10}, want: true},
+		{name: "admin take", event: DiscordExpEvents{Action: DiscordExpActionAdminTake, Exp: -10}, want: false},
+		{name: "decay", event: DiscordExpEvents{Action: DiscordExpActionDecay, Exp: -5}, want: false},
+		{name: "zero exp", event: DiscordExpEvents{Action: DiscordExpActionAdminGrant}, want: false},
+		{name: "set positive", event: DiscordExpEvents{Action: DiscordExpActionAdminSet, TargetExp: target(100)}, want: true},
+		{name: "reset", event: DiscordExpEvents{Action: DiscordExpActionAdminReset, TargetExp: target(0)}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.event.createsMember(); got != tt.want {
+				t.Errorf("createsMember() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiscordExpEventsApplyTo(t *testing.T) {
+	var (
+		settings = DefaultDiscordLevelSettings("guild")
+		now      = time.Now()
+		leftAt   = now.Add(-time.Hour)
+		target   = func(exp int) *int { return &exp }
+	)
+	tests := []struct {
+		name        string
+		event       DiscordExpEvents
+		member      DiscordMember
+		wantExp     int
+		wantTotal   int
+		wantLevel   int
+		wantLeft    bool
+		wantUpdated []string
+	}{
+		{
+			name:        "rejoined member active again",
+			event:       DiscordExpEvents{Action: DiscordExpActionMessage, Exp: 20},
+			member:      DiscordMember{TotalExp: 90, Level: 0, Exp: 90, LeftAt: &leftAt},
+			wantExp:     20,
+			wantTotal:   110,
+			wantLevel:   1,
+			wantLeft:    false,
+			wantUpdated: []string{"left_at", "exp_component_message_exp", "exp_component_message_num"},
+		},
+		{
+			name:      "admin grant keeps left member",
+			event:     DiscordExpEvents{Action: DiscordExpActionAdminGrant, Exp: 20},
+			member:    DiscordMember{TotalExp: 90, LeftAt: &leftAt},
+			wantExp:   20,
+			wantTotal: 110,
+			wantLevel: 1,
+			wantLeft:  true,
+		},
+		{
+			name:      "negative event limited to balance",
+			event:     DiscordExpEvents{Action: DiscordExpActionAdminTake, Exp: -50},
+			member:    DiscordMember{TotalExp: 30, Exp: 30},
+			wantExp:   -30,
+			wantTotal: 0,
+			wantLevel: 0,
+		},
+		{
+			name:      "decay drops level",
+			event:     DiscordExpEvents{Action: DiscordExpActionDecay, Exp: -20},
+			member:    DiscordMember{TotalExp: 110, Level: 1, Exp: 10},
+			wantExp:   -20,
+			wantTotal: 90,
+			wantLevel: 0,
+		},
+		{
+			name:      "set records difference",
+			event:     DiscordExpEvents{Action: DiscordExpActionAdminSet, TargetExp: target(300)},
+			member:    DiscordMember{TotalExp: 100, Level: 1},
+			wantExp:   200,
+			wantTotal: 300,
+			wantLevel: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, member := tt.event, tt.member
+			updates := event.applyTo(&member, &DiscordMember{}, settings, now)
+			if event.Exp != tt.wantExp {
+				t.Errorf("event exp = %v, want %v", event.Exp, tt.wantExp)
+			}
+			if member.TotalExp != tt.wantTotal || updates["total_exp"] != tt.wantTotal {
+				t.Errorf("total exp = %v, want %v", member.TotalExp, tt.wantTotal)
+			}
+			if member.Level != tt.wantLevel {
+				t.Errorf("level = %v, want %v", member.Level, tt.wantLevel)
+			}
+			if left := member.LeftAt != nil; left != tt.wantLeft {
+				t.Errorf("left = %v, want %v", left, tt.wantLeft)
+			}
+			for _, column := range tt.wantUpdated {
+				if _, ok := updates[column]; !ok {
+					t.Errorf("column %v not updated", column)
+				}
+			}
+			if _, ok := updates["left_at"]; ok && tt.wantLeft {
+				t.Errorf("left_at updated for %v", event.Action)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package database
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"moff.io/moff-social/pkg/errors"
+	"time"
+)
+
+const (
+	// DefaultExpSimilarityThreshold 未设置的服务器与最近消息相似度达到85%时视为刷屏
+	DefaultExpSimilarityThreshold = 0.85
+)
+
+// DiscordExpPolicies 服务器的经验策略，包括刷屏检测、不活跃衰减、多倍经验活动及语音经验
+type DiscordExpPolicies struct {
+	ID      int64  `gorm:"primaryKey"`
+	GuildID string `gorm:"type:varchar(100);uniqueIndex"`
+	// SimilarityThreshold 消息与成员最近消息的相似度达到阈值时不获得经验，0为不检查
+	SimilarityThreshold float64 `gorm:"type:float8"`
+	// DecayAfterDays 成员不活跃超过天数后每天衰减经验，0为不衰减
+	DecayAfterDays int `gorm:"type:int"`
+	// DecayPercent 每天衰减总经验的百分比
+	DecayPercent int        `gorm:"type:int"`
+	LastDecayAt  *time.Time `gorm:"type:timestamptz"`
+	// EventMultiplier 活动期间获得经验的倍数
+	EventMultiplier float64    `gorm:"type:float8"`
+	EventStartAt    *time.Time `gorm:"type:timestamptz"`
+	EventEndAt      *time.Time `gorm:"type:timestamptz"`
+	// VoiceDisabled 关闭语音经验
+	VoiceDisabled bool `gorm:"type:bool"`
+	// VoiceIntervalMinutes 在语音中每满多少分钟获得一次经验，0为默认间隔
+	VoiceIntervalMinutes int `gorm:"type:int"`
+	// VoiceExp 每次获得的语音经验，0为使用全局配置
+	VoiceExp int `gorm:"type:int"`
+	// VoiceDailyCap 每天通过语音获得的经验上限，0为不限制
+	VoiceDailyCap int       `gorm:"type:int"`
+	UpdatedBy     string    `gorm:"type:varchar(100)"`
+	CreatedAt     time.Time `gorm:"type:timestamptz"`
+	UpdatedAt     time.Time `gorm:"type:timestamptz"`
+}
+
+// DefaultDiscordExpPolicies 未设置的服务器仅检查刷屏
+func DefaultDiscordExpPolicies(guildID string) *DiscordExpPolicies {
+	return &DiscordExpPolicies{
+		GuildID:             guildID,
+		SimilarityThreshold: DefaultExpSimilarityThreshold,
+	}
+}
+
+// ActiveEventMultiplier 当前生效的多倍经验活动倍数，没有活动时为1
+func (in DiscordExpPolicies) ActiveEventMultiplier(now time.Time) float64 {
+	if in.EventMultiplier <= 0 || in.EventStartAt == nil || in.EventEndAt == nil {
+		return 1
+	}
+	if now.Before(*in.EventStartAt) || !now.Before(*in.EventEndAt) {
+		return 1
+	}
+	return in.EventMultiplier
+}
+
+func (in DiscordExpPolicies) DecayEnabled() bool {
+	return in.DecayAfterDays > 0 && in.DecayPercent > 0
+}
+
+func (in *DiscordExpPolicies) Upsert() error {
+	now := time.Now()
+	in.CreatedAt, in.UpdatedAt = now, now
+	err := CommunityPostgres.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "guild_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"similarity_threshold", "decay_after_days", "decay_percent",
+			"event_multiplier", "event_start_at", "event_end_at", "voice_disabled", "voice_interval_minutes", "voice_exp",
+			"voice_daily_cap", "updated_by", "updated_at"}),
+	}).Create(in).Error
+	return errors.WrapAndReport(err, "upsert discord exp policy")
+}
+
+// SelectOne 未设置时返回默认策略
+func (DiscordExpPolicies) SelectOne(guildID string) (*DiscordExpPolicies, error) {
+	var entity DiscordExpPolicies
+	err := CommunityPostgres.Where("guild_id = ?", guildID).First(&entity).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return DefaultDiscordExpPolicies(guildID), nil
+	}
+	if err != nil {
+		return nil, errors.WrapAndReport(err, "query discord exp policy")
+	}
+	return &entity, nil
+}
+
+// SelectDecayDue 查询开启衰减且before之后未衰减过的服务器
+func (DiscordExpPolicies) SelectDecayDue(before time.Time) ([]*DiscordExpPolicies, error) {
+	var entities []*DiscordExpPolicies
+	err := CommunityPostgres.Where("decay_after_days > 0 AND decay_percent > 0 AND (last_decay_at IS NULL OR last_decay_at < ?)",
+		before).Find(&entities).Error
+	return entities, errors.WrapAndReport(err, "query discord exp policies to decay")
+}
+
+func (DiscordExpPolicies) UpdateLastDecayAt(guildID string, decayAt time.Time) error {
+	err := CommunityPostgres.Model(&DiscordExpPolicies{}).Where("guild_id = ?", guildID).
+		Update("last_decay_at", decayAt).Error
+	return errors.WrapAndReport(err, "update discord exp policy last decay")
+}
+
+type DiscordExpMultiplierTarget string
+
+const (
+	DiscordExpMultiplierChannel = DiscordExpMultiplierTarget("channel")
+	DiscordExpMultiplierRole    = DiscordExpMultiplierTarget("role")
+)
+
+// DiscordExpMultipliers 频道或角色获得经验的倍数，频道倍数为0时该频道不获得经验
+type DiscordExpMultipliers struct {
+	ID         int64                      `gorm:"primaryKey"`
+	GuildID    string                     `gorm:"type:varchar(100);uniqueIndex:idx_discord_exp_multiplier"`
+	TargetType DiscordExpMultiplierTarget `gorm:"type:varchar(20);uniqueIndex:idx_discord_exp_multiplier"`
+	TargetID   string                     `gorm:"type:varchar(100);uniqueIndex:idx_discord_exp_multiplier"`
+	Multiplier float64                    `gorm:"type:float8"`
+	CreatedBy  string                     `gorm:"type:varchar(100)"`
+	CreatedAt  time.Time                  `gorm:"type:timestamptz"`
+}
+
+func (in *DiscordExpMultipliers) Upsert() error {
+	in.CreatedAt = time.Now()
+	err := CommunityPostgres.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "guild_id"}, {Name: "target_type"}, {Name: "target_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"multiplier", "created_by", "created_at"}),
+	}).Create(in).Error
+	return errors.WrapAndReport(err, "upsert discord exp multiplier")
+}
+
+func (in DiscordExpMultipliers) Delete() error {
+	err := CommunityPostgres.Where("guild_id = ? AND target_type = ? AND target_id = ?",
+		in.GuildID, in.TargetType, in.TargetID).Delete(&DiscordExpMultipliers{}).Error
+	return errors.WrapAndReport(err, "delete discord exp multiplier")
+}
+
+func (DiscordExpMultipliers) SelectByGuild(guildID string) ([]*DiscordExpMultipliers, error) {
+	var entities []*DiscordExpMultipliers
+	err := CommunityPostgres.Where("guild_id = ?", guildID).Order("target_type, multiplier DESC").Find(&entities).Error
+	return entities, errors.WrapAndReport(err, "query discord exp multipliers")
+}
+
+// DiscordExpManagerRoles 可以使用经验管理命令的角色
+type DiscordExpManagerRoles struct {
+	ID        int64     `gorm:"primaryKey"`
+	GuildID   string    `gorm:"type:varchar(100);uniqueIndex:idx_discord_exp_manager_role"`
+	RoleID    string    `gorm:"type:varchar(100);uniqueIndex:idx_discord_exp_manager_role"`
+	CreatedBy string    `gorm:"type:varchar(100)"`
+	CreatedAt time.Time `gorm:"type:timestamptz"`
+}
+
+func (in *DiscordExpManagerRoles) Create() error {
+	in.CreatedAt = time.Now()
+	err := CommunityPostgres.Clauses(clause.OnConflict{DoNothing: true}).Create(in).Error
+	return errors.WrapAndReport(err, "create discord exp manager role")
+}
+
+func (in DiscordExpManagerRoles) Delete() error {
+	err := CommunityPostgres.Where("guild_id = ? AND role_id = ?", in.GuildID, in.RoleID).
+		Delete(&DiscordExpManagerRoles{}).Error
+	return errors.WrapAndReport(err, "delete discord exp manager role")
+}
+
+func (DiscordExpManagerRoles) SelectByGuild(guildID string) ([]*DiscordExpManagerRoles, error) {
+	var entities []*DiscordExpManagerRoles
+	err := CommunityPostgres.Where("guild_id = ?", guildID).Find(&entities).Error
+	return entities, errors.WrapAndReport(err, "query discord exp manager roles")
+}
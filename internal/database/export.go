@@ -0,0 +1,112 @@
+package database
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"moff.io/moff-social/pkg/errors"
+	"time"
+)
+
+type ExportKind string
+
+const (
+	ExportKindTwitterSpace = ExportKind("twitter_space")
+	ExportKindTweet        = ExportKind("tweet")
+)
+
+// ExportObjects 私有导出文件，同一个对象可被多个服务器引用
+type ExportObjects struct {
+	ID          int64      `gorm:"primaryKey"`
+	ExportID    string     `gorm:"type:varchar(100);uniqueIndex"`
+	GuildID     string     `gorm:"type:varchar(100);index"`
+	Kind        ExportKind `gorm:"type:varchar(100)"`
+	ReferenceID string     `gorm:"type:varchar(100);index"`
+	ObjectKey   string     `gorm:"type:varchar(500);index"`
+	CreatedBy   string     `gorm:"type:varchar(100)"`
+	CreatedAt   time.Time  `gorm:"type:timestamptz"`
+	ExpiredAt   time.Time  `gorm:"type:timestamptz;index"`
+	DeletedTime int64      `gorm:"type:int8"`
+}
+
+func (in ExportObjects) Create() error {
+	err := CommunityPostgres.Create(&in).Error
+	return errors.WrapAndReport(err, "create export object")
+}
+
+func (ExportObjects) SelectOne(exportID string) (*ExportObjects, error) {
+	var entity ExportObjects
+	err := CommunityPostgres.Where("export_id = ? AND deleted_time = 0", exportID).First(&entity).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WrapAndReport(err, "query export object")
+	}
+	return &entity, nil
+}
+
+func (ExportObjects) SelectLatest(guildID string, kind ExportKind, referenceID string) (*ExportObjects, error) {
+	var entity ExportObjects
+	err := CommunityPostgres.Where("guild_id = ? AND kind = ? AND reference_id = ? AND deleted_time = 0",
+		guildID, kind, referenceID).Order("created_at desc").First(&entity).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WrapAndReport(err, "query latest export object")
+	}
+	return &entity, nil
+}
+
+func (ExportObjects) SelectExpired(limit int) ([]*ExportObjects, error) {
+	var entities []*ExportObjects
+	err := CommunityPostgres.Where("expired_at < ? AND deleted_time = 0", time.Now()).
+		Order("expired_at asc").Limit(limit).Find(&entities).Error
+	if err != nil {
+		return nil, errors.WrapAndReport(err, "query expired export objects")
+	}
+	return entities, nil
+}
+
+func (ExportObjects) CountObjectReferences(objectKey string) (int64, error) {
+	var count int64
+	err := CommunityPostgres.Model(&ExportObjects{}).Where("object_key = ? AND deleted_time = 0", objectKey).
+		Count(&count).Error
+	return count, errors.WrapAndReport(err, "count export object references")
+}
+
+func (in ExportObjects) Delete() error {
+	err := CommunityPostgres.Model(&ExportObjects{}).Where("export_id = ? AND deleted_time = 0", in.ExportID).
+		Update("deleted_time", time.Now().UnixMilli()).Error
+	return errors.WrapAndReport(err, "delete export object")
+}
+
+// DiscordExportPolicy 服务器的导出文件保留策略，未配置时使用全局默认值
+type DiscordExportPolicy struct {
+	ID                int64     `gorm:"primaryKey"`
+	GuildID           string    `gorm:"type:varchar(100);uniqueIndex"`
+	RetentionDays     int       `gorm:"type:int"`
+	LinkExpireMinutes int       `gorm:"type:int"`
+	UpdatedBy         string    `gorm:"type:varchar(100)"`
+	UpdatedAt         time.Time `gorm:"type:timestamptz"`
+}
+
+func (DiscordExportPolicy) SelectOne(guildID string) (*DiscordExportPolicy, error) {
+	var entity DiscordExportPolicy
+	err := CommunityPostgres.Where("guild_id = ?", guildID).First(&entity).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WrapAndReport(err, "query discord export policy")
+	}
+	return &entity, nil
+}
+
+func (in DiscordExportPolicy) Save() error {
+	err := CommunityPostgres.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "guild_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"retention_days", "link_expire_minutes", "updated_by", "updated_at"}),
+	}).Create(&in).Error
+	return errors.WrapAndReport(err, "save discord export policy")
+}
@@ -0,0 +1,171 @@
+package database
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"moff.io/moff-social/pkg/errors"
+	"time"
+)
+
+type IdentityVerifyMethod string
+
+const (
+	// IdentityVerifyMethodWalletSignature 用户通过wallet connect签名验证钱包地址
+	IdentityVerifyMethodWalletSignature = IdentityVerifyMethod("wallet_signature")
+	// IdentityVerifyMethodTwitterOAuth 用户通过twitter oauth授权验证twitter账号
+	IdentityVerifyMethodTwitterOAuth = IdentityVerifyMethod("twitter_oauth")
+	// IdentityVerifyMethodDiscordUser moff平台用户通过discord登录验证
+	IdentityVerifyMethodDiscordUser = IdentityVerifyMethod("discord_user")
+)
+
+type IdentityLinkAction string
+
+const (
+	IdentityLinkActionLink     = IdentityLinkAction("link")
+	IdentityLinkActionReverify = IdentityLinkAction("reverify")
+	IdentityLinkActionRelink   = IdentityLinkAction("relink")
+	IdentityLinkActionUnlink   = IdentityLinkAction("unlink")
+)
+
+// IdentityLinks 已验证的身份关联，均以discord id为中心，同一身份仅能关联一个discord用户
+type IdentityLinks struct {
+	ID           int64                                   `gorm:"primaryKey"`
+	IdentityType CommunityQuestWhitelistUserIdentityType `gorm:"type:varchar(50);uniqueIndex:uni_identity_link"`
+	Identity     string                                  `gorm:"type:varchar(200);uniqueIndex:uni_identity_link"`
+	DiscordID    string                                  `gorm:"type:varchar(100);index"`
+	Method       IdentityVerifyMethod                    `gorm:"type:varchar(50)"`
+	GuildID      string                                  `gorm:"type:varchar(100)"`
+	VerifiedAt   time.Time                               `gorm:"type:timestamptz"`
+}
+
+// IdentityLinkAudits 身份关联的变更记录，proof为验证凭据，如签名消息及签名
+type IdentityLinkAudits struct {
+	ID                int64                                   `gorm:"primaryKey"`
+	IdentityType      CommunityQuestWhitelistUserIdentityType `gorm:"type:varchar(50);index:idx_identity_link_audit"`
+	Identity          string                                  `gorm:"type:varchar(200);index:idx_identity_link_audit"`
+	DiscordID         string                                  `gorm:"type:varchar(100);index"`
+	PreviousDiscordID string                                  `gorm:"type:varchar(100)"`
+	Action            IdentityLinkAction                      `gorm:"type:varchar(50)"`
+	Method            IdentityVerifyMethod                    `gorm:"type:varchar(50)"`
+	GuildID           string                                  `gorm:"type:varchar(100)"`
+	Proof             string                                  `gorm:"type:text"`
+	Operator          string                                  `gorm:"type:varchar(100)"`
+	CreatedTime       time.Time                               `gorm:"type:timestamptz"`
+}
+
+// Link 保存验证通过的关联，身份已关联其他discord用户时改为关联当前用户；db为事务时与其他修改一起提交
+func (in IdentityLinks) Link(db *gorm.DB, proof, operator string) (IdentityLinkAction, error) {
+	var action IdentityLinkAction
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var existing IdentityLinks
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("identity_type = ? AND identity = ?", in.IdentityType, in.Identity).First(&existing).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		in.VerifiedAt = time.Now()
+		audit := &IdentityLinkAudits{
+			IdentityType: in.IdentityType,
+			Identity:     in.Identity,
+			DiscordID:    in.DiscordID,
+			Method:       in.Method,
+			GuildID:      in.GuildID,
+			Proof:        proof,
+			Operator:     operator,
+			CreatedTime:  in.VerifiedAt,
+		}
+		switch {
+		case existing.ID == 0:
+			action = IdentityLinkActionLink
+			err = tx.Create(&in).Error
+		default:
+			action = IdentityLinkActionReverify
+			if existing.DiscordID != in.DiscordID {
+				action = IdentityLinkActionRelink
+				audit.PreviousDiscordID = existing.DiscordID
+			}
+			err = tx.Model(&existing).Updates(map[string]interface{}{
+				"discord_id":  in.DiscordID,
+				"method":      in.Method,
+				"guild_id":    in.GuildID,
+				"verified_at": in.VerifiedAt,
+			}).Error
+		}
+		if err != nil {
+			return err
+		}
+		audit.Action = action
+		return tx.Create(audit).Error
+	})
+	return action, errors.WrapAndReport(err, "link identity")
+}
+
+// Unlink 解除关联，身份未关联时返回false
+func (IdentityLinks) Unlink(db *gorm.DB, identityType CommunityQuestWhitelistUserIdentityType, identity, operator string) (bool, error) {
+	var unlinked bool
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var existing IdentityLinks
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("identity_type = ? AND identity = ?", identityType, identity).First(&existing).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := tx.Delete(&existing).Error; err != nil {
+			return err
+		}
+		unlinked = true
+		return tx.Create(&IdentityLinkAudits{
+			IdentityType: identityType,
+			Identity:     identity,
+			DiscordID:    existing.DiscordID,
+			Action:       IdentityLinkActionUnlink,
+			Method:       existing.Method,
+			GuildID:      existing.GuildID,
+			Operator:     operator,
+			CreatedTime:  time.Now(),
+		}).Error
+	})
+	return unlinked, errors.WrapAndReport(err, "unlink identity")
+}
+
+func (IdentityLinks) SelectByIdentities(identityType CommunityQuestWhitelistUserIdentityType, identities []string) ([]*IdentityLinks, error) {
+	var entities []*IdentityLinks
+	if len(identities) == 0 {
+		return entities, nil
+	}
+	err := CommunityPostgres.Where("identity_type = ? AND identity IN ?", identityType, identities).Find(&entities).Error
+	return entities, errors.WrapAndReport(err, "query identity links by identities")
+}
+
+func (IdentityLinks) SelectByDiscordIDs(identityType CommunityQuestWhitelistUserIdentityType, discordIDs []string) ([]*IdentityLinks, error) {
+	var entities []*IdentityLinks
+	if len(discordIDs) == 0 {
+		return entities, nil
+	}
+	err := CommunityPostgres.Where("identity_type = ? AND discord_id IN ?", identityType, discordIDs).
+		Order("verified_at").Find(&entities).Error
+	return entities, errors.WrapAndReport(err, "query identity links by discord ids")
+}
+
+func (IdentityLinks) SelectByDiscordID(discordID string) ([]*IdentityLinks, error) {
+	var entities []*IdentityLinks
+	err := CommunityPostgres.Where("discord_id = ?", discordID).Order("identity_type, verified_at").Find(&entities).Error
+	return entities, errors.WrapAndReport(err, "query identity links by discord id")
+}
+
+func (IdentityLinkAudits) SelectByIdentity(identityType CommunityQuestWhitelistUserIdentityType, identity string) ([]*IdentityLinkAudits, error) {
+	var entities []*IdentityLinkAudits
+	err := CommunityPostgres.Where("identity_type = ? AND identity = ?", identityType, identity).
+		Order("created_time desc").Find(&entities).Error
+	return entities, errors.WrapAndReport(err, "query identity link audits")
+}
+
+func (IdentityLinkAudits) SelectByDiscordID(discordID string) ([]*IdentityLinkAudits, error) {
+	var entities []*IdentityLinkAudits
+	err := CommunityPostgres.Where("discord_id = ? OR previous_discord_id = ?", discordID, discordID).
+		Order("created_time desc").Find(&entities).Error
+	return entities, errors.WrapAndReport(err, "query identity link audits")
+}
@@ -0,0 +1,155 @@
+package database
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"moff.io/moff-social/pkg/errors"
+	"sort"
+	"time"
+)
+
+const (
+	defaultInviteMinAccountAgeDays = 30
+	defaultInviteBurstWindow       = 10
+)
+
+// DiscordInviteQualityRules 服务器合格邀请的判定规则，排行榜及活动奖励只统计合格邀请
+type DiscordInviteQualityRules struct {
+	ID      int64  `gorm:"primaryKey"`
+	GuildID string `gorm:"type:varchar(100);uniqueIndex"`
+	// MinAccountAgeDays 被邀请者加入时账号注册的最少天数
+	MinAccountAgeDays int `gorm:"type:int"`
+	// RejectDefaultAvatar 使用默认头像的账号不合格
+	RejectDefaultAvatar bool `gorm:"type:bool"`
+	// RequireActivity 加入后需要在服务器中活跃过
+	RequireActivity bool `gorm:"type:bool"`
+	// MinStayHours 被邀请者停留超过该时长后离开仍视为合格，0为离开即不合格
+	MinStayHours int `gorm:"type:int"`
+	// BurstWindowMinutes 及 BurstThreshold 邀请者在窗口期内的邀请数达到阈值时视为突发，阈值为0时不检测
+	BurstWindowMinutes int       `gorm:"type:int"`
+	BurstThreshold     int       `gorm:"type:int"`
+	UpdatedBy          string    `gorm:"type:varchar(100)"`
+	CreatedAt          time.Time `gorm:"type:timestamptz"`
+	UpdatedAt          time.Time `gorm:"type:timestamptz"`
+}
+
+// DefaultDiscordInviteQualityRules 未设置的服务器沿用账号注册满30天且未离开的规则
+func DefaultDiscordInviteQualityRules(guildID string) *DiscordInviteQualityRules {
+	return &DiscordInviteQualityRules{
+		GuildID:            guildID,
+		MinAccountAgeDays:  defaultInviteMinAccountAgeDays,
+		BurstWindowMinutes: defaultInviteBurstWindow,
+	}
+}
+
+func (in *DiscordInviteQualityRules) Upsert() error {
+	now := time.Now()
+	in.CreatedAt, in.UpdatedAt = now, now
+	err := CommunityPostgres.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "guild_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"min_account_age_days", "reject_default_avatar", "require_activity",
+			"min_stay_hours", "burst_window_minutes", "burst_threshold", "updated_by", "updated_at"}),
+	}).Create(in).Error
+	return errors.WrapAndReport(err, "upsert discord invite quality rules")
+}
+
+// SelectOne 未设置时返回默认规则
+func (DiscordInviteQualityRules) SelectOne(guildID string) (*DiscordInviteQualityRules, error) {
+	var entity DiscordInviteQualityRules
+	err := CommunityPostgres.Where("guild_id = ?", guildID).First(&entity).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return DefaultDiscordInviteQualityRules(guildID), nil
+	}
+	if err != nil {
+		return nil, errors.WrapAndReport(err, "query discord invite quality rules")
+	}
+	return &entity, nil
+}
+
+func (in DiscordInviteQualityRules) BurstWindow() time.Duration {
+	return time.Duration(in.BurstWindowMinutes) * time.Minute
+}
+
+// inviteQualityRow 判定邀请质量所需的邀请记录及被邀请者最近活跃时间
+type inviteQualityRow struct {
+	InviterID            string
+	InviteeJoinedAt      int64
+	InviteeRegisteredAt  int64
+	InviteeLeftAt        *int64
+	InviteeDefaultAvatar bool
+	Burst                bool
+	LastActiveAt         *time.Time
+}
+
+// inviteQuality 单个邀请的各项信号
+type inviteQuality struct {
+	young, left, defaultAvatar, inactive, burst bool
+	qualified                                   bool
+}
+
+// classify 按规则判定邀请的各项信号及是否合格
+func (in DiscordInviteQualityRules) classify(row *inviteQualityRow) inviteQuality {
+	q := inviteQuality{
+		young: in.MinAccountAgeDays > 0 && row.InviteeRegisteredAt > 0 &&
+			row.InviteeJoinedAt-row.InviteeRegisteredAt < int64(in.MinAccountAgeDays)*(time.Hour*24).Milliseconds(),
+		left: row.InviteeLeftAt != nil &&
+			(in.MinStayHours <= 0 || *row.InviteeLeftAt-row.InviteeJoinedAt < int64(in.MinStayHours)*time.Hour.Milliseconds()),
+		defaultAvatar: row.InviteeDefaultAvatar,
+		inactive:      row.LastActiveAt == nil || !row.LastActiveAt.After(time.UnixMilli(row.InviteeJoinedAt)),
+		burst:         row.Burst,
+	}
+	q.qualified = !q.left && !q.young &&
+		!(in.RejectDefaultAvatar && q.defaultAvatar) &&
+		!(in.RequireActivity && q.inactive) &&
+		!(in.BurstThreshold > 0 && q.burst)
+	return q
+}
+
+// leaderboard 按邀请者统计各项信号及合格邀请数，按合格邀请数、邀请数排序
+func (in DiscordInviteQualityRules) leaderboard(rows []*inviteQualityRow) []*DiscordInviteLeaderboard {
+	var (
+		byInviter = make(map[string]*DiscordInviteLeaderboard)
+		entities  []*DiscordInviteLeaderboard
+	)
+	for _, row := range rows {
+		entity := byInviter[row.InviterID]
+		if entity == nil {
+			entity = &DiscordInviteLeaderboard{InviterID: row.InviterID}
+			byInviter[row.InviterID] = entity
+			entities = append(entities, entity)
+		}
+		q := in.classify(row)
+		entity.InviteNum++
+		entity.Leave += boolCount(q.left)
+		entity.Newbee += boolCount(q.young)
+		entity.DefaultAvatar += boolCount(q.defaultAvatar)
+		entity.Inactive += boolCount(q.inactive)
+		entity.Burst += boolCount(q.burst)
+		entity.Qualified += boolCount(q.qualified)
+	}
+	sort.SliceStable(entities, func(i, j int) bool {
+		if entities[i].Qualified != entities[j].Qualified {
+			return entities[i].Qualified > entities[j].Qualified
+		}
+		return entities[i].InviteNum > entities[j].InviteNum
+	})
+	return entities
+}
+
+func boolCount(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// selectInviteQualityRows 查询邀请记录，最近活跃时间按UTC转换后与加入时间比较
+func selectInviteQualityRows(query string, args ...interface{}) ([]*inviteQualityRow, error) {
+	var rows []*inviteQualityRow
+	err := CommunityPostgres.Table("community.discord_guild_member_invites i").
+		Select("i.inviter_id, i.invitee_joined_at, i.invitee_registered_at, i.invitee_left_at, i.invitee_default_avatar, "+
+			"i.burst, m.last_active_at AT TIME ZONE 'UTC' last_active_at").
+		Joins("LEFT JOIN community.discord_members m ON m.guild_id = i.guild_id AND m.discord_id = i.invitee_id").
+		Where(query, args...).Order("i.id").Scan(&rows).Error
+	return rows, errors.WrapAndReport(err, "query invite quality rows")
+}
@@ -0,0 +1,136 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDiscordInviteQualityRulesClassify(t *testing.T) {
+	var (
+		day      = (time.Hour * 24).Milliseconds()
+		joinedAt = time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC).UnixMilli()
+		leftAt   = func(after time.Duration) *int64 {
+			v := joinedAt + after.Milliseconds()
+			return &v
+		}
+		activeAt = func(after time.Duration) *time.Time {
+			v := time.UnixMilli(joinedAt).Add(after)
+			return &v
+		}
+		veteran = func() *inviteQualityRow {
+			return &inviteQualityRow{InviteeJoinedAt: joinedAt, InviteeRegisteredAt: joinedAt - 365*day, LastActiveAt: activeAt(time.Hour)}
+		}
+	)
+	tests := []struct {
+		name  string
+		rules DiscordInviteQualityRules
+		row   func() *inviteQualityRow
+		want  inviteQuality
+	}{
+		{name: "veteran", rules: *DefaultDiscordInviteQualityRules("guild"), row: veteran,
+			want: inviteQuality{qualified: true}},
+		{name: "young account", rules: *DefaultDiscordInviteQualityRules("guild"), row: func() *inviteQualityRow {
+			row := veteran()
+			row.InviteeRegisteredAt = joinedAt - 29*day
+			return row
+		}, want: inviteQuality{young: true}},
+		{name: "young account without age rule", rules: DiscordInviteQualityRules{}, row: func() *inviteQualityRow {
+			row := veteran()
+			row.InviteeRegisteredAt = joinedAt - day
+			return row
+		}, want: inviteQuality{qualified: true}},
+		{name: "unknown registration", rules: *DefaultDiscordInviteQualityRules("guild"), row: func() *inviteQualityRow {
+			row := veteran()
+			row.InviteeRegisteredAt = 0
+			return row
+		}, want: inviteQuality{qualified: true}},
+		{name: "left", rules: DiscordInviteQualityRules{}, row: func() *inviteQualityRow {
+			row := veteran()
+			row.InviteeLeftAt = leftAt(time.Hour * 100)
+			return row
+		}, want: inviteQuality{left: true}},
+		{name: "left after min stay", rules: DiscordInviteQualityRules{MinStayHours: 24}, row: func() *inviteQualityRow {
+			row := veteran()
+			row.InviteeLeftAt = leftAt(time.Hour * 25)
+			return row
+		}, want: inviteQuality{qualified: true}},
+		{name: "left before min stay", rules: DiscordInviteQualityRules{MinStayHours: 24}, row: func() *inviteQualityRow {
+			row := veteran()
+			row.InviteeLeftAt = leftAt(time.Hour)
+			return row
+		}, want: inviteQuality{left: true}},
+		{name: "default avatar allowed", rules: DiscordInviteQualityRules{}, row: func() *inviteQualityRow {
+			row := veteran()
+			row.InviteeDefaultAvatar = true
+			return row
+		}, want: inviteQuality{defaultAvatar: true, qualified: true}},
+		{name: "default avatar rejected", rules: DiscordInviteQualityRules{RejectDefaultAvatar: true}, row: func() *inviteQualityRow {
+			row := veteran()
+			row.InviteeDefaultAvatar = true
+			return row
+		}, want: inviteQuality{defaultAvatar: true}},
+		{name: "never active", rules: DiscordInviteQualityRules{RequireActivity: true}, row: func() *inviteQualityRow {
+			row := veteran()
+			row.LastActiveAt = nil
+			return row
+		}, want: inviteQuality{inactive: true}},
+		{name: "active before joining", rules: DiscordInviteQualityRules{RequireActivity: true}, row: func() *inviteQualityRow {
+			row := veteran()
+			row.LastActiveAt = activeAt(-time.Hour)
+			return row
+		}, want: inviteQuality{inactive: true}},
+		{name: "active after joining in another zone", rules: DiscordInviteQualityRules{RequireActivity: true},
+			row: func() *inviteQualityRow {
+				row := veteran()
+				v := activeAt(time.Minute).In(time.FixedZone("UTC+8", 8*3600))
+				row.LastActiveAt = &v
+				return row
+			}, want: inviteQuality{qualified: true}},
+		{name: "burst ignored", rules: DiscordInviteQualityRules{}, row: func() *inviteQualityRow {
+			row := veteran()
+			row.Burst = true
+			return row
+		}, want: inviteQuality{burst: true, qualified: true}},
+		{name: "burst rejected", rules: DiscordInviteQualityRules{BurstThreshold: 5}, row: func() *inviteQualityRow {
+			row := veteran()
+			row.Burst = true
+			return row
+		}, want: inviteQuality{burst: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rules.classify(tt.row()); got != tt.want {
+				t.Errorf("classify() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiscordInviteQualityRulesLeaderboard(t *testing.T) {
+	var (
+		joinedAt = time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC).UnixMilli()
+		leftAt   = joinedAt + time.Hour.Milliseconds()
+		rules    = DiscordInviteQualityRules{}
+	)
+	rows := []*inviteQualityRow{
+		{InviterID: "a", InviteeJoinedAt: joinedAt, InviteeLeftAt: &leftAt},
+		{InviterID: "a", InviteeJoinedAt: joinedAt, InviteeLeftAt: &leftAt},
+		{InviterID: "b", InviteeJoinedAt: joinedAt},
+		{InviterID: "b", InviteeJoinedAt: joinedAt, InviteeDefaultAvatar: true},
+		{InviterID: "c", InviteeJoinedAt: joinedAt},
+	}
+	got := rules.leaderboard(rows)
+	want := []DiscordInviteLeaderboard{
+		{InviterID: "b", InviteNum: 2, DefaultAvatar: 1, Inactive: 2, Qualified: 2},
+		{InviterID: "c", InviteNum: 1, Inactive: 1, Qualified: 1},
+		{InviterID: "a", InviteNum: 2, Leave: 2, Inactive: 2},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("leaderboard() returned %v entries, want %v", len(got), len(want))
+	}
+	for idx := range want {
+		if *got[idx] != want[idx] {
+			t.Errorf("leaderboard()[%v] = %+v, want %+v", idx, *got[idx], want[idx])
+		}
+	}
+}
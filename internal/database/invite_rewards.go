@@ -0,0 +1,79 @@
+package database
+
+import (
+	"gorm.io/gorm/clause"
+	"moff.io/moff-social/pkg/errors"
+	"time"
+)
+
+// DiscordInviteRewards 邀请者合格邀请数达到里程碑时的奖励，角色在邀请数回落时收回，任务奖励仅发放一次
+type DiscordInviteRewards struct {
+	ID        int64     `gorm:"primaryKey"`
+	GuildID   string    `gorm:"type:varchar(100);uniqueIndex:idx_discord_invite_reward"`
+	Invites   int       `gorm:"type:int;uniqueIndex:idx_discord_invite_reward"`
+	RoleID    string    `gorm:"type:varchar(100);uniqueIndex:idx_discord_invite_reward"`
+	QuestID   string    `gorm:"type:varchar(100);uniqueIndex:idx_discord_invite_reward"`
+	CreatedBy string    `gorm:"type:varchar(100)"`
+	CreatedAt time.Time `gorm:"type:timestamptz"`
+}
+
+func (in *DiscordInviteRewards) Create() error {
+	in.CreatedAt = time.Now()
+	err := CommunityPostgres.Clauses(clause.OnConflict{DoNothing: true}).Create(in).Error
+	return errors.WrapAndReport(err, "create discord invite reward")
+}
+
+func (in DiscordInviteRewards) Delete() error {
+	err := CommunityPostgres.Where("guild_id = ? AND invites = ? AND role_id = ? AND quest_id = ?",
+		in.GuildID, in.Invites, in.RoleID, in.QuestID).Delete(&DiscordInviteRewards{}).Error
+	return errors.WrapAndReport(err, "delete discord invite reward")
+}
+
+func (DiscordInviteRewards) SelectByGuild(guildID string) ([]*DiscordInviteRewards, error) {
+	var entities []*DiscordInviteRewards
+	err := CommunityPostgres.Where("guild_id = ?", guildID).Order("invites").Find(&entities).Error
+	return entities, errors.WrapAndReport(err, "query discord invite rewards")
+}
+
+type DiscordInviteRewardGrantKind string
+
+const (
+	DiscordInviteRewardGrantQuest = DiscordInviteRewardGrantKind("quest")
+	DiscordInviteRewardGrantRole  = DiscordInviteRewardGrantKind("role")
+)
+
+// DiscordInviteRewardGrants 已发放的邀请奖励，任务奖励避免邀请数反复变化时重复发放，
+// 角色奖励用于区分本功能授予及手动授予的角色，邀请数回落时仅收回本功能授予的角色
+type DiscordInviteRewardGrants struct {
+	ID        int64                        `gorm:"primaryKey"`
+	RewardID  int64                        `gorm:"type:int8;uniqueIndex:idx_discord_invite_reward_grant_kind"`
+	Kind      DiscordInviteRewardGrantKind `gorm:"type:varchar(20);not null;default:'quest';uniqueIndex:idx_discord_invite_reward_grant_kind"`
+	GuildID   string                       `gorm:"type:varchar(100);index"`
+	DiscordID string                       `gorm:"type:varchar(100);uniqueIndex:idx_discord_invite_reward_grant_kind"`
+	Invites   int64                        `gorm:"type:int8"`
+	CreatedAt time.Time                    `gorm:"type:timestamptz"`
+}
+
+// Create 返回是否首次发放
+func (in *DiscordInviteRewardGrants) Create() (bool, error) {
+	in.CreatedAt = time.Now()
+	result := CommunityPostgres.Clauses(clause.OnConflict{DoNothing: true}).Create(in)
+	if result.Error != nil {
+		return false, errors.WrapAndReport(result.Error, "create discord invite reward grant")
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (in DiscordInviteRewardGrants) Delete() error {
+	err := CommunityPostgres.Where("reward_id = ? AND kind = ? AND discord_id = ?", in.RewardID, in.Kind, in.DiscordID).
+		Delete(&DiscordInviteRewardGrants{}).Error
+	return errors.WrapAndReport(err, "delete discord invite reward grant")
+}
+
+// SelectByMember 成员已发放的某类奖励
+func (DiscordInviteRewardGrants) SelectByMember(guildID, discordID string, kind DiscordInviteRewardGrantKind) ([]*DiscordInviteRewardGrants, error) {
+	var entities []*DiscordInviteRewardGrants
+	err := CommunityPostgres.Where("guild_id = ? AND discord_id = ? AND kind = ?", guildID, discordID, kind).
+		Find(&entities).Error
+	return entities, errors.WrapAndReport(err, "query discord invite reward grants")
+}
@@ -16,18 +16,51 @@ type DiscordGuildMemberInvites struct {
 	InviteeJoinedAt     int64  `gorm:"type:int8"`
 	InviteeRegisteredAt int64  `gorm:"type:int8"`
 	InviteeLeftAt       *int64 `gorm:"type:int8"`
+	// InviteeDefaultAvatar 被邀请者加入时使用默认头像
+	InviteeDefaultAvatar bool `gorm:"type:bool;default:false"`
+	// Burst 邀请者短时间内邀请过多，可能为小号
+	Burst bool `gorm:"type:bool;default:false"`
+	// Source 成员加入的来源，邀请链接、服务器自定义链接或服务器发现
+	Source DiscordInviteSource `gorm:"type:varchar(20)"`
+	// Confidence 邀请关系判定的可信度
+	Confidence DiscordInviteConfidence `gorm:"type:varchar(20)"`
 }
 
+type DiscordInviteSource string
+
+const (
+	DiscordInviteSourceInvite    = DiscordInviteSource("invite")
+	DiscordInviteSourceVanity    = DiscordInviteSource("vanity")
+	DiscordInviteSourceDiscovery = DiscordInviteSource("discovery")
+	DiscordInviteSourceUnknown   = DiscordInviteSource("unknown")
+)
+
+// DiscordInviteConfidence 邀请关系的可信度:
+// high 本批次加入的成员全部来自同一个来源;
+// medium 多个来源同时增加或邀请因用完次数被删除，来源正确但成员与邀请的对应关系无法确定;
+// low 没有任何来源的使用数增加，仅根据服务器是否开启发现推断
+type DiscordInviteConfidence string
+
+const (
+	DiscordInviteConfidenceHigh   = DiscordInviteConfidence("high")
+	DiscordInviteConfidenceMedium = DiscordInviteConfidence("medium")
+	DiscordInviteConfidenceLow    = DiscordInviteConfidence("low")
+)
+
 func NewDiscordGuildMemberInvites(invite *discordgo.Invite, invitee *discordgo.Member) *DiscordGuildMemberInvites {
 	invites := &DiscordGuildMemberInvites{
 		GuildID:         invitee.GuildID,
 		InviteeID:       invitee.User.ID,
 		InviteeJoinedAt: invitee.JoinedAt.UnixMilli(),
+		// 头像为空时使用默认头像
+		InviteeDefaultAvatar: invitee.User.Avatar == "",
 	}
 	if invite != nil {
-		inviter := invite.Inviter
 		invites.InviteCode = invite.Code
-		invites.InviterID = inviter.ID
+		// 服务器自定义链接没有邀请者
+		if invite.Inviter != nil {
+			invites.InviterID = invite.Inviter.ID
+		}
 		invites.InviteeRegisteredAt = common.DecodeTimeInSnowflake(invitee.User.ID).UnixMilli()
 	}
 	return invites
@@ -47,36 +80,89 @@ func (in DiscordGuildMemberInvites) UpdateInviteeLeave() error {
 	return errors.WrapAndReport(err, "update member leave")
 }
 
+// SelectActiveInviters 被邀请者尚未离开的邀请记录的邀请者
+func (in DiscordGuildMemberInvites) SelectActiveInviters() ([]string, error) {
+	var inviterIDs []string
+	err := CommunityPostgres.Model(&DiscordGuildMemberInvites{}).
+		Where("guild_id = ? AND invitee_id = ? AND invitee_left_at IS NULL AND inviter_id IS NOT NULL AND inviter_id <> ''",
+			in.GuildID, in.InviteeID).Distinct().Pluck("inviter_id", &inviterIDs).Error
+	return inviterIDs, errors.WrapAndReport(err, "query invitee active inviters")
+}
+
+// MarkBurst 邀请者在窗口期内的邀请数达到阈值时，将窗口期内的邀请都标记为突发
+func (in DiscordGuildMemberInvites) MarkBurst(window time.Duration, threshold int) error {
+	if in.InviterID == "" || threshold <= 0 {
+		return nil
+	}
+	db := CommunityPostgres.Model(&DiscordGuildMemberInvites{}).
+		Where("guild_id = ? AND inviter_id = ? AND invitee_joined_at BETWEEN ? AND ?",
+			in.GuildID, in.InviterID, in.InviteeJoinedAt-window.Milliseconds(), in.InviteeJoinedAt)
+	var count int64
+	if err := db.Count(&count).Error; err != nil {
+		return errors.WrapAndReport(err, "count inviter burst invites")
+	}
+	if count < int64(threshold) {
+		return nil
+	}
+	err := CommunityPostgres.Model(&DiscordGuildMemberInvites{}).
+		Where("guild_id = ? AND inviter_id = ? AND invitee_joined_at BETWEEN ? AND ?",
+			in.GuildID, in.InviterID, in.InviteeJoinedAt-window.Milliseconds(), in.InviteeJoinedAt).
+		Update("burst", true).Error
+	return errors.WrapAndReport(err, "mark burst invites")
+}
+
 type DiscordInviteLeaderboard struct {
 	InviterID string
 	// 所有的邀请
 	InviteNum int64
-	// 邀请后用户离开
+	// 邀请后用户离开，设置停留时长时仅统计停留不足的离开
 	Leave int64
-	// 账户注册不超过指定时间(暂时按一个月)
+	// 加入时账户注册不足规则天数
 	Newbee int64
+	// 使用默认头像
+	DefaultAvatar int64
+	// 加入后未活跃
+	Inactive int64
+	// 短时间内突发的邀请
+	Burst int64
+	// 按服务器规则合格的邀请
+	Qualified int64
 }
 
+// GetValidInvitesCount 合格的邀请数
 func (l *DiscordInviteLeaderboard) GetValidInvitesCount() int64 {
-	return l.InviteNum - l.Leave - l.Newbee
+	return l.Qualified
 }
 
 func (DiscordGuildMemberInvites) UserTotalInvites(guildID, memberID string) ([]*DiscordInviteLeaderboard, error) {
-	var entities []*DiscordInviteLeaderboard
-	err := CommunityPostgres.Raw("SELECT t.*, \n(SELECT count(*) FROM community.discord_guild_member_invites WHERE guild_id = ? AND inviter_id = t.inviter_id AND invitee_left_at IS NOT NULL) leave,\n(SELECT count(*) FROM community.discord_guild_member_invites WHERE guild_id = ? AND inviter_id = t.inviter_id AND invitee_left_at IS NULL AND invitee_registered_at > ?) newbee \nFROM (\nSELECT inviter_id, count(*) invite_num \nFROM community.discord_guild_member_invites WHERE guild_id = ? AND inviter_id = ?\nGROUP BY inviter_id\n) t",
-		guildID, guildID, time.Now().Add(-time.Hour*24*30).UnixMilli(), guildID, memberID).Scan(&entities).Error
+	rules, err := DiscordInviteQualityRules{}.SelectOne(guildID)
 	if err != nil {
-		return nil, errors.WrapAndReport(err, "query user leaderboard")
+		return nil, err
 	}
-	return entities, nil
+	rows, err := selectInviteQualityRows("i.guild_id = ? AND i.inviter_id = ?", guildID, memberID)
+	if err != nil {
+		return nil, err
+	}
+	return rules.leaderboard(rows), nil
 }
 
+// QueryTotalLeaderboard 按合格邀请数排行
 func (DiscordGuildMemberInvites) QueryTotalLeaderboard(guildID string, offset, limit int) ([]*DiscordInviteLeaderboard, error) {
-	var entities []*DiscordInviteLeaderboard
-	err := CommunityPostgres.Raw("SELECT t.*, \n(SELECT count(*) FROM community.discord_guild_member_invites WHERE guild_id = ? AND inviter_id = t.inviter_id AND invitee_left_at IS NOT NULL) leave,\n(SELECT count(*) FROM community.discord_guild_member_invites WHERE guild_id = ? AND inviter_id = t.inviter_id AND invitee_left_at IS NULL AND invitee_registered_at > ?) newbee \nFROM (\nSELECT inviter_id, count(*) invite_num \nFROM community.discord_guild_member_invites WHERE guild_id = ? AND inviter_id IS NOT NULL \nGROUP BY inviter_id ORDER BY invite_num DESC LIMIT ? OFFSET ?\n) t",
-		guildID, guildID, time.Now().Add(-time.Hour*24*30).UnixMilli(), guildID, limit, offset).Scan(&entities).Error
+	rules, err := DiscordInviteQualityRules{}.SelectOne(guildID)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := selectInviteQualityRows("i.guild_id = ? AND i.inviter_id IS NOT NULL AND i.inviter_id <> ''", guildID)
 	if err != nil {
-		return nil, errors.WrapAndReport(err, "query total leaderboard")
+		return nil, err
+	}
+	entities := rules.leaderboard(rows)
+	if offset >= len(entities) {
+		return nil, nil
+	}
+	entities = entities[offset:]
+	if limit < len(entities) {
+		entities = entities[:limit]
 	}
 	return entities, nil
 }
@@ -23,6 +23,8 @@ type DiscordMember struct {
 	ExpComponentReactionExp    int        `gorm:"type:int"`
 	ExpComponentInteractionNum int        `gorm:"type:int"`
 	ExpComponentInteractionExp int        `gorm:"type:int"`
+	ExpComponentVoiceNum       int        `gorm:"type:int;not null;default:0"`
+	ExpComponentVoiceExp       int        `gorm:"type:int;not null;default:0"`
 	JoinedAt                   time.Time  `gorm:"type:timestamp"`
 	UpdatedAt                  time.Time  `gorm:"type:timestamp"`
 	NotificationEnabled        bool       `gorm:"type:bool;default:true"`
@@ -35,6 +37,10 @@ type DiscordMember struct {
 	Deafened                   bool       `gorm:"type:bool"`
 	Permissions                int64      `gorm:"type:int8"`
 	IsBot                      bool       `gorm:"type:bool"`
+	// 通过oauth关联的twitter账号，以身份关联为准，此处便于展示
+	TwitterID       string     `gorm:"type:varchar(100);index"`
+	TwitterUsername string     `gorm:"type:varchar(200)"`
+	TwitterLinkedAt *time.Time `gorm:"type:timestamp"`
 }
 
 func (DiscordMember) DisableNotification(guildID, discordID string) error {
@@ -65,6 +71,34 @@ func (DiscordMember) UpdateLeave(guildID, memberID string) error {
 	return errors.WrapAndReport(err, "update discord member left")
 }
 
+// UpdateTwitter 更新用户在各服务器中关联的twitter账号，twitterID为空时解除关联
+func (DiscordMember) UpdateTwitter(tx *gorm.DB, discordID, twitterID, twitterUsername string) error {
+	var linkedAt *time.Time
+	if twitterID != "" {
+		now := time.Now()
+		linkedAt = &now
+	}
+	err := tx.Model(&DiscordMember{}).Where("discord_id = ?", discordID).
+		Updates(map[string]interface{}{
+			"twitter_id":        twitterID,
+			"twitter_username":  twitterUsername,
+			"twitter_linked_at": linkedAt,
+		}).Error
+	return errors.WrapAndReport(err, "update discord member twitter")
+}
+
+func (DiscordMember) SelectOneByTwitterID(discordID, twitterID string) (*DiscordMember, error) {
+	var member DiscordMember
+	err := CommunityPostgres.Where("discord_id = ? AND twitter_id = ?", discordID, twitterID).First(&member).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WrapAndReport(err, "query discord member by twitter id")
+	}
+	return &member, nil
+}
+
 func (DiscordMember) UpdateActive(guildID, memberID string) error {
 	now := time.Now()
 	err := CommunityPostgres.Where("guild_id = ? AND discord_id = ?",
@@ -117,3 +151,22 @@ func (in DiscordMember) Update() error {
 		in.GuildID, in.DiscordID).Updates(in).Error
 	return errors.WrapAndReport(err, "update discord member")
 }
+
+// SelectInactive 按id分页查询before之后未活跃且仍有经验的成员
+func (DiscordMember) SelectInactive(guildID string, before time.Time, lastID int64, limit int) ([]*DiscordMember, error) {
+	var entities []*DiscordMember
+	err := CommunityPostgres.Where("guild_id = ? AND id > ? AND total_exp > 0 AND left_at IS NULL AND last_active_at < ?",
+		guildID, lastID, before).Order("id").Limit(limit).Find(&entities).Error
+	return entities, errors.WrapAndReport(err, "query inactive discord members")
+}
+
+// SelectByGuild 按id分页查询服务器成员，discordID不为空时仅查询该成员
+func (DiscordMember) SelectByGuild(guildID, discordID string, lastID int64, limit int) ([]*DiscordMember, error) {
+	var entities []*DiscordMember
+	db := CommunityPostgres.Where("guild_id = ? AND id > ?", guildID, lastID)
+	if discordID != "" {
+		db = db.Where("discord_id = ?", discordID)
+	}
+	err := db.Order("id").Limit(limit).Find(&entities).Error
+	return entities, errors.WrapAndReport(err, "query discord members by guild")
+}
@@ -0,0 +1,164 @@
+package database
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"math"
+	"moff.io/moff-social/pkg/errors"
+	"time"
+)
+
+type DiscordLevelCurve string
+
+const (
+	// DiscordLevelCurveDefault 升级所需经验为5*level^2+50*level+100
+	DiscordLevelCurveDefault     = DiscordLevelCurve("default")
+	DiscordLevelCurveLinear      = DiscordLevelCurve("linear")
+	DiscordLevelCurveExponential = DiscordLevelCurve("exponential")
+	DiscordLevelCurveTable       = DiscordLevelCurve("table")
+
+	// 防止配置异常时计算等级陷入死循环
+	maxDiscordLevel = 1000
+	// MaxDiscordExpToLevelUp 单级升级所需经验上限，指数曲线在高等级时溢出
+	MaxDiscordExpToLevelUp = math.MaxInt32
+)
+
+// DiscordLevelSettings 服务器的等级曲线及升级公告设置
+type DiscordLevelSettings struct {
+	ID      int64             `gorm:"primaryKey"`
+	GuildID string            `gorm:"type:varchar(100);uniqueIndex"`
+	Curve   DiscordLevelCurve `gorm:"type:varchar(20)"`
+	// Base 线性及指数曲线0级升1级所需经验
+	Base int `gorm:"type:int"`
+	// Step 线性曲线每级增加的经验
+	Step int `gorm:"type:int"`
+	// Factor 指数曲线每级经验的倍数
+	Factor float64 `gorm:"type:float8"`
+	// Table 表格曲线各级升级所需经验，超出表格的等级使用最后一项
+	Table JSONBArray `gorm:"type:jsonb"`
+	// AnnounceChannelID 升级公告频道，为空时在获得经验的频道不公告
+	AnnounceChannelID string `gorm:"type:varchar(100)"`
+	// AnnounceTemplateID 升级公告使用的回复模板
+	AnnounceTemplateID string    `gorm:"type:varchar(100)"`
+	UpdatedBy          string    `gorm:"type:varchar(100)"`
+	CreatedAt          time.Time `gorm:"type:timestamptz"`
+	UpdatedAt          time.Time `gorm:"type:timestamptz"`
+}
+
+// DefaultDiscordLevelSettings 未设置的服务器使用默认曲线
+func DefaultDiscordLevelSettings(guildID string) *DiscordLevelSettings {
+	return &DiscordLevelSettings{
+		GuildID: guildID,
+		Curve:   DiscordLevelCurveDefault,
+	}
+}
+
+// ExpToLevelUp level级升至下一级所需经验，取值1~MaxDiscordExpToLevelUp
+func (in DiscordLevelSettings) ExpToLevelUp(level int) int {
+	var exp float64
+	switch in.Curve {
+	case DiscordLevelCurveLinear:
+		exp = float64(in.Base) + float64(in.Step)*float64(level)
+	case DiscordLevelCurveExponential:
+		exp = math.Round(float64(in.Base) * math.Pow(in.Factor, float64(level)))
+	case DiscordLevelCurveTable:
+		if len(in.Table) > 0 {
+			idx := level
+			if idx >= len(in.Table) {
+				idx = len(in.Table) - 1
+			}
+			switch v := in.Table[idx].(type) {
+			case float64:
+				exp = v
+			case int:
+				exp = float64(v)
+			}
+		}
+	default:
+		l := float64(level)
+		exp = 5*(l*l) + (50 * l) + 100
+	}
+	// 先在浮点数范围内限制，溢出的+Inf转换为int后为负数
+	if math.IsNaN(exp) || exp < 1 {
+		return 1
+	}
+	if exp > MaxDiscordExpToLevelUp {
+		return MaxDiscordExpToLevelUp
+	}
+	return int(exp)
+}
+
+// Level 根据总经验计算等级及当前等级内的经验
+func (in DiscordLevelSettings) Level(totalExp int) (level, exp int) {
+	exp = totalExp
+	for level < maxDiscordLevel {
+		required := in.ExpToLevelUp(level)
+		if exp < required {
+			break
+		}
+		exp -= required
+		level++
+	}
+	return level, exp
+}
+
+func (in *DiscordLevelSettings) Upsert() error {
+	now := time.Now()
+	in.CreatedAt, in.UpdatedAt = now, now
+	err := CommunityPostgres.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "guild_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"curve", "base", "step", "factor", "table",
+			"announce_channel_id", "announce_template_id", "updated_by", "updated_at"}),
+	}).Create(in).Error
+	return errors.WrapAndReport(err, "upsert discord level settings")
+}
+
+// SelectOne 未设置时返回默认设置
+func (DiscordLevelSettings) SelectOne(guildID string) (*DiscordLevelSettings, error) {
+	var entity DiscordLevelSettings
+	err := CommunityPostgres.Where("guild_id = ?", guildID).First(&entity).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return DefaultDiscordLevelSettings(guildID), nil
+	}
+	if err != nil {
+		return nil, errors.WrapAndReport(err, "query discord level settings")
+	}
+	return &entity, nil
+}
+
+// DiscordLevelRewards 达到等级时授予的角色或社区任务奖励
+type DiscordLevelRewards struct {
+	ID        int64     `gorm:"primaryKey"`
+	GuildID   string    `gorm:"type:varchar(100);uniqueIndex:idx_discord_level_reward"`
+	Level     int       `gorm:"type:int;uniqueIndex:idx_discord_level_reward"`
+	RoleID    string    `gorm:"type:varchar(100);uniqueIndex:idx_discord_level_reward"`
+	QuestID   string    `gorm:"type:varchar(100);uniqueIndex:idx_discord_level_reward"`
+	CreatedBy string    `gorm:"type:varchar(100)"`
+	CreatedAt time.Time `gorm:"type:timestamptz"`
+}
+
+func (in *DiscordLevelRewards) Create() error {
+	in.CreatedAt = time.Now()
+	err := CommunityPostgres.Clauses(clause.OnConflict{DoNothing: true}).Create(in).Error
+	return errors.WrapAndReport(err, "create discord level reward")
+}
+
+func (in DiscordLevelRewards) Delete() error {
+	err := CommunityPostgres.Where("guild_id = ? AND level = ? AND role_id = ? AND quest_id = ?",
+		in.GuildID, in.Level, in.RoleID, in.QuestID).Delete(&DiscordLevelRewards{}).Error
+	return errors.WrapAndReport(err, "delete discord level reward")
+}
+
+func (DiscordLevelRewards) SelectByGuild(guildID string) ([]*DiscordLevelRewards, error) {
+	var entities []*DiscordLevelRewards
+	err := CommunityPostgres.Where("guild_id = ?", guildID).Order("level").Find(&entities).Error
+	return entities, errors.WrapAndReport(err, "query discord level rewards")
+}
+
+// SelectBetween 查询等级在(from, to]之间的奖励
+func (DiscordLevelRewards) SelectBetween(guildID string, from, to int) ([]*DiscordLevelRewards, error) {
+	var entities []*DiscordLevelRewards
+	err := CommunityPostgres.Where("guild_id = ? AND level > ? AND level <= ?", guildID, from, to).
+		Order("level").Find(&entities).Error
+	return entities, errors.WrapAndReport(err, "query discord level rewards between")
+}
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"testing"
+)
+
+func TestDiscordLevelSettingsExpToLevelUp(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings DiscordLevelSettings
+		level    int
+		want     int
+	}{
+		{name: "default level 0", settings: DiscordLevelSettings{Curve: DiscordLevelCurveDefault}, level: 0, want: 100},
+		{name: "default level 10", settings: DiscordLevelSettings{Curve: DiscordLevelCurveDefault}, level: 10, want: 1100},
+		{name: "unknown curve uses default", settings: DiscordLevelSettings{Curve: "unknown"}, level: 1, want: 155},
+		{name: "linear", settings: DiscordLevelSettings{Curve: DiscordLevelCurveLinear, Base: 100, Step: 20}, level: 3, want: 160},
+		{name: "linear negative step", settings: DiscordLevelSettings{Curve: DiscordLevelCurveLinear, Base: 100, Step: -50}, level: 5, want: 1},
+		{name: "exponential", settings: DiscordLevelSettings{Curve: DiscordLevelCurveExponential, Base: 100, Factor: 1.5}, level: 2, want: 225},
+		{name: "exponential overflow", settings: DiscordLevelSettings{Curve: DiscordLevelCurveExponential, Base: 100, Factor: 2}, level: 999, want: MaxDiscordExpToLevelUp},
+		{name: "exponential beyond int", settings: DiscordLevelSettings{Curve: DiscordLevelCurveExponential, Base: 100, Factor: 10}, level: 30, want: MaxDiscordExpToLevelUp},
+		{name: "table", settings: DiscordLevelSettings{Curve: DiscordLevelCurveTable, Table: JSONBArray{float64(10), float64(20)}}, level: 1, want: 20},
+		{name: "table beyond last", settings: DiscordLevelSettings{Curve: DiscordLevelCurveTable, Table: JSONBArray{float64(10), float64(20)}}, level: 9, want: 20},
+		{name: "empty table", settings: DiscordLevelSettings{Curve: DiscordLevelCurveTable}, level: 0, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.settings.ExpToLevelUp(tt.level); got != tt.want {
+				t.Errorf("ExpToLevelUp(%v) = %v, want %v", tt.level, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiscordLevelSettingsLevel(t *testing.T) {
+	tests := []struct {
+		name      string
+		settings  DiscordLevelSettings
+		totalExp  int
+		wantLevel int
+		wantExp   int
+	}{
+		{name: "no exp", settings: DiscordLevelSettings{Curve: DiscordLevelCurveDefault}, totalExp: 0, wantLevel: 0, wantExp: 0},
+		{name: "just below level 1", settings: DiscordLevelSettings{Curve: DiscordLevelCurveDefault}, totalExp: 99, wantLevel: 0, wantExp: 99},
+		{name: "level 2", settings: DiscordLevelSettings{Curve: DiscordLevelCurveDefault}, totalExp: 100 + 155 + 10, wantLevel: 2, wantExp: 10},
+		{name: "linear", settings: DiscordLevelSettings{Curve: DiscordLevelCurveLinear, Base: 10, Step: 10}, totalExp: 60, wantLevel: 3, wantExp: 0},
+		{name: "high exponential level is expensive", settings: DiscordLevelSettings{Curve: DiscordLevelCurveExponential, Base: 100, Factor: 10},
+			totalExp: 2000000000, wantLevel: 8, wantExp: 2000000000 - 1111111100},
+		{name: "capped at max level", settings: DiscordLevelSettings{Curve: DiscordLevelCurveTable, Table: JSONBArray{float64(1)}},
+			totalExp: maxDiscordLevel + 5, wantLevel: maxDiscordLevel, wantExp: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			level, exp := tt.settings.Level(tt.totalExp)
+			if level != tt.wantLevel || exp != tt.wantExp {
+				t.Errorf("Level(%v) = (%v, %v), want (%v, %v)", tt.totalExp, level, exp, tt.wantLevel, tt.wantExp)
+			}
+		})
+	}
+}
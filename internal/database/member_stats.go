@@ -0,0 +1,161 @@
+package database
+
+import (
+	"gorm.io/gorm"
+	"moff.io/moff-social/pkg/errors"
+	"time"
+)
+
+// discordExpActivityActions 成员主动参与的经验行为，用于统计活跃成员
+var discordExpActivityActions = []string{DiscordExpActionMessage, DiscordExpActionReaction, DiscordExpActionInteraction,
+	DiscordExpActionVoice}
+
+// DiscordMemberDailyStats 服务器每天(UTC)的活跃、加入及离开成员数
+type DiscordMemberDailyStats struct {
+	Day    time.Time `json:"day"`
+	Active int64     `json:"active"`
+	Joins  int64     `json:"joins"`
+	Leaves int64     `json:"leaves"`
+}
+
+type discordMemberDayCount struct {
+	Day   time.Time
+	Count int64
+}
+
+// SelectDaily 查询since当天至今每天的统计，没有数据的日期为0；活跃以获得经验的行为为准，不获得经验的频道不计入。
+// joined_at及left_at为不带时区的UTC时间，created_at及查询参数统一转换为UTC后再比较和按天分组
+func (DiscordMemberDailyStats) SelectDaily(guildID string, since time.Time) ([]*DiscordMemberDailyStats, error) {
+	since = since.UTC().Truncate(time.Hour * 24)
+	var active, joins, leaves []*discordMemberDayCount
+	err := CommunityPostgres.Raw("SELECT date_trunc('day', created_at AT TIME ZONE 'UTC') AS day, count(DISTINCT discord_id) AS count\n"+
+		"FROM community.discord_exp_events WHERE guild_id = ? AND action IN ? AND created_at >= ? GROUP BY 1",
+		guildID, discordExpActivityActions, since).Scan(&active).Error
+	if err != nil {
+		return nil, errors.WrapAndReport(err, "query discord daily active members")
+	}
+	err = CommunityPostgres.Raw("SELECT date_trunc('day', joined_at) AS day, count(*) AS count FROM community.discord_members\n"+
+		"WHERE guild_id = ? AND is_bot IS NOT TRUE AND joined_at >= (?::timestamptz AT TIME ZONE 'UTC') GROUP BY 1", guildID, since).Scan(&joins).Error
+	if err != nil {
+		return nil, errors.WrapAndReport(err, "query discord daily joined members")
+	}
+	err = CommunityPostgres.Raw("SELECT date_trunc('day', left_at) AS day, count(*) AS count FROM community.discord_members\n"+
+		"WHERE guild_id = ? AND is_bot IS NOT TRUE AND left_at >= (?::timestamptz AT TIME ZONE 'UTC') GROUP BY 1", guildID, since).Scan(&leaves).Error
+	if err != nil {
+		return nil, errors.WrapAndReport(err, "query discord daily left members")
+	}
+
+	var (
+		days  []*DiscordMemberDailyStats
+		index = make(map[string]*DiscordMemberDailyStats)
+	)
+	for day := since; !day.After(time.Now().UTC()); day = day.Add(time.Hour * 24) {
+		stats := &DiscordMemberDailyStats{Day: day}
+		days = append(days, stats)
+		index[day.Format("2006-01-02")] = stats
+	}
+	for _, c := range active {
+		if stats := index[c.Day.Format("2006-01-02")]; stats != nil {
+			stats.Active = c.Count
+		}
+	}
+	for _, c := range joins {
+		if stats := index[c.Day.Format("2006-01-02")]; stats != nil {
+			stats.Joins = c.Count
+		}
+	}
+	for _, c := range leaves {
+		if stats := index[c.Day.Format("2006-01-02")]; stats != nil {
+			stats.Leaves = c.Count
+		}
+	}
+	return days, nil
+}
+
+// DiscordMemberCohort 同一周(UTC周一开始)加入的成员，Active[k]为加入后第k周活跃的成员数，第0周为加入当周
+type DiscordMemberCohort struct {
+	Week   time.Time `json:"week"`
+	Size   int64     `json:"size"`
+	Active []int64   `json:"active"`
+}
+
+// SelectCohorts 查询最近weeks周每周加入成员的留存
+func (DiscordMemberCohort) SelectCohorts(guildID string, weeks int) ([]*DiscordMemberCohort, error) {
+	now := time.Now().UTC()
+	thisWeek := now.Truncate(time.Hour*24).AddDate(0, 0, -(int(now.Weekday())+6)%7)
+	since := thisWeek.AddDate(0, 0, -7*(weeks-1))
+
+	var sizes []*discordMemberDayCount
+	err := CommunityPostgres.Raw("SELECT date_trunc('week', joined_at) AS day, count(*) AS count FROM community.discord_members\n"+
+		"WHERE guild_id = ? AND is_bot IS NOT TRUE AND joined_at >= (?::timestamptz AT TIME ZONE 'UTC') GROUP BY 1", guildID, since).Scan(&sizes).Error
+	if err != nil {
+		return nil, errors.WrapAndReport(err, "query discord member cohort sizes")
+	}
+	var actives []*struct {
+		Day        time.Time
+		WeekOffset int
+		Count      int64
+	}
+	err = CommunityPostgres.Raw("SELECT date_trunc('week', m.joined_at) AS day,\n"+
+		"floor(extract(epoch FROM (e.created_at AT TIME ZONE 'UTC') - date_trunc('week', m.joined_at)) / 604800)::int AS week_offset,\n"+
+		"count(DISTINCT m.discord_id) AS count\n"+
+		"FROM community.discord_members m JOIN community.discord_exp_events e\n"+
+		"ON e.guild_id = m.guild_id AND e.discord_id = m.discord_id AND e.action IN ? AND e.created_at >= ?\n"+
+		"WHERE m.guild_id = ? AND m.is_bot IS NOT TRUE AND m.joined_at >= (?::timestamptz AT TIME ZONE 'UTC') GROUP BY 1, 2",
+		discordExpActivityActions, since, guildID, since).Scan(&actives).Error
+	if err != nil {
+		return nil, errors.WrapAndReport(err, "query discord member cohort activity")
+	}
+
+	var (
+		cohorts []*DiscordMemberCohort
+		index   = make(map[string]*DiscordMemberCohort)
+	)
+	for week := since; !week.After(thisWeek); week = week.AddDate(0, 0, 7) {
+		// 仅统计已经开始的周
+		cohort := &DiscordMemberCohort{
+			Week:   week,
+			Active: make([]int64, int(thisWeek.Sub(week).Hours()/24/7)+1),
+		}
+		cohorts = append(cohorts, cohort)
+		index[week.Format("2006-01-02")] = cohort
+	}
+	for _, s := range sizes {
+		if cohort := index[s.Day.Format("2006-01-02")]; cohort != nil {
+			cohort.Size = s.Count
+		}
+	}
+	for _, a := range actives {
+		cohort := index[a.Day.Format("2006-01-02")]
+		// 重新加入的成员可能在加入前活跃过
+		if cohort == nil || a.WeekOffset < 0 || a.WeekOffset >= len(cohort.Active) {
+			continue
+		}
+		cohort.Active[a.WeekOffset] = a.Count
+	}
+	return cohorts, nil
+}
+
+// SelectDormant 按最后活跃时间升序分页查询before之后未活跃且仍在服务器的成员，从未活跃的成员排在最前
+func (DiscordMember) SelectDormant(guildID string, before time.Time, offset, limit int) ([]*DiscordMember, int64, error) {
+	dormant := func() *gorm.DB {
+		return CommunityPostgres.Model(&DiscordMember{}).
+			Where("guild_id = ? AND left_at IS NULL AND is_bot IS NOT TRUE AND (last_active_at IS NULL OR last_active_at < ?)",
+				guildID, before)
+	}
+	var count int64
+	if err := dormant().Count(&count).Error; err != nil {
+		return nil, 0, errors.WrapAndReport(err, "count dormant discord members")
+	}
+	var entities []*DiscordMember
+	err := dormant().Order("last_active_at NULLS FIRST, id").Offset(offset).Limit(limit).Find(&entities).Error
+	return entities, count, errors.WrapAndReport(err, "query dormant discord members")
+}
+
+// CountCurrent 仍在服务器的成员数
+func (DiscordMember) CountCurrent(guildID string) (int64, error) {
+	var count int64
+	err := CommunityPostgres.Model(&DiscordMember{}).
+		Where("guild_id = ? AND left_at IS NULL AND is_bot IS NOT TRUE", guildID).Count(&count).Error
+	return count, errors.WrapAndReport(err, "count current discord members")
+}
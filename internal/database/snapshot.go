@@ -2,13 +2,15 @@ package database
 
 import (
 	"github.com/bwmarrin/discordgo"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"moff.io/moff-social/pkg/errors"
 	"time"
 )
 
 type TwitterSpaceBackups struct {
 	ID          int64     `gorm:"primaryKey"`
-	SpaceID     string    `gorm:"type:varchar(100)"`
+	SpaceID     string    `gorm:"type:varchar(100);index"`
 	Response    string    `gorm:"type:text"`
 	CreatedTime time.Time `gorm:"type:timestamptz"`
 }
@@ -18,6 +20,14 @@ func (in TwitterSpaceBackups) Create() error {
 	return errors.WrapAndReport(err, "create twitter space backups")
 }
 
+// SelectSince 按时间顺序分批查询space的原始响应，用于恢复监控状态
+func (TwitterSpaceBackups) SelectSince(spaceID string, afterID int64, createdTime time.Time, limit int) ([]*TwitterSpaceBackups, error) {
+	var entities []*TwitterSpaceBackups
+	err := CommunityPostgres.Where("space_id = ? AND id > ? AND created_time >= ?", spaceID, afterID, createdTime).
+		Order("id").Limit(limit).Find(&entities).Error
+	return entities, errors.WrapAndReport(err, "query twitter space backups")
+}
+
 func (TwitterSpaceBackups) DeleteBefore(createdTime time.Time) error {
 	err := CommunityPostgres.Where("created_time < ?", createdTime).Delete(TwitterSpaceBackups{}).Error
 	return errors.WrapAndReport(err, "delete twitter space backups")
@@ -213,3 +223,264 @@ func (in DiscordVoiceChannelPresence) Leave() error {
 	}).Error
 	return errors.WrapAndReport(err, "discord voice channel presence left")
 }
+
+// TwitterSpaceSnapshotSources 快照获取space数据的方式，未设置时使用默认方式
+type TwitterSpaceSnapshotSources struct {
+	ID        int64     `gorm:"primaryKey"`
+	SpaceID   string    `gorm:"type:varchar(100);uniqueIndex"`
+	Source    string    `gorm:"type:varchar(50)"`
+	UpdatedBy string    `gorm:"type:varchar(100)"`
+	UpdatedAt time.Time `gorm:"type:timestamptz"`
+}
+
+func (TwitterSpaceSnapshotSources) SelectOne(spaceID string) (*TwitterSpaceSnapshotSources, error) {
+	var entity TwitterSpaceSnapshotSources
+	err := CommunityPostgres.Where("space_id = ?", spaceID).First(&entity).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WrapAndReport(err, "query twitter space snapshot source")
+	}
+	return &entity, nil
+}
+
+func (in TwitterSpaceSnapshotSources) Save() error {
+	in.UpdatedAt = time.Now()
+	err := CommunityPostgres.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "space_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"source", "updated_by", "updated_at"}),
+	}).Create(&in).Error
+	return errors.WrapAndReport(err, "save twitter space snapshot source")
+}
+
+// TwitterSpaceParticipantRoles 快照结束时参与者按身份统计的参与时间
+type TwitterSpaceParticipantRoles struct {
+	ID              int64     `gorm:"primaryKey"`
+	SpaceID         string    `gorm:"type:varchar(100);uniqueIndex:idx_twitter_space_participant_role"`
+	TwitterID       string    `gorm:"type:varchar(100);uniqueIndex:idx_twitter_space_participant_role"`
+	HighestRole     string    `gorm:"type:varchar(50)"`
+	PresenceSeconds int64     `gorm:"type:int8"`
+	HostSeconds     int64     `gorm:"type:int8"`
+	SpeakerSeconds  int64     `gorm:"type:int8"`
+	ListenerSeconds int64     `gorm:"type:int8"`
+	CreatedAt       time.Time `gorm:"type:timestamptz"`
+}
+
+func (TwitterSpaceParticipantRoles) SelectTwitterIDs(spaceID string) ([]string, error) {
+	var twitterIDs []string
+	err := CommunityPostgres.Model(&TwitterSpaceParticipantRoles{}).Where("space_id = ?", spaceID).
+		Pluck("twitter_id", &twitterIDs).Error
+	return twitterIDs, errors.WrapAndReport(err, "query twitter space participants")
+}
+
+func (TwitterSpaceParticipantRoles) SelectBySpace(spaceID string) ([]*TwitterSpaceParticipantRoles, error) {
+	var entities []*TwitterSpaceParticipantRoles
+	err := CommunityPostgres.Where("space_id = ?", spaceID).Find(&entities).Error
+	return entities, errors.WrapAndReport(err, "query twitter space participant roles")
+}
+
+func (TwitterSpaceParticipantRoles) SelectByTwitterID(twitterID string) ([]*TwitterSpaceParticipantRoles, error) {
+	var entities []*TwitterSpaceParticipantRoles
+	err := CommunityPostgres.Where("twitter_id = ?", twitterID).Find(&entities).Error
+	return entities, errors.WrapAndReport(err, "query twitter space participant roles")
+}
+
+func (TwitterSpaceParticipantRoles) SaveBatch(entities []*TwitterSpaceParticipantRoles) error {
+	if len(entities) == 0 {
+		return nil
+	}
+	err := CommunityPostgres.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "space_id"}, {Name: "twitter_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"highest_role", "presence_seconds", "host_seconds",
+			"speaker_seconds", "listener_seconds"}),
+	}).CreateInBatches(entities, 1000).Error
+	return errors.WrapAndReport(err, "save twitter space participant roles")
+}
+
+// TwitterSpaceRoleTransitions 参与者在space中的身份变化，首次出现时FromRole为空
+type TwitterSpaceRoleTransitions struct {
+	ID        int64     `gorm:"primaryKey"`
+	SpaceID   string    `gorm:"type:varchar(100);index:idx_twitter_space_role_transition"`
+	TwitterID string    `gorm:"type:varchar(100);index:idx_twitter_space_role_transition"`
+	FromRole  string    `gorm:"type:varchar(50)"`
+	ToRole    string    `gorm:"type:varchar(50)"`
+	At        time.Time `gorm:"type:timestamptz"`
+}
+
+// ReplaceBySpace 覆盖space的全部身份变化，重复保存时结果一致
+func (TwitterSpaceRoleTransitions) ReplaceBySpace(spaceID string, entities []*TwitterSpaceRoleTransitions) error {
+	err := CommunityPostgres.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("space_id = ?", spaceID).Delete(&TwitterSpaceRoleTransitions{}).Error; err != nil {
+			return err
+		}
+		if len(entities) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(entities, 1000).Error
+	})
+	return errors.WrapAndReport(err, "replace twitter space role transitions")
+}
+
+type TwitterSpaceRoleSummary struct {
+	Hosts           int64
+	Speakers        int64
+	Listeners       int64
+	SpeakingSeconds int64
+	// Promoted 由听众上台发言的参与者
+	Promoted int64
+}
+
+func (TwitterSpaceParticipantRoles) SelectSummary(spaceID string) (*TwitterSpaceRoleSummary, error) {
+	var summary TwitterSpaceRoleSummary
+	sql := "SELECT count(*) FILTER (WHERE highest_role = 'admin') AS hosts," +
+		"count(*) FILTER (WHERE highest_role = 'speaker') AS speakers," +
+		"count(*) FILTER (WHERE highest_role = 'listener') AS listeners," +
+		"COALESCE(sum(host_seconds + speaker_seconds), 0) AS speaking_seconds," +
+		"(SELECT count(DISTINCT twitter_id) FROM community.twitter_space_role_transitions " +
+		"WHERE space_id = ? AND from_role = 'listener' AND to_role IN ('speaker', 'admin')) AS promoted " +
+		"FROM community.twitter_space_participant_roles WHERE space_id = ?"
+	err := CommunityPostgres.Raw(sql, spaceID, spaceID).Scan(&summary).Error
+	if err != nil {
+		return nil, errors.WrapAndReport(err, "query twitter space role summary")
+	}
+	return &summary, nil
+}
+
+// TwitterSpaceWhitelistRequirements 写入白名单时对参与者身份及发言时间的要求
+type TwitterSpaceWhitelistRequirements struct {
+	ID                 int64     `gorm:"primaryKey"`
+	GuildID            string    `gorm:"type:varchar(100);uniqueIndex:idx_twitter_space_whitelist_requirement"`
+	SpaceID            string    `gorm:"type:varchar(100);uniqueIndex:idx_twitter_space_whitelist_requirement"`
+	MinRole            string    `gorm:"type:varchar(50)"`
+	MinSpeakingSeconds int64     `gorm:"type:int8"`
+	UpdatedBy          string    `gorm:"type:varchar(100)"`
+	UpdatedAt          time.Time `gorm:"type:timestamptz"`
+}
+
+func (TwitterSpaceWhitelistRequirements) SelectOne(guildID, spaceID string) (*TwitterSpaceWhitelistRequirements, error) {
+	var entity TwitterSpaceWhitelistRequirements
+	err := CommunityPostgres.Where("guild_id = ? AND space_id = ?", guildID, spaceID).First(&entity).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WrapAndReport(err, "query twitter space whitelist requirement")
+	}
+	return &entity, nil
+}
+
+func (in TwitterSpaceWhitelistRequirements) Save() error {
+	in.UpdatedAt = time.Now()
+	err := CommunityPostgres.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "guild_id"}, {Name: "space_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"min_role", "min_speaking_seconds", "updated_by", "updated_at"}),
+	}).Create(&in).Error
+	return errors.WrapAndReport(err, "save twitter space whitelist requirement")
+}
+
+// TwitterSpaceCheckpoints space监控状态检查点，监控实例崩溃后其他实例据此恢复
+type TwitterSpaceCheckpoints struct {
+	ID           int64     `gorm:"primaryKey"`
+	SpaceID      string    `gorm:"type:varchar(100);uniqueIndex"`
+	Sequence     int64     `gorm:"type:int8"`
+	Holder       string    `gorm:"type:varchar(200)"`
+	ObservedAt   int64     `gorm:"type:int8"`
+	Participants string    `gorm:"type:text"`
+	UpdatedAt    time.Time `gorm:"type:timestamptz"`
+}
+
+func (TwitterSpaceCheckpoints) SelectOne(spaceID string) (*TwitterSpaceCheckpoints, error) {
+	var entity TwitterSpaceCheckpoints
+	err := CommunityPostgres.Where("space_id = ?", spaceID).First(&entity).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WrapAndReport(err, "query twitter space checkpoint")
+	}
+	return &entity, nil
+}
+
+// Save 仅当序号大于已保存的检查点时覆盖，避免失去监控权的实例写入过期状态
+func (in TwitterSpaceCheckpoints) Save() (bool, error) {
+	in.UpdatedAt = time.Now()
+	result := CommunityPostgres.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "space_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"sequence", "holder", "observed_at", "participants", "updated_at"}),
+		Where: clause.Where{Exprs: []clause.Expression{
+			clause.Expr{SQL: "community.twitter_space_checkpoints.sequence < excluded.sequence"},
+		}},
+	}).Create(&in)
+	if result.Error != nil {
+		return false, errors.WrapAndReport(result.Error, "save twitter space checkpoint")
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (TwitterSpaceCheckpoints) DeleteBefore(updatedAt time.Time) error {
+	err := CommunityPostgres.Where("updated_at < ?", updatedAt).Delete(TwitterSpaceCheckpoints{}).Error
+	return errors.WrapAndReport(err, "delete twitter space checkpoints")
+}
+
+// TwitterSpaceMonitorGaps 监控中断的时间段，FromAt为最后一次观测时间，ToAt为恢复后首次观测时间
+type TwitterSpaceMonitorGaps struct {
+	ID          int64     `gorm:"primaryKey"`
+	SpaceID     string    `gorm:"type:varchar(100);index"`
+	FromAt      int64     `gorm:"type:int8"`
+	ToAt        int64     `gorm:"type:int8"`
+	Holder      string    `gorm:"type:varchar(200)"`
+	Continued   int       `gorm:"type:int"`
+	Rejoined    int       `gorm:"type:int"`
+	Left        int       `gorm:"type:int"`
+	CreatedTime time.Time `gorm:"type:timestamptz"`
+}
+
+func (in TwitterSpaceMonitorGaps) Create() error {
+	in.CreatedTime = time.Now()
+	err := CommunityPostgres.Create(&in).Error
+	return errors.WrapAndReport(err, "create twitter space monitor gap")
+}
+
+// SelectSummary 返回中断次数及总时长（毫秒）
+func (TwitterSpaceMonitorGaps) SelectSummary(spaceID string) (count int64, totalMs int64, err error) {
+	var summary struct {
+		Count   int64
+		TotalMs int64
+	}
+	err = CommunityPostgres.Model(&TwitterSpaceMonitorGaps{}).
+		Select("COUNT(*) AS count, COALESCE(SUM(to_at - from_at), 0) AS total_ms").
+		Where("space_id = ?", spaceID).Scan(&summary).Error
+	if err != nil {
+		return 0, 0, errors.WrapAndReport(err, "query twitter space monitor gaps")
+	}
+	return summary.Count, summary.TotalMs, nil
+}
+
+// TwitterSpaceAttendanceRoles 满足白名单条件并已关联twitter账号的参与者授予的角色，SpaceID为空时适用于服务器的所有space
+type TwitterSpaceAttendanceRoles struct {
+	ID        int64     `gorm:"primaryKey"`
+	GuildID   string    `gorm:"type:varchar(100);uniqueIndex:idx_twitter_space_attendance_role"`
+	SpaceID   string    `gorm:"type:varchar(100);uniqueIndex:idx_twitter_space_attendance_role"`
+	RoleID    string    `gorm:"type:varchar(100);uniqueIndex:idx_twitter_space_attendance_role"`
+	CreatedBy string    `gorm:"type:varchar(100)"`
+	CreatedAt time.Time `gorm:"type:timestamptz"`
+}
+
+func (in TwitterSpaceAttendanceRoles) Save() error {
+	in.CreatedAt = time.Now()
+	err := CommunityPostgres.Clauses(clause.OnConflict{DoNothing: true}).Create(&in).Error
+	return errors.WrapAndReport(err, "save twitter space attendance role")
+}
+
+func (TwitterSpaceAttendanceRoles) Delete(guildID, spaceID, roleID string) error {
+	err := CommunityPostgres.Where("guild_id = ? AND space_id = ? AND role_id = ?", guildID, spaceID, roleID).
+		Delete(&TwitterSpaceAttendanceRoles{}).Error
+	return errors.WrapAndReport(err, "delete twitter space attendance role")
+}
+
+func (TwitterSpaceAttendanceRoles) SelectByGuild(guildID string) ([]*TwitterSpaceAttendanceRoles, error) {
+	var entities []*TwitterSpaceAttendanceRoles
+	err := CommunityPostgres.Where("guild_id = ?", guildID).Order("id").Find(&entities).Error
+	return entities, errors.WrapAndReport(err, "query twitter space attendance roles")
+}
@@ -0,0 +1,208 @@
+package database
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"moff.io/moff-social/pkg/errors"
+	"strings"
+	"time"
+)
+
+type TweetSnapshotStatus string
+
+const (
+	TweetSnapshotStatusPending    = TweetSnapshotStatus("pending")
+	TweetSnapshotStatusCollecting = TweetSnapshotStatus("collecting")
+	TweetSnapshotStatusFinished   = TweetSnapshotStatus("finished")
+	TweetSnapshotStatusFailed     = TweetSnapshotStatus("failed")
+)
+
+type TweetEngagementAction string
+
+const (
+	TweetEngagementLike    = TweetEngagementAction("like")
+	TweetEngagementRetweet = TweetEngagementAction("retweet")
+	TweetEngagementQuote   = TweetEngagementAction("quote")
+	TweetEngagementReply   = TweetEngagementAction("reply")
+)
+
+func IsValidTweetEngagementAction(action string) bool {
+	switch TweetEngagementAction(action) {
+	case TweetEngagementLike, TweetEngagementRetweet, TweetEngagementQuote, TweetEngagementReply:
+		return true
+	}
+	return false
+}
+
+// TweetSnapshots 推文互动快照，截止时间到达后收集点赞、转推、引用及回复的用户
+type TweetSnapshots struct {
+	ID                  int64               `gorm:"primaryKey"`
+	GuildID             string              `gorm:"type:varchar(100);uniqueIndex:idx_tweet_snapshot"`
+	TweetID             string              `gorm:"type:varchar(100);uniqueIndex:idx_tweet_snapshot"`
+	TweetURL            string              `gorm:"type:varchar(500)"`
+	AuthorID            string              `gorm:"type:varchar(100)"`
+	TweetText           string              `gorm:"type:text"`
+	LinkedCampaignID    string              `gorm:"type:varchar(100)"`
+	CampaignWhitelistID string              `gorm:"type:varchar(100)"`
+	RequiredActions     string              `gorm:"type:varchar(100)"` // 逗号分隔，写入白名单需完成全部互动
+	ReplyKeywords       string              `gorm:"type:varchar(500)"` // 逗号分隔，回复需包含任一关键词
+	ReplyMinWords       int                 `gorm:"type:int"`
+	ReplyMinMentions    int                 `gorm:"type:int"`
+	CutoffAt            time.Time           `gorm:"type:timestamptz;index"`
+	RetryAt             *time.Time          `gorm:"type:timestamptz"`
+	Status              TweetSnapshotStatus `gorm:"type:varchar(20);index"`
+	Attempts            int                 `gorm:"type:int"`
+	LastError           string              `gorm:"type:text"`
+	Likers              int                 `gorm:"type:int"`
+	Retweeters          int                 `gorm:"type:int"`
+	Quoters             int                 `gorm:"type:int"`
+	Repliers            int                 `gorm:"type:int"`
+	Qualified           int                 `gorm:"type:int"`
+	StarterDiscordID    string              `gorm:"type:varchar(100)"`
+	CreatedAt           time.Time           `gorm:"type:timestamptz"`
+	UpdatedAt           time.Time           `gorm:"type:timestamptz"`
+	FinishedAt          *time.Time          `gorm:"type:timestamptz"`
+}
+
+func (s TweetSnapshots) Actions() []TweetEngagementAction {
+	var actions []TweetEngagementAction
+	for _, action := range strings.Split(s.RequiredActions, ",") {
+		if action = strings.TrimSpace(action); action != "" {
+			actions = append(actions, TweetEngagementAction(action))
+		}
+	}
+	return actions
+}
+
+func (s TweetSnapshots) Keywords() []string {
+	var keywords []string
+	for _, keyword := range strings.Split(s.ReplyKeywords, ",") {
+		if keyword = strings.TrimSpace(keyword); keyword != "" {
+			keywords = append(keywords, strings.ToLower(keyword))
+		}
+	}
+	return keywords
+}
+
+// Create 同一服务器对同一推文仅创建一个快照，已存在时返回false
+func (in *TweetSnapshots) Create() (bool, error) {
+	now := time.Now()
+	in.Status = TweetSnapshotStatusPending
+	in.CreatedAt, in.UpdatedAt = now, now
+	result := CommunityPostgres.Clauses(clause.OnConflict{DoNothing: true}).Create(in)
+	if result.Error != nil {
+		return false, errors.WrapAndReport(result.Error, "create tweet snapshot")
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (TweetSnapshots) SelectOne(guildID, tweetID string) (*TweetSnapshots, error) {
+	var entity TweetSnapshots
+	err := CommunityPostgres.Where("guild_id = ? AND tweet_id = ?", guildID, tweetID).First(&entity).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WrapAndReport(err, "query tweet snapshot")
+	}
+	return &entity, nil
+}
+
+func (TweetSnapshots) SelectLatest(guildID string, limit int) ([]*TweetSnapshots, error) {
+	var entities []*TweetSnapshots
+	err := CommunityPostgres.Where("guild_id = ?", guildID).Order("id DESC").Limit(limit).Find(&entities).Error
+	return entities, errors.WrapAndReport(err, "query latest tweet snapshots")
+}
+
+// SelectDue 查询已到截止时间且未在重试等待中的快照
+func (TweetSnapshots) SelectDue(now time.Time, limit int) ([]*TweetSnapshots, error) {
+	var entities []*TweetSnapshots
+	err := CommunityPostgres.
+		Where("status = ? AND cutoff_at <= ? AND (retry_at IS NULL OR retry_at <= ?)", TweetSnapshotStatusPending, now, now).
+		Order("cutoff_at").Limit(limit).Find(&entities).Error
+	return entities, errors.WrapAndReport(err, "query due tweet snapshots")
+}
+
+// Claim 将快照标记为收集中，多个实例同时处理时仅一个成功
+func (in *TweetSnapshots) Claim() (bool, error) {
+	now := time.Now()
+	result := CommunityPostgres.Model(&TweetSnapshots{}).
+		Where("id = ? AND status = ?", in.ID, TweetSnapshotStatusPending).
+		Updates(map[string]interface{}{
+			"status":     TweetSnapshotStatusCollecting,
+			"attempts":   gorm.Expr("attempts + 1"),
+			"updated_at": now,
+		})
+	if result.Error != nil {
+		return false, errors.WrapAndReport(result.Error, "claim tweet snapshot")
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	in.Status = TweetSnapshotStatusCollecting
+	in.Attempts++
+	in.UpdatedAt = now
+	return true, nil
+}
+
+// ReleaseStale 收集实例崩溃后，超时的快照重新等待收集
+func (TweetSnapshots) ReleaseStale(before time.Time) (int64, error) {
+	result := CommunityPostgres.Model(&TweetSnapshots{}).
+		Where("status = ? AND updated_at < ?", TweetSnapshotStatusCollecting, before).
+		Updates(map[string]interface{}{
+			"status":     TweetSnapshotStatusPending,
+			"updated_at": time.Now(),
+		})
+	return result.RowsAffected, errors.WrapAndReport(result.Error, "release stale tweet snapshots")
+}
+
+func (in *TweetSnapshots) Update() error {
+	in.UpdatedAt = time.Now()
+	err := CommunityPostgres.Save(in).Error
+	return errors.WrapAndReport(err, "update tweet snapshot")
+}
+
+// TweetEngagements 快照收集到的互动，每个用户每种互动一条记录
+type TweetEngagements struct {
+	ID                int64                 `gorm:"primaryKey"`
+	SnapshotID        int64                 `gorm:"uniqueIndex:idx_tweet_engagement"`
+	TwitterID         string                `gorm:"type:varchar(100);uniqueIndex:idx_tweet_engagement"`
+	Action            TweetEngagementAction `gorm:"type:varchar(20);uniqueIndex:idx_tweet_engagement"`
+	Username          string                `gorm:"type:varchar(100)"`
+	EngagementTweetID string                `gorm:"type:varchar(100)"` // 引用或回复的推文
+	Text              string                `gorm:"type:text"`
+	Qualified         bool
+	EngagedAt         *time.Time `gorm:"type:timestamptz"`
+	CreatedAt         time.Time  `gorm:"type:timestamptz"`
+}
+
+// Replace 重新收集时覆盖快照之前的互动记录
+func (TweetEngagements) Replace(snapshotID int64, entities []*TweetEngagements) error {
+	now := time.Now()
+	for _, entity := range entities {
+		entity.SnapshotID = snapshotID
+		entity.CreatedAt = now
+	}
+	err := CommunityPostgres.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("snapshot_id = ?", snapshotID).Delete(&TweetEngagements{}).Error; err != nil {
+			return err
+		}
+		if len(entities) == 0 {
+			return nil
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(entities, 1000).Error
+	})
+	return errors.WrapAndReport(err, "replace tweet engagements")
+}
+
+func (TweetEngagements) SelectBySnapshot(snapshotID int64) ([]*TweetEngagements, error) {
+	var entities []*TweetEngagements
+	err := CommunityPostgres.Where("snapshot_id = ?", snapshotID).Order("id").Find(&entities).Error
+	return entities, errors.WrapAndReport(err, "query tweet engagements")
+}
+
+func (TweetEngagements) SelectByTwitterID(snapshotID int64, twitterID string) ([]*TweetEngagements, error) {
+	var entities []*TweetEngagements
+	err := CommunityPostgres.Where("snapshot_id = ? AND twitter_id = ?", snapshotID, twitterID).Find(&entities).Error
+	return entities, errors.WrapAndReport(err, "query tweet engagements of user")
+}
@@ -2,7 +2,9 @@ package database
 
 import (
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"moff.io/moff-social/pkg/errors"
+	"strings"
 	"time"
 )
 
@@ -32,15 +34,28 @@ const (
 	MaxHeartbeatCount = 5
 )
 
-func (TwitterWebAuthorization) FindHeartbeatableAndNotExpired() ([]*TwitterWebAuthorization, error) {
-	var auth []*TwitterWebAuthorization
-	sql := "SELECT a.* FROM community.twitter_web_authorizations a WHERE a.expired_time is NULL AND (" +
-		"SELECT count(id) < ? FROM community.twitter_web_authorization_heartbeats WHERE authorization_id=a.id AND heartbeat_time > ?)"
-	err := PublicPostgres.Raw(sql, MaxHeartbeatCount, time.Now().Add(-time.Minute)).Scan(&auth).Error
+// TwitterWebAuthorizationLoads 凭证及最近一分钟内占用它的space数量
+type TwitterWebAuthorizationLoads struct {
+	TwitterWebAuthorization
+	Load int64
+}
+
+func (TwitterWebAuthorization) SelectLoads() ([]*TwitterWebAuthorizationLoads, error) {
+	var loads []*TwitterWebAuthorizationLoads
+	sql := "SELECT a.*,(SELECT count(id) FROM community.twitter_web_authorization_heartbeats " +
+		"WHERE authorization_id=a.id AND heartbeat_time > ?) AS load FROM community.twitter_web_authorizations a ORDER BY a.id"
+	err := PublicPostgres.Raw(sql, time.Now().Add(-time.Minute)).Scan(&loads).Error
 	if err != nil {
-		return nil, errors.WrapAndReport(err, "select twitter web authorizations")
+		return nil, errors.WrapAndReport(err, "select twitter web authorization loads")
 	}
-	return auth, nil
+	return loads, nil
+}
+
+func (in TwitterWebAuthorization) Create() (int64, error) {
+	var id int64
+	sql := "INSERT INTO community.twitter_web_authorizations (cookies,csrf_token,\"authorization\") VALUES (?,?,?) RETURNING id"
+	err := PublicPostgres.Raw(sql, in.Cookies, in.CsrfToken, in.Authorization).Scan(&id).Error
+	return id, errors.WrapAndReport(err, "create twitter web authorization")
 }
 
 func (in TwitterWebAuthorization) Expire() error {
@@ -169,7 +184,14 @@ type TwitterSpaceSnapshots struct {
 	StartedAt          *time.Time `gorm:"type:timestamptz"`
 	EndedAt            *time.Time `gorm:"type:timestamptz"`
 	TotalParticipants  int        `gorm:"type:int8"`
-	ParticipantLink    string     `gorm:"type:varchar"`
+	// 出席统计，留存为停留超过对应分钟数的参与者百分比
+	PeakConcurrency   int     `gorm:"type:int8"`
+	AvgConcurrency    float64 `gorm:"type:float8"`
+	UniqueListeners   int     `gorm:"type:int8"`
+	Retention5m       float64 `gorm:"type:float8"`
+	Retention15m      float64 `gorm:"type:float8"`
+	Retention30m      float64 `gorm:"type:float8"`
+	ConcurrencySeries string  `gorm:"type:text"`
 }
 
 func (s TwitterSpaceSnapshots) StartTime() *time.Time {
@@ -204,8 +226,11 @@ func (TwitterSpaceSnapshots) SelectOngoing() ([]*TwitterSpaceSnapshots, error) {
 }
 
 func (in TwitterSpaceSnapshots) Update() error {
-	err := PublicPostgres.Exec("UPDATE community.twitter_space_snapshots SET started_at=?,ended_at=?,total_participants=?,participant_link=? WHERE space_id=? AND ended_at IS NULL",
-		in.StartedAt, in.EndedAt, in.TotalParticipants, in.ParticipantLink, in.SpaceID).Error
+	err := PublicPostgres.Exec("UPDATE community.twitter_space_snapshots SET started_at=?,ended_at=?,total_participants=?,"+
+		"peak_concurrency=?,avg_concurrency=?,unique_listeners=?,retention5m=?,retention15m=?,retention30m=?,concurrency_series=? "+
+		"WHERE space_id=? AND ended_at IS NULL",
+		in.StartedAt, in.EndedAt, in.TotalParticipants, in.PeakConcurrency, in.AvgConcurrency,
+		in.UniqueListeners, in.Retention5m, in.Retention15m, in.Retention30m, in.ConcurrencySeries, in.SpaceID).Error
 	return errors.WrapAndReport(err, "update twitter snapshot")
 }
 
@@ -216,3 +241,78 @@ type TwitterSpacePresences struct {
 	JoinedAt  time.Time `gorm:"type:timestamptz"`
 	LeftAt    time.Time `gorm:"type:timestamptz"`
 }
+
+// TwitterWebAuthorizationStates 管理员对网页登录凭证的停用设置
+type TwitterWebAuthorizationStates struct {
+	ID              int64     `gorm:"primaryKey"`
+	AuthorizationID int64     `gorm:"type:int8;uniqueIndex"`
+	Disabled        bool      `gorm:"type:bool"`
+	Note            string    `gorm:"type:text"`
+	UpdatedBy       string    `gorm:"type:varchar(100)"`
+	UpdatedAt       time.Time `gorm:"type:timestamptz"`
+}
+
+func (TwitterWebAuthorizationStates) SelectAll() ([]*TwitterWebAuthorizationStates, error) {
+	var states []*TwitterWebAuthorizationStates
+	err := CommunityPostgres.Find(&states).Error
+	if err != nil {
+		return nil, errors.WrapAndReport(err, "select twitter web authorization states")
+	}
+	return states, nil
+}
+
+func (in TwitterWebAuthorizationStates) Save() error {
+	in.UpdatedAt = time.Now()
+	err := CommunityPostgres.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "authorization_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"disabled", "note", "updated_by", "updated_at"}),
+	}).Create(&in).Error
+	return errors.WrapAndReport(err, "save twitter web authorization state")
+}
+
+// TwitterFollowGates 验证关注指定twitter账号后授予角色或写入白名单的按钮
+type TwitterFollowGates struct {
+	ID          int64     `gorm:"primaryKey"`
+	GuildID     string    `gorm:"type:varchar(100);index"`
+	ChannelID   string    `gorm:"type:varchar(100)"`
+	MessageID   string    `gorm:"type:varchar(100)"`
+	Accounts    string    `gorm:"type:varchar(500)"` // 逗号分隔的用户名
+	CampaignID  string    `gorm:"type:varchar(100)"`
+	RoleID      string    `gorm:"type:varchar(100)"`
+	WhitelistID string    `gorm:"type:varchar(100)"`
+	CreatedBy   string    `gorm:"type:varchar(100)"`
+	CreatedAt   time.Time `gorm:"type:timestamptz"`
+}
+
+func (in *TwitterFollowGates) Create() error {
+	in.CreatedAt = time.Now()
+	err := CommunityPostgres.Create(in).Error
+	return errors.WrapAndReport(err, "create twitter follow gate")
+}
+
+func (TwitterFollowGates) SelectOne(id int64) (*TwitterFollowGates, error) {
+	var entity TwitterFollowGates
+	err := CommunityPostgres.Where("id = ?", id).First(&entity).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WrapAndReport(err, "query twitter follow gate")
+	}
+	return &entity, nil
+}
+
+func (in TwitterFollowGates) UpdateMessageID(messageID string) error {
+	err := CommunityPostgres.Model(&TwitterFollowGates{}).Where("id = ?", in.ID).Update("message_id", messageID).Error
+	return errors.WrapAndReport(err, "update twitter follow gate message")
+}
+
+func (in TwitterFollowGates) AccountList() []string {
+	var accounts []string
+	for _, account := range strings.Split(in.Accounts, ",") {
+		if account = strings.TrimSpace(account); account != "" {
+			accounts = append(accounts, account)
+		}
+	}
+	return accounts
+}
@@ -7,7 +7,9 @@ type WhiteLabelingApps struct {
 	AppID                           string `gorm:"type:varchar(255)"`
 	DiscordGuildId                  string
 	AutoSnapshotTwitterSpaceEnabled bool
-	CommunityDashboardURL           string
+	// AutoSnapshotTweetEnabled 活动参与链接为推文时自动收集互动，与space的开关分开设置
+	AutoSnapshotTweetEnabled bool
+	CommunityDashboardURL    string
 }
 
 func (WhiteLabelingApps) SelectOne(guildID string) (*WhiteLabelingApps, error) {
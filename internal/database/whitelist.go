@@ -11,6 +11,8 @@ type WhitelistEntityType string
 const (
 	WhitelistEntityTypeTwitterID = WhitelistEntityType("twitter_ids")
 	WhitelistEntityTypeDiscordID = WhitelistEntityType("discord_ids")
+	// WhitelistEntityTypeWalletAddr 钱包地址不区分大小写
+	WhitelistEntityTypeWalletAddr = WhitelistEntityType("wallet_addrs")
 )
 
 type Whitelist struct {
@@ -44,3 +46,45 @@ func (Whitelist) WriteDiscordIds(tx *gorm.DB, whitelistID string, ids []string)
 	err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&wl).Error
 	return errors.WrapAndReport(err, "write twitter id to whitelist")
 }
+
+// DeleteDiscordIds 从白名单移除discord id
+func (Whitelist) DeleteDiscordIds(tx *gorm.DB, whitelistID string, ids []string) error {
+	err := tx.Where("whitelist_id = ? AND entity_type = ? AND entity_id IN ?", whitelistID, WhitelistEntityTypeDiscordID, ids).
+		Delete(&Whitelist{}).Error
+	return errors.WrapAndReport(err, "delete discord id from whitelist")
+}
+
+func (Whitelist) SelectByWhitelistID(whitelistID string) ([]*Whitelist, error) {
+	var entities []*Whitelist
+	err := PublicPostgres.Where("whitelist_id = ?", whitelistID).Find(&entities).Error
+	return entities, errors.WrapAndReport(err, "query whitelist")
+}
+
+// SelectWhitelistIDs 查询包含该身份的白名单
+func (Whitelist) SelectWhitelistIDs(entityType WhitelistEntityType, entityID string) ([]string, error) {
+	var whitelistIDs []string
+	err := PublicPostgres.Model(&Whitelist{}).Distinct("whitelist_id").
+		Where("entity_type = ? AND entity_id = ?", entityType, entityID).Pluck("whitelist_id", &whitelistIDs).Error
+	return whitelistIDs, errors.WrapAndReport(err, "query whitelist ids")
+}
+
+// Contains 白名单是否包含任一身份，钱包地址需为小写
+func (Whitelist) Contains(whitelistID string, entityType WhitelistEntityType, entityIDs []string) (bool, error) {
+	if len(entityIDs) == 0 {
+		return false, nil
+	}
+	var (
+		count int64
+		db    = PublicPostgres.Model(&Whitelist{}).Where("whitelist_id = ? AND entity_type = ?", whitelistID, entityType)
+	)
+	if entityType == WhitelistEntityTypeWalletAddr {
+		db = db.Where("lower(entity_id) IN ?", entityIDs)
+	} else {
+		db = db.Where("entity_id IN ?", entityIDs)
+	}
+	err := db.Count(&count).Error
+	if err != nil {
+		return false, errors.WrapAndReport(err, "query whitelist entity")
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,302 @@
+package discord
+
+import (
+	"context"
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"moff.io/moff-social/internal/database"
+	"moff.io/moff-social/pkg/errors"
+	"moff.io/moff-social/pkg/log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	campaignAnnounceInterval = time.Minute
+	// 仅公告最近发生的开始和结束，服务长时间停止后不补发过期的公告
+	campaignAnnounceWindow = time.Hour
+	campaignEndingNotice   = time.Hour * 24
+)
+
+var (
+	initCampaignAnnouncerOnce sync.Once
+	internalCampaignAnnouncer *CampaignAnnouncer
+
+	defaultCampaignAnnouncementTemplates = map[database.CampaignAnnouncementKind]string{
+		database.CampaignAnnouncementStart:  "**{name}** is live now!\n\n{description}\n\nEnds {end}\n[Join now]({link})",
+		database.CampaignAnnouncementEnding: "**{name}** ends {end}, don't miss out!\n\n[Join now]({link})",
+		database.CampaignAnnouncementEnd:    "**{name}** has ended. Thanks to everyone who joined!",
+	}
+	campaignAnnouncementTitles = map[database.CampaignAnnouncementKind]string{
+		database.CampaignAnnouncementStart:  "🚀 Event started",
+		database.CampaignAnnouncementEnding: "⏰ Event ending in 24 hours",
+		database.CampaignAnnouncementEnd:    "🏁 Event ended",
+	}
+)
+
+// CampaignAnnouncer 检查活动的开始、结束前24小时及结束，在白标应用服务器的指定频道发送公告
+type CampaignAnnouncer struct{}
+
+func NewCampaignAnnouncer() *CampaignAnnouncer {
+	initCampaignAnnouncerOnce.Do(func() {
+		internalCampaignAnnouncer = &CampaignAnnouncer{}
+	})
+	return internalCampaignAnnouncer
+}
+
+func (in *CampaignAnnouncer) Start(ctx context.Context) {
+	go in.start(ctx)
+}
+
+func (in *CampaignAnnouncer) start(ctx context.Context) {
+	ticker := time.NewTicker(campaignAnnounceInterval)
+	defer ticker.Stop()
+	log.Infof("Campaign announcer running...")
+	defer log.Infof("Campaign announcer stopped...")
+	for {
+		select {
+		case <-ticker.C:
+			// 机器人未连接时跳过
+			if session == nil {
+				continue
+			}
+			if err := in.announce(time.Now()); err != nil {
+				log.Error(err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (in *CampaignAnnouncer) announce(now time.Time) error {
+	settings, err := database.CampaignAnnouncementSettings{}.SelectEnabled()
+	if err != nil {
+		return err
+	}
+	// 同一应用可能绑定多个服务器，每个服务器都需要发送公告
+	var (
+		appIDs      []string
+		appSettings = make(map[string][]*database.CampaignAnnouncementSettings)
+	)
+	for _, setting := range settings {
+		app, err := database.WhiteLabelingApps{}.SelectOne(setting.GuildID)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		if app == nil || app.AppID == "" {
+			continue
+		}
+		if _, ok := appSettings[app.AppID]; !ok {
+			appIDs = append(appIDs, app.AppID)
+		}
+		appSettings[app.AppID] = append(appSettings[app.AppID], setting)
+	}
+	if len(appIDs) == 0 {
+		return nil
+	}
+	campaigns, err := database.Campaigns{}.QueryLifecycle(appIDs, now.Add(-campaignAnnounceWindow), now.Add(campaignEndingNotice))
+	if err != nil {
+		return err
+	}
+	for _, campaign := range campaigns {
+		kinds := campaignAnnouncementKinds(campaign, now)
+		for _, setting := range appSettings[campaign.AppID] {
+			for _, kind := range kinds {
+				if err := in.send(setting, campaign, kind); err != nil {
+					log.Error(err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// campaignAnnouncementKinds 活动当前需发送的公告，不足24小时的活动不发送即将结束的公告
+func campaignAnnouncementKinds(campaign *database.Campaigns, now time.Time) []database.CampaignAnnouncementKind {
+	var (
+		kinds []database.CampaignAnnouncementKind
+		start = time.UnixMilli(campaign.StartDate)
+		end   = time.UnixMilli(campaign.EndDate)
+		since = now.Add(-campaignAnnounceWindow)
+	)
+	if start.After(since) && !start.After(now) && end.After(now) {
+		kinds = append(kinds, database.CampaignAnnouncementStart)
+	}
+	if end.After(now) && !end.After(now.Add(campaignEndingNotice)) && end.Sub(start) > campaignEndingNotice {
+		kinds = append(kinds, database.CampaignAnnouncementEnding)
+	}
+	if end.After(since) && !end.After(now) {
+		kinds = append(kinds, database.CampaignAnnouncementEnd)
+	}
+	return kinds
+}
+
+func (in *CampaignAnnouncer) send(setting *database.CampaignAnnouncementSettings, campaign *database.Campaigns,
+	kind database.CampaignAnnouncementKind) error {
+	announcement := &database.CampaignAnnouncements{
+		GuildID:    setting.GuildID,
+		CampaignID: campaign.CampaignID,
+		Kind:       kind,
+		ChannelID:  setting.ChannelID,
+	}
+	claimed, err := announcement.Claim()
+	if err != nil || !claimed {
+		return err
+	}
+	msg, err := session.ChannelMessageSendComplex(setting.ChannelID, campaignAnnouncementMessage(setting, campaign, kind))
+	if err != nil {
+		if err := announcement.Release(); err != nil {
+			log.Error(err)
+		}
+		return errors.WrapAndReport(err, fmt.Sprintf("send campaign %v %v announcement to guild %v",
+			campaign.CampaignID, kind, setting.GuildID))
+	}
+	log.Infof("Campaign %v %v announced in guild %v", campaign.CampaignID, kind, setting.GuildID)
+	return announcement.UpdateMessageID(msg.ID)
+}
+
+func campaignAnnouncementMessage(setting *database.CampaignAnnouncementSettings, campaign *database.Campaigns,
+	kind database.CampaignAnnouncementKind) *discordgo.MessageSend {
+	var (
+		link = fmt.Sprintf("https://moff.io/events?campaign_id=%v", campaign.CampaignID)
+		tmpl = setting.Template(kind)
+		role string
+	)
+	if tmpl == "" {
+		tmpl = defaultCampaignAnnouncementTemplates[kind]
+	}
+	if setting.RoleID != "" {
+		role = fmt.Sprintf("<@&%v>", setting.RoleID)
+	}
+	desc := strings.NewReplacer(
+		"{name}", campaign.Name,
+		"{game}", campaign.GameName,
+		"{description}", campaign.DescriptionText,
+		"{link}", link,
+		"{start}", fmt.Sprintf("<t:%v:R>", campaign.StartDate/1000),
+		"{end}", fmt.Sprintf("<t:%v:R>", campaign.EndDate/1000),
+		"{role}", role,
+		// 斜杠命令无法输入换行
+		`\n`, "\n",
+	).Replace(tmpl)
+	msg := &discordgo.MessageSend{
+		Embeds: []*discordgo.MessageEmbed{
+			{
+				Title:       ellipsis(campaignAnnouncementTitles[kind], 250),
+				URL:         link,
+				Description: ellipsis(desc, 4090),
+				Color:       6095103,
+				Author:      moffAuthor,
+			},
+		},
+	}
+	if campaign.ImageURL != "" {
+		msg.Embeds[0].Image = &discordgo.MessageEmbedImage{URL: campaign.ImageURL}
+	}
+	if setting.RoleID != "" {
+		msg.Content = role
+		msg.AllowedMentions = &discordgo.MessageAllowedMentions{
+			Roles: []string{setting.RoleID},
+		}
+	}
+	return msg
+}
+
+// manageCampaignAnnouncer 设置白标应用服务器的活动公告频道、提醒角色及模板
+func manageCampaignAnnouncer(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if !IsAdminPermission(i.Member.Permissions) {
+		respondSnapshotError(s, i, "Not allowed:thinking: ")
+		return
+	}
+	app, err := database.WhiteLabelingApps{}.SelectOne(i.GuildID)
+	if err != nil {
+		log.Error(err)
+		respondSnapshotError(s, i, "Unknown error")
+		return
+	}
+	if app == nil || app.AppID == "" {
+		respondSnapshotError(s, i, "Campaign announcements are only available for white-label app servers")
+		return
+	}
+	existing, err := database.CampaignAnnouncementSettings{}.SelectOne(i.GuildID)
+	if err != nil {
+		log.Error(err)
+		respondSnapshotError(s, i, "Unknown error")
+		return
+	}
+	// 仅更新本次指定的选项，其余沿用之前的设置
+	setting := &database.CampaignAnnouncementSettings{
+		GuildID:   i.GuildID,
+		Enabled:   true,
+		UpdatedBy: i.Member.User.ID,
+	}
+	if existing != nil {
+		setting.ChannelID, setting.RoleID, setting.Enabled = existing.ChannelID, existing.RoleID, existing.Enabled
+		setting.StartTemplate, setting.EndingTemplate, setting.EndTemplate =
+			existing.StartTemplate, existing.EndingTemplate, existing.EndTemplate
+	}
+	for _, option := range i.ApplicationCommandData().Options {
+		switch option.Name {
+		case "channel":
+			setting.ChannelID = option.ChannelValue(nil).ID
+		case "role":
+			setting.RoleID = option.RoleValue(nil, "").ID
+		case "remove-role":
+			if option.BoolValue() {
+				setting.RoleID = ""
+			}
+		case "enabled":
+			setting.Enabled = option.BoolValue()
+		case "reset-templates":
+			if option.BoolValue() {
+				setting.StartTemplate, setting.EndingTemplate, setting.EndTemplate = "", "", ""
+			}
+		}
+	}
+	// 重置后再应用本次指定的模板
+	for _, option := range i.ApplicationCommandData().Options {
+		switch option.Name {
+		case "start-template":
+			setting.StartTemplate = strings.TrimSpace(option.StringValue())
+		case "ending-template":
+			setting.EndingTemplate = strings.TrimSpace(option.StringValue())
+		case "end-template":
+			setting.EndTemplate = strings.TrimSpace(option.StringValue())
+		}
+	}
+	if setting.ChannelID == "" {
+		respondSnapshotError(s, i, "Please choose a channel to post announcements")
+		return
+	}
+	if err := setting.Upsert(); err != nil {
+		log.Error(err)
+		respondSnapshotError(s, i, "Unknown error")
+		return
+	}
+	desc := fmt.Sprintf("**Channel**:<#%v>", setting.ChannelID)
+	if setting.RoleID != "" {
+		desc += fmt.Sprintf("\n**Ping**:<@&%v>", setting.RoleID)
+	}
+	desc += fmt.Sprintf("\n**Enabled**:%v", setting.Enabled)
+	desc += "\n\nTemplates support `{name}` `{game}` `{description}` `{link}` `{start}` `{end}` `{role}` and `\\n`."
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags: discordgo.MessageFlagsEphemeral,
+			Embeds: []*discordgo.MessageEmbed{
+				{
+					Title:       "Campaign announcements updated",
+					Description: desc,
+					Color:       6095103,
+					Author:      moffAuthor,
+				},
+			},
+		},
+	})
+	if err != nil {
+		log.Error(errors.WrapAndReport(err, "respond manage campaign announcer"))
+	}
+}
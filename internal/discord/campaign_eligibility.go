@@ -0,0 +1,65 @@
+package discord
+
+import (
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"moff.io/moff-social/internal/campaign"
+	"moff.io/moff-social/internal/database"
+	"moff.io/moff-social/pkg/errors"
+	"moff.io/moff-social/pkg/log"
+	"strings"
+)
+
+// checkCampaignEligibility 检查成员是否满足活动要求，并逐项说明不满足的原因
+func checkCampaignEligibility(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	var campaignID string
+	for _, option := range i.ApplicationCommandData().Options {
+		if option.Name == "campaign-id" {
+			campaignID = strings.TrimSpace(option.StringValue())
+		}
+	}
+	// 部分要求需查询twitter及链上数据，先响应
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		log.Error(errors.WrapAndReport(err, "quick response to check campaign eligibility"))
+		return
+	}
+	c, err := database.Campaigns{}.SelectOne(campaignID)
+	if err != nil {
+		log.Error(err)
+		respondEditSnapshotError(s, i, "Unknown error")
+		return
+	}
+	if c == nil {
+		respondEditSnapshotError(s, i, fmt.Sprintf("Campaign %v not found", campaignID))
+		return
+	}
+	subject := &campaign.Subject{
+		GuildID:   i.GuildID,
+		DiscordID: i.Member.User.ID,
+		Roles:     i.Member.Roles,
+	}
+	result := campaign.Evaluate(subject, c.Required)
+	title := fmt.Sprintf("✅ You're eligible for %v", c.Name)
+	if !result.Passed {
+		title = fmt.Sprintf("❌ You're not eligible for %v yet", c.Name)
+	}
+	_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Embeds: &[]*discordgo.MessageEmbed{
+			{
+				Title:       ellipsis(title, 250),
+				Description: ellipsis(result.Explain(), 4090),
+				Color:       6095103,
+				Author:      moffAuthor,
+			},
+		},
+	})
+	if err != nil {
+		log.Error(errors.WrapAndReport(err, "respond campaign eligibility"))
+	}
+}
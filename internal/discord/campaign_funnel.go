@@ -0,0 +1,145 @@
+package discord
+
+import (
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"github.com/gin-gonic/gin"
+	"moff.io/moff-social/internal/database"
+	"moff.io/moff-social/pkg/errors"
+	"moff.io/moff-social/pkg/log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultCampaignFunnelLevel = 5
+	defaultCampaignFunnelCount = 5
+	maxCampaignFunnelCount     = 100
+)
+
+// campaignFunnelCommandHandler 展示活动邀请链接的转化漏斗，未指定链接时展示最近创建的链接
+func campaignFunnelCommandHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	defer logHandlerDuration("campaign funnel", time.Now())
+	if !IsAdminPermission(i.Member.Permissions) {
+		respondSnapshotError(s, i, "Not allowed:thinking: ")
+		return
+	}
+	var (
+		inviteCode string
+		level      = defaultCampaignFunnelLevel
+	)
+	for _, option := range i.ApplicationCommandData().Options {
+		switch option.Name {
+		case "invite-code":
+			inviteCode = option.StringValue()
+		case "level":
+			level = int(option.IntValue())
+		}
+	}
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		log.Error(errors.WrapAndReport(err, "quick response to campaign funnel"))
+		return
+	}
+	funnels, err := database.DiscordCampaignFunnel{}.SelectFunnels(i.GuildID, inviteCode, level, 0, defaultCampaignFunnelCount)
+	if err != nil {
+		log.Error(err)
+		interactionResponseEditOnError(s, i)
+		return
+	}
+	var fields []*discordgo.MessageEmbedField
+	for _, funnel := range funnels {
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:  ellipsis(fmt.Sprintf("%v · %v", funnel.CampaignName, funnel.CampaignSource), 250),
+			Value: campaignFunnelDesc(funnel, level),
+		})
+	}
+	desc := fmt.Sprintf("Conversion of members who joined through the latest %v campaign invites", defaultCampaignFunnelCount)
+	if inviteCode != "" {
+		desc = fmt.Sprintf("Conversion of members who joined through `%v`", inviteCode)
+	}
+	if len(funnels) == 0 {
+		desc = "No campaign invites found, create one with `/create-invites`"
+	}
+	_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Embeds: &[]*discordgo.MessageEmbed{
+			{
+				Title:       "Campaign invite funnel",
+				Description: desc,
+				Color:       6095103,
+				Author:      moffAuthor,
+				Fields:      fields,
+			},
+		},
+	})
+	if err != nil {
+		log.Error(errors.WrapAndReport(err, "campaign funnel response edit"))
+	}
+}
+
+func campaignFunnelDesc(funnel *database.DiscordCampaignFunnel, level int) string {
+	return fmt.Sprintf("https://discord.gg/%v\n"+
+		"**Joined**: `%v`\n"+
+		"**Retention**: D1 %v　D7 %v　D30 %v\n"+
+		"**Reached level %v**: %v\n"+
+		"**Wallet verified**: %v\n"+
+		"**Joined snapshots**: %v (text, voice, spaces and tweets)\n"+
+		"**Joined quizzes**: %v",
+		funnel.InviteCode, funnel.Joins,
+		funnelRate(funnel.Day1Retained, funnel.Day1Eligible),
+		funnelRate(funnel.Day7Retained, funnel.Day7Eligible),
+		funnelRate(funnel.Day30Retained, funnel.Day30Eligible),
+		level, funnelRate(funnel.ReachedLevel, funnel.Joins),
+		funnelRate(funnel.WalletVerified, funnel.Joins),
+		funnelRate(funnel.SnapshotParticipated, funnel.Joins),
+		funnelRate(funnel.QuizParticipated, funnel.Joins))
+}
+
+// funnelRate 转化率，没有可统计的成员时显示为-
+func funnelRate(num, total int64) string {
+	if total == 0 {
+		return "`-`"
+	}
+	return fmt.Sprintf("`%.1f%%` (%v/%v)", float64(num)*100/float64(total), num, total)
+}
+
+// CampaignFunnels 查询服务器活动邀请链接的转化漏斗
+func CampaignFunnels(ctx *gin.Context) {
+	// curl -H 'X-Moff-Analytics-Token: xxx' 'http://127.0.0.1:8080/discord/campaign_funnels?guild_id=1&level=5'
+	guildID := ctx.Query("guild_id")
+	if guildID == "" {
+		ctx.String(http.StatusBadRequest, "guild id not present")
+		return
+	}
+	level, err := strconv.Atoi(ctx.DefaultQuery("level", strconv.Itoa(defaultCampaignFunnelLevel)))
+	if err != nil || level < 0 {
+		ctx.String(http.StatusBadRequest, "invalid level")
+		return
+	}
+	offset, err := strconv.Atoi(ctx.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		ctx.String(http.StatusBadRequest, "invalid offset")
+		return
+	}
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", strconv.Itoa(maxCampaignFunnelCount)))
+	if err != nil || limit <= 0 || limit > maxCampaignFunnelCount {
+		ctx.String(http.StatusBadRequest, "invalid limit")
+		return
+	}
+	funnels, err := database.DiscordCampaignFunnel{}.SelectFunnels(guildID, ctx.Query("invite_code"), level, offset, limit)
+	if err != nil {
+		log.Error(err)
+		ctx.String(http.StatusInternalServerError, "internal error")
+		return
+	}
+	ctx.JSONP(http.StatusOK, map[string]interface{}{
+		"level":   level,
+		"funnels": funnels,
+	})
+}
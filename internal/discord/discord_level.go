@@ -82,7 +82,13 @@ func discordUserLevelContent(guildID, memberID string) (string, error) {
 	if member == nil {
 		content = "Your Discord Level is 0"
 	} else {
-		exp2LevelUp := 5*(member.Level*member.Level) + (50 * member.Level) + 100
+		settings, err := database.DiscordLevelSettings{}.SelectOne(guildID)
+		if err != nil {
+			return "", err
+		}
+		// 等级曲线修改后，成员下次获得经验前按新曲线展示
+		member.Level, member.Exp = settings.Level(member.TotalExp)
+		exp2LevelUp := settings.ExpToLevelUp(member.Level)
 		progress := int(math.Floor(float64(member.Exp) * 20 / float64(exp2LevelUp)))
 		if progress == 0 {
 			progress = 1
@@ -105,19 +111,27 @@ func discordUserLevelContent(guildID, memberID string) (string, error) {
 }
 
 const (
-	discordReactionKey     = "exp:discord_reaction"
-	discordInteractionKey  = "exp:discord_interaction"
-	discordSendMessageKey  = "exp:discord_send_message"
+	discordReactionKey     = database.DiscordExpActionReaction
+	discordInteractionKey  = database.DiscordExpActionInteraction
+	discordSendMessageKey  = database.DiscordExpActionMessage
 	defaultExpCalcInterval = time.Second * 15
 )
 
 type memberExpAction interface {
+	// EventID 经验流水的幂等键，同一事件重复投递时只计算一次
+	EventID() string
 	Action() string
 	Exp() int
 	Guild() string
+	Channel() string
 	Member() *discordgo.Member
 }
 
+// cappedExpAction 有每日上限的经验行为，上限按经验策略处理后的经验计算
+type cappedExpAction interface {
+	capExp(ctx context.Context, exp int) (int, error)
+}
+
 type discordSendMessage struct {
 	*discordgo.MessageCreate
 }
@@ -126,6 +140,10 @@ func newDiscordSendMessage(message *discordgo.MessageCreate) memberExpAction {
 	return &discordSendMessage{message}
 }
 
+func (in *discordSendMessage) EventID() string {
+	return "message:" + in.ID
+}
+
 func (in *discordSendMessage) Action() string {
 	return discordSendMessageKey
 }
@@ -148,6 +166,10 @@ func (in *discordSendMessage) Guild() string {
 	return in.GuildID
 }
 
+func (in *discordSendMessage) Channel() string {
+	return in.ChannelID
+}
+
 func (in *discordSendMessage) Member() *discordgo.Member {
 	if in.Message.Member == nil {
 		in.Message.Member = &discordgo.Member{}
@@ -164,6 +186,10 @@ func newDiscordInteraction(m *discordgo.MessageCreate) memberExpAction {
 	return &discordInteraction{m}
 }
 
+func (in *discordInteraction) EventID() string {
+	return "interaction:" + in.ID
+}
+
 func (in *discordInteraction) Action() string {
 	return discordInteractionKey
 }
@@ -175,6 +201,11 @@ func (in *discordInteraction) Exp() int {
 func (in *discordInteraction) Guild() string {
 	return in.GuildID
 }
+
+func (in *discordInteraction) Channel() string {
+	return in.ChannelID
+}
+
 func (in *discordInteraction) Member() *discordgo.Member {
 	if in.Message.Member == nil {
 		in.Message.Member = &discordgo.Member{}
@@ -191,6 +222,11 @@ func newDiscordReaction(reaction *discordgo.MessageReactionAdd) memberExpAction
 	return &discordReaction{reaction}
 }
 
+// EventID 同一成员对同一消息的同一表情重复添加时只计算一次
+func (in *discordReaction) EventID() string {
+	return fmt.Sprintf("reaction:%v:%v:%v", in.MessageID, in.UserID, in.Emoji.APIName())
+}
+
 func (in *discordReaction) Action() string {
 	return discordReactionKey
 }
@@ -202,6 +238,11 @@ func (in *discordReaction) Exp() int {
 func (in *discordReaction) Guild() string {
 	return in.GuildID
 }
+
+func (in *discordReaction) Channel() string {
+	return in.ChannelID
+}
+
 func (in *discordReaction) Member() *discordgo.Member {
 	return in.MessageReactionAdd.Member
 }
@@ -215,8 +256,13 @@ func addMemberExpMessage2SQS(action memberExpAction) {
 		return
 	}
 
-	key := fmt.Sprintf("%v:%v:%v", action.Action(), action.Guild(), action.Member().User.ID)
 	ctx := context.TODO()
+	// 忽略的频道及刷屏消息不获得经验，也不占用冷却时间
+	expValue := applyExpPolicy(ctx, action)
+	if expValue <= 0 {
+		return
+	}
+	key := fmt.Sprintf("%v:%v:%v", action.Action(), action.Guild(), action.Member().User.ID)
 	ok, err := cache.Redis.SetNX(ctx, key, 1, defaultExpCalcInterval).Result()
 	if err != nil {
 		log.Error(errors.WrapAndReport(err, "cache discord reaction"))
@@ -226,13 +272,24 @@ func addMemberExpMessage2SQS(action memberExpAction) {
 		//log.Debugf("skip add exp to guild %v member %v %v", action.Guild(), action.Member().User.ID, action.Action())
 		return
 	}
+	if capped, ok := action.(cappedExpAction); ok {
+		expValue, err = capped.capExp(ctx, expValue)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+		if expValue <= 0 {
+			return
+		}
+	}
 	exp := memberExp{
+		EventID:       action.EventID(),
 		GuildID:       action.Guild(),
 		MemberID:      action.Member().User.ID,
 		Avatar:        action.Member().User.Avatar,
 		Discriminator: action.Member().User.Discriminator,
 		Username:      action.Member().User.Username,
-		Exp:           action.Exp(),
+		Exp:           expValue,
 		Action:        action.Action(),
 		CreatedAt:     time.Now(),
 	}
@@ -333,6 +390,7 @@ func saveMessageReaction(i *discordgo.MessageReactionAdd) {
 }
 
 type memberExp struct {
+	EventID       string    `json:"event_id"`
 	GuildID       string    `json:"guild_id"`
 	MemberID      string    `json:"member_id"`
 	Avatar        string    `json:"avatar"`
@@ -344,9 +402,7 @@ type memberExp struct {
 }
 
 const (
-	discordMemberLockKeyPrefix = "discord_member_lock"
-	discordMemberLockTimeout   = time.Second * 20
-	calculateMemberExpTimeout  = time.Second * 25
+	calculateMemberExpTimeout = time.Second * 25
 )
 
 func calculateDiscordMemberExp(msg *types.Message) (deleteMsg bool, err error) {
@@ -362,56 +418,56 @@ func calculateDiscordMemberExp(msg *types.Message) (deleteMsg bool, err error) {
 		log.Error(errors.ErrorfAndReport("invalid sqs message %v", *msg.Body))
 		return true, nil
 	}
-	// 锁定当前用户
-	lockKey := fmt.Sprintf("%v:%v:%v", discordMemberLockKeyPrefix, exp.GuildID, exp.MemberID)
-	set, err := cache.Redis.SetNX(ctx, lockKey, 1, discordMemberLockTimeout).Result()
-	if err != nil {
-		return false, errors.WrapfAndReport(err, "lock discord member")
+	// 没有事件ID的旧消息使用SQS消息ID去重
+	if exp.EventID == "" && msg.MessageId != nil {
+		exp.EventID = "sqs:" + *msg.MessageId
 	}
-	if !set {
-		return false, nil
+	event := &database.DiscordExpEvents{
+		EventID:   exp.EventID,
+		GuildID:   exp.GuildID,
+		DiscordID: exp.MemberID,
+		Action:    exp.Action,
+		Exp:       exp.Exp,
+		CreatedAt: exp.CreatedAt,
 	}
-	// 获取discord用户并刷新其等级与经验
-	member, err := database.DiscordMember{}.SelectOne(exp.GuildID, exp.MemberID)
-	if err != nil {
+	profile := &database.DiscordMember{
+		Avatar:        exp.Avatar,
+		Discriminator: exp.Discriminator,
+		Username:      exp.Username,
+	}
+	if _, err := applyMemberExp(ctx, event, profile); err != nil {
 		return false, err
 	}
-	if member == nil {
-		member = &database.DiscordMember{
-			GuildID:   exp.GuildID,
-			DiscordID: exp.MemberID,
-			JoinedAt:  exp.CreatedAt,
-		}
+	return true, nil
+}
+
+// applyMemberExp 所有经验变动的入口，流水入账后等级提升时发放奖励，等级下降时收回等级角色，重复的事件不做处理
+func applyMemberExp(ctx context.Context, event *database.DiscordExpEvents, profile *database.DiscordMember) (*database.DiscordExpResult, error) {
+	settings, err := database.DiscordLevelSettings{}.SelectOne(event.GuildID)
+	if err != nil {
+		return nil, err
 	}
-	switch exp.Action {
-	case discordReactionKey:
-		member.ExpComponentReactionExp += exp.Exp
-		member.ExpComponentReactionNum++
-	case discordInteractionKey:
-		member.ExpComponentInteractionExp += exp.Exp
-		member.ExpComponentInteractionNum++
-	case discordSendMessageKey:
-		member.ExpComponentMessageExp += exp.Exp
-		member.ExpComponentMessageNum++
-	}
-	member.Avatar = exp.Avatar
-	member.Discriminator = exp.Discriminator
-	member.Username = exp.Username
-	member.Exp += exp.Exp
-	member.TotalExp += exp.Exp
-	member.LeftAt = nil
-	member.UpdatedAt = time.Now()
-	if err := member.Update(); err != nil {
-		return false, err
+	result, err := event.Apply(profile, settings)
+	if err != nil {
+		return nil, err
 	}
-	// 尝试删除用户锁定
-	if err := cache.Redis.Del(ctx, lockKey).Err(); err != nil {
-		log.Error(errors.WrapAndReport(err, "delete discord member lock"))
+	if result.Duplicated {
+		log.Debugf("Skip duplicated exp event %v", event.EventID)
+		return result, nil
 	}
-
-	// 刷新用户的等级stat
-	//log.Debugf("add %v exp to guild %v member %v", exp.Exp, exp.GuildID, exp.MemberID)
-	return true, nil
+	switch {
+	case result.Member == nil:
+	case result.Member.Level > result.FromLevel:
+		onMemberLevelUp(ctx, &memberLevelUp{
+			Member:   result.Member,
+			Settings: settings,
+			From:     result.FromLevel,
+			To:       result.Member.Level,
+		})
+	case result.Member.Level < result.FromLevel:
+		onMemberLevelDown(result.Member, result.FromLevel, result.Member.Level)
+	}
+	return result, nil
 }
 
 type userCommunityQuestTrigger string
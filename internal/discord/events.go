@@ -0,0 +1,241 @@
+package discord
+
+import (
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"moff.io/moff-social/internal/database"
+	"moff.io/moff-social/pkg/errors"
+	"moff.io/moff-social/pkg/log"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	listEventsPage         = "events_page:"
+	defaultListEventsCount = 10
+	// 单条消息所有嵌入的字符总数上限
+	maxMessageEmbedsLength = 6000
+	maxEmbedDescLength     = 4096
+	maxCustomIDLength      = 100
+)
+
+// eventsQuery /events的查询条件及页码，翻页按钮的custom id保存同样的条件
+type eventsQuery struct {
+	database.CampaignEventsFilter
+	Page int
+}
+
+// customID 游戏条件超出custom id长度时按字符截断，其他条件超出时返回错误
+func (in *eventsQuery) customID(page int) (string, error) {
+	status := "o"
+	if in.Upcoming {
+		status = "u"
+	}
+	customID := fmt.Sprintf("%v%v:%v:%v:", listEventsPage, status, page, in.AppID)
+	if len(customID) > maxCustomIDLength {
+		return "", errors.Errorf("events page custom id %v too long", customID)
+	}
+	game := in.Game
+	if end := maxCustomIDLength - len(customID); len(game) > end {
+		// 截断位置不能落在多字节字符中间
+		for end > 0 && !utf8.RuneStart(game[end]) {
+			end--
+		}
+		game = game[:end]
+	}
+	return customID + game, nil
+}
+
+func parseEventsQuery(customID string) (*eventsQuery, error) {
+	parts := strings.SplitN(strings.TrimPrefix(customID, listEventsPage), ":", 4)
+	if len(parts) != 4 {
+		return nil, errors.Errorf("invalid events page %v", customID)
+	}
+	page, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return nil, errors.Wrap(err, "parse events page")
+	}
+	return &eventsQuery{
+		CampaignEventsFilter: database.CampaignEventsFilter{
+			Upcoming: parts[0] == "u",
+			AppID:    parts[2],
+			Game:     parts[3],
+		},
+		Page: page,
+	}, nil
+}
+
+func listmoffEventsCommandHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	defer logHandlerDuration("list moff events", time.Now())
+	query := &eventsQuery{Page: 1}
+	for _, option := range i.ApplicationCommandData().Options {
+		switch option.Name {
+		case "upcoming":
+			query.Upcoming = option.BoolValue()
+		case "ongoing":
+			query.Upcoming = !option.BoolValue()
+		case "game":
+			query.Game = strings.TrimSpace(option.StringValue())
+		case "app-id":
+			query.AppID = strings.TrimSpace(option.StringValue())
+		}
+	}
+	// 快速响应，等待后续响应用户
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		log.Error(errors.WrapAndReport(err, "quick response to list events"))
+		return
+	}
+	respondEvents(s, i, query)
+}
+
+func listEventsPagination(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	defer logHandlerDuration("list moff events pagination", time.Now())
+	query, err := parseEventsQuery(i.MessageComponentData().CustomID)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	// 在原消息上翻页
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredMessageUpdate,
+	})
+	if err != nil {
+		log.Error(errors.WrapAndReport(err, "quick response to list events pagination"))
+		return
+	}
+	respondEvents(s, i, query)
+}
+
+func respondEvents(s *discordgo.Session, i *discordgo.InteractionCreate, query *eventsQuery) {
+	// 白标应用的服务器只展示该应用的活动
+	app, err := database.WhiteLabelingApps{}.SelectOne(i.GuildID)
+	if err != nil {
+		log.Error(err)
+		interactionResponseEditOnError(s, i)
+		return
+	}
+	if app != nil && app.AppID != "" {
+		query.AppID = app.AppID
+	}
+	if query.Page < 1 {
+		query.Page = 1
+	}
+	offset := (query.Page - 1) * defaultListEventsCount
+	campaigns, err := database.Campaigns{}.QueryEvents(&query.CampaignEventsFilter, defaultListEventsCount+1, offset)
+	if err != nil {
+		log.Error(err)
+		interactionResponseEditOnError(s, i)
+		return
+	}
+	hasNextPage := len(campaigns) > defaultListEventsCount
+	if hasNextPage {
+		campaigns = campaigns[:defaultListEventsCount]
+	}
+
+	title, header := "Ongoing events on moff.io", "These are the ongoing events on moff.io! Come check on here :"
+	if query.Upcoming {
+		title, header = "Upcoming events on moff.io", "These are the upcoming events on moff.io! Come check on here :"
+	}
+	if query.Game != "" {
+		header += fmt.Sprintf("\nGame: `%v`", query.Game)
+	}
+	var entries []string
+	for _, campaign := range campaigns {
+		eventLink := fmt.Sprintf("https://moff.io/events?campaign_id=%v", campaign.CampaignID)
+		date := fmt.Sprintf("End in <t:%v:f>", campaign.EndDate/1000)
+		if query.Upcoming {
+			date = fmt.Sprintf("Start in <t:%v:f>", campaign.StartDate/1000)
+		}
+		entries = append(entries, fmt.Sprintf("\n\n**[%v](%v)** | %v | %v %v", campaign.Name, eventLink,
+			ellipsis(strings.ReplaceAll(campaign.DescriptionText, "\n", " "), 200), date, newDiscordEmoji().Random()))
+	}
+	if len(entries) == 0 {
+		header = "No events found, check moff official website please :hushed:"
+		if query.Page > 1 {
+			header = "No more events on this page :hushed:"
+		}
+	}
+	var embeds []*discordgo.MessageEmbed
+	for idx, desc := range splitEmbedDescriptions(header, entries, len(title)) {
+		embed := &discordgo.MessageEmbed{
+			Type:        discordgo.EmbedTypeImage,
+			Description: desc,
+			// 嵌入的左边栏的颜色，最左方的竖条
+			Color: 6095103,
+		}
+		// 仅第一个嵌入展示标题及作者
+		if idx == 0 {
+			embed.Title = title
+			embed.URL = "https://moff.io/events"
+			embed.Author = moffAuthor
+		}
+		embeds = append(embeds, embed)
+	}
+	components := []discordgo.MessageComponent{}
+	if query.Page > 1 || hasNextPage {
+		prevID, err := query.customID(query.Page - 1)
+		var nextID string
+		if err == nil {
+			nextID, err = query.customID(query.Page + 1)
+		}
+		if err != nil {
+			// 条件过长无法翻页时仅展示当前页
+			log.Warn(err)
+		} else {
+			components = append(components, discordgo.ActionsRow{
+				Components: []discordgo.MessageComponent{
+					discordgo.Button{
+						Style:    discordgo.PrimaryButton,
+						Label:    "Prev page",
+						CustomID: prevID,
+						Disabled: query.Page <= 1,
+					},
+					discordgo.Button{
+						Style:    discordgo.PrimaryButton,
+						Label:    "Next page",
+						CustomID: nextID,
+						Disabled: !hasNextPage,
+					},
+				},
+			})
+		}
+	}
+	_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Embeds:     &embeds,
+		Components: &components,
+	})
+	if err != nil {
+		log.Error(errors.WrapAndReport(err, "respond list events"))
+		interactionResponseEditOnError(s, i)
+	}
+}
+
+// splitEmbedDescriptions 将条目拆分到多个嵌入，单个嵌入不超过4096字符，
+// 所有嵌入合计不超过6000字符，超出的条目不再展示
+func splitEmbedDescriptions(header string, entries []string, reserved int) []string {
+	var (
+		descs = []string{header}
+		total = reserved + len(header)
+	)
+	for _, entry := range entries {
+		if total+len(entry) > maxMessageEmbedsLength {
+			break
+		}
+		total += len(entry)
+		last := len(descs) - 1
+		if len(descs[last])+len(entry) > maxEmbedDescLength {
+			descs = append(descs, strings.TrimPrefix(entry, "\n\n"))
+			continue
+		}
+		descs[last] += entry
+	}
+	return descs
+}
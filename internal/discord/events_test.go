@@ -0,0 +1,57 @@
+package discord
+
+import (
+	"moff.io/moff-social/internal/database"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestEventsQueryCustomID(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   eventsQuery
+		page    int
+		want    string
+		wantErr bool
+	}{
+		{name: "empty", page: 1, want: "events_page:o:1::"},
+		{name: "filters", query: eventsQuery{CampaignEventsFilter: database.CampaignEventsFilter{
+			Upcoming: true, AppID: "app", Game: "moff"}}, page: 2, want: "events_page:u:2:app:moff"},
+		{name: "long game", query: eventsQuery{CampaignEventsFilter: database.CampaignEventsFilter{
+			Game: strings.Repeat("g", 200)}}, page: 1, want: "events_page:o:1::" + strings.Repeat("g", 83)},
+		{name: "long app without game", query: eventsQuery{CampaignEventsFilter: database.CampaignEventsFilter{
+			AppID: strings.Repeat("a", 100)}}, page: 1, wantErr: true},
+		{name: "long app with game", query: eventsQuery{CampaignEventsFilter: database.CampaignEventsFilter{
+			AppID: strings.Repeat("a", 100), Game: "moff"}}, page: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.query.customID(tt.page)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("customID() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("customID() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEventsQueryCustomIDMultiByte(t *testing.T) {
+	query := eventsQuery{CampaignEventsFilter: database.CampaignEventsFilter{Game: strings.Repeat("游戏", 30)}}
+	got, err := query.customID(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) > maxCustomIDLength || !utf8.ValidString(got) {
+		t.Errorf("customID() = %q, want valid utf8 within %v bytes", got, maxCustomIDLength)
+	}
+	parsed, err := parseEventsQuery(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(query.Game, parsed.Game) || parsed.Game == "" {
+		t.Errorf("parseEventsQuery().Game = %q, want prefix of %q", parsed.Game, query.Game)
+	}
+}
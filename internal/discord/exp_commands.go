@@ -0,0 +1,226 @@
+package discord
+
+import (
+	"context"
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"moff.io/moff-social/internal/database"
+	"moff.io/moff-social/pkg/errors"
+	"moff.io/moff-social/pkg/log"
+	"strings"
+)
+
+const (
+	defaultExpHistoryCount = 20
+)
+
+var (
+	expCommandActions = map[string]string{
+		"give":  database.DiscordExpActionAdminGrant,
+		"take":  database.DiscordExpActionAdminTake,
+		"set":   database.DiscordExpActionAdminSet,
+		"reset": database.DiscordExpActionAdminReset,
+	}
+	expActionNames = map[string]string{
+		database.DiscordExpActionReaction:       "Reaction",
+		database.DiscordExpActionInteraction:    "Interaction",
+		database.DiscordExpActionMessage:        "Message",
+		database.DiscordExpActionVoice:          "Voice",
+		database.DiscordExpActionDecay:          "Decay",
+		database.DiscordExpActionAdminGrant:     "Manual",
+		database.DiscordExpActionAdminTake:      "Taken",
+		database.DiscordExpActionAdminRevoke:    "Revoke",
+		database.DiscordExpActionAdminSet:       "Set",
+		database.DiscordExpActionAdminReset:     "Reset",
+		database.DiscordExpActionOpeningBalance: "Opening balance",
+	}
+)
+
+// isExpManager 管理员或拥有经验管理角色的成员可以调整经验
+func isExpManager(member *discordgo.Member, guildID string) (bool, error) {
+	if IsAdminPermission(member.Permissions) {
+		return true, nil
+	}
+	roles, err := database.DiscordExpManagerRoles{}.SelectByGuild(guildID)
+	if err != nil {
+		return false, err
+	}
+	for _, role := range roles {
+		for _, memberRole := range member.Roles {
+			if role.RoleID == memberRole {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// expCommandHandler 调整成员经验、撤销流水、重新计算及查看经验流水
+func expCommandHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	options := i.ApplicationCommandData().Options
+	if len(options) == 0 {
+		return
+	}
+	allowed, err := isExpManager(i.Member, i.GuildID)
+	if err != nil {
+		log.Error(err)
+		respondSnapshotError(s, i, "Unknown error")
+		return
+	}
+	if !allowed {
+		respondSnapshotError(s, i, "Not allowed:thinking: ")
+		return
+	}
+	subcommand := options[0]
+	switch subcommand.Name {
+	case "history":
+		respondExpHistory(s, i, subcommand.Options)
+	case "revoke":
+		revokeExpLedger(s, i, subcommand.Options)
+	case "recompute":
+		recomputeExpLedger(s, i, subcommand.Options)
+	default:
+		adjustMemberExp(s, i, subcommand)
+	}
+}
+
+// adjustMemberExp 与SQS经验消费者相同，通过流水写入并发放升级奖励
+func adjustMemberExp(s *discordgo.Session, i *discordgo.InteractionCreate, subcommand *discordgo.ApplicationCommandInteractionDataOption) {
+	var (
+		user     *discordgo.User
+		amount   int
+		reason   string
+		announce bool
+	)
+	for _, option := range subcommand.Options {
+		switch option.Name {
+		case "user":
+			user = option.UserValue(s)
+		case "amount":
+			amount = int(option.IntValue())
+		case "reason":
+			reason = strings.TrimSpace(option.StringValue())
+		case "announce":
+			announce = option.BoolValue()
+		}
+	}
+	if user == nil {
+		return
+	}
+	if user.Bot {
+		respondSnapshotError(s, i, "Bots can't earn exp")
+		return
+	}
+	event := &database.DiscordExpEvents{
+		EventID:    fmt.Sprintf("%v:%v", subcommand.Name, i.ID),
+		GuildID:    i.GuildID,
+		DiscordID:  user.ID,
+		Action:     expCommandActions[subcommand.Name],
+		OperatorID: i.Member.User.ID,
+		Reason:     ellipsis(reason, 490),
+	}
+	if amount == 0 && (subcommand.Name == "give" || subcommand.Name == "take") {
+		respondSnapshotError(s, i, "Please provide an amount greater than 0")
+		return
+	}
+	switch subcommand.Name {
+	case "give":
+		event.Exp = amount
+	case "take":
+		event.Exp = -amount
+	case "set":
+		event.TargetExp = &amount
+	case "reset":
+		event.TargetExp = new(int)
+	}
+	profile := &database.DiscordMember{
+		Avatar:        user.Avatar,
+		Discriminator: user.Discriminator,
+		Username:      user.Username,
+	}
+	result, err := applyMemberExp(context.TODO(), event, profile)
+	if err != nil {
+		log.Error(err)
+		respondSnapshotError(s, i, "Unknown error")
+		return
+	}
+	respondLevelSettings(s, i, "Exp updated", expLedgerResultDesc(event, result))
+	if announce && event.Exp != 0 && result.Member != nil {
+		if err := announceExpAdjustment(i, event, result); err != nil {
+			log.Error(err)
+		}
+	}
+}
+
+// announceExpAdjustment 在升级公告频道公开经验调整，未设置时在当前频道公告
+func announceExpAdjustment(i *discordgo.InteractionCreate, event *database.DiscordExpEvents, result *database.DiscordExpResult) error {
+	settings, err := database.DiscordLevelSettings{}.SelectOne(i.GuildID)
+	if err != nil {
+		return err
+	}
+	channelID := settings.AnnounceChannelID
+	if channelID == "" {
+		channelID = i.ChannelID
+	}
+	desc := fmt.Sprintf("<@%v> received **%+d** exp from <@%v>", event.DiscordID, event.Exp, event.OperatorID)
+	if event.Exp < 0 {
+		desc = fmt.Sprintf("<@%v> lost **%v** exp by <@%v>", event.DiscordID, -event.Exp, event.OperatorID)
+	}
+	if event.Reason != "" {
+		desc += fmt.Sprintf("\n\n**Reason**:%v", event.Reason)
+	}
+	desc += fmt.Sprintf("\n\nNow level **%v**", result.Member.Level)
+	_, err = session.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+		Content: fmt.Sprintf("<@%v>", event.DiscordID),
+		Embeds: []*discordgo.MessageEmbed{
+			{
+				Title:       "✨ Exp update",
+				Description: desc,
+				Color:       6095103,
+				Author:      moffAuthor,
+			},
+		},
+		AllowedMentions: &discordgo.MessageAllowedMentions{
+			Users: []string{event.DiscordID},
+		},
+	})
+	return errors.WrapAndReport(err, "announce exp adjustment")
+}
+
+func respondExpHistory(s *discordgo.Session, i *discordgo.InteractionCreate, options []*discordgo.ApplicationCommandInteractionDataOption) {
+	var user *discordgo.User
+	for _, option := range options {
+		if option.Name == "user" {
+			user = option.UserValue(s)
+		}
+	}
+	if user == nil {
+		return
+	}
+	events, err := database.DiscordExpEvents{}.SelectByMember(i.GuildID, user.ID, defaultExpHistoryCount)
+	if err != nil {
+		log.Error(err)
+		respondSnapshotError(s, i, "Unknown error")
+		return
+	}
+	var lines []string
+	for _, event := range events {
+		name := expActionNames[event.Action]
+		if name == "" {
+			name = event.Action
+		}
+		line := fmt.Sprintf("<t:%v:d> **%+d** %v `%v`", event.CreatedAt.Unix(), event.Exp, name, event.EventID)
+		if event.OperatorID != "" {
+			line += fmt.Sprintf(" by <@%v>", event.OperatorID)
+		}
+		if event.Reason != "" {
+			line += fmt.Sprintf("\n　%v", ellipsis(event.Reason, 100))
+		}
+		lines = append(lines, line)
+	}
+	desc := "There is no exp history for now.."
+	if len(lines) > 0 {
+		desc = fmt.Sprintf("Latest %v exp changes of <@%v>\n\n", len(lines), user.ID) + strings.Join(lines, "\n")
+	}
+	respondLevelSettings(s, i, fmt.Sprintf("%v's exp history", user.Username), ellipsis(desc, 4090))
+}
@@ -0,0 +1,195 @@
+package discord
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"moff.io/moff-social/internal/chart"
+	"moff.io/moff-social/internal/database"
+	"moff.io/moff-social/pkg/errors"
+	"moff.io/moff-social/pkg/log"
+	"time"
+)
+
+const (
+	expWindowAll     = "all"
+	expWindowMonthly = "monthly"
+	expWindowWeekly  = "weekly"
+
+	defaultExpLeaderboardCount = 20
+)
+
+var expWindowChoices = []*discordgo.ApplicationCommandOptionChoice{
+	{Name: "All time", Value: expWindowAll},
+	{Name: "This month", Value: expWindowMonthly},
+	{Name: "This week", Value: expWindowWeekly},
+}
+
+// expWindowSince 时间段的开始时间，按UTC自然月及自然周(周一开始)统计，全部时间返回nil
+func expWindowSince(window string, now time.Time) *time.Time {
+	now = now.UTC()
+	var since time.Time
+	switch window {
+	case expWindowMonthly:
+		since = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	case expWindowWeekly:
+		weekday := (int(now.Weekday()) + 6) % 7
+		since = time.Date(now.Year(), now.Month(), now.Day()-weekday, 0, 0, 0, 0, time.UTC)
+	default:
+		return nil
+	}
+	return &since
+}
+
+func expWindowTitle(window string) string {
+	switch window {
+	case expWindowMonthly:
+		return "This month's exp leaderboard"
+	case expWindowWeekly:
+		return "This week's exp leaderboard"
+	default:
+		return "All time exp leaderboard"
+	}
+}
+
+func leaderboardCommandHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	options := i.ApplicationCommandData().Options
+	if len(options) == 0 {
+		return
+	}
+	switch options[0].Name {
+	case "exp":
+		window := expWindowAll
+		for _, option := range options[0].Options {
+			if option.Name == "window" {
+				window = option.StringValue()
+			}
+		}
+		respondExpLeaderboard(s, i, window)
+	}
+}
+
+func respondExpLeaderboard(s *discordgo.Session, i *discordgo.InteractionCreate, window string) {
+	defer logHandlerDuration("exp leaderboard", time.Now())
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		log.Error(errors.WrapAndReport(err, "quick response to exp leaderboard"))
+		return
+	}
+	since := expWindowSince(window, time.Now())
+	leaderboard, err := database.DiscordExpEvents{}.QueryLeaderboard(i.GuildID, since, 0, defaultExpLeaderboardCount)
+	if err != nil {
+		log.Error(err)
+		interactionResponseEditOnError(s, i)
+		return
+	}
+	rank, exp, err := database.DiscordExpEvents{}.QueryRank(i.GuildID, i.Member.User.ID, since)
+	if err != nil {
+		log.Error(err)
+		interactionResponseEditOnError(s, i)
+		return
+	}
+	content := fmt.Sprintf("TOP %v members by exp", defaultExpLeaderboardCount)
+	if since != nil {
+		content += fmt.Sprintf(" since <t:%v:D>", since.Unix())
+	}
+	content += ".\n"
+	if len(leaderboard) == 0 {
+		content += "\nNo one has earned exp yet, start chatting!"
+	}
+	for idx, l := range leaderboard {
+		content += fmt.Sprintf("\n**%v** | <@%v> -> **%v** exp", idx+1, l.DiscordID, l.Exp)
+	}
+	footer := "You haven't earned exp yet"
+	if rank > 0 {
+		footer = fmt.Sprintf("You're #%v with %v exp", rank, exp)
+	}
+	_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Embeds: &[]*discordgo.MessageEmbed{
+			{
+				Title:       expWindowTitle(window),
+				Description: content,
+				Color:       6095103,
+				Author:      moffAuthor,
+				Footer: &discordgo.MessageEmbedFooter{
+					Text: footer,
+				},
+			},
+		},
+	})
+	if err != nil {
+		log.Error(errors.WrapAndReport(err, "exp leaderboard response edit"))
+	}
+}
+
+// rankCommandHandler 渲染成员的等级卡片，默认为自己
+func rankCommandHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	defer logHandlerDuration("rank command", time.Now())
+	user := i.Member.User
+	for _, option := range i.ApplicationCommandData().Options {
+		if option.Name == "user" {
+			user = option.UserValue(s)
+		}
+	}
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+	if err != nil {
+		log.Error(errors.WrapAndReport(err, "quick response to rank command"))
+		return
+	}
+	member, err := database.DiscordMember{}.SelectOne(i.GuildID, user.ID)
+	if err != nil {
+		log.Error(err)
+		interactionResponseEditOnError(s, i)
+		return
+	}
+	settings, err := database.DiscordLevelSettings{}.SelectOne(i.GuildID)
+	if err != nil {
+		log.Error(err)
+		interactionResponseEditOnError(s, i)
+		return
+	}
+	card := chart.RankCard{
+		Username: user.Username,
+	}
+	if member != nil {
+		card.Level, card.Exp = settings.Level(member.TotalExp)
+	}
+	card.ExpToLevelUp = settings.ExpToLevelUp(card.Level)
+	card.Rank, _, err = database.DiscordExpEvents{}.QueryRank(i.GuildID, user.ID, nil)
+	if err != nil {
+		log.Error(err)
+		interactionResponseEditOnError(s, i)
+		return
+	}
+	// 头像获取失败时使用默认头像
+	if avatar, err := s.UserAvatarDecode(user); err != nil {
+		log.Warnf("Decode user %v avatar:%v", user.ID, err)
+	} else {
+		card.Avatar = avatar
+	}
+	var buf bytes.Buffer
+	if err := card.Render(&buf); err != nil {
+		log.Error(err)
+		interactionResponseEditOnError(s, i)
+		return
+	}
+	_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Files: []*discordgo.File{
+			{
+				Name:        "rank.png",
+				ContentType: "image/png",
+				Reader:      &buf,
+			},
+		},
+	})
+	if err != nil {
+		log.Error(errors.WrapAndReport(err, "respond rank card"))
+	}
+}
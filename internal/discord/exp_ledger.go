@@ -0,0 +1,120 @@
+package discord
+
+import (
+	"context"
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"moff.io/moff-social/internal/database"
+	"moff.io/moff-social/pkg/errors"
+	"moff.io/moff-social/pkg/log"
+	"strings"
+	"time"
+)
+
+// revokeExpLedger 追加一条抵消流水撤销指定事件，同一事件只能撤销一次
+func revokeExpLedger(s *discordgo.Session, i *discordgo.InteractionCreate, options []*discordgo.ApplicationCommandInteractionDataOption) {
+	var eventID, reason string
+	for _, option := range options {
+		switch option.Name {
+		case "event-id":
+			eventID = strings.TrimSpace(option.StringValue())
+		case "reason":
+			reason = strings.TrimSpace(option.StringValue())
+		}
+	}
+	original, err := database.DiscordExpEvents{}.SelectOne(eventID)
+	if err != nil {
+		log.Error(err)
+		respondSnapshotError(s, i, "Unknown error")
+		return
+	}
+	if original == nil || original.GuildID != i.GuildID {
+		respondSnapshotError(s, i, fmt.Sprintf("Exp event `%v` not found", eventID))
+		return
+	}
+	if original.Exp == 0 {
+		respondSnapshotError(s, i, fmt.Sprintf("Exp event `%v` changed no exp", eventID))
+		return
+	}
+	event := &database.DiscordExpEvents{
+		EventID:    "revoke:" + original.EventID,
+		GuildID:    original.GuildID,
+		DiscordID:  original.DiscordID,
+		Action:     database.DiscordExpActionAdminRevoke,
+		Exp:        -original.Exp,
+		OperatorID: i.Member.User.ID,
+		Reason:     ellipsis(reason, 490),
+	}
+	result, err := applyMemberExp(context.TODO(), event, &database.DiscordMember{})
+	if err != nil {
+		log.Error(err)
+		respondSnapshotError(s, i, "Unknown error")
+		return
+	}
+	if result.Duplicated {
+		respondSnapshotError(s, i, fmt.Sprintf("Exp event `%v` has already been revoked", eventID))
+		return
+	}
+	respondLevelSettings(s, i, "Exp revoked", expLedgerResultDesc(event, result))
+}
+
+func recomputeExpLedger(s *discordgo.Session, i *discordgo.InteractionCreate, options []*discordgo.ApplicationCommandInteractionDataOption) {
+	defer logHandlerDuration("recompute exp ledger", time.Now())
+	var discordID string
+	for _, option := range options {
+		if option.Name == "user" {
+			discordID = option.UserValue(nil).ID
+		}
+	}
+	// 重新计算整个服务器可能较慢，先响应
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		log.Error(errors.WrapAndReport(err, "quick response to recompute exp"))
+		return
+	}
+	settings, err := database.DiscordLevelSettings{}.SelectOne(i.GuildID)
+	if err != nil {
+		log.Error(err)
+		interactionResponseEditOnError(s, i)
+		return
+	}
+	corrected, err := database.DiscordExpEvents{}.Recompute(i.GuildID, discordID, settings)
+	if err != nil {
+		log.Error(err)
+		respondEditSnapshotError(s, i, fmt.Sprintf("Recompute failed after correcting %v members", corrected))
+		return
+	}
+	target := "all members"
+	if discordID != "" {
+		target = fmt.Sprintf("<@%v>", discordID)
+	}
+	_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Embeds: &[]*discordgo.MessageEmbed{
+			{
+				Title:       "Exp recomputed",
+				Description: fmt.Sprintf("Recomputed exp of %v from the ledger, %v members corrected.", target, corrected),
+				Color:       6095103,
+				Author:      moffAuthor,
+			},
+		},
+	})
+	if err != nil {
+		log.Error(errors.WrapAndReport(err, "recompute exp response edit"))
+	}
+}
+
+func expLedgerResultDesc(event *database.DiscordExpEvents, result *database.DiscordExpResult) string {
+	desc := fmt.Sprintf("**Member**:<@%v>\n**Exp**:%+d\n**Event**:`%v`", event.DiscordID, event.Exp, event.EventID)
+	if event.Reason != "" {
+		desc += fmt.Sprintf("\n**Reason**:%v", event.Reason)
+	}
+	if result.Member != nil {
+		desc += fmt.Sprintf("\n\nNow level **%v** with %v total exp", result.Member.Level, result.Member.TotalExp)
+	}
+	return desc
+}
@@ -0,0 +1,294 @@
+package discord
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"moff.io/moff-social/internal/aws"
+	"moff.io/moff-social/internal/cache"
+	"moff.io/moff-social/internal/config"
+	"moff.io/moff-social/internal/database"
+	"moff.io/moff-social/pkg/errors"
+	"moff.io/moff-social/pkg/log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	expPolicyCacheTTL = time.Minute * 5
+	// 保存成员最近的消息用于刷屏检测
+	expRecentMessagesKeyPrefix = "exp:recent_messages"
+	expRecentMessagesCount     = 5
+	expRecentMessagesTTL       = time.Hour
+
+	expDecayCheckInterval = time.Hour
+	expDecayInterval      = time.Hour * 24
+	expDecayBatchSize     = 500
+)
+
+var (
+	guildExpPoliciesLock sync.RWMutex
+	guildExpPolicies     = make(map[string]*guildExpPolicy)
+)
+
+// guildExpPolicy 内存中缓存的服务器经验策略及频道、角色倍数
+type guildExpPolicy struct {
+	*database.DiscordExpPolicies
+	channels map[string]float64
+	roles    map[string]float64
+	expireAt time.Time
+}
+
+func loadGuildExpPolicy(guildID string) (*guildExpPolicy, error) {
+	guildExpPoliciesLock.RLock()
+	policy := guildExpPolicies[guildID]
+	guildExpPoliciesLock.RUnlock()
+	if policy != nil && time.Now().Before(policy.expireAt) {
+		return policy, nil
+	}
+
+	settings, err := database.DiscordExpPolicies{}.SelectOne(guildID)
+	if err != nil {
+		return nil, err
+	}
+	multipliers, err := database.DiscordExpMultipliers{}.SelectByGuild(guildID)
+	if err != nil {
+		return nil, err
+	}
+	policy = &guildExpPolicy{
+		DiscordExpPolicies: settings,
+		channels:           make(map[string]float64),
+		roles:              make(map[string]float64),
+		expireAt:           time.Now().Add(expPolicyCacheTTL),
+	}
+	for _, m := range multipliers {
+		switch m.TargetType {
+		case database.DiscordExpMultiplierChannel:
+			policy.channels[m.TargetID] = m.Multiplier
+		case database.DiscordExpMultiplierRole:
+			policy.roles[m.TargetID] = m.Multiplier
+		}
+	}
+	guildExpPoliciesLock.Lock()
+	guildExpPolicies[guildID] = policy
+	guildExpPoliciesLock.Unlock()
+	return policy, nil
+}
+
+// invalidateGuildExpPolicy 策略修改后立即生效
+func invalidateGuildExpPolicy(guildID string) {
+	guildExpPoliciesLock.Lock()
+	defer guildExpPoliciesLock.Unlock()
+	delete(guildExpPolicies, guildID)
+}
+
+// channelMultiplier 子区及频道未设置时沿用父频道或分类的倍数
+func (in *guildExpPolicy) channelMultiplier(channelID string) float64 {
+	if m, ok := in.channels[channelID]; ok {
+		return m
+	}
+	if session != nil {
+		if channel, err := session.State.Channel(channelID); err == nil && channel.ParentID != "" {
+			if m, ok := in.channels[channel.ParentID]; ok {
+				return m
+			}
+		}
+	}
+	return 1
+}
+
+// multiplier 频道倍数、成员角色中最高的倍数及活动倍数相乘
+func (in *guildExpPolicy) multiplier(channelID string, roles []string, now time.Time) float64 {
+	multiplier := in.channelMultiplier(channelID)
+	if multiplier <= 0 {
+		return 0
+	}
+	var (
+		roleMultiplier float64
+		found          bool
+	)
+	for _, role := range roles {
+		if m, ok := in.roles[role]; ok && (!found || m > roleMultiplier) {
+			roleMultiplier, found = m, true
+		}
+	}
+	if found {
+		multiplier *= roleMultiplier
+	}
+	return multiplier * in.ActiveEventMultiplier(now)
+}
+
+// applyExpPolicy 按服务器策略计算成员本次获得的经验，忽略的频道及刷屏消息返回0，策略查询失败时按默认经验计算
+func applyExpPolicy(ctx context.Context, action memberExpAction) int {
+	exp := action.Exp()
+	policy, err := loadGuildExpPolicy(action.Guild())
+	if err != nil {
+		log.Error(err)
+		return exp
+	}
+	multiplier := policy.multiplier(action.Channel(), action.Member().Roles, time.Now())
+	if multiplier <= 0 {
+		return 0
+	}
+	if message, ok := action.(*discordSendMessage); ok && policy.SimilarityThreshold > 0 {
+		spam, err := isSpamMessage(ctx, action.Guild(), message.Author.ID, message.Content, policy.SimilarityThreshold)
+		if err != nil {
+			log.Error(err)
+		} else if spam {
+			return 0
+		}
+	}
+	return int(math.Round(float64(exp) * multiplier))
+}
+
+// isSpamMessage 消息与成员最近的任一消息相似度达到阈值时视为刷屏，检查后记录当前消息
+func isSpamMessage(ctx context.Context, guildID, memberID, content string, threshold float64) (bool, error) {
+	key := fmt.Sprintf("%v:%v:%v", expRecentMessagesKeyPrefix, guildID, memberID)
+	content = normalizeExpMessage(content)
+	recent, err := cache.Redis.LRange(ctx, key, 0, expRecentMessagesCount-1).Result()
+	if err != nil {
+		return false, errors.WrapAndReport(err, "query member recent messages")
+	}
+	pipe := cache.Redis.TxPipeline()
+	pipe.LPush(ctx, key, content)
+	pipe.LTrim(ctx, key, 0, expRecentMessagesCount-1)
+	pipe.Expire(ctx, key, expRecentMessagesTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, errors.WrapAndReport(err, "cache member recent message")
+	}
+	for _, message := range recent {
+		if messageSimilarity(content, message) >= threshold {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func normalizeExpMessage(content string) string {
+	return strings.Join(strings.Fields(strings.ToLower(content)), " ")
+}
+
+// messageSimilarity 基于字符二元组的Dice系数，取值0~1
+func messageSimilarity(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) < 2 || len(rb) < 2 {
+		return 0
+	}
+	bigrams := make(map[string]int)
+	for i := 0; i < len(ra)-1; i++ {
+		bigrams[string(ra[i:i+2])]++
+	}
+	var intersection int
+	for i := 0; i < len(rb)-1; i++ {
+		bigram := string(rb[i : i+2])
+		if bigrams[bigram] > 0 {
+			bigrams[bigram]--
+			intersection++
+		}
+	}
+	return float64(2*intersection) / float64(len(ra)+len(rb)-2)
+}
+
+var (
+	initExpDecayerOnce sync.Once
+	internalExpDecayer *ExpDecayer
+)
+
+// ExpDecayer 每天按服务器策略衰减不活跃成员的经验，衰减通过经验队列计算以保证等级一致
+type ExpDecayer struct{}
+
+func NewExpDecayer() *ExpDecayer {
+	initExpDecayerOnce.Do(func() {
+		internalExpDecayer = &ExpDecayer{}
+	})
+	return internalExpDecayer
+}
+
+func (in *ExpDecayer) Start(ctx context.Context) {
+	go in.start(ctx)
+}
+
+func (in *ExpDecayer) start(ctx context.Context) {
+	ticker := time.NewTicker(expDecayCheckInterval)
+	defer ticker.Stop()
+	log.Infof("Exp decayer running...")
+	defer log.Infof("Exp decayer stopped...")
+	for {
+		select {
+		case <-ticker.C:
+			if err := in.decay(ctx, time.Now()); err != nil {
+				log.Error(err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (in *ExpDecayer) decay(ctx context.Context, now time.Time) error {
+	policies, err := database.DiscordExpPolicies{}.SelectDecayDue(now.Add(-expDecayInterval))
+	if err != nil {
+		return err
+	}
+	for _, policy := range policies {
+		// 衰减事件按天去重，中途失败时下次检查重试
+		if err := in.decayGuild(ctx, policy, now); err != nil {
+			log.Error(err)
+			continue
+		}
+		if err := (database.DiscordExpPolicies{}).UpdateLastDecayAt(policy.GuildID, now); err != nil {
+			log.Error(err)
+		}
+	}
+	return nil
+}
+
+func (in *ExpDecayer) decayGuild(ctx context.Context, policy *database.DiscordExpPolicies, now time.Time) error {
+	before := now.Add(-time.Duration(policy.DecayAfterDays) * time.Hour * 24)
+	var (
+		lastID int64
+		count  int
+	)
+	for {
+		members, err := database.DiscordMember{}.SelectInactive(policy.GuildID, before, lastID, expDecayBatchSize)
+		if err != nil {
+			return err
+		}
+		for _, member := range members {
+			lastID = member.ID
+			decayed := member.TotalExp * policy.DecayPercent / 100
+			if decayed < 1 {
+				decayed = 1
+			}
+			bts, err := json.Marshal(memberExp{
+				EventID:       fmt.Sprintf("decay:%v:%v:%v", member.GuildID, member.DiscordID, now.Format("2006-01-02")),
+				GuildID:       member.GuildID,
+				MemberID:      member.DiscordID,
+				Avatar:        member.Avatar,
+				Discriminator: member.Discriminator,
+				Username:      member.Username,
+				Exp:           -decayed,
+				Action:        database.DiscordExpActionDecay,
+				CreatedAt:     now,
+			})
+			if err != nil {
+				return errors.WrapAndReport(err, "marshal member exp decay")
+			}
+			err = aws.Client.SendMessageToSQS(ctx, config.Global.DiscordBot.MessageQueues.MemberExpQueueURL, string(bts))
+			if err != nil {
+				return err
+			}
+			count++
+		}
+		if len(members) < expDecayBatchSize {
+			break
+		}
+	}
+	log.Infof("Decayed exp of %v inactive members in guild %v", count, policy.GuildID)
+	return nil
+}
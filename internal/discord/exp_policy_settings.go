@@ -0,0 +1,228 @@
+package discord
+
+import (
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"moff.io/moff-social/internal/database"
+	"moff.io/moff-social/pkg/log"
+	"strings"
+	"time"
+)
+
+var (
+	expSimilarityMaxValue float64 = 1
+	expDecayMaxPercent    float64 = 100
+	expMultiplierMaxValue float64 = 10
+)
+
+// manageExpPolicy 设置服务器的经验防刷策略
+func manageExpPolicy(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if !IsAdminPermission(i.Member.Permissions) {
+		respondSnapshotError(s, i, "Not allowed:thinking: ")
+		return
+	}
+	options := i.ApplicationCommandData().Options
+	if len(options) == 0 {
+		return
+	}
+	policy, err := database.DiscordExpPolicies{}.SelectOne(i.GuildID)
+	if err != nil {
+		log.Error(err)
+		respondSnapshotError(s, i, "Unknown error")
+		return
+	}
+	subcommand := options[0]
+	switch subcommand.Name {
+	case "spam":
+		for _, option := range subcommand.Options {
+			if option.Name == "similarity" {
+				policy.SimilarityThreshold = option.FloatValue()
+			}
+		}
+	case "decay":
+		for _, option := range subcommand.Options {
+			switch option.Name {
+			case "after-days":
+				policy.DecayAfterDays = int(option.IntValue())
+			case "percent":
+				policy.DecayPercent = int(option.IntValue())
+			}
+		}
+	case "voice":
+		for _, option := range subcommand.Options {
+			switch option.Name {
+			case "enabled":
+				policy.VoiceDisabled = !option.BoolValue()
+			case "interval-minutes":
+				policy.VoiceIntervalMinutes = int(option.IntValue())
+			case "exp":
+				policy.VoiceExp = int(option.IntValue())
+			case "daily-cap":
+				policy.VoiceDailyCap = int(option.IntValue())
+			}
+		}
+	case "event":
+		var hours int64
+		for _, option := range subcommand.Options {
+			switch option.Name {
+			case "multiplier":
+				policy.EventMultiplier = option.FloatValue()
+			case "hours":
+				hours = option.IntValue()
+			}
+		}
+		// 时长为0时结束当前活动
+		now := time.Now()
+		end := now.Add(time.Duration(hours) * time.Hour)
+		policy.EventStartAt, policy.EventEndAt = &now, &end
+	case "channel", "role":
+		multiplier := &database.DiscordExpMultipliers{
+			GuildID:    i.GuildID,
+			TargetType: database.DiscordExpMultiplierTarget(subcommand.Name),
+			CreatedBy:  i.Member.User.ID,
+		}
+		var remove, ignore, hasMultiplier bool
+		for _, option := range subcommand.Options {
+			switch option.Name {
+			case "channel":
+				multiplier.TargetID = option.ChannelValue(nil).ID
+			case "role":
+				multiplier.TargetID = option.RoleValue(nil, "").ID
+			case "multiplier":
+				multiplier.Multiplier, hasMultiplier = option.FloatValue(), true
+			case "ignore":
+				ignore = option.BoolValue()
+			case "remove":
+				remove = option.BoolValue()
+			}
+		}
+		// 忽略频道即倍数为0
+		if ignore {
+			multiplier.Multiplier, hasMultiplier = 0, true
+		}
+		if !remove && !hasMultiplier {
+			respondSnapshotError(s, i, "Please provide a multiplier")
+			return
+		}
+		if remove {
+			err = multiplier.Delete()
+		} else {
+			err = multiplier.Upsert()
+		}
+		if err != nil {
+			log.Error(err)
+			respondSnapshotError(s, i, "Unknown error")
+			return
+		}
+		invalidateGuildExpPolicy(i.GuildID)
+		respondExpPolicy(s, i, policy)
+		return
+	case "manager-role":
+		role := &database.DiscordExpManagerRoles{
+			GuildID:   i.GuildID,
+			CreatedBy: i.Member.User.ID,
+		}
+		var remove bool
+		for _, option := range subcommand.Options {
+			switch option.Name {
+			case "role":
+				role.RoleID = option.RoleValue(nil, "").ID
+			case "remove":
+				remove = option.BoolValue()
+			}
+		}
+		if remove {
+			err = role.Delete()
+		} else {
+			err = role.Create()
+		}
+		if err != nil {
+			log.Error(err)
+			respondSnapshotError(s, i, "Unknown error")
+			return
+		}
+		respondExpPolicy(s, i, policy)
+		return
+	case "show":
+		respondExpPolicy(s, i, policy)
+		return
+	}
+	policy.UpdatedBy = i.Member.User.ID
+	if err := policy.Upsert(); err != nil {
+		log.Error(err)
+		respondSnapshotError(s, i, "Unknown error")
+		return
+	}
+	invalidateGuildExpPolicy(i.GuildID)
+	respondExpPolicy(s, i, policy)
+}
+
+func respondExpPolicy(s *discordgo.Session, i *discordgo.InteractionCreate, policy *database.DiscordExpPolicies) {
+	multipliers, err := database.DiscordExpMultipliers{}.SelectByGuild(i.GuildID)
+	if err != nil {
+		log.Error(err)
+		respondSnapshotError(s, i, "Unknown error")
+		return
+	}
+	desc := "**Spam detection**:disabled"
+	if policy.SimilarityThreshold > 0 {
+		desc = fmt.Sprintf("**Spam detection**:messages %.0f%% similar to recent ones earn no exp", policy.SimilarityThreshold*100)
+	}
+	if policy.DecayEnabled() {
+		desc += fmt.Sprintf("\n**Decay**:%v%% of exp per day after %v inactive days", policy.DecayPercent, policy.DecayAfterDays)
+	} else {
+		desc += "\n**Decay**:disabled"
+	}
+	if policy.VoiceDisabled {
+		desc += "\n**Voice**:disabled"
+	} else {
+		interval, exp := policy.VoiceIntervalMinutes, "default"
+		if interval <= 0 {
+			interval = defaultVoiceExpIntervalMinutes
+		}
+		if policy.VoiceExp > 0 {
+			exp = fmt.Sprintf("%v", policy.VoiceExp)
+		}
+		desc += fmt.Sprintf("\n**Voice**:%v exp per %v minutes unmuted", exp, interval)
+		if policy.VoiceDailyCap > 0 {
+			desc += fmt.Sprintf(", up to %v exp per day", policy.VoiceDailyCap)
+		}
+	}
+	now := time.Now()
+	if multiplier := policy.ActiveEventMultiplier(now); multiplier != 1 {
+		desc += fmt.Sprintf("\n**Event**:%vx exp until <t:%v:f>", multiplier, policy.EventEndAt.Unix())
+	}
+	managerRoles, err := database.DiscordExpManagerRoles{}.SelectByGuild(i.GuildID)
+	if err != nil {
+		log.Error(err)
+		respondSnapshotError(s, i, "Unknown error")
+		return
+	}
+	var channels, ignored, roles, managers []string
+	for _, m := range multipliers {
+		switch {
+		case m.TargetType == database.DiscordExpMultiplierChannel && m.Multiplier <= 0:
+			ignored = append(ignored, fmt.Sprintf("<#%v>", m.TargetID))
+		case m.TargetType == database.DiscordExpMultiplierChannel:
+			channels = append(channels, fmt.Sprintf("<#%v> %vx", m.TargetID, m.Multiplier))
+		case m.TargetType == database.DiscordExpMultiplierRole:
+			roles = append(roles, fmt.Sprintf("<@&%v> %vx", m.TargetID, m.Multiplier))
+		}
+	}
+	for _, role := range managerRoles {
+		managers = append(managers, fmt.Sprintf("<@&%v>", role.RoleID))
+	}
+	if len(managers) > 0 {
+		desc += "\n\n**Exp managers**\n" + strings.Join(managers, ", ")
+	}
+	if len(ignored) > 0 {
+		desc += "\n\n**Ignored channels**\n" + strings.Join(ignored, ", ")
+	}
+	if len(channels) > 0 {
+		desc += "\n\n**Channel multipliers**\n" + strings.Join(channels, "\n")
+	}
+	if len(roles) > 0 {
+		desc += "\n\n**Role multipliers**\n" + strings.Join(roles, "\n")
+	}
+	respondLevelSettings(s, i, "Exp policy", ellipsis(desc, 4090))
+}
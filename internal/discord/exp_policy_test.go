@@ -0,0 +1,50 @@
+package discord
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNormalizeExpMessage(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "", want: ""},
+		{in: "GM", want: "gm"},
+		{in: "  gm   Frens \n\t wagmi ", want: "gm frens wagmi"},
+	}
+	for _, tt := range tests {
+		if got := normalizeExpMessage(tt.in); got != tt.want {
+			t.Errorf("normalizeExpMessage(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMessageSimilarity(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want float64
+	}{
+		{name: "identical", a: "good morning", b: "good morning", want: 1},
+		{name: "identical single rune", a: "g", b: "g", want: 1},
+		{name: "too short", a: "g", b: "gm", want: 0},
+		{name: "empty", a: "", b: "gm", want: 0},
+		{name: "disjoint", a: "abc", b: "xyz", want: 0},
+		{name: "one bigram differs", a: "night", b: "nacht", want: 0.25},
+		{name: "repeated bigrams counted once each", a: "aaaa", b: "aa", want: 0.5},
+		{name: "multibyte runes", a: "早上好", b: "早上好呀", want: 0.8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := messageSimilarity(tt.a, tt.b)
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("messageSimilarity(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+			if reverse := messageSimilarity(tt.b, tt.a); math.Abs(reverse-got) > 1e-9 {
+				t.Errorf("messageSimilarity(%q, %q) = %v, not symmetric with %v", tt.b, tt.a, reverse, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package discord
+
+import (
+	"context"
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"moff.io/moff-social/internal/export"
+	"moff.io/moff-social/pkg/errors"
+	"moff.io/moff-social/pkg/log"
+	"strings"
+)
+
+const (
+	customExportLink = "export_link:"
+)
+
+func exportLinkButton(label, exportID string) *discordgo.Button {
+	return &discordgo.Button{
+		Style:    discordgo.SecondaryButton,
+		Label:    ellipsis(label, 60),
+		CustomID: fmt.Sprintf("%v%v", customExportLink, exportID),
+		Emoji: discordgo.ComponentEmoji{
+			Name: "📥",
+		},
+	}
+}
+
+func sendExportLink(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if !IsAdminPermission(i.Member.Permissions) {
+		respondSnapshotError(s, i, "Not allowed:thinking: ")
+		return
+	}
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		log.Error(errors.WrapAndReport(err, "quick response to export link"))
+		return
+	}
+
+	exportID := strings.TrimPrefix(i.MessageComponentData().CustomID, customExportLink)
+	url, expiredAt, err := export.PresignedURL(context.TODO(), i.GuildID, exportID)
+	switch {
+	case errors.Is(err, export.ErrExportNotFound):
+		respondEditSnapshotError(s, i, "`We cannot locate this export`")
+		return
+	case errors.Is(err, export.ErrExportExpired):
+		respondEditSnapshotError(s, i, "`This export has been removed according to the retention policy`")
+		return
+	case err != nil:
+		log.Error(err)
+		interactionResponseEditOnError(s, i)
+		return
+	}
+	_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Embeds: &[]*discordgo.MessageEmbed{
+			{
+				Title:       "`📥`Export is ready",
+				Description: fmt.Sprintf("The link below expires <t:%v:R>, please do not share it.", expiredAt.Unix()),
+			},
+		},
+		Components: &[]discordgo.MessageComponent{
+			&discordgo.ActionsRow{
+				Components: []discordgo.MessageComponent{
+					&discordgo.Button{
+						Style: discordgo.LinkButton,
+						Label: "Download",
+						URL:   url,
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		log.Error(errors.WrapAndReport(err, "respond export link"))
+	}
+}
+
+func manageExportPolicy(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if !IsAdminPermission(i.Member.Permissions) {
+		respondSnapshotError(s, i, "Not allowed:thinking: ")
+		return
+	}
+	var retentionDays, linkExpireMinutes int
+	for _, option := range i.ApplicationCommandData().Options {
+		switch option.Name {
+		case "retention-days":
+			retentionDays = int(option.IntValue())
+		case "link-expire-minutes":
+			linkExpireMinutes = int(option.IntValue())
+		}
+	}
+	if retentionDays > 0 || linkExpireMinutes > 0 {
+		policy, err := export.GuildPolicy(i.GuildID)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+		if retentionDays == 0 {
+			retentionDays = policy.RetentionDays
+		}
+		if linkExpireMinutes == 0 {
+			linkExpireMinutes = policy.LinkExpireMinutes
+		}
+		if err := export.SaveGuildPolicy(i.GuildID, i.Member.User.ID, retentionDays, linkExpireMinutes); err != nil {
+			respondSnapshotError(s, i, err.Error())
+			return
+		}
+	}
+	policy, err := export.GuildPolicy(i.GuildID)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags: discordgo.MessageFlagsEphemeral,
+			Embeds: []*discordgo.MessageEmbed{
+				{
+					Title: "Export policy",
+					Description: fmt.Sprintf("**Retention**:`%v` days\n**Download link expiration**:`%v` minutes",
+						policy.RetentionDays, policy.LinkExpireMinutes),
+				},
+			},
+		},
+	})
+	if err != nil {
+		log.Error(errors.WrapAndReport(err, "respond export policy"))
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"moff.io/moff-social/internal/aws"
 	"moff.io/moff-social/internal/config"
 	"moff.io/moff-social/internal/database"
+	"moff.io/moff-social/internal/twitter"
 	"moff.io/moff-social/pkg/errors"
 	"moff.io/moff-social/pkg/log"
 	"os"
@@ -82,8 +83,7 @@ func initOps(ctx context.Context, s *discordgo.Session) error {
 	// 重置邀请缓存
 	resetInvitesCache(guilds)
 	// 邀请相关初始化
-	inviterMatchPipes = make(chan *inviterMatchPipe, 500)
-	go blockingTrackGuildInviter(ctx, s)
+	inviteTrackers = newGuildInviteTrackers(ctx, s)
 	// 校验资产相关初始化
 	verifyUserAssetsPipes = make(chan *verifyUserAssetsPipe, 500)
 	go blockingVerifyUserAssets()
@@ -94,6 +94,7 @@ func initOps(ctx context.Context, s *discordgo.Session) error {
 	aws.Client.NewSQSWorker(ctx, config.Global.DiscordBot.MessageQueues.NotificationQueueURL, sendDiscordNotification)
 	aws.Client.NewSQSWorker(ctx, config.Global.DiscordBot.MessageQueues.MemberExpQueueURL, calculateDiscordMemberExp)
 	go removeCasinoAccessScheduler(ctx)
+	twitter.OnSpaceFinalized(grantTwitterSpaceAttendanceRoles)
 	return nil
 }
 
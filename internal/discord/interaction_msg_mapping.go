@@ -50,6 +50,9 @@ const (
 )
 
 var (
+	exportPolicyMinValue = float64(1)
+	inviteRewardMinValue = float64(1)
+
 	commandsHandlers = map[string]func(s *discordgo.Session, i *discordgo.InteractionCreate){
 		"faq":                          frequentAskQuestionCommandHandler,
 		"events":                       listmoffEventsCommandHandler,
@@ -60,13 +63,33 @@ var (
 		"stop-snapshot":                stopChannelSnapshotFromCommand,
 		"start-twitter-space-snapshot": startTwitterSpaceSnapshot,
 		"list-twitter-space-snapshot":  listTwitterSpaceSnapshot,
+		"start-tweet-snapshot":         startTweetSnapshot,
+		"list-tweet-snapshot":          listTweetSnapshot,
+		"twitter-follow-gate":          createTwitterFollowGate,
+		"eligibility":                  checkCampaignEligibility,
+		"campaign-announcer":           manageCampaignAnnouncer,
+		"level-curve":                  manageLevelCurve,
+		"level-reward":                 manageLevelReward,
+		"leaderboard":                  leaderboardCommandHandler,
+		"rank":                         rankCommandHandler,
+		"exp-policy":                   manageExpPolicy,
+		"exp":                          expCommandHandler,
+		"invite-quality":               manageInviteQuality,
+		"invite-reward":                manageInviteReward,
 		"snapshot-check":               checkUserSnapshot,
 		"notification":                 notificationSwitchCommandHandler,
 		"temp-role-gateway":            manageTempRole,
 		"send-connect":                 sendAppConnectionGateway,
 		"create-invites":               createInviteCode,
 		"check-invites":                listInviteCodes,
+		"campaign-funnel":              campaignFunnelCommandHandler,
+		"stats":                        statsCommandHandler,
 		"dashboard":                    listDashboard,
+		"export-policy":                manageExportPolicy,
+		"link-twitter":                 linkTwitterCommandHandler,
+		"relink-twitter":               relinkTwitterCommandHandler,
+		"unlink-twitter":               unlinkTwitterCommandHandler,
+		"twitter-space-role":           manageTwitterSpaceRoles,
 	}
 	messageReactionHandlers = map[string]func(s *discordgo.Session, i *discordgo.InteractionCreate){
 		customRemoveTwitterSpace:                        removeTwitterSpaceSnapshot,
@@ -77,12 +100,16 @@ var (
 		unlockTempAccessPrefix:                          sendCasinoCaptchaVerification,
 		"confirm-temp-access:":                          confirmTempRoleManagement,
 		listInvitePage:                                  listInviteCodesPagination,
+		listEventsPage:                                  listEventsPagination,
 		"verify_user_assets":                            verifyUserAssetsHandler,
 		"disable_notifications":                         disableNotifications,
 		"unlock_access_to_casino":                       sendCasinoCaptchaVerification,
 		"confirm-app-connection":                        confirmAppConnection,
 		"connect_app_user":                              connectAppUser,
 		stopSnapshot:                                    stopChannelSnapshotFromInteraction,
+		customExportLink:                                sendExportLink,
+		customTwitterSpaceAttendance:                    showTwitterSpaceAttendance,
+		customTwitterFollowGate:                         verifyTwitterFollowGate,
 	}
 
 	modalSubmitHandlers = map[string]func(s *discordgo.Session, i *discordgo.InteractionCreate){
@@ -119,6 +146,18 @@ var (
 					Name:        "upcoming",
 					Description: "moff upcoming event list",
 				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "game",
+					Description: "Filter by game id or name",
+					MaxLength:   32,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "app-id",
+					Description: "Filter by app, white-label servers always show their own app",
+					MaxLength:   40,
+				},
 			},
 			Description: "List ongoing or upcoming moff events",
 		},
@@ -155,6 +194,25 @@ var (
 			Name:        "check-invites",
 			Description: "List latest permanent invite links",
 		},
+		{
+			Name:        "export-policy",
+			Description: "Show or change retention of exported snapshot files",
+			Type:        discordgo.ChatApplicationCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "retention-days",
+					Description: "Days to keep exported files before removal",
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					MinValue:    &exportPolicyMinValue,
+				},
+				{
+					Name:        "link-expire-minutes",
+					Description: "Minutes a download link stays valid",
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					MinValue:    &exportPolicyMinValue,
+				},
+			},
+		},
 		{
 			Name:        "dashboard",
 			Description: "Get a link to the dashboard",
@@ -212,150 +270,1629 @@ var (
 			Type:        discordgo.ChatApplicationCommand,
 		},
 		{
-			Name:        "temp-role-gateway",
-			Description: "Manage temp role",
+			Name:        "start-tweet-snapshot",
+			Description: "Snapshot likes, retweets, quotes and replies of a tweet",
+			Type:        discordgo.ChatApplicationCommand,
+			Options:     tweetSnapshotCommandOptions(),
+		},
+		{
+			Name:        "list-tweet-snapshot",
+			Description: "List snapshots for tweets",
+			Type:        discordgo.ChatApplicationCommand,
+		},
+		{
+			Name:        "twitter-follow-gate",
+			Description: "Send a button verifying members follow Twitter accounts",
 			Type:        discordgo.ChatApplicationCommand,
 			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "accounts",
+					Description: "Comma separated Twitter usernames to follow",
+					Type:        discordgo.ApplicationCommandOptionString,
+				},
+				{
+					Name:        "campaign-id",
+					Description: "Campaign whose follow requirement and whitelist to use",
+					Type:        discordgo.ApplicationCommandOptionString,
+				},
 				{
 					Name:        "role",
-					Description: "The role to manage",
+					Description: "Role granted to verified members",
 					Type:        discordgo.ApplicationCommandOptionRole,
-					Required:    true,
 				},
 				{
-					Name:        "expiration-min",
-					Description: "The minutes to expire the role",
-					Type:        discordgo.ApplicationCommandOptionInteger,
-					Required:    true,
+					Name:        "whitelist-id",
+					Description: "Whitelist to write verified members into",
+					Type:        discordgo.ApplicationCommandOptionString,
+				},
+				{
+					Name:        "channel",
+					Description: "Channel to send the button, current channel by default",
+					Type:        discordgo.ApplicationCommandOptionChannel,
 				},
 			},
 		},
 		{
-			Name:        "send-connect",
-			Description: "Send a connect interactive message",
+			Name:        "campaign-announcer",
+			Description: "Announce campaign start, ending and end in a channel",
 			Type:        discordgo.ChatApplicationCommand,
-		},
-		{
-			Name: "list-twitter-space-snapshot",
 			Options: []*discordgo.ApplicationCommandOption{
 				{
+					Name:        "channel",
+					Description: "Channel to post announcements, required for the first setup",
+					Type:        discordgo.ApplicationCommandOptionChannel,
+				},
+				{
+					Name:        "role",
+					Description: "Role to ping with announcements",
+					Type:        discordgo.ApplicationCommandOptionRole,
+				},
+				{
+					Name:        "remove-role",
+					Description: "Stop pinging a role with announcements",
 					Type:        discordgo.ApplicationCommandOptionBoolean,
-					Name:        "ongoing",
-					Description: "List ongoing snapshots for twitter space",
 				},
 				{
+					Name:        "enabled",
+					Description: "Turn announcements on or off, on by default",
 					Type:        discordgo.ApplicationCommandOptionBoolean,
-					Name:        "finished",
-					Description: "List finished snapshots for twitter space",
+				},
+				{
+					Name:        "reset-templates",
+					Description: "Restore the default templates",
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+				},
+				{
+					Name:        "start-template",
+					Description: "Message when a campaign starts",
+					Type:        discordgo.ApplicationCommandOptionString,
+				},
+				{
+					Name:        "ending-template",
+					Description: "Message 24 hours before a campaign ends",
+					Type:        discordgo.ApplicationCommandOptionString,
+				},
+				{
+					Name:        "end-template",
+					Description: "Message when a campaign ends",
+					Type:        discordgo.ApplicationCommandOptionString,
 				},
 			},
-			Description: "List snapshots for twitter space",
 		},
 		{
-			Name:        "snapshot-check",
-			Description: "Check if you are being snapshotted!",
+			Name:        "level-curve",
+			Description: "Configure how much exp each level requires and level up announcements",
 			Type:        discordgo.ChatApplicationCommand,
 			Options: []*discordgo.ApplicationCommandOption{
 				{
-					Name:        "channel",
-					Description: "The voice channel under snapshot",
+					Name:        "curve",
+					Description: "Level curve",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Choices:     levelCurveChoices,
+				},
+				{
+					Name:        "base",
+					Description: "Exp from level 0 to 1 of linear and exponential curves",
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					MinValue:    &levelSettingsMinValue,
+				},
+				{
+					Name:        "step",
+					Description: "Exp added per level of linear curve",
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					MinValue:    &levelSettingsMinValue,
+				},
+				{
+					Name:        "factor",
+					Description: "Exp multiplier per level of exponential curve",
+					Type:        discordgo.ApplicationCommandOptionNumber,
+					MinValue:    &levelSettingsMinValue,
+				},
+				{
+					Name:        "table",
+					Description: "Comma separated exp to level up from level 0, the last one repeats",
+					Type:        discordgo.ApplicationCommandOptionString,
+				},
+				{
+					Name:        "announce-channel",
+					Description: "Channel to announce level ups",
 					Type:        discordgo.ApplicationCommandOptionChannel,
-					Required:    true,
+				},
+				{
+					Name:        "announce-template",
+					Description: "Reply template id of announcements, supports {user} {username} {level} {from}",
+					Type:        discordgo.ApplicationCommandOptionString,
+				},
+				{
+					Name:        "disable-announcement",
+					Description: "Stop announcing level ups",
+					Type:        discordgo.ApplicationCommandOptionBoolean,
 				},
 			},
 		},
-	}
-
-	authorizedCommands = []*discordgo.ApplicationCommand{
 		{
-			Name:        "create-invites",
-			Description: "Create permanent invite link",
+			Name:        "level-reward",
+			Description: "Add or remove rewards for reaching a level",
+			Type:        discordgo.ChatApplicationCommand,
 			Options: []*discordgo.ApplicationCommandOption{
 				{
-					Name:        "channel",
-					Description: "Invite Users to Specific Channels",
-					Type:        discordgo.ApplicationCommandOptionChannel,
+					Name:        "level",
+					Description: "Level to reward",
+					Type:        discordgo.ApplicationCommandOptionInteger,
 					Required:    true,
+					MinValue:    &levelSettingsMinValue,
+				},
+				{
+					Name:        "role",
+					Description: "Role granted at the level",
+					Type:        discordgo.ApplicationCommandOptionRole,
+				},
+				{
+					Name:        "quest-id",
+					Description: "Community quest rewarded at the level",
+					Type:        discordgo.ApplicationCommandOptionString,
+				},
+				{
+					Name:        "remove",
+					Description: "Remove the reward instead",
+					Type:        discordgo.ApplicationCommandOptionBoolean,
 				},
 			},
 		},
 		{
-			Name:        "check-invites",
-			Description: "List latest permanent invite links",
-		},
-		{
-			Name:        "send-connect",
-			Description: "Send a connect interactive message",
-			Type:        discordgo.ChatApplicationCommand,
-		},
-		{
-			Name:        "start-snapshot",
-			Description: "Start snapshot for given channel",
+			Name:        "leaderboard",
+			Description: "Community leaderboards",
 			Type:        discordgo.ChatApplicationCommand,
 			Options: []*discordgo.ApplicationCommandOption{
 				{
-					Name:        "channel",
-					Description: "The channel to start snapshot",
-					Type:        discordgo.ApplicationCommandOptionChannel,
-					Required:    true,
+					Name:        "exp",
+					Description: "Members with the most exp",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "window",
+							Description: "All time by default",
+							Type:        discordgo.ApplicationCommandOptionString,
+							Choices:     expWindowChoices,
+						},
+					},
 				},
 			},
 		},
 		{
-			Name:        "list-snapshot",
-			Description: "list history snapshots for channels",
+			Name:        "rank",
+			Description: "Show the rank card of you or a member",
 			Type:        discordgo.ChatApplicationCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "user",
+					Description: "Member to show, yourself by default",
+					Type:        discordgo.ApplicationCommandOptionUser,
+				},
+			},
 		},
 		{
-			Name:        "stop-snapshot",
-			Description: "Stop snapshot for given channel",
+			Name:        "exp-policy",
+			Description: "Manage exp anti-abuse policy",
 			Type:        discordgo.ChatApplicationCommand,
 			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "show",
+					Description: "Show the exp policy",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+				},
+				{
+					Name:        "spam",
+					Description: "Messages similar to recent ones earn no exp",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "similarity",
+							Description: "Similarity from 0 to 1, 0 to disable",
+							Type:        discordgo.ApplicationCommandOptionNumber,
+							Required:    true,
+							MinValue:    &levelSettingsMinValue,
+							MaxValue:    expSimilarityMaxValue,
+						},
+					},
+				},
+				{
+					Name:        "decay",
+					Description: "Decay exp of inactive members every day",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "after-days",
+							Description: "Inactive days before decay, 0 to disable",
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Required:    true,
+							MinValue:    &levelSettingsMinValue,
+						},
+						{
+							Name:        "percent",
+							Description: "Percent of total exp to decay per day",
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Required:    true,
+							MinValue:    &levelSettingsMinValue,
+							MaxValue:    expDecayMaxPercent,
+						},
+					},
+				},
+				{
+					Name:        "voice",
+					Description: "Exp for time spent unmuted in voice and stage channels",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "enabled",
+							Description: "Enable voice exp",
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+						},
+						{
+							Name:        "interval-minutes",
+							Description: "Minutes in voice per exp grant, 0 for default",
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							MinValue:    &levelSettingsMinValue,
+						},
+						{
+							Name:        "exp",
+							Description: "Exp per grant, 0 for default",
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							MinValue:    &levelSettingsMinValue,
+						},
+						{
+							Name:        "daily-cap",
+							Description: "Max voice exp per day, 0 for no cap",
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							MinValue:    &levelSettingsMinValue,
+						},
+					},
+				},
+				{
+					Name:        "event",
+					Description: "Start a temporary multiple exp event",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "multiplier",
+							Description: "Exp multiplier during the event, e.g. 2",
+							Type:        discordgo.ApplicationCommandOptionNumber,
+							Required:    true,
+							MinValue:    &levelSettingsMinValue,
+							MaxValue:    expMultiplierMaxValue,
+						},
+						{
+							Name:        "hours",
+							Description: "Event duration in hours, 0 to end the event",
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Required:    true,
+							MinValue:    &levelSettingsMinValue,
+						},
+					},
+				},
+				{
+					Name:        "manager-role",
+					Description: "Allow a role to use /exp commands",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "role",
+							Description: "Role",
+							Type:        discordgo.ApplicationCommandOptionRole,
+							Required:    true,
+						},
+						{
+							Name:        "remove",
+							Description: "Remove the role",
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+						},
+					},
+				},
 				{
 					Name:        "channel",
-					Description: "The channel to stop snapshot",
-					Type:        discordgo.ApplicationCommandOptionChannel,
-					Required:    true,
+					Description: "Set exp multiplier of a channel or category",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "channel",
+							Description: "Channel or category",
+							Type:        discordgo.ApplicationCommandOptionChannel,
+							Required:    true,
+						},
+						{
+							Name:        "multiplier",
+							Description: "Exp multiplier of the channel",
+							Type:        discordgo.ApplicationCommandOptionNumber,
+							MinValue:    &levelSettingsMinValue,
+							MaxValue:    expMultiplierMaxValue,
+						},
+						{
+							Name:        "ignore",
+							Description: "Earn no exp in the channel",
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+						},
+						{
+							Name:        "remove",
+							Description: "Remove the channel setting",
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+						},
+					},
+				},
+				{
+					Name:        "role",
+					Description: "Set exp multiplier of a role, the highest one applies",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "role",
+							Description: "Role",
+							Type:        discordgo.ApplicationCommandOptionRole,
+							Required:    true,
+						},
+						{
+							Name:        "multiplier",
+							Description: "Exp multiplier of the role",
+							Type:        discordgo.ApplicationCommandOptionNumber,
+							MinValue:    &levelSettingsMinValue,
+							MaxValue:    expMultiplierMaxValue,
+						},
+						{
+							Name:        "remove",
+							Description: "Remove the role setting",
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+						},
+					},
 				},
 			},
 		},
 		{
-			Name:        "snapshot-check",
-			Description: "Check if you are being snapshotted!",
+			Name:        "exp",
+			Description: "Manage member exp",
 			Type:        discordgo.ChatApplicationCommand,
 			Options: []*discordgo.ApplicationCommandOption{
 				{
-					Name:        "channel",
-					Description: "The voice channel under snapshot",
-					Type:        discordgo.ApplicationCommandOptionChannel,
-					Required:    true,
+					Name:        "give",
+					Description: "Give exp to a member",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "user",
+							Description: "Member",
+							Type:        discordgo.ApplicationCommandOptionUser,
+							Required:    true,
+						},
+						{
+							Name:        "amount",
+							Description: "Exp to give",
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Required:    true,
+							MinValue:    &levelSettingsMinValue,
+						},
+						{
+							Name:        "reason",
+							Description: "Reason for the audit log",
+							Type:        discordgo.ApplicationCommandOptionString,
+						},
+						{
+							Name:        "announce",
+							Description: "Announce the change publicly",
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+						},
+					},
+				},
+				{
+					Name:        "take",
+					Description: "Take exp from a member",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "user",
+							Description: "Member",
+							Type:        discordgo.ApplicationCommandOptionUser,
+							Required:    true,
+						},
+						{
+							Name:        "amount",
+							Description: "Exp to take",
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Required:    true,
+							MinValue:    &levelSettingsMinValue,
+						},
+						{
+							Name:        "reason",
+							Description: "Reason for the audit log",
+							Type:        discordgo.ApplicationCommandOptionString,
+						},
+						{
+							Name:        "announce",
+							Description: "Announce the change publicly",
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+						},
+					},
+				},
+				{
+					Name:        "set",
+					Description: "Set total exp of a member",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "user",
+							Description: "Member",
+							Type:        discordgo.ApplicationCommandOptionUser,
+							Required:    true,
+						},
+						{
+							Name:        "amount",
+							Description: "Total exp",
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Required:    true,
+							MinValue:    &levelSettingsMinValue,
+						},
+						{
+							Name:        "reason",
+							Description: "Reason for the audit log",
+							Type:        discordgo.ApplicationCommandOptionString,
+						},
+						{
+							Name:        "announce",
+							Description: "Announce the change publicly",
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+						},
+					},
+				},
+				{
+					Name:        "reset",
+					Description: "Reset exp of a member to 0",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "user",
+							Description: "Member",
+							Type:        discordgo.ApplicationCommandOptionUser,
+							Required:    true,
+						},
+						{
+							Name:        "reason",
+							Description: "Reason for the audit log",
+							Type:        discordgo.ApplicationCommandOptionString,
+						},
+						{
+							Name:        "announce",
+							Description: "Announce the change publicly",
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+						},
+					},
+				},
+				{
+					Name:        "revoke",
+					Description: "Revoke an exp event by appending an offsetting event",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "event-id",
+							Description: "Exp event id",
+							Type:        discordgo.ApplicationCommandOptionString,
+							Required:    true,
+						},
+						{
+							Name:        "reason",
+							Description: "Reason for the audit log",
+							Type:        discordgo.ApplicationCommandOptionString,
+						},
+					},
+				},
+				{
+					Name:        "recompute",
+					Description: "Recompute exp and levels from the ledger",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "user",
+							Description: "Member to recompute, all members by default",
+							Type:        discordgo.ApplicationCommandOptionUser,
+						},
+					},
+				},
+				{
+					Name:        "history",
+					Description: "Show exp history of a member",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "user",
+							Description: "Member",
+							Type:        discordgo.ApplicationCommandOptionUser,
+							Required:    true,
+						},
+					},
 				},
 			},
 		},
 		{
-			Name:        "start-twitter-space-snapshot",
-			Description: "Start snapshot for twitter space",
+			Name:        "invite-quality",
+			Description: "Set rules for qualified invites",
 			Type:        discordgo.ChatApplicationCommand,
-		},
-		{
-			Name: "list-twitter-space-snapshot",
 			Options: []*discordgo.ApplicationCommandOption{
 				{
+					Name:        "min-account-age-days",
+					Description: "Min account age of invited members when joining, 0 to disable",
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					MinValue:    &levelSettingsMinValue,
+				},
+				{
+					Name:        "reject-default-avatar",
+					Description: "Members with the default avatar don't count",
 					Type:        discordgo.ApplicationCommandOptionBoolean,
-					Name:        "ongoing",
-					Description: "List ongoing snapshots for twitter space",
 				},
 				{
+					Name:        "require-activity",
+					Description: "Members must be active after joining",
 					Type:        discordgo.ApplicationCommandOptionBoolean,
-					Name:        "finished",
-					Description: "List finished snapshots for twitter space",
+				},
+				{
+					Name:        "min-stay-hours",
+					Description: "Members leaving after these hours still count, 0 if leaving never counts",
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					MinValue:    &levelSettingsMinValue,
+				},
+				{
+					Name:        "burst-window-minutes",
+					Description: "Window to detect invite bursts",
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					MinValue:    &levelSettingsMinValue,
+				},
+				{
+					Name:        "burst-threshold",
+					Description: "Invites within the window to flag a burst, 0 to disable",
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					MinValue:    &levelSettingsMinValue,
 				},
 			},
-			Description: "List snapshots for twitter space",
 		},
 		{
-			Name:        "dashboard",
-			Description: "Get a link to the dashboard",
+			Name:        "campaign-funnel",
+			Description: "Show conversion of members who joined through campaign invites",
+			Type:        discordgo.ChatApplicationCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "invite-code",
+					Description: "Campaign invite code, the latest campaign invites if not set",
+					Type:        discordgo.ApplicationCommandOptionString,
+				},
+				{
+					Name:        "level",
+					Description: "Level members should reach, 5 by default",
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					MinValue:    &levelSettingsMinValue,
+				},
+			},
+		},
+		{
+			Name:        "invite-reward",
+			Description: "Add or remove rewards for reaching qualified invites",
+			Type:        discordgo.ChatApplicationCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "invites",
+					Description: "Qualified invites to reward",
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					Required:    true,
+					MinValue:    &inviteRewardMinValue,
+				},
+				{
+					Name:        "role",
+					Description: "Role granted at the milestone, revoked when invites drop below",
+					Type:        discordgo.ApplicationCommandOptionRole,
+				},
+				{
+					Name:        "quest-id",
+					Description: "Community quest rewarded once at the milestone",
+					Type:        discordgo.ApplicationCommandOptionString,
+				},
+				{
+					Name:        "remove",
+					Description: "Remove the reward instead",
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+				},
+			},
+		},
+		{
+			Name:        "stats",
+			Description: "Member activity, retention and dormant members",
+			Type:        discordgo.ChatApplicationCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "overview",
+					Description: "Daily active members, joins and leaves",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "days",
+							Description: "Last 30 days by default",
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Choices:     statsDaysChoices,
+						},
+					},
+				},
+				{
+					Name:        "retention",
+					Description: "Weekly retention of members by the week they joined",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "weeks",
+							Description: "Weeks of cohorts, 8 by default",
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							MinValue:    &statsMinWeeksValue,
+							MaxValue:    maxStatsWeeks,
+						},
+					},
+				},
+				{
+					Name:        "dormant",
+					Description: "Members who haven't been active for a while",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "days",
+							Description: "Days without activity, 30 by default",
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							MinValue:    &statsMinValue,
+						},
+						{
+							Name:        "page",
+							Description: "Page number",
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							MinValue:    &statsMinValue,
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:        "eligibility",
+			Description: "Check whether you meet the requirements of a campaign",
+			Type:        discordgo.ChatApplicationCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "campaign-id",
+					Description: "The campaign to check",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Required:    true,
+				},
+			},
+		},
+		{
+			Name:        "temp-role-gateway",
+			Description: "Manage temp role",
+			Type:        discordgo.ChatApplicationCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "role",
+					Description: "The role to manage",
+					Type:        discordgo.ApplicationCommandOptionRole,
+					Required:    true,
+				},
+				{
+					Name:        "expiration-min",
+					Description: "The minutes to expire the role",
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					Required:    true,
+				},
+			},
+		},
+		{
+			Name:        "send-connect",
+			Description: "Send a connect interactive message",
+			Type:        discordgo.ChatApplicationCommand,
+		},
+		{
+			Name: "list-twitter-space-snapshot",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+					Name:        "ongoing",
+					Description: "List ongoing snapshots for twitter space",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+					Name:        "finished",
+					Description: "List finished snapshots for twitter space",
+				},
+			},
+			Description: "List snapshots for twitter space",
+		},
+		{
+			Name:        "snapshot-check",
+			Description: "Check if you are being snapshotted!",
+			Type:        discordgo.ChatApplicationCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "channel",
+					Description: "The voice channel under snapshot",
+					Type:        discordgo.ApplicationCommandOptionChannel,
+					Required:    true,
+				},
+			},
+		},
+		{
+			Name:        "link-twitter",
+			Description: "Link your Twitter account",
+			Type:        discordgo.ChatApplicationCommand,
+		},
+		{
+			Name:        "relink-twitter",
+			Description: "Link another Twitter account instead of the current one",
+			Type:        discordgo.ChatApplicationCommand,
+		},
+		{
+			Name:        "unlink-twitter",
+			Description: "Unlink your Twitter account",
+			Type:        discordgo.ChatApplicationCommand,
+		},
+		{
+			Name:        "twitter-space-role",
+			Description: "Show or change roles granted for attending Twitter Spaces",
+			Type:        discordgo.ChatApplicationCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "role",
+					Description: "Role granted to linked members meeting the whitelist requirement",
+					Type:        discordgo.ApplicationCommandOptionRole,
+				},
+				{
+					Name:        "space-url",
+					Description: "Only for this Twitter Space, all Spaces if absent",
+					Type:        discordgo.ApplicationCommandOptionString,
+				},
+				{
+					Name:        "remove",
+					Description: "Stop granting the role",
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+				},
+			},
+		},
+	}
+
+	authorizedCommands = []*discordgo.ApplicationCommand{
+		{
+			Name:        "create-invites",
+			Description: "Create permanent invite link",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "channel",
+					Description: "Invite Users to Specific Channels",
+					Type:        discordgo.ApplicationCommandOptionChannel,
+					Required:    true,
+				},
+			},
+		},
+		{
+			Name:        "check-invites",
+			Description: "List latest permanent invite links",
+		},
+		{
+			Name:        "send-connect",
+			Description: "Send a connect interactive message",
+			Type:        discordgo.ChatApplicationCommand,
+		},
+		{
+			Name:        "start-snapshot",
+			Description: "Start snapshot for given channel",
+			Type:        discordgo.ChatApplicationCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "channel",
+					Description: "The channel to start snapshot",
+					Type:        discordgo.ApplicationCommandOptionChannel,
+					Required:    true,
+				},
+			},
+		},
+		{
+			Name:        "list-snapshot",
+			Description: "list history snapshots for channels",
+			Type:        discordgo.ChatApplicationCommand,
+		},
+		{
+			Name:        "stop-snapshot",
+			Description: "Stop snapshot for given channel",
+			Type:        discordgo.ChatApplicationCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "channel",
+					Description: "The channel to stop snapshot",
+					Type:        discordgo.ApplicationCommandOptionChannel,
+					Required:    true,
+				},
+			},
+		},
+		{
+			Name:        "snapshot-check",
+			Description: "Check if you are being snapshotted!",
+			Type:        discordgo.ChatApplicationCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "channel",
+					Description: "The voice channel under snapshot",
+					Type:        discordgo.ApplicationCommandOptionChannel,
+					Required:    true,
+				},
+			},
+		},
+		{
+			Name:        "start-twitter-space-snapshot",
+			Description: "Start snapshot for twitter space",
+			Type:        discordgo.ChatApplicationCommand,
+		},
+		{
+			Name:        "start-tweet-snapshot",
+			Description: "Snapshot likes, retweets, quotes and replies of a tweet",
+			Type:        discordgo.ChatApplicationCommand,
+			Options:     tweetSnapshotCommandOptions(),
+		},
+		{
+			Name:        "list-tweet-snapshot",
+			Description: "List snapshots for tweets",
+			Type:        discordgo.ChatApplicationCommand,
+		},
+		{
+			Name:        "twitter-follow-gate",
+			Description: "Send a button verifying members follow Twitter accounts",
+			Type:        discordgo.ChatApplicationCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "accounts",
+					Description: "Comma separated Twitter usernames to follow",
+					Type:        discordgo.ApplicationCommandOptionString,
+				},
+				{
+					Name:        "campaign-id",
+					Description: "Campaign whose follow requirement and whitelist to use",
+					Type:        discordgo.ApplicationCommandOptionString,
+				},
+				{
+					Name:        "role",
+					Description: "Role granted to verified members",
+					Type:        discordgo.ApplicationCommandOptionRole,
+				},
+				{
+					Name:        "whitelist-id",
+					Description: "Whitelist to write verified members into",
+					Type:        discordgo.ApplicationCommandOptionString,
+				},
+				{
+					Name:        "channel",
+					Description: "Channel to send the button, current channel by default",
+					Type:        discordgo.ApplicationCommandOptionChannel,
+				},
+			},
+		},
+		{
+			Name:        "campaign-announcer",
+			Description: "Announce campaign start, ending and end in a channel",
+			Type:        discordgo.ChatApplicationCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "channel",
+					Description: "Channel to post announcements, required for the first setup",
+					Type:        discordgo.ApplicationCommandOptionChannel,
+				},
+				{
+					Name:        "role",
+					Description: "Role to ping with announcements",
+					Type:        discordgo.ApplicationCommandOptionRole,
+				},
+				{
+					Name:        "remove-role",
+					Description: "Stop pinging a role with announcements",
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+				},
+				{
+					Name:        "enabled",
+					Description: "Turn announcements on or off, on by default",
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+				},
+				{
+					Name:        "reset-templates",
+					Description: "Restore the default templates",
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+				},
+				{
+					Name:        "start-template",
+					Description: "Message when a campaign starts",
+					Type:        discordgo.ApplicationCommandOptionString,
+				},
+				{
+					Name:        "ending-template",
+					Description: "Message 24 hours before a campaign ends",
+					Type:        discordgo.ApplicationCommandOptionString,
+				},
+				{
+					Name:        "end-template",
+					Description: "Message when a campaign ends",
+					Type:        discordgo.ApplicationCommandOptionString,
+				},
+			},
+		},
+		{
+			Name:        "level-curve",
+			Description: "Configure how much exp each level requires and level up announcements",
+			Type:        discordgo.ChatApplicationCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "curve",
+					Description: "Level curve",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Choices:     levelCurveChoices,
+				},
+				{
+					Name:        "base",
+					Description: "Exp from level 0 to 1 of linear and exponential curves",
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					MinValue:    &levelSettingsMinValue,
+				},
+				{
+					Name:        "step",
+					Description: "Exp added per level of linear curve",
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					MinValue:    &levelSettingsMinValue,
+				},
+				{
+					Name:        "factor",
+					Description: "Exp multiplier per level of exponential curve",
+					Type:        discordgo.ApplicationCommandOptionNumber,
+					MinValue:    &levelSettingsMinValue,
+				},
+				{
+					Name:        "table",
+					Description: "Comma separated exp to level up from level 0, the last one repeats",
+					Type:        discordgo.ApplicationCommandOptionString,
+				},
+				{
+					Name:        "announce-channel",
+					Description: "Channel to announce level ups",
+					Type:        discordgo.ApplicationCommandOptionChannel,
+				},
+				{
+					Name:        "announce-template",
+					Description: "Reply template id of announcements, supports {user} {username} {level} {from}",
+					Type:        discordgo.ApplicationCommandOptionString,
+				},
+				{
+					Name:        "disable-announcement",
+					Description: "Stop announcing level ups",
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+				},
+			},
+		},
+		{
+			Name:        "level-reward",
+			Description: "Add or remove rewards for reaching a level",
+			Type:        discordgo.ChatApplicationCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "level",
+					Description: "Level to reward",
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					Required:    true,
+					MinValue:    &levelSettingsMinValue,
+				},
+				{
+					Name:        "role",
+					Description: "Role granted at the level",
+					Type:        discordgo.ApplicationCommandOptionRole,
+				},
+				{
+					Name:        "quest-id",
+					Description: "Community quest rewarded at the level",
+					Type:        discordgo.ApplicationCommandOptionString,
+				},
+				{
+					Name:        "remove",
+					Description: "Remove the reward instead",
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+				},
+			},
+		},
+		{
+			Name:        "leaderboard",
+			Description: "Community leaderboards",
+			Type:        discordgo.ChatApplicationCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "exp",
+					Description: "Members with the most exp",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "window",
+							Description: "All time by default",
+							Type:        discordgo.ApplicationCommandOptionString,
+							Choices:     expWindowChoices,
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:        "rank",
+			Description: "Show the rank card of you or a member",
+			Type:        discordgo.ChatApplicationCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "user",
+					Description: "Member to show, yourself by default",
+					Type:        discordgo.ApplicationCommandOptionUser,
+				},
+			},
+		},
+		{
+			Name:        "exp-policy",
+			Description: "Manage exp anti-abuse policy",
+			Type:        discordgo.ChatApplicationCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "show",
+					Description: "Show the exp policy",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+				},
+				{
+					Name:        "spam",
+					Description: "Messages similar to recent ones earn no exp",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "similarity",
+							Description: "Similarity from 0 to 1, 0 to disable",
+							Type:        discordgo.ApplicationCommandOptionNumber,
+							Required:    true,
+							MinValue:    &levelSettingsMinValue,
+							MaxValue:    expSimilarityMaxValue,
+						},
+					},
+				},
+				{
+					Name:        "decay",
+					Description: "Decay exp of inactive members every day",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "after-days",
+							Description: "Inactive days before decay, 0 to disable",
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Required:    true,
+							MinValue:    &levelSettingsMinValue,
+						},
+						{
+							Name:        "percent",
+							Description: "Percent of total exp to decay per day",
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Required:    true,
+							MinValue:    &levelSettingsMinValue,
+							MaxValue:    expDecayMaxPercent,
+						},
+					},
+				},
+				{
+					Name:        "voice",
+					Description: "Exp for time spent unmuted in voice and stage channels",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "enabled",
+							Description: "Enable voice exp",
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+						},
+						{
+							Name:        "interval-minutes",
+							Description: "Minutes in voice per exp grant, 0 for default",
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							MinValue:    &levelSettingsMinValue,
+						},
+						{
+							Name:        "exp",
+							Description: "Exp per grant, 0 for default",
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							MinValue:    &levelSettingsMinValue,
+						},
+						{
+							Name:        "daily-cap",
+							Description: "Max voice exp per day, 0 for no cap",
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							MinValue:    &levelSettingsMinValue,
+						},
+					},
+				},
+				{
+					Name:        "event",
+					Description: "Start a temporary multiple exp event",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "multiplier",
+							Description: "Exp multiplier during the event, e.g. 2",
+							Type:        discordgo.ApplicationCommandOptionNumber,
+							Required:    true,
+							MinValue:    &levelSettingsMinValue,
+							MaxValue:    expMultiplierMaxValue,
+						},
+						{
+							Name:        "hours",
+							Description: "Event duration in hours, 0 to end the event",
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Required:    true,
+							MinValue:    &levelSettingsMinValue,
+						},
+					},
+				},
+				{
+					Name:        "manager-role",
+					Description: "Allow a role to use /exp commands",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "role",
+							Description: "Role",
+							Type:        discordgo.ApplicationCommandOptionRole,
+							Required:    true,
+						},
+						{
+							Name:        "remove",
+							Description: "Remove the role",
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+						},
+					},
+				},
+				{
+					Name:        "channel",
+					Description: "Set exp multiplier of a channel or category",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "channel",
+							Description: "Channel or category",
+							Type:        discordgo.ApplicationCommandOptionChannel,
+							Required:    true,
+						},
+						{
+							Name:        "multiplier",
+							Description: "Exp multiplier of the channel",
+							Type:        discordgo.ApplicationCommandOptionNumber,
+							MinValue:    &levelSettingsMinValue,
+							MaxValue:    expMultiplierMaxValue,
+						},
+						{
+							Name:        "ignore",
+							Description: "Earn no exp in the channel",
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+						},
+						{
+							Name:        "remove",
+							Description: "Remove the channel setting",
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+						},
+					},
+				},
+				{
+					Name:        "role",
+					Description: "Set exp multiplier of a role, the highest one applies",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "role",
+							Description: "Role",
+							Type:        discordgo.ApplicationCommandOptionRole,
+							Required:    true,
+						},
+						{
+							Name:        "multiplier",
+							Description: "Exp multiplier of the role",
+							Type:        discordgo.ApplicationCommandOptionNumber,
+							MinValue:    &levelSettingsMinValue,
+							MaxValue:    expMultiplierMaxValue,
+						},
+						{
+							Name:        "remove",
+							Description: "Remove the role setting",
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:        "exp",
+			Description: "Manage member exp",
+			Type:        discordgo.ChatApplicationCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "give",
+					Description: "Give exp to a member",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "user",
+							Description: "Member",
+							Type:        discordgo.ApplicationCommandOptionUser,
+							Required:    true,
+						},
+						{
+							Name:        "amount",
+							Description: "Exp to give",
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Required:    true,
+							MinValue:    &levelSettingsMinValue,
+						},
+						{
+							Name:        "reason",
+							Description: "Reason for the audit log",
+							Type:        discordgo.ApplicationCommandOptionString,
+						},
+						{
+							Name:        "announce",
+							Description: "Announce the change publicly",
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+						},
+					},
+				},
+				{
+					Name:        "take",
+					Description: "Take exp from a member",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "user",
+							Description: "Member",
+							Type:        discordgo.ApplicationCommandOptionUser,
+							Required:    true,
+						},
+						{
+							Name:        "amount",
+							Description: "Exp to take",
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Required:    true,
+							MinValue:    &levelSettingsMinValue,
+						},
+						{
+							Name:        "reason",
+							Description: "Reason for the audit log",
+							Type:        discordgo.ApplicationCommandOptionString,
+						},
+						{
+							Name:        "announce",
+							Description: "Announce the change publicly",
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+						},
+					},
+				},
+				{
+					Name:        "set",
+					Description: "Set total exp of a member",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "user",
+							Description: "Member",
+							Type:        discordgo.ApplicationCommandOptionUser,
+							Required:    true,
+						},
+						{
+							Name:        "amount",
+							Description: "Total exp",
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Required:    true,
+							MinValue:    &levelSettingsMinValue,
+						},
+						{
+							Name:        "reason",
+							Description: "Reason for the audit log",
+							Type:        discordgo.ApplicationCommandOptionString,
+						},
+						{
+							Name:        "announce",
+							Description: "Announce the change publicly",
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+						},
+					},
+				},
+				{
+					Name:        "reset",
+					Description: "Reset exp of a member to 0",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "user",
+							Description: "Member",
+							Type:        discordgo.ApplicationCommandOptionUser,
+							Required:    true,
+						},
+						{
+							Name:        "reason",
+							Description: "Reason for the audit log",
+							Type:        discordgo.ApplicationCommandOptionString,
+						},
+						{
+							Name:        "announce",
+							Description: "Announce the change publicly",
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+						},
+					},
+				},
+				{
+					Name:        "revoke",
+					Description: "Revoke an exp event by appending an offsetting event",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "event-id",
+							Description: "Exp event id",
+							Type:        discordgo.ApplicationCommandOptionString,
+							Required:    true,
+						},
+						{
+							Name:        "reason",
+							Description: "Reason for the audit log",
+							Type:        discordgo.ApplicationCommandOptionString,
+						},
+					},
+				},
+				{
+					Name:        "recompute",
+					Description: "Recompute exp and levels from the ledger",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "user",
+							Description: "Member to recompute, all members by default",
+							Type:        discordgo.ApplicationCommandOptionUser,
+						},
+					},
+				},
+				{
+					Name:        "history",
+					Description: "Show exp history of a member",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "user",
+							Description: "Member",
+							Type:        discordgo.ApplicationCommandOptionUser,
+							Required:    true,
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:        "invite-quality",
+			Description: "Set rules for qualified invites",
+			Type:        discordgo.ChatApplicationCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "min-account-age-days",
+					Description: "Min account age of invited members when joining, 0 to disable",
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					MinValue:    &levelSettingsMinValue,
+				},
+				{
+					Name:        "reject-default-avatar",
+					Description: "Members with the default avatar don't count",
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+				},
+				{
+					Name:        "require-activity",
+					Description: "Members must be active after joining",
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+				},
+				{
+					Name:        "min-stay-hours",
+					Description: "Members leaving after these hours still count, 0 if leaving never counts",
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					MinValue:    &levelSettingsMinValue,
+				},
+				{
+					Name:        "burst-window-minutes",
+					Description: "Window to detect invite bursts",
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					MinValue:    &levelSettingsMinValue,
+				},
+				{
+					Name:        "burst-threshold",
+					Description: "Invites within the window to flag a burst, 0 to disable",
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					MinValue:    &levelSettingsMinValue,
+				},
+			},
+		},
+		{
+			Name:        "campaign-funnel",
+			Description: "Show conversion of members who joined through campaign invites",
+			Type:        discordgo.ChatApplicationCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "invite-code",
+					Description: "Campaign invite code, the latest campaign invites if not set",
+					Type:        discordgo.ApplicationCommandOptionString,
+				},
+				{
+					Name:        "level",
+					Description: "Level members should reach, 5 by default",
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					MinValue:    &levelSettingsMinValue,
+				},
+			},
+		},
+		{
+			Name:        "invite-reward",
+			Description: "Add or remove rewards for reaching qualified invites",
+			Type:        discordgo.ChatApplicationCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "invites",
+					Description: "Qualified invites to reward",
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					Required:    true,
+					MinValue:    &inviteRewardMinValue,
+				},
+				{
+					Name:        "role",
+					Description: "Role granted at the milestone, revoked when invites drop below",
+					Type:        discordgo.ApplicationCommandOptionRole,
+				},
+				{
+					Name:        "quest-id",
+					Description: "Community quest rewarded once at the milestone",
+					Type:        discordgo.ApplicationCommandOptionString,
+				},
+				{
+					Name:        "remove",
+					Description: "Remove the reward instead",
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+				},
+			},
+		},
+		{
+			Name:        "stats",
+			Description: "Member activity, retention and dormant members",
+			Type:        discordgo.ChatApplicationCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "overview",
+					Description: "Daily active members, joins and leaves",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "days",
+							Description: "Last 30 days by default",
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Choices:     statsDaysChoices,
+						},
+					},
+				},
+				{
+					Name:        "retention",
+					Description: "Weekly retention of members by the week they joined",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "weeks",
+							Description: "Weeks of cohorts, 8 by default",
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							MinValue:    &statsMinWeeksValue,
+							MaxValue:    maxStatsWeeks,
+						},
+					},
+				},
+				{
+					Name:        "dormant",
+					Description: "Members who haven't been active for a while",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "days",
+							Description: "Days without activity, 30 by default",
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							MinValue:    &statsMinValue,
+						},
+						{
+							Name:        "page",
+							Description: "Page number",
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							MinValue:    &statsMinValue,
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:        "eligibility",
+			Description: "Check whether you meet the requirements of a campaign",
+			Type:        discordgo.ChatApplicationCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "campaign-id",
+					Description: "The campaign to check",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Required:    true,
+				},
+			},
+		},
+		{
+			Name: "list-twitter-space-snapshot",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+					Name:        "ongoing",
+					Description: "List ongoing snapshots for twitter space",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+					Name:        "finished",
+					Description: "List finished snapshots for twitter space",
+				},
+			},
+			Description: "List snapshots for twitter space",
+		},
+		{
+			Name:        "dashboard",
+			Description: "Get a link to the dashboard",
+		},
+		{
+			Name:        "export-policy",
+			Description: "Show or change retention of exported snapshot files",
+			Type:        discordgo.ChatApplicationCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "retention-days",
+					Description: "Days to keep exported files before removal",
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					MinValue:    &exportPolicyMinValue,
+				},
+				{
+					Name:        "link-expire-minutes",
+					Description: "Minutes a download link stays valid",
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					MinValue:    &exportPolicyMinValue,
+				},
+			},
+		},
+		{
+			Name:        "link-twitter",
+			Description: "Link your Twitter account",
+			Type:        discordgo.ChatApplicationCommand,
+		},
+		{
+			Name:        "relink-twitter",
+			Description: "Link another Twitter account instead of the current one",
+			Type:        discordgo.ChatApplicationCommand,
+		},
+		{
+			Name:        "unlink-twitter",
+			Description: "Unlink your Twitter account",
+			Type:        discordgo.ChatApplicationCommand,
+		},
+		{
+			Name:        "twitter-space-role",
+			Description: "Show or change roles granted for attending Twitter Spaces",
+			Type:        discordgo.ChatApplicationCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "role",
+					Description: "Role granted to linked members meeting the whitelist requirement",
+					Type:        discordgo.ApplicationCommandOptionRole,
+				},
+				{
+					Name:        "space-url",
+					Description: "Only for this Twitter Space, all Spaces if absent",
+					Type:        discordgo.ApplicationCommandOptionString,
+				},
+				{
+					Name:        "remove",
+					Description: "Stop granting the role",
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+				},
+			},
 		},
 	}
 )
@@ -9,6 +9,7 @@ import (
 	"moff.io/moff-social/internal/aws"
 	"moff.io/moff-social/internal/chains/moralis"
 	"moff.io/moff-social/internal/database"
+	"moff.io/moff-social/internal/identity"
 	"moff.io/moff-social/internal/walletconnect"
 	"moff.io/moff-social/pkg/concurrent"
 	"moff.io/moff-social/pkg/errors"
@@ -94,6 +95,12 @@ func verifyUserAssets(concurrency concurrent.Limiter, pipe *verifyUserAssetsPipe
 
 	if wallet.Confirmed() {
 		log.Debug("wallet confirmed")
+		// 记录已验证的钱包关联
+		_, err := identity.LinkWallet(pipe.interaction.Member.User.ID, pipe.interaction.GuildID, wallet.Accounts[0],
+			signMsg, wallet.Signature())
+		if err != nil {
+			log.Error(err)
+		}
 		// 校验用户的地址，检查所在的链是否存在tpr
 		roles, err := database.DiscordTokenPermissionedRole{}.SelectByGuildIDAndChainID(pipe.interaction.GuildID,
 			strconv.Itoa(wallet.ChainID))
@@ -0,0 +1,77 @@
+package discord
+
+import (
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"moff.io/moff-social/internal/database"
+	"moff.io/moff-social/pkg/log"
+)
+
+// manageInviteQuality 设置服务器合格邀请的规则，未指定的选项沿用之前的设置
+func manageInviteQuality(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if !IsAdminPermission(i.Member.Permissions) {
+		respondSnapshotError(s, i, "Not allowed:thinking: ")
+		return
+	}
+	rules, err := database.DiscordInviteQualityRules{}.SelectOne(i.GuildID)
+	if err != nil {
+		log.Error(err)
+		respondSnapshotError(s, i, "Unknown error")
+		return
+	}
+	options := i.ApplicationCommandData().Options
+	for _, option := range options {
+		switch option.Name {
+		case "min-account-age-days":
+			rules.MinAccountAgeDays = int(option.IntValue())
+		case "reject-default-avatar":
+			rules.RejectDefaultAvatar = option.BoolValue()
+		case "require-activity":
+			rules.RequireActivity = option.BoolValue()
+		case "min-stay-hours":
+			rules.MinStayHours = int(option.IntValue())
+		case "burst-window-minutes":
+			rules.BurstWindowMinutes = int(option.IntValue())
+		case "burst-threshold":
+			rules.BurstThreshold = int(option.IntValue())
+		}
+	}
+	if rules.BurstThreshold > 0 && rules.BurstWindowMinutes <= 0 {
+		respondSnapshotError(s, i, "Burst detection requires `burst-window-minutes` greater than 0")
+		return
+	}
+	title := "Invite quality rules"
+	if len(options) > 0 {
+		rules.UpdatedBy = i.Member.User.ID
+		if err := rules.Upsert(); err != nil {
+			log.Error(err)
+			respondSnapshotError(s, i, "Unknown error")
+			return
+		}
+		title = "Invite quality rules updated"
+	}
+	respondLevelSettings(s, i, title, inviteQualityRulesDesc(rules))
+}
+
+func inviteQualityRulesDesc(rules *database.DiscordInviteQualityRules) string {
+	desc := "Only qualified invites count on the leaderboard and for campaign rewards. An invite is qualified when the member:\n"
+	if rules.MinStayHours > 0 {
+		desc += fmt.Sprintf("\n• stays at least %v hours", rules.MinStayHours)
+	} else {
+		desc += "\n• is still in the server"
+	}
+	if rules.MinAccountAgeDays > 0 {
+		desc += fmt.Sprintf("\n• has an account at least %v days old when joining", rules.MinAccountAgeDays)
+	}
+	if rules.RejectDefaultAvatar {
+		desc += "\n• has a custom avatar"
+	}
+	if rules.RequireActivity {
+		desc += "\n• has been active after joining"
+	}
+	if rules.BurstThreshold > 0 {
+		desc += fmt.Sprintf("\n• isn't one of %v or more invites by the same inviter within %v minutes",
+			rules.BurstThreshold, rules.BurstWindowMinutes)
+	}
+	return desc
+}
@@ -0,0 +1,240 @@
+package discord
+
+import (
+	"context"
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"moff.io/moff-social/internal/database"
+	"moff.io/moff-social/pkg/errors"
+	"moff.io/moff-social/pkg/log"
+	"strings"
+)
+
+// evaluateInviteRewards 邀请者的被邀请者加入或离开后，按合格邀请数发放或收回里程碑奖励，失败时仅记录错误
+func evaluateInviteRewards(ctx context.Context, guildID, inviterID string) {
+	rewards, err := database.DiscordInviteRewards{}.SelectByGuild(guildID)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	if len(rewards) == 0 {
+		return
+	}
+	invites, err := database.DiscordGuildMemberInvites{}.UserTotalInvites(guildID, inviterID)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	var qualified int64
+	if len(invites) > 0 {
+		qualified = invites[0].GetValidInvitesCount()
+	}
+	member, err := session.State.Member(guildID, inviterID)
+	if err != nil {
+		member, err = session.GuildMember(guildID, inviterID)
+	}
+	if err != nil {
+		// 邀请者已离开服务器
+		log.Warnf("Guild %v inviter %v not found:%v", guildID, inviterID, err)
+		return
+	}
+
+	// 同一角色可能设置在多个里程碑，达到任一里程碑即保留
+	type inviteRewardRole struct {
+		reached   bool
+		rewardIDs []int64
+	}
+	roles := make(map[string]*inviteRewardRole)
+	for _, reward := range rewards {
+		reached := qualified >= int64(reward.Invites)
+		if reward.RoleID != "" {
+			role := roles[reward.RoleID]
+			if role == nil {
+				role = &inviteRewardRole{}
+				roles[reward.RoleID] = role
+			}
+			role.reached = role.reached || reached
+			role.rewardIDs = append(role.rewardIDs, reward.ID)
+		}
+		if !reached || reward.QuestID == "" {
+			continue
+		}
+		if err := grantInviteQuestReward(ctx, reward, inviterID, qualified); err != nil {
+			log.Error(err)
+		}
+	}
+	if len(roles) == 0 {
+		return
+	}
+	grants, err := database.DiscordInviteRewardGrants{}.SelectByMember(guildID, inviterID, database.DiscordInviteRewardGrantRole)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	grantedRewards := make(map[int64]*database.DiscordInviteRewardGrants, len(grants))
+	for _, grant := range grants {
+		grantedRewards[grant.RewardID] = grant
+	}
+	for roleID, role := range roles {
+		hasRole := false
+		for _, memberRole := range member.Roles {
+			if memberRole == roleID {
+				hasRole = true
+				break
+			}
+		}
+		switch {
+		case role.reached && !hasRole:
+			if err := session.GuildMemberRoleAdd(guildID, inviterID, roleID); err != nil {
+				log.Error(errors.WrapAndReport(err, fmt.Sprintf("grant invite reward role %v", roleID)))
+				continue
+			}
+			for _, rewardID := range role.rewardIDs {
+				grant := &database.DiscordInviteRewardGrants{
+					RewardID:  rewardID,
+					Kind:      database.DiscordInviteRewardGrantRole,
+					GuildID:   guildID,
+					DiscordID: inviterID,
+					Invites:   qualified,
+				}
+				if _, err := grant.Create(); err != nil {
+					log.Error(err)
+				}
+			}
+		case !role.reached:
+			// 仅收回本功能授予的角色，手动授予的角色没有发放记录
+			var granted []*database.DiscordInviteRewardGrants
+			for _, rewardID := range role.rewardIDs {
+				if grant := grantedRewards[rewardID]; grant != nil {
+					granted = append(granted, grant)
+				}
+			}
+			if len(granted) == 0 {
+				continue
+			}
+			if hasRole {
+				if err := session.GuildMemberRoleRemove(guildID, inviterID, roleID); err != nil {
+					log.Error(errors.WrapAndReport(err, fmt.Sprintf("revoke invite reward role %v", roleID)))
+					continue
+				}
+			}
+			for _, grant := range granted {
+				if err := grant.Delete(); err != nil {
+					log.Error(err)
+				}
+			}
+		}
+	}
+}
+
+// grantInviteQuestReward 先占用发放记录避免并发重复发放，奖励未发送成功时删除记录，在下次加入或离开时重试
+func grantInviteQuestReward(ctx context.Context, reward *database.DiscordInviteRewards, inviterID string, qualified int64) error {
+	grant := &database.DiscordInviteRewardGrants{
+		RewardID:  reward.ID,
+		Kind:      database.DiscordInviteRewardGrantQuest,
+		GuildID:   reward.GuildID,
+		DiscordID: inviterID,
+		Invites:   qualified,
+	}
+	first, err := grant.Create()
+	if err != nil || !first {
+		return err
+	}
+	log.Infof("Guild %v inviter %v reached %v qualified invites, reward quest %v", reward.GuildID, inviterID,
+		reward.Invites, reward.QuestID)
+	sent, err := triggerCommunityQuestReward(ctx, reward.GuildID, reward.QuestID, inviterID)
+	if err == nil && !sent {
+		err = errors.ErrorfAndReport("invite reward quest %v can not be rewarded", reward.QuestID)
+	}
+	if err != nil {
+		if e := grant.Delete(); e != nil {
+			log.Error(e)
+		}
+		return err
+	}
+	return nil
+}
+
+// manageInviteReward 添加或移除邀请里程碑奖励
+func manageInviteReward(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if !IsAdminPermission(i.Member.Permissions) {
+		respondSnapshotError(s, i, "Not allowed:thinking: ")
+		return
+	}
+	var (
+		reward = &database.DiscordInviteRewards{
+			GuildID:   i.GuildID,
+			CreatedBy: i.Member.User.ID,
+		}
+		remove bool
+	)
+	for _, option := range i.ApplicationCommandData().Options {
+		switch option.Name {
+		case "invites":
+			reward.Invites = int(option.IntValue())
+		case "role":
+			reward.RoleID = option.RoleValue(nil, "").ID
+		case "quest-id":
+			reward.QuestID = strings.TrimSpace(option.StringValue())
+		case "remove":
+			remove = option.BoolValue()
+		}
+	}
+	if reward.RoleID == "" && reward.QuestID == "" {
+		respondSnapshotError(s, i, "Please provide a role or a quest")
+		return
+	}
+	if remove {
+		err := reward.Delete()
+		if err != nil {
+			log.Error(err)
+			respondSnapshotError(s, i, "Unknown error")
+			return
+		}
+	} else {
+		if reward.QuestID != "" {
+			quest, err := database.CommunityQuestTemplate{}.SelectOne(reward.QuestID)
+			if err != nil {
+				log.Error(err)
+				respondSnapshotError(s, i, "Unknown error")
+				return
+			}
+			if quest == nil {
+				respondSnapshotError(s, i, fmt.Sprintf("Quest `%v` not found", reward.QuestID))
+				return
+			}
+			if !isRewardableQuest(quest) {
+				respondSnapshotError(s, i, fmt.Sprintf("Quest `%v` can not be rewarded automatically, only whitelist quests are supported", reward.QuestID))
+				return
+			}
+		}
+		if err := reward.Create(); err != nil {
+			log.Error(err)
+			respondSnapshotError(s, i, "Unknown error")
+			return
+		}
+	}
+	rewards, err := database.DiscordInviteRewards{}.SelectByGuild(i.GuildID)
+	if err != nil {
+		log.Error(err)
+		respondSnapshotError(s, i, "Unknown error")
+		return
+	}
+	var lines []string
+	for _, r := range rewards {
+		var items []string
+		if r.RoleID != "" {
+			items = append(items, fmt.Sprintf("<@&%v>", r.RoleID))
+		}
+		if r.QuestID != "" {
+			items = append(items, fmt.Sprintf("quest `%v`", r.QuestID))
+		}
+		lines = append(lines, fmt.Sprintf("**%v qualified invites**:%v", r.Invites, strings.Join(items, ", ")))
+	}
+	desc := "There are no invite rewards for now.."
+	if len(lines) > 0 {
+		desc = ellipsis("Roles granted by invite rewards are revoked when qualified invites drop below the milestone, quests are rewarded once.\n\n"+
+			strings.Join(lines, "\n"), 4090)
+	}
+	respondLevelSettings(s, i, "Invite rewards", desc)
+}
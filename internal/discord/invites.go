@@ -347,9 +347,7 @@ func resetInvitesCache(guilds []*discordgo.UserGuild) {
 	for _, guild := range guilds {
 		// 清空缓存的邀请数
 		guildCacheKey := fmt.Sprintf("%v%v", guildInvitesCacheKeyPrefix, guild.ID)
-		// 清空缓存的邀请者队列
-		potentialInvitersCacheKey := fmt.Sprintf("%v%v", discordPotentialInviterCacheKeyPrefix, guild.ID)
-		if err := cache.Redis.Del(ctx, guildCacheKey, potentialInvitersCacheKey).Err(); err != nil {
+		if err := cache.Redis.Del(ctx, guildCacheKey).Err(); err != nil {
 			log.Error(errors.WrapAndReport(err, "reset invites cache"))
 		}
 	}
@@ -372,19 +370,8 @@ func guildMemberAddEventHandler(s *discordgo.Session, a *discordgo.GuildMemberAd
 		EventTime: time.Now(),
 	})
 
-	pipe := newInviterMatchPipe(a.GuildID, a.User.ID)
-	inviterMatchPipes <- pipe
-	notification := <-pipe.inviterNotification
-	if notification.Invite == nil {
-		log.Warnf("guild %v member %v inviter not found", a.GuildID, a.User.ID)
-	} else {
-		millis := time.Since(notification.BufferTime).Milliseconds()
-		if int64(millis) > 3000 {
-			log.Warnf("Got inviter buffered %v seconds", millis)
-		} else {
-			log.Debugf("Got inviter buffered %v seconds", millis)
-		}
-	}
+	// 按批次对账邀请使用数，确定成员加入的来源
+	attribution := inviteTrackers.Match(a.Member)
 	// 尝试加入成员
 	member := database.DiscordMember{
 		GuildID:       a.GuildID,
@@ -400,33 +387,43 @@ func guildMemberAddEventHandler(s *discordgo.Session, a *discordgo.GuildMemberAd
 		log.Error(err)
 	}
 	// 添加邀请关系
-	invites := database.NewDiscordGuildMemberInvites(notification.Invite, a.Member)
+	invites := database.NewDiscordGuildMemberInvites(attribution.Invite, a.Member)
+	invites.Source = attribution.Source
+	invites.Confidence = attribution.Confidence
 	if err := invites.Create(); err != nil {
 		log.Errorf("member add event:%v", err)
 		return
 	}
+	markBurstInvites(invites)
+	if invites.InviterID != "" {
+		evaluateInviteRewards(context.TODO(), a.GuildID, invites.InviterID)
+	}
 
 	inviterId := ""
 	inviterName := ""
 	inviteCode := ""
-	if notification.Invite != nil {
-		inviteCode = notification.Invite.Code
-		inviterId = notification.Invite.Inviter.ID
-		inviterName = notification.Invite.Inviter.Username
+	if attribution.Invite != nil {
+		inviteCode = attribution.Invite.Code
+		if inviter := attribution.Invite.Inviter; inviter != nil {
+			inviterId = inviter.ID
+			inviterName = inviter.Username
+		}
 	}
 	rawEvent, err := json.Marshal(a)
 	if err == nil {
 		pubDiscordEvent(&database.DiscordInviteEvent{
-			GuildID:     a.GuildID,
-			EventType:   database.DiscordEventTypeGuildMemberAdd,
-			InviterId:   inviterId,
-			InviterName: inviterName,
-			InviteeId:   member.DiscordID,
-			InviteeName: member.Username,
-			InviteCode:  inviteCode,
-			RawEvent:    string(rawEvent),
-			EventTime:   time.Now().UTC().Format("2006-01-02 15:04:05.000 UTC"),
-			TotalMember: cache.GetOrUpdateGuildInfo(s, inviteCode, a.GuildID),
+			GuildID:      a.GuildID,
+			EventType:    database.DiscordEventTypeGuildMemberAdd,
+			InviterId:    inviterId,
+			InviterName:  inviterName,
+			InviteeId:    member.DiscordID,
+			InviteeName:  member.Username,
+			InviteCode:   inviteCode,
+			InviteSource: string(attribution.Source),
+			Confidence:   string(attribution.Confidence),
+			RawEvent:     string(rawEvent),
+			EventTime:    time.Now().UTC().Format("2006-01-02 15:04:05.000 UTC"),
+			TotalMember:  cache.GetOrUpdateGuildInfo(s, inviteCode, a.GuildID),
 		})
 	} else {
 		log.Errorf("failed to dump invite event: %v", err)
@@ -457,31 +454,54 @@ func guildMemberRemovedEventHandler(s *discordgo.Session, a *discordgo.GuildMemb
 		log.Error(err)
 	}
 	invites := database.NewDiscordGuildMemberInvites(nil, a.Member)
+	inviterIDs, err := invites.SelectActiveInviters()
+	if err != nil {
+		log.Error(err)
+	}
 	err = invites.UpdateInviteeLeave()
 	if err != nil {
 		log.Errorf("update invites left:%v", err)
 		return
 	}
+	// 被邀请者离开后邀请者的合格邀请数可能减少
+	for _, inviterID := range inviterIDs {
+		evaluateInviteRewards(context.TODO(), a.GuildID, inviterID)
+	}
 	log.Debugf("update guild member %v left", invites.InviteeID)
 }
 
-func showUserInvitesInfo(s *discordgo.Session, m *discordgo.MessageCreate) {
-	users, err := database.DiscordGuildMemberInvites{}.UserTotalInvites(m.GuildID, m.Author.ID)
+// markBurstInvites 按服务器规则检测邀请者的突发邀请
+func markBurstInvites(invites *database.DiscordGuildMemberInvites) {
+	if invites.InviterID == "" {
+		return
+	}
+	rules, err := database.DiscordInviteQualityRules{}.SelectOne(invites.GuildID)
 	if err != nil {
 		log.Error(err)
 		return
 	}
-	var (
-		valid, total, fake, leave int64
-	)
+	if err := invites.MarkBurst(rules.BurstWindow(), rules.BurstThreshold); err != nil {
+		log.Error(err)
+	}
+}
+
+// memberInvitesContent 成员的邀请统计，各项不合格原因可能重叠
+func memberInvitesContent(users []*database.DiscordInviteLeaderboard) string {
+	var l database.DiscordInviteLeaderboard
 	if len(users) > 0 {
-		valid = users[0].GetValidInvitesCount()
-		total = users[0].InviteNum
-		fake = users[0].Newbee
-		leave = users[0].Leave
+		l = *users[0]
 	}
-	content := fmt.Sprintf("\n✅ **%v** joins\n👶 **%v** fakes (account too young)\n❌ %v leaves\n\nYou have %v invites ! :clap:",
-		total, fake, leave, valid)
+	return fmt.Sprintf("\n✅ **%v** joins\n👶 **%v** fakes (account too young)\n🖼 **%v** default avatars\n💤 **%v** inactive\n⚡ **%v** burst invites\n❌ %v leaves\n\nYou have %v qualified invites ! :clap:",
+		l.InviteNum, l.Newbee, l.DefaultAvatar, l.Inactive, l.Burst, l.Leave, l.GetValidInvitesCount())
+}
+
+func showUserInvitesInfo(s *discordgo.Session, m *discordgo.MessageCreate) {
+	users, err := database.DiscordGuildMemberInvites{}.UserTotalInvites(m.GuildID, m.Author.ID)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	content := memberInvitesContent(users)
 	_, err = s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
 		Embeds: []*discordgo.MessageEmbed{
 			{
@@ -529,17 +549,7 @@ func respondMemberInvitesAmount(s *discordgo.Session, i *discordgo.InteractionCr
 		interactionResponseEditOnError(s, i)
 		return
 	}
-	var (
-		valid, total, fake, leave int64
-	)
-	if len(users) > 0 {
-		valid = users[0].GetValidInvitesCount()
-		total = users[0].InviteNum
-		fake = users[0].Newbee
-		leave = users[0].Leave
-	}
-	content := fmt.Sprintf("\n✅ **%v** joins\n👶 **%v** fakes (account too young)\n❌ %v leaves\n\nYou have %v invites ! :clap:",
-		total, fake, leave, valid)
+	content := memberInvitesContent(users)
 	_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
 		Embeds: &[]*discordgo.MessageEmbed{
 			{
@@ -563,10 +573,10 @@ func respondInvitesLeaderboard(s *discordgo.Session, i *discordgo.InteractionCre
 		return
 	}
 
-	content := "moff's invites leaderboard TOP 20.\n\n✅ Valid invites\n♾ All invites\n👶 Fake invites (account too young)\n❌Leave\n"
+	content := "moff's invites leaderboard TOP 20.\n\n✅ Qualified invites\n♾ All invites\n👶 Fake invites (account too young)\n⚡ Burst invites\n❌Leave\n"
 	for idx, l := range total {
-		content += fmt.Sprintf("\n**%v** | <@%v> -> ✅∶**%v**  ♾∶**%v**  👶:**%v** ❌:**%v**\n", idx+1, l.InviterID,
-			l.GetValidInvitesCount(), l.InviteNum, l.Newbee, l.Leave)
+		content += fmt.Sprintf("\n**%v** | <@%v> -> ✅∶**%v**  ♾∶**%v**  👶:**%v** ⚡:**%v** ❌:**%v**\n", idx+1, l.InviterID,
+			l.GetValidInvitesCount(), l.InviteNum, l.Newbee, l.Burst, l.Leave)
 	}
 	_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
 		Embeds: &[]*discordgo.MessageEmbed{
@@ -10,178 +10,429 @@ import (
 	"gorm.io/gorm"
 	"moff.io/moff-social/internal/cache"
 	"moff.io/moff-social/internal/database"
+	"moff.io/moff-social/pkg/common"
 	"moff.io/moff-social/pkg/errors"
 	"moff.io/moff-social/pkg/log"
+	"sort"
 	"strconv"
+	"sync"
 	"time"
 )
 
 const (
 	guildInvitesCacheKeyPrefix = "guild_invites:"
+	// 服务器自定义链接的使用数与邀请使用数缓存在同一个hash中
+	vanityInviteCacheKey = "vanity"
+	// 收集同一批次加入成员的时间窗口，窗口内的加入与使用数变化一起对账
+	inviteReconcileWindow = time.Millisecond * 1500
+	// 未被认领的使用数保留的时长，等待之后到达的加入事件
+	inviteLeftoverTTL = time.Second * 30
+	// 查询审计日志中最近被删除的邀请的时长
+	inviteDeleteAuditWindow = time.Minute * 5
 )
 
 var (
-	// 邀请者队列, 用于GuildMemberAddEventHandler读取加入工会的成员的邀请者:
-	// 用户加工会事件发生时，触发daemon去discord拉取最新的invites列表，
-	// 同本地缓存邀请列表进行比较，当邀请者的邀请使用数增加N,会把N份邀请者放入该队列
-	inviterMatchPipes chan *inviterMatchPipe
+	// 每个服务器独立的邀请者匹配协程，用于GuildMemberAddEventHandler读取加入工会的成员的来源
+	inviteTrackers *guildInviteTrackers
 )
 
 type inviterMatchPipe struct {
-	guildID             string
-	inviteeID           string
-	inviterNotification chan *guildInviter
+	invitee             *discordgo.Member
+	inviterNotification chan *inviteAttribution
 }
 
-type guildInviter struct {
-	Invite     *discordgo.Invite `json:"invite"`
-	BufferTime time.Time         `json:"buffer_time"`
+// inviteAttribution 成员加入的来源，服务器自定义链接的Invite没有邀请者，来源未知或服务器发现时Invite为空
+type inviteAttribution struct {
+	Invite     *discordgo.Invite
+	Source     database.DiscordInviteSource
+	Confidence database.DiscordInviteConfidence
 }
 
-func (guildInviter) Dequeue(ctx context.Context, guildID string) (*guildInviter, error) {
-	result, err := cache.Redis.RPop(ctx, fmt.Sprintf("%v%v", discordPotentialInviterCacheKeyPrefix, guildID)).Result()
-	if errors.Is(err, redis.Nil) {
-		return nil, nil
+// inviteUse 对账时发现的某个来源增加的使用数
+type inviteUse struct {
+	key        string
+	invite     *discordgo.Invite
+	source     database.DiscordInviteSource
+	count      int
+	confidence database.DiscordInviteConfidence
+	seenAt     time.Time
+}
+
+type guildVanityURL struct {
+	Code string `json:"code"`
+	Uses int    `json:"uses"`
+}
+
+type guildInviteTrackers struct {
+	ctx     context.Context
+	session *discordgo.Session
+	lock    sync.Mutex
+	guilds  map[string]*guildInviteTracker
+}
+
+func newGuildInviteTrackers(ctx context.Context, s *discordgo.Session) *guildInviteTrackers {
+	return &guildInviteTrackers{
+		ctx:     ctx,
+		session: s,
+		guilds:  make(map[string]*guildInviteTracker),
 	}
-	if err != nil {
-		return nil, errors.WrapfAndReport(err, "query potential inviter from cache")
+}
+
+// Match 阻塞等待成员所在批次对账完成，返回成员加入的来源
+func (in *guildInviteTrackers) Match(invitee *discordgo.Member) *inviteAttribution {
+	pipe := &inviterMatchPipe{
+		invitee:             invitee,
+		inviterNotification: make(chan *inviteAttribution, 1),
 	}
-	var inviter guildInviter
-	if err := json.Unmarshal([]byte(result), &inviter); err != nil {
-		return nil, errors.WrapfAndReport(err, "unmarshal potential inviter")
+	in.guild(invitee.GuildID).pipes <- pipe
+	return <-pipe.inviterNotification
+}
+
+// guild 首次有成员加入时为该服务器启动匹配协程
+func (in *guildInviteTrackers) guild(guildID string) *guildInviteTracker {
+	in.lock.Lock()
+	defer in.lock.Unlock()
+	tracker := in.guilds[guildID]
+	if tracker == nil {
+		tracker = &guildInviteTracker{
+			guildID:  guildID,
+			pipes:    make(chan *inviterMatchPipe, 500),
+			snapshot: make(map[string]*discordgo.Invite),
+		}
+		in.guilds[guildID] = tracker
+		go tracker.run(in.ctx, in.session)
 	}
-	return &inviter, nil
+	return tracker
 }
 
-func newInviterMatchPipe(guildID, inviteeID string) *inviterMatchPipe {
-	return &inviterMatchPipe{
-		guildID:             guildID,
-		inviteeID:           inviteeID,
-		inviterNotification: make(chan *guildInviter, 2),
+// guildInviteTracker 按批次对账单个服务器的加入事件与邀请使用数变化
+type guildInviteTracker struct {
+	guildID string
+	pipes   chan *inviterMatchPipe
+	// 上次拉取的邀请，用于判断消失的邀请是否因用完次数被删除
+	snapshot map[string]*discordgo.Invite
+	// 使用数增加但尚未被加入事件认领的来源
+	leftovers []*inviteUse
+	// 对账失败且未能重置缓存，缓存中的使用数已过期，下次对账得到的变化不可信
+	stale bool
+}
+
+func (in *guildInviteTracker) run(ctx context.Context, s *discordgo.Session) {
+	log.Infof("Discord guild %v inviter tracker running...", in.guildID)
+	defer log.Infof("Discord guild %v inviter tracker stopped...", in.guildID)
+	for {
+		select {
+		case pipe := <-in.pipes:
+			in.reconcile(ctx, s, in.collect(ctx, pipe))
+		case <-ctx.Done():
+			return
+		}
 	}
 }
 
-const (
-	discordPotentialInviterCacheKeyPrefix = "discord_potential_inviter:"
-)
+// collect 收集窗口期内同时加入的成员
+func (in *guildInviteTracker) collect(ctx context.Context, first *inviterMatchPipe) []*inviterMatchPipe {
+	batch := []*inviterMatchPipe{first}
+	timer := time.NewTimer(inviteReconcileWindow)
+	defer timer.Stop()
+	for {
+		select {
+		case pipe := <-in.pipes:
+			batch = append(batch, pipe)
+		case <-timer.C:
+			return batch
+		case <-ctx.Done():
+			return batch
+		}
+	}
+}
 
-func blockingTrackGuildInviter(ctx context.Context, s *discordgo.Session) {
-	log.Info("Discord guild inviter tracker running...")
+// reconcile 拉取最新的邀请及自定义链接使用数，与缓存比较后把增加的使用数按加入顺序分配给本批次的成员
+func (in *guildInviteTracker) reconcile(ctx context.Context, s *discordgo.Session, batch []*inviterMatchPipe) {
+	attributions := make([]*inviteAttribution, len(batch))
 	defer func() {
 		if i := recover(); i != nil {
-			log.Errorf("guild inviter tracker panic:%v", i)
+			log.Errorf("guild %v inviter tracker panic:%v", in.guildID, i)
 		}
-		log.Info("Discord guild inviter tracker stopped...")
-	}()
-	for pipe := range inviterMatchPipes {
-		var (
-			foundPotential bool
-		)
-		// 潜在的工会邀请人
-		for {
-			potential, err := guildInviter{}.Dequeue(ctx, pipe.guildID)
-			if err != nil {
-				log.Error(err)
-				continue
+		// 无论对账是否成功都需要通知等待中的加入事件
+		for idx, pipe := range batch {
+			attribution := attributions[idx]
+			if attribution == nil {
+				attribution = &inviteAttribution{
+					Source:     database.DiscordInviteSourceUnknown,
+					Confidence: database.DiscordInviteConfidenceLow,
+				}
 			}
-			// 找不到潜在的邀请人
-			if potential == nil {
-				break
+			pipe.inviterNotification <- attribution
+		}
+	}()
+	sort.SliceStable(batch, func(i, j int) bool {
+		return batch[i].invitee.JoinedAt.Before(batch[j].invitee.JoinedAt)
+	})
+
+	uses, err := in.collectUses(ctx, s)
+	if err != nil {
+		// 本批次来源未知，以最新使用数重置缓存，避免本批次的使用数被分配给之后加入的成员
+		log.Error(err)
+		if err := in.resetUses(ctx, s); err != nil {
+			log.Error(err)
+			in.stale = true
+		}
+		return
+	}
+	if in.stale {
+		// 缓存过期期间的使用数变化混杂了之前批次的加入，丢弃后以本次结果为准
+		log.Warnf("drop guild %v stale invite uses %v", in.guildID, len(uses))
+		in.stale = false
+		return
+	}
+	// 之前批次未被认领的使用数优先分配
+	now := time.Now()
+	var candidates []*inviteUse
+	for _, use := range in.leftovers {
+		if now.Sub(use.seenAt) > inviteLeftoverTTL {
+			log.Warnf("drop guild %v unclaimed invite %v uses %v", in.guildID, use.key, use.count)
+			continue
+		}
+		use.confidence = database.DiscordInviteConfidenceMedium
+		candidates = append(candidates, use)
+	}
+	candidates = append(candidates, uses...)
+
+	// 本批次所有成员都来自同一个来源时可以确定对应关系
+	total := 0
+	for _, use := range candidates {
+		total += use.count
+	}
+	certain := len(candidates) == 1 && total == len(batch)
+
+	guild, _ := s.State.Guild(in.guildID)
+	discoverable := guild != nil && hasGuildFeature(guild, discordgo.GuildFeatureDiscoverable)
+	for idx, pipe := range batch {
+		if len(candidates) == 0 {
+			// 没有任何来源的使用数增加，开启服务器发现时通常来自发现页
+			attribution := &inviteAttribution{
+				Source:     database.DiscordInviteSourceUnknown,
+				Confidence: database.DiscordInviteConfidenceLow,
 			}
-			sec := time.Since(potential.BufferTime).Milliseconds()
-			if sec > 5000 {
-				log.Warnf("drop potential inviter %v which cached %v milliseconds", potential.Invite.Inviter.ID, sec)
-				continue
+			if discoverable {
+				attribution.Source = database.DiscordInviteSourceDiscovery
 			}
-			pipe.inviterNotification <- potential
-			foundPotential = true
-			break
-		}
-		if foundPotential {
+			attributions[idx] = attribution
+			log.Warnf("guild %v member %v inviter not found, attributed to %v", in.guildID, pipe.invitee.User.ID,
+				attribution.Source)
 			continue
 		}
+		use := candidates[0]
+		confidence := use.confidence
+		if !certain && confidence == database.DiscordInviteConfidenceHigh {
+			confidence = database.DiscordInviteConfidenceMedium
+		}
+		attributions[idx] = &inviteAttribution{
+			Invite:     use.invite,
+			Source:     use.source,
+			Confidence: confidence,
+		}
+		log.Infof("Discord invite matched: source %v code %v, invitee %v, confidence %v", use.source, use.invite.Code,
+			pipe.invitee.User.ID, confidence)
+		use.count--
+		if use.count == 0 {
+			candidates = candidates[1:]
+		}
+	}
+	in.leftovers = candidates
+}
 
-		// 查找当前工会的邀请记录与缓存记录进行对比, 查找潜在的邀请人
-		latestGuildInvites, err := GetGuildInvitesFromDiscord(s, &discordgo.UserGuild{ID: pipe.guildID})
-		if err != nil {
-			log.Errorf("discord guild inviter:%v", err)
+// collectUses 对比缓存的使用数，返回各个来源增加的使用数并更新缓存
+func (in *guildInviteTracker) collectUses(ctx context.Context, s *discordgo.Session) ([]*inviteUse, error) {
+	latestInvites, err := s.GuildInvites(in.guildID)
+	if err != nil {
+		return nil, errors.WrapfAndReport(err, "query guild %v invites from discord", in.guildID)
+	}
+	guildInvitesCacheKey := fmt.Sprintf("%v%v", guildInvitesCacheKeyPrefix, in.guildID)
+	cachedInvites, err := cache.Redis.HGetAll(ctx, guildInvitesCacheKey).Result()
+	if err != nil {
+		return nil, errors.WrapAndReport(err, "query cache guild invites")
+	}
+	cached := convertMapStringValueToInt(cachedInvites)
+	latest := deduplicateGuildInvites(latestInvites)
+
+	var (
+		now                = time.Now()
+		uses               []*inviteUse
+		invitesCacheValues []interface{}
+		vanishedKeys       []string
+	)
+	keys := make([]string, 0, len(latest))
+	for key := range latest {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		invite := latest[key]
+		invitesCacheValues = append(invitesCacheValues, key, invite.Uses)
+		if delta := invite.Uses - cached[key]; delta > 0 {
+			uses = append(uses, &inviteUse{
+				key:        key,
+				invite:     invite,
+				source:     database.DiscordInviteSourceInvite,
+				count:      delta,
+				confidence: database.DiscordInviteConfidenceHigh,
+				seenAt:     now,
+			})
+		}
+	}
+
+	// 限制使用次数的邀请在最后一次使用后会被删除，需排除过期及被管理员删除的邀请
+	var deleted map[string]bool
+	for key, used := range cached {
+		if key == vanityInviteCacheKey || latest[key] != nil {
 			continue
 		}
-		latestMemberInvites := deduplicateGuildInvites(latestGuildInvites[pipe.guildID])
-		cachedInvites, err := cache.Redis.HGetAll(ctx, fmt.Sprintf("%v%v", guildInvitesCacheKeyPrefix, pipe.guildID)).Result()
-		if err != nil {
-			log.Errorf("query cache guild invites:%v", err)
+		vanishedKeys = append(vanishedKeys, key)
+		last := in.snapshot[key]
+		if last == nil || last.MaxUses <= 0 || last.MaxUses <= used {
 			continue
 		}
-		var (
-			inviterMatched         bool
-			potentialInvitersCache []interface{}
-			invitesCacheValues     []interface{}
-		)
-		cached := convertMapStringValueToInt(cachedInvites)
-		guildInvitesCacheKey := fmt.Sprintf("%v%v", guildInvitesCacheKeyPrefix, pipe.guildID)
-		for inviterKey, invite := range latestMemberInvites {
-			invitesCacheValues = append(invitesCacheValues, inviterKey, invite.Uses)
-			used := cached[inviterKey]
-			// TODO 此处需要根据使用次数、缓存对应次数该用户
-			if invite.Uses > used {
-				// 检查是否已经触发邀请者匹配，有更多的邀请者则把邀请者放入潜在的邀请者队列
-				if !inviterMatched {
-					inviterMatched = true
-					pipe.inviterNotification <- &guildInviter{
-						Invite:     invite,
-						BufferTime: time.Now(),
-					}
-					log.Infof("Discord invite matched: inviter %v code %v, invitee %v", invite.Inviter.ID,
-						invite.Code, pipe.inviteeID)
-					// 尝试把该用户的邀请的使用数+1
-					if e := cache.Redis.HIncrBy(ctx, guildInvitesCacheKey, inviterKey, 1).Err(); e != nil {
-						log.Error(errors.WrapAndReport(err, "increment user invite use count"))
-					}
-					continue
-				}
-				log.Debugf("discord potential inviter %v found:latest %v, used %v", invite.Inviter.ID, invite.Uses, used)
-				var inviterJSON []byte
-				// 同时多次使用?实际此时没法判定，此时仅按一个计算，多余的按找不到处理
-				inviterJSON, err = json.Marshal(guildInviter{
-					Invite:     invite,
-					BufferTime: time.Now(),
-				})
-				if err != nil {
-					err = errors.WrapAndReport(err, "marshal potential inviter")
-					break
-				}
-				potentialInvitersCache = append(potentialInvitersCache, string(inviterJSON))
+		if last.MaxAge > 0 && last.CreatedAt.Add(time.Duration(last.MaxAge)*time.Second).Before(now) {
+			continue
+		}
+		if deleted == nil {
+			if deleted, err = deletedInviteCodes(s, in.guildID); err != nil {
+				log.Error(err)
+				continue
 			}
 		}
-		// 先检查是否匹配到邀请者，再检查是否发生错误
-		if !inviterMatched {
-			pipe.inviterNotification <- &guildInviter{}
+		if deleted[last.Code] {
+			continue
 		}
+		uses = append(uses, &inviteUse{
+			key:        key,
+			invite:     last,
+			source:     database.DiscordInviteSourceInvite,
+			count:      last.MaxUses - used,
+			confidence: database.DiscordInviteConfidenceMedium,
+			seenAt:     now,
+		})
+	}
+
+	// 服务器自定义链接，首次查询时仅记录使用数
+	if guild, _ := s.State.Guild(in.guildID); guild != nil && hasGuildFeature(guild, discordgo.GuildFeatureVanityURL) {
+		vanity, err := getGuildVanityURL(s, in.guildID)
 		if err != nil {
 			log.Error(err)
-			continue
+		} else if vanity.Code != "" {
+			invitesCacheValues = append(invitesCacheValues, vanityInviteCacheKey, vanity.Uses)
+			if used, ok := cached[vanityInviteCacheKey]; ok && vanity.Uses > used {
+				uses = append(uses, &inviteUse{
+					key:        vanityInviteCacheKey,
+					invite:     &discordgo.Invite{Code: vanity.Code, Uses: vanity.Uses},
+					source:     database.DiscordInviteSourceVanity,
+					count:      vanity.Uses - used,
+					confidence: database.DiscordInviteConfidenceHigh,
+					seenAt:     now,
+				})
+			}
 		}
+	}
+	in.snapshot = latest
 
-		// 缓存潜在邀请者队列与邀请数快照
-		potentialInvitersCacheKey := fmt.Sprintf("%v%v", discordPotentialInviterCacheKeyPrefix, pipe.guildID)
-		_, err = cache.Redis.TxPipelined(ctx, func(pipeliner redis.Pipeliner) error {
-			if len(invitesCacheValues) > 0 {
-				if err := pipeliner.HMSet(ctx, guildInvitesCacheKey, invitesCacheValues...).Err(); err != nil {
-					return errors.WrapAndReport(err, "cache guild invites")
-				}
+	_, err = cache.Redis.TxPipelined(ctx, func(pipeliner redis.Pipeliner) error {
+		if len(invitesCacheValues) > 0 {
+			if err := pipeliner.HMSet(ctx, guildInvitesCacheKey, invitesCacheValues...).Err(); err != nil {
+				return errors.WrapAndReport(err, "cache guild invites")
 			}
-			if len(potentialInvitersCache) > 0 {
-				if err := pipeliner.LPush(ctx, potentialInvitersCacheKey, potentialInvitersCache...).Err(); err != nil {
-					return errors.WrapAndReport(err, "cache potential inviters")
-				}
+		}
+		if len(vanishedKeys) > 0 {
+			if err := pipeliner.HDel(ctx, guildInvitesCacheKey, vanishedKeys...).Err(); err != nil {
+				return errors.WrapAndReport(err, "remove vanished guild invites")
 			}
-			return nil
-		})
+		}
+		return nil
+	})
+	return uses, errors.Wrap(err, "exec redis tx pipelined")
+}
+
+// resetUses 以最新的使用数覆盖缓存，丢弃尚未对账的使用数变化
+func (in *guildInviteTracker) resetUses(ctx context.Context, s *discordgo.Session) error {
+	latestInvites, err := s.GuildInvites(in.guildID)
+	if err != nil {
+		return errors.WrapfAndReport(err, "query guild %v invites from discord", in.guildID)
+	}
+	latest := deduplicateGuildInvites(latestInvites)
+	var invitesCacheValues []interface{}
+	for key, invite := range latest {
+		invitesCacheValues = append(invitesCacheValues, key, invite.Uses)
+	}
+	// 自定义链接查询失败时不写入，下次对账视为首次查询
+	if guild, _ := s.State.Guild(in.guildID); guild != nil && hasGuildFeature(guild, discordgo.GuildFeatureVanityURL) {
+		vanity, err := getGuildVanityURL(s, in.guildID)
 		if err != nil {
-			log.Error(errors.Wrap(err, "exec redis tx pipelined"))
+			log.Error(err)
+		} else if vanity.Code != "" {
+			invitesCacheValues = append(invitesCacheValues, vanityInviteCacheKey, vanity.Uses)
+		}
+	}
+	guildInvitesCacheKey := fmt.Sprintf("%v%v", guildInvitesCacheKeyPrefix, in.guildID)
+	_, err = cache.Redis.TxPipelined(ctx, func(pipeliner redis.Pipeliner) error {
+		pipeliner.Del(ctx, guildInvitesCacheKey)
+		if len(invitesCacheValues) > 0 {
+			pipeliner.HMSet(ctx, guildInvitesCacheKey, invitesCacheValues...)
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.WrapfAndReport(err, "reset guild %v invites cache", in.guildID)
+	}
+	in.snapshot = latest
+	return nil
+}
+
+func hasGuildFeature(guild *discordgo.Guild, feature discordgo.GuildFeature) bool {
+	for _, f := range guild.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// getGuildVanityURL 查询服务器自定义链接及其使用数，需要管理服务器权限
+func getGuildVanityURL(s *discordgo.Session, guildID string) (*guildVanityURL, error) {
+	endpoint := discordgo.EndpointGuild(guildID)
+	body, err := s.RequestWithBucketID("GET", endpoint+"/vanity-url", nil, endpoint+"/vanity-url")
+	if err != nil {
+		return nil, errors.WrapfAndReport(err, "query guild %v vanity url", guildID)
+	}
+	var vanity guildVanityURL
+	if err := json.Unmarshal(body, &vanity); err != nil {
+		return nil, errors.WrapAndReport(err, "unmarshal guild vanity url")
+	}
+	return &vanity, nil
+}
+
+// deletedInviteCodes 审计日志中最近被删除的邀请，这些邀请消失不是因为用完次数
+func deletedInviteCodes(s *discordgo.Session, guildID string) (map[string]bool, error) {
+	auditLog, err := s.GuildAuditLog(guildID, "", "", int(discordgo.AuditLogActionInviteDelete), 50)
+	if err != nil {
+		return nil, errors.WrapfAndReport(err, "query guild %v invite delete audit log", guildID)
+	}
+	codes := make(map[string]bool)
+	for _, entry := range auditLog.AuditLogEntries {
+		deletedAt := common.DecodeTimeInSnowflake(entry.ID)
+		if deletedAt == nil || time.Since(*deletedAt) > inviteDeleteAuditWindow {
+			continue
+		}
+		for _, change := range entry.Changes {
+			if change.Key == nil || *change.Key != discordgo.AuditLogChangeKeyCode {
+				continue
+			}
+			if code, ok := change.OldValue.(string); ok {
+				codes[code] = true
+			}
 		}
 	}
+	return codes, nil
 }
 
 func convertMapStringValueToInt(m map[string]string) map[string]int {
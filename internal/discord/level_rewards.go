@@ -0,0 +1,190 @@
+package discord
+
+import (
+	"context"
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"moff.io/moff-social/internal/aws"
+	"moff.io/moff-social/internal/config"
+	"moff.io/moff-social/internal/database"
+	"moff.io/moff-social/pkg/errors"
+	"moff.io/moff-social/pkg/log"
+	"strconv"
+	"strings"
+)
+
+// memberLevelUp 成员从From级升至To级，可能一次跨越多级
+type memberLevelUp struct {
+	Member   *database.DiscordMember
+	Settings *database.DiscordLevelSettings
+	From     int
+	To       int
+}
+
+// onMemberLevelUp 发放升级奖励并公告，经验已保存，失败时仅记录错误
+func onMemberLevelUp(ctx context.Context, event *memberLevelUp) {
+	log.Infof("Guild %v member %v level up %v -> %v", event.Member.GuildID, event.Member.DiscordID, event.From, event.To)
+	reconcileLevelRoles(event.Member, event.From, event.To)
+	rewards, err := database.DiscordLevelRewards{}.SelectBetween(event.Member.GuildID, event.From, event.To)
+	if err != nil {
+		log.Error(err)
+	}
+	for _, reward := range rewards {
+		if reward.QuestID != "" {
+			if _, err := triggerCommunityQuestReward(ctx, reward.GuildID, reward.QuestID, event.Member.DiscordID); err != nil {
+				log.Error(err)
+			}
+		}
+	}
+	// 等级类任务由任务服务重新检查
+	err = aws.Client.MultiTrySendMessageToSQS(ctx, config.Global.DiscordBot.MessageQueues.GenerateCommunityQuestRewardsQueue,
+		newDiscordUserCommunityQuestForceCheck(event.Member.DiscordID).Marshal(), 3)
+	if err != nil {
+		log.Error(err)
+	}
+	if err := announceMemberLevelUp(event); err != nil {
+		log.Error(err)
+	}
+}
+
+// onMemberLevelDown 扣除、清零或衰减经验后等级下降，收回不再满足等级的角色，已触发的任务奖励不收回
+func onMemberLevelDown(member *database.DiscordMember, from, to int) {
+	log.Infof("Guild %v member %v level down %v -> %v", member.GuildID, member.DiscordID, from, to)
+	reconcileLevelRoles(member, from, to)
+}
+
+// reconcileLevelRoles 等级从from变为to后按新等级授予或收回等级角色，失败时仅记录错误
+func reconcileLevelRoles(member *database.DiscordMember, from, to int) {
+	rewards, err := database.DiscordLevelRewards{}.SelectByGuild(member.GuildID)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	grant, revoke := levelRoleChanges(rewards, from, to)
+	for _, roleID := range grant {
+		if err := session.GuildMemberRoleAdd(member.GuildID, member.DiscordID, roleID); err != nil {
+			log.Error(errors.WrapAndReport(err, fmt.Sprintf("grant level %v role %v", to, roleID)))
+		}
+	}
+	for _, roleID := range revoke {
+		if err := session.GuildMemberRoleRemove(member.GuildID, member.DiscordID, roleID); err != nil {
+			log.Error(errors.WrapAndReport(err, fmt.Sprintf("revoke level %v role %v", from, roleID)))
+		}
+	}
+}
+
+// levelRoleChanges 等级从from变为to后需要授予及收回的等级角色，同一角色设置在多个等级时满足最低等级即保留
+func levelRoleChanges(rewards []*database.DiscordLevelRewards, from, to int) (grant, revoke []string) {
+	minLevels := make(map[string]int)
+	var roleIDs []string
+	for _, reward := range rewards {
+		if reward.RoleID == "" {
+			continue
+		}
+		level, ok := minLevels[reward.RoleID]
+		if !ok {
+			roleIDs = append(roleIDs, reward.RoleID)
+		}
+		if !ok || reward.Level < level {
+			minLevels[reward.RoleID] = reward.Level
+		}
+	}
+	for _, roleID := range roleIDs {
+		held, holds := minLevels[roleID] <= from, minLevels[roleID] <= to
+		switch {
+		case holds && !held:
+			grant = append(grant, roleID)
+		case held && !holds:
+			revoke = append(revoke, roleID)
+		}
+	}
+	return grant, revoke
+}
+
+// isRewardableQuest 仅白名单类任务可由机器人直接触发奖励，其他任务由任务服务检查
+func isRewardableQuest(quest *database.CommunityQuestTemplate) bool {
+	return quest.RequirementsType == database.CommunityQuestTemplateRequirementsTypeWhitelist
+}
+
+// triggerCommunityQuestReward 白名单类任务将成员加入白名单后触发奖励，其他任务由任务服务检查，返回是否已发送奖励
+func triggerCommunityQuestReward(ctx context.Context, guildID, questID, discordID string) (bool, error) {
+	quest, err := database.CommunityQuestTemplate{}.SelectOne(questID)
+	if err != nil {
+		return false, err
+	}
+	if quest == nil {
+		log.Warnf("Guild %v reward quest %v not found", guildID, questID)
+		return false, nil
+	}
+	if !isRewardableQuest(quest) {
+		return false, nil
+	}
+	whitelistID, _ := quest.Requirements["whitelist_id"].(string)
+	if whitelistID == "" {
+		return false, errors.ErrorfAndReport("reward quest %v without whitelist", quest.QuestID)
+	}
+	if err := (database.CommunityQuestWhitelistUser{}).AddDiscordIDs(whitelistID, []string{discordID}); err != nil {
+		return false, err
+	}
+	err = aws.Client.MultiTrySendMessageToSQS(ctx, config.Global.DiscordBot.MessageQueues.GenerateCommunityQuestRewardsQueue,
+		newDiscordUserCommunityQuestRewardFromWhitelist(quest, []string{discordID}).Marshal(), 3)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// announceMemberLevelUp 使用回复模板发送升级公告，模板支持{user}、{username}、{level}及{from}
+func announceMemberLevelUp(event *memberLevelUp) error {
+	if event.Settings.AnnounceChannelID == "" {
+		return nil
+	}
+	replacer := strings.NewReplacer(
+		"{user}", fmt.Sprintf("<@%v>", event.Member.DiscordID),
+		"{username}", event.Member.Username,
+		"{level}", strconv.Itoa(event.To),
+		"{from}", strconv.Itoa(event.From),
+	)
+	msg := &discordgo.MessageSend{
+		Content: fmt.Sprintf("<@%v>", event.Member.DiscordID),
+		Embeds: []*discordgo.MessageEmbed{
+			{
+				Title:       "🎉 Level up!",
+				Description: replacer.Replace("{user} reached level **{level}**!"),
+				Color:       6095103,
+				Author:      moffAuthor,
+			},
+		},
+	}
+	if event.Settings.AnnounceTemplateID != "" {
+		template, err := database.DiscordBotReplyTemplate{}.SelectInteractID(event.Settings.AnnounceTemplateID)
+		if err != nil {
+			return err
+		}
+		if template != nil {
+			embeds, err := template.GetMessageEmbeds()
+			if err != nil {
+				return err
+			}
+			components, err := template.GetMessageComponents()
+			if err != nil {
+				return err
+			}
+			for _, embed := range embeds {
+				embed.Title = replacer.Replace(embed.Title)
+				embed.Description = replacer.Replace(embed.Description)
+			}
+			msg = &discordgo.MessageSend{
+				Content:    replacer.Replace(template.Content),
+				Embeds:     embeds,
+				Components: components,
+			}
+		}
+	}
+	// 仅提醒升级的成员
+	msg.AllowedMentions = &discordgo.MessageAllowedMentions{
+		Users: []string{event.Member.DiscordID},
+	}
+	_, err := session.ChannelMessageSendComplex(event.Settings.AnnounceChannelID, msg)
+	return errors.WrapAndReport(err, "announce member level up")
+}
@@ -0,0 +1,43 @@
+package discord
+
+import (
+	"moff.io/moff-social/internal/database"
+	"reflect"
+	"testing"
+)
+
+func TestLevelRoleChanges(t *testing.T) {
+	rewards := []*database.DiscordLevelRewards{
+		{Level: 5, RoleID: "bronze"},
+		{Level: 5, QuestID: "quest"},
+		{Level: 10, RoleID: "silver"},
+		{Level: 20, RoleID: "gold"},
+		// 同一角色设置在多个等级时满足最低等级即保留
+		{Level: 15, RoleID: "veteran"},
+		{Level: 8, RoleID: "veteran"},
+	}
+	tests := []struct {
+		name     string
+		from, to int
+		grant    []string
+		revoke   []string
+	}{
+		{name: "unchanged", from: 10, to: 10},
+		{name: "level up", from: 4, to: 10, grant: []string{"bronze", "silver", "veteran"}},
+		{name: "level up within", from: 10, to: 19},
+		{name: "level down", from: 20, to: 9, revoke: []string{"silver", "gold"}},
+		{name: "reset", from: 20, to: 0, revoke: []string{"bronze", "silver", "gold", "veteran"}},
+		{name: "level down keeps lowest", from: 16, to: 8, revoke: []string{"silver"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			grant, revoke := levelRoleChanges(rewards, tt.from, tt.to)
+			if !reflect.DeepEqual(grant, tt.grant) {
+				t.Errorf("levelRoleChanges() grant = %v, want %v", grant, tt.grant)
+			}
+			if !reflect.DeepEqual(revoke, tt.revoke) {
+				t.Errorf("levelRoleChanges() revoke = %v, want %v", revoke, tt.revoke)
+			}
+		})
+	}
+}
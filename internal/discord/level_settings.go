@@ -0,0 +1,216 @@
+package discord
+
+import (
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"moff.io/moff-social/internal/database"
+	"moff.io/moff-social/pkg/errors"
+	"moff.io/moff-social/pkg/log"
+	"strconv"
+	"strings"
+)
+
+var (
+	levelSettingsMinValue float64 = 0
+	levelCurveChoices             = []*discordgo.ApplicationCommandOptionChoice{
+		{Name: "Default (5×level²+50×level+100)", Value: string(database.DiscordLevelCurveDefault)},
+		{Name: "Linear (base+step×level)", Value: string(database.DiscordLevelCurveLinear)},
+		{Name: "Exponential (base×factor^level)", Value: string(database.DiscordLevelCurveExponential)},
+		{Name: "Table", Value: string(database.DiscordLevelCurveTable)},
+	}
+)
+
+// manageLevelCurve 设置服务器的等级曲线及升级公告，未指定的选项沿用之前的设置
+func manageLevelCurve(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if !IsAdminPermission(i.Member.Permissions) {
+		respondSnapshotError(s, i, "Not allowed:thinking: ")
+		return
+	}
+	settings, err := database.DiscordLevelSettings{}.SelectOne(i.GuildID)
+	if err != nil {
+		log.Error(err)
+		respondSnapshotError(s, i, "Unknown error")
+		return
+	}
+	for _, option := range i.ApplicationCommandData().Options {
+		switch option.Name {
+		case "curve":
+			settings.Curve = database.DiscordLevelCurve(option.StringValue())
+		case "base":
+			settings.Base = int(option.IntValue())
+		case "step":
+			settings.Step = int(option.IntValue())
+		case "factor":
+			settings.Factor = option.FloatValue()
+		case "table":
+			settings.Table = nil
+			for _, val := range strings.Split(option.StringValue(), ",") {
+				exp, err := strconv.Atoi(strings.TrimSpace(val))
+				if err != nil || exp <= 0 {
+					respondSnapshotError(s, i, fmt.Sprintf("Invalid exp `%v` in table, please use comma separated positive numbers", val))
+					return
+				}
+				settings.Table = append(settings.Table, exp)
+			}
+		case "announce-channel":
+			settings.AnnounceChannelID = option.ChannelValue(nil).ID
+		case "announce-template":
+			settings.AnnounceTemplateID = strings.TrimSpace(option.StringValue())
+		case "disable-announcement":
+			if option.BoolValue() {
+				settings.AnnounceChannelID = ""
+			}
+		}
+	}
+	switch settings.Curve {
+	case database.DiscordLevelCurveLinear:
+		if settings.Base <= 0 {
+			respondSnapshotError(s, i, "Linear curve requires `base` greater than 0")
+			return
+		}
+	case database.DiscordLevelCurveExponential:
+		if settings.Base <= 0 || settings.Factor <= 1 {
+			respondSnapshotError(s, i, "Exponential curve requires `base` greater than 0 and `factor` greater than 1")
+			return
+		}
+	case database.DiscordLevelCurveTable:
+		if len(settings.Table) == 0 {
+			respondSnapshotError(s, i, "Table curve requires `table`")
+			return
+		}
+	}
+	if settings.AnnounceTemplateID != "" {
+		template, err := database.DiscordBotReplyTemplate{}.SelectInteractID(settings.AnnounceTemplateID)
+		if err != nil {
+			log.Error(err)
+			respondSnapshotError(s, i, "Unknown error")
+			return
+		}
+		if template == nil {
+			respondSnapshotError(s, i, fmt.Sprintf("Template `%v` not found", settings.AnnounceTemplateID))
+			return
+		}
+	}
+	settings.UpdatedBy = i.Member.User.ID
+	if err := settings.Upsert(); err != nil {
+		log.Error(err)
+		respondSnapshotError(s, i, "Unknown error")
+		return
+	}
+	respondLevelSettings(s, i, "Level curve updated", levelCurveDesc(settings))
+}
+
+func levelCurveDesc(settings *database.DiscordLevelSettings) string {
+	desc := fmt.Sprintf("**Curve**:%v", settings.Curve)
+	var levels []string
+	for level := 0; level < 5; level++ {
+		levels = append(levels, fmt.Sprintf("`%v→%v` %v exp", level, level+1, settings.ExpToLevelUp(level)))
+	}
+	desc += "\n" + strings.Join(levels, "\n")
+	if settings.AnnounceChannelID != "" {
+		desc += fmt.Sprintf("\n\n**Announcements**:<#%v>", settings.AnnounceChannelID)
+		if settings.AnnounceTemplateID != "" {
+			desc += fmt.Sprintf(" with template `%v`", settings.AnnounceTemplateID)
+		}
+	}
+	return desc
+}
+
+// manageLevelReward 添加或移除等级奖励
+func manageLevelReward(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if !IsAdminPermission(i.Member.Permissions) {
+		respondSnapshotError(s, i, "Not allowed:thinking: ")
+		return
+	}
+	var (
+		reward = &database.DiscordLevelRewards{
+			GuildID:   i.GuildID,
+			CreatedBy: i.Member.User.ID,
+		}
+		remove bool
+	)
+	for _, option := range i.ApplicationCommandData().Options {
+		switch option.Name {
+		case "level":
+			reward.Level = int(option.IntValue())
+		case "role":
+			reward.RoleID = option.RoleValue(nil, "").ID
+		case "quest-id":
+			reward.QuestID = strings.TrimSpace(option.StringValue())
+		case "remove":
+			remove = option.BoolValue()
+		}
+	}
+	if reward.RoleID == "" && reward.QuestID == "" {
+		respondSnapshotError(s, i, "Please provide a role or a quest")
+		return
+	}
+	if remove {
+		err := reward.Delete()
+		if err != nil {
+			log.Error(err)
+			respondSnapshotError(s, i, "Unknown error")
+			return
+		}
+	} else {
+		if reward.QuestID != "" {
+			quest, err := database.CommunityQuestTemplate{}.SelectOne(reward.QuestID)
+			if err != nil {
+				log.Error(err)
+				respondSnapshotError(s, i, "Unknown error")
+				return
+			}
+			if quest == nil {
+				respondSnapshotError(s, i, fmt.Sprintf("Quest `%v` not found", reward.QuestID))
+				return
+			}
+		}
+		if err := reward.Create(); err != nil {
+			log.Error(err)
+			respondSnapshotError(s, i, "Unknown error")
+			return
+		}
+	}
+	rewards, err := database.DiscordLevelRewards{}.SelectByGuild(i.GuildID)
+	if err != nil {
+		log.Error(err)
+		respondSnapshotError(s, i, "Unknown error")
+		return
+	}
+	var lines []string
+	for _, r := range rewards {
+		var items []string
+		if r.RoleID != "" {
+			items = append(items, fmt.Sprintf("<@&%v>", r.RoleID))
+		}
+		if r.QuestID != "" {
+			items = append(items, fmt.Sprintf("quest `%v`", r.QuestID))
+		}
+		lines = append(lines, fmt.Sprintf("**Level %v**:%v", r.Level, strings.Join(items, ", ")))
+	}
+	desc := "There are no level rewards for now.."
+	if len(lines) > 0 {
+		desc = ellipsis(strings.Join(lines, "\n"), 4090)
+	}
+	respondLevelSettings(s, i, "Level rewards", desc)
+}
+
+func respondLevelSettings(s *discordgo.Session, i *discordgo.InteractionCreate, title, desc string) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags: discordgo.MessageFlagsEphemeral,
+			Embeds: []*discordgo.MessageEmbed{
+				{
+					Title:       title,
+					Description: desc,
+					Color:       6095103,
+					Author:      moffAuthor,
+				},
+			},
+		},
+	})
+	if err != nil {
+		log.Error(errors.WrapAndReport(err, "respond level settings"))
+	}
+}
@@ -0,0 +1,406 @@
+package discord
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"github.com/gin-gonic/gin"
+	"math"
+	"moff.io/moff-social/internal/chart"
+	"moff.io/moff-social/internal/database"
+	"moff.io/moff-social/pkg/errors"
+	"moff.io/moff-social/pkg/log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultStatsDays    = 30
+	maxStatsDays        = 90
+	defaultStatsWeeks   = 8
+	maxStatsWeeks       = 12
+	defaultDormantDays  = 30
+	defaultDormantCount = 20
+	maxDormantCount     = 500
+)
+
+var (
+	statsDaysChoices = []*discordgo.ApplicationCommandOptionChoice{
+		{Name: "Last 7 days", Value: 7},
+		{Name: "Last 30 days", Value: 30},
+		{Name: "Last 90 days", Value: maxStatsDays},
+	}
+	statsMinWeeksValue = float64(2)
+	statsMinValue      = float64(1)
+)
+
+// memberOverview 服务器成员概况，Churn为期间离开成员占期初成员的比例
+type memberOverview struct {
+	Members   int64                               `json:"members"`
+	Joins     int64                               `json:"joins"`
+	Leaves    int64                               `json:"leaves"`
+	AvgActive float64                             `json:"avg_active"`
+	Churn     float64                             `json:"churn"`
+	Daily     []*database.DiscordMemberDailyStats `json:"daily"`
+}
+
+type dormantMember struct {
+	DiscordID    string     `json:"discord_id"`
+	Username     string     `json:"username"`
+	JoinedAt     time.Time  `json:"joined_at"`
+	LastActiveAt *time.Time `json:"last_active_at"`
+}
+
+func queryMemberOverview(guildID string, days int) (*memberOverview, error) {
+	members, err := database.DiscordMember{}.CountCurrent(guildID)
+	if err != nil {
+		return nil, err
+	}
+	daily, err := database.DiscordMemberDailyStats{}.SelectDaily(guildID, time.Now().AddDate(0, 0, -days+1))
+	if err != nil {
+		return nil, err
+	}
+	overview := &memberOverview{
+		Members: members,
+		Daily:   daily,
+	}
+	var active int64
+	for _, d := range daily {
+		overview.Joins += d.Joins
+		overview.Leaves += d.Leaves
+		active += d.Active
+	}
+	if len(daily) > 0 {
+		overview.AvgActive = float64(active) / float64(len(daily))
+	}
+	if start := members - overview.Joins + overview.Leaves; start > 0 {
+		overview.Churn = float64(overview.Leaves) / float64(start)
+	}
+	return overview, nil
+}
+
+func queryDormantMembers(guildID string, days, offset, limit int) ([]*dormantMember, int64, error) {
+	members, total, err := database.DiscordMember{}.SelectDormant(guildID, time.Now().AddDate(0, 0, -days), offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	dormant := make([]*dormantMember, 0, len(members))
+	for _, m := range members {
+		d := &dormantMember{
+			DiscordID: m.DiscordID,
+			Username:  m.Username,
+			JoinedAt:  m.JoinedAt,
+		}
+		if !m.LastActiveAt.IsZero() {
+			lastActiveAt := m.LastActiveAt
+			d.LastActiveAt = &lastActiveAt
+		}
+		dormant = append(dormant, d)
+	}
+	return dormant, total, nil
+}
+
+// statsCommandHandler 服务器成员活跃、留存及沉睡成员统计
+func statsCommandHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	defer logHandlerDuration("stats", time.Now())
+	options := i.ApplicationCommandData().Options
+	if len(options) == 0 {
+		return
+	}
+	if !IsAdminPermission(i.Member.Permissions) {
+		respondSnapshotError(s, i, "Not allowed:thinking: ")
+		return
+	}
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		log.Error(errors.WrapAndReport(err, "quick response to stats"))
+		return
+	}
+	subcommand := options[0]
+	var (
+		days  int
+		weeks = defaultStatsWeeks
+		page  = 1
+	)
+	for _, option := range subcommand.Options {
+		switch option.Name {
+		case "days":
+			days = int(option.IntValue())
+		case "weeks":
+			weeks = int(option.IntValue())
+		case "page":
+			page = int(option.IntValue())
+		}
+	}
+	switch subcommand.Name {
+	case "overview":
+		if days <= 0 {
+			days = defaultStatsDays
+		}
+		respondStatsOverview(s, i, days)
+	case "retention":
+		respondStatsRetention(s, i, weeks)
+	case "dormant":
+		if days <= 0 {
+			days = defaultDormantDays
+		}
+		respondStatsDormant(s, i, days, page)
+	}
+}
+
+func respondStatsOverview(s *discordgo.Session, i *discordgo.InteractionCreate, days int) {
+	overview, err := queryMemberOverview(i.GuildID, days)
+	if err != nil {
+		log.Error(err)
+		interactionResponseEditOnError(s, i)
+		return
+	}
+	var active, joins, leaves []chart.Point
+	for _, d := range overview.Daily {
+		x := d.Day.UnixMilli()
+		active = append(active, chart.Point{X: x, Y: float64(d.Active)})
+		joins = append(joins, chart.Point{X: x, Y: float64(d.Joins)})
+		leaves = append(leaves, chart.Point{X: x, Y: float64(d.Leaves)})
+	}
+	var buf bytes.Buffer
+	err = chart.Lines{
+		Title: fmt.Sprintf("Members in the last %v days (UTC)", days),
+		Series: []chart.Series{
+			{Name: "Active", Points: active},
+			{Name: "Joins", Points: joins},
+			{Name: "Leaves", Points: leaves},
+		},
+	}.Render(&buf)
+	if err != nil {
+		log.Error(err)
+		interactionResponseEditOnError(s, i)
+		return
+	}
+	_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Embeds: &[]*discordgo.MessageEmbed{
+			{
+				Title: "Member stats",
+				Description: fmt.Sprintf("Last %v days. Members are active when they earn exp by chatting, reacting, "+
+					"using commands or talking in voice.", days),
+				Color:  6095103,
+				Author: moffAuthor,
+				Fields: []*discordgo.MessageEmbedField{
+					{Name: "Members", Value: fmt.Sprintf("`%v`", overview.Members), Inline: true},
+					{Name: "Joins", Value: fmt.Sprintf("`%v`", overview.Joins), Inline: true},
+					{Name: "Leaves", Value: fmt.Sprintf("`%v`", overview.Leaves), Inline: true},
+					{Name: "Net growth", Value: fmt.Sprintf("`%+d`", overview.Joins-overview.Leaves), Inline: true},
+					{Name: "Avg daily active", Value: fmt.Sprintf("`%.1f`", overview.AvgActive), Inline: true},
+					{Name: "Churn", Value: fmt.Sprintf("`%.1f%%`", overview.Churn*100), Inline: true},
+				},
+				Image: &discordgo.MessageEmbedImage{
+					URL: "attachment://stats.png",
+				},
+			},
+		},
+		Files: []*discordgo.File{
+			{
+				Name:        "stats.png",
+				ContentType: "image/png",
+				Reader:      &buf,
+			},
+		},
+	})
+	if err != nil {
+		log.Error(errors.WrapAndReport(err, "stats overview response edit"))
+	}
+}
+
+func respondStatsRetention(s *discordgo.Session, i *discordgo.InteractionCreate, weeks int) {
+	cohorts, err := database.DiscordMemberCohort{}.SelectCohorts(i.GuildID, weeks)
+	if err != nil {
+		log.Error(err)
+		interactionResponseEditOnError(s, i)
+		return
+	}
+	var rows []chart.Cohort
+	for _, cohort := range cohorts {
+		row := chart.Cohort{
+			Label: cohort.Week.Format("2006-01-02"),
+			Size:  cohort.Size,
+		}
+		for _, active := range cohort.Active {
+			var rate float64
+			if cohort.Size > 0 {
+				rate = float64(active) / float64(cohort.Size)
+			}
+			row.Rates = append(row.Rates, rate)
+		}
+		rows = append(rows, row)
+	}
+	var buf bytes.Buffer
+	err = chart.Cohorts{
+		Title:       "Weekly cohort retention (UTC)",
+		PeriodLabel: "W",
+		Rows:        rows,
+	}.Render(&buf)
+	if err != nil {
+		log.Error(err)
+		interactionResponseEditOnError(s, i)
+		return
+	}
+	_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Embeds: &[]*discordgo.MessageEmbed{
+			{
+				Title: "Cohort retention",
+				Description: fmt.Sprintf("Members who joined in each of the last %v weeks, and the share of them active "+
+					"in the joining week `W0` and every week after.", weeks),
+				Color:  6095103,
+				Author: moffAuthor,
+				Image: &discordgo.MessageEmbedImage{
+					URL: "attachment://retention.png",
+				},
+			},
+		},
+		Files: []*discordgo.File{
+			{
+				Name:        "retention.png",
+				ContentType: "image/png",
+				Reader:      &buf,
+			},
+		},
+	})
+	if err != nil {
+		log.Error(errors.WrapAndReport(err, "stats retention response edit"))
+	}
+}
+
+func respondStatsDormant(s *discordgo.Session, i *discordgo.InteractionCreate, days, page int) {
+	offset := (page - 1) * defaultDormantCount
+	members, total, err := queryDormantMembers(i.GuildID, days, offset, defaultDormantCount)
+	if err != nil {
+		log.Error(err)
+		interactionResponseEditOnError(s, i)
+		return
+	}
+	var lines []string
+	for idx, m := range members {
+		lastActive := "never active"
+		if m.LastActiveAt != nil {
+			lastActive = fmt.Sprintf("last active <t:%v:R>", m.LastActiveAt.Unix())
+		}
+		lines = append(lines, fmt.Sprintf("**%v** | <@%v> %v, joined <t:%v:d>", offset+idx+1, m.DiscordID, lastActive,
+			m.JoinedAt.Unix()))
+	}
+	desc := fmt.Sprintf("`%v` members haven't been active for %v days.\n\n", total, days)
+	if len(lines) == 0 {
+		desc += "No more dormant members."
+	}
+	pages := (total + defaultDormantCount - 1) / defaultDormantCount
+	if pages == 0 {
+		pages = 1
+	}
+	_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Embeds: &[]*discordgo.MessageEmbed{
+			{
+				Title:       "Dormant members",
+				Description: ellipsis(desc+strings.Join(lines, "\n"), 4090),
+				Color:       6095103,
+				Author:      moffAuthor,
+				Footer: &discordgo.MessageEmbedFooter{
+					Text: fmt.Sprintf("Page %v of %v", page, pages),
+				},
+			},
+		},
+	})
+	if err != nil {
+		log.Error(errors.WrapAndReport(err, "stats dormant response edit"))
+	}
+}
+
+// queryIntParam 读取整数查询参数，未设置时使用默认值，超出范围时返回false
+func queryIntParam(ctx *gin.Context, name string, def, min, max int) (int, bool) {
+	value, err := strconv.Atoi(ctx.DefaultQuery(name, strconv.Itoa(def)))
+	if err != nil || value < min || value > max {
+		ctx.String(http.StatusBadRequest, "invalid "+name)
+		return 0, false
+	}
+	return value, true
+}
+
+// MemberStatsOverview 查询服务器成员概况及每天的活跃、加入及离开成员数
+func MemberStatsOverview(ctx *gin.Context) {
+	// curl -H 'X-Moff-Analytics-Token: xxx' 'http://127.0.0.1:8080/discord/stats/overview?guild_id=1&days=30'
+	guildID := ctx.Query("guild_id")
+	if guildID == "" {
+		ctx.String(http.StatusBadRequest, "guild id not present")
+		return
+	}
+	days, ok := queryIntParam(ctx, "days", defaultStatsDays, 1, maxStatsDays)
+	if !ok {
+		return
+	}
+	overview, err := queryMemberOverview(guildID, days)
+	if err != nil {
+		log.Error(err)
+		ctx.String(http.StatusInternalServerError, "internal error")
+		return
+	}
+	ctx.JSONP(http.StatusOK, overview)
+}
+
+// MemberStatsRetention 查询服务器最近几周加入成员的每周留存
+func MemberStatsRetention(ctx *gin.Context) {
+	// curl -H 'X-Moff-Analytics-Token: xxx' 'http://127.0.0.1:8080/discord/stats/retention?guild_id=1&weeks=8'
+	guildID := ctx.Query("guild_id")
+	if guildID == "" {
+		ctx.String(http.StatusBadRequest, "guild id not present")
+		return
+	}
+	weeks, ok := queryIntParam(ctx, "weeks", defaultStatsWeeks, 1, maxStatsWeeks)
+	if !ok {
+		return
+	}
+	cohorts, err := database.DiscordMemberCohort{}.SelectCohorts(guildID, weeks)
+	if err != nil {
+		log.Error(err)
+		ctx.String(http.StatusInternalServerError, "internal error")
+		return
+	}
+	ctx.JSONP(http.StatusOK, map[string]interface{}{
+		"cohorts": cohorts,
+	})
+}
+
+// MemberStatsDormant 分页查询服务器中长期未活跃的成员
+func MemberStatsDormant(ctx *gin.Context) {
+	// curl -H 'X-Moff-Analytics-Token: xxx' 'http://127.0.0.1:8080/discord/stats/dormant?guild_id=1&days=30&offset=0&limit=100'
+	guildID := ctx.Query("guild_id")
+	if guildID == "" {
+		ctx.String(http.StatusBadRequest, "guild id not present")
+		return
+	}
+	days, ok := queryIntParam(ctx, "days", defaultDormantDays, 1, 3650)
+	if !ok {
+		return
+	}
+	offset, ok := queryIntParam(ctx, "offset", 0, 0, math.MaxInt32)
+	if !ok {
+		return
+	}
+	limit, ok := queryIntParam(ctx, "limit", maxDormantCount, 1, maxDormantCount)
+	if !ok {
+		return
+	}
+	members, total, err := queryDormantMembers(guildID, days, offset, limit)
+	if err != nil {
+		log.Error(err)
+		ctx.String(http.StatusInternalServerError, "internal error")
+		return
+	}
+	ctx.JSONP(http.StatusOK, map[string]interface{}{
+		"total":   total,
+		"members": members,
+	})
+}
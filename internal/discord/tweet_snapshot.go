@@ -0,0 +1,241 @@
+package discord
+
+import (
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"moff.io/moff-social/internal/database"
+	"moff.io/moff-social/internal/twitter"
+	"moff.io/moff-social/pkg/errors"
+	"moff.io/moff-social/pkg/log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	tweetSnapshotMinValue float64 = 0
+	tweetSnapshotActions          = map[string]database.TweetEngagementAction{
+		"require-like":    database.TweetEngagementLike,
+		"require-retweet": database.TweetEngagementRetweet,
+		"require-quote":   database.TweetEngagementQuote,
+		"require-reply":   database.TweetEngagementReply,
+	}
+)
+
+func tweetSnapshotCommandOptions() []*discordgo.ApplicationCommandOption {
+	options := []*discordgo.ApplicationCommandOption{
+		{
+			Name:        "url",
+			Description: "The tweet to snapshot",
+			Type:        discordgo.ApplicationCommandOptionString,
+			Required:    true,
+		},
+		{
+			Name:        "cutoff-hours",
+			Description: "Hours from now to collect engagements, collect right away if 0",
+			Type:        discordgo.ApplicationCommandOptionInteger,
+			MinValue:    &tweetSnapshotMinValue,
+		},
+		{
+			Name:        "whitelist-id",
+			Description: "Whitelist to write qualified users into",
+			Type:        discordgo.ApplicationCommandOptionString,
+		},
+	}
+	for _, name := range []string{"require-like", "require-retweet", "require-quote", "require-reply"} {
+		options = append(options, &discordgo.ApplicationCommandOption{
+			Name:        name,
+			Description: fmt.Sprintf("Users must %v the tweet, like and retweet by default", tweetSnapshotActions[name]),
+			Type:        discordgo.ApplicationCommandOptionBoolean,
+		})
+	}
+	return append(options,
+		&discordgo.ApplicationCommandOption{
+			Name:        "reply-keywords",
+			Description: "Comma separated, replies must contain one of them",
+			Type:        discordgo.ApplicationCommandOptionString,
+		},
+		&discordgo.ApplicationCommandOption{
+			Name:        "reply-min-words",
+			Description: "Minimum words of replies",
+			Type:        discordgo.ApplicationCommandOptionInteger,
+			MinValue:    &tweetSnapshotMinValue,
+		},
+		&discordgo.ApplicationCommandOption{
+			Name:        "reply-min-mentions",
+			Description: "Minimum friends tagged in replies",
+			Type:        discordgo.ApplicationCommandOptionInteger,
+			MinValue:    &tweetSnapshotMinValue,
+		},
+	)
+}
+
+func startTweetSnapshot(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if !IsAdminPermission(i.Member.Permissions) {
+		respondSnapshotError(s, i, "Not allowed:thinking: ")
+		return
+	}
+	req := &twitter.TweetSnapshotRequest{
+		GuildID:   i.GuildID,
+		StarterID: i.Member.User.ID,
+	}
+	var cutoffHours int64
+	for _, option := range i.ApplicationCommandData().Options {
+		switch option.Name {
+		case "url":
+			req.TweetURL = option.StringValue()
+		case "cutoff-hours":
+			cutoffHours = option.IntValue()
+		case "whitelist-id":
+			req.WhitelistID = strings.TrimSpace(option.StringValue())
+		case "require-like", "require-retweet", "require-quote", "require-reply":
+			if option.BoolValue() {
+				req.RequiredActions = append(req.RequiredActions, tweetSnapshotActions[option.Name])
+			}
+		case "reply-keywords":
+			for _, keyword := range strings.Split(option.StringValue(), ",") {
+				if keyword = strings.TrimSpace(keyword); keyword != "" {
+					req.ReplyKeywords = append(req.ReplyKeywords, keyword)
+				}
+			}
+		case "reply-min-words":
+			req.ReplyMinWords = int(option.IntValue())
+		case "reply-min-mentions":
+			req.ReplyMinMentions = int(option.IntValue())
+		}
+	}
+	req.CutoffAt = time.Now().Add(time.Duration(cutoffHours) * time.Hour)
+
+	// 查询推文耗时较长，先响应
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		log.Error(errors.WrapAndReport(err, "quick response to start tweet snapshot"))
+		return
+	}
+	snapshot, tips := twitter.NewTweetSnapshotManager().CreateTweetSnapshot(req, nil)
+	if tips != "" {
+		respondEditSnapshotError(s, i, tips)
+		return
+	}
+	_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Embeds: &[]*discordgo.MessageEmbed{
+			{
+				Title:       "`📸`Tweet snapshot is on!",
+				Description: tweetSnapshotDesc(snapshot),
+				Color:       6095103,
+			},
+		},
+	})
+	if err != nil {
+		log.Error(errors.WrapAndReport(err, "respond start tweet snapshot"))
+	}
+}
+
+func listTweetSnapshot(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if !IsAdminPermission(i.Member.Permissions) {
+		respondSnapshotError(s, i, "Not allowed:thinking: ")
+		return
+	}
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		log.Error(errors.WrapAndReport(err, "quick response to list tweet snapshots"))
+		return
+	}
+	snapshots, err := database.TweetSnapshots{}.SelectLatest(i.GuildID, 10)
+	if err != nil {
+		log.Error(err)
+		respondEditSnapshotError(s, i, "Unknown error")
+		return
+	}
+	var (
+		title      = "Latest tweet snapshots"
+		desc       string
+		components []discordgo.MessageComponent
+		row        discordgo.ActionsRow
+	)
+	if len(snapshots) == 0 {
+		title = "There are no tweet snapshots for now.."
+	}
+	for idx, snapshot := range snapshots {
+		content := fmt.Sprintf("\n\n**%v.** %v", idx+1, tweetSnapshotDesc(snapshot))
+		// 检查是否字符超限
+		if len(desc+content) > 4096 {
+			break
+		}
+		desc += content
+		if snapshot.Status != database.TweetSnapshotStatusFinished {
+			continue
+		}
+		exported, err := database.ExportObjects{}.SelectLatest(i.GuildID, database.ExportKindTweet,
+			strconv.FormatInt(snapshot.ID, 10))
+		if err != nil {
+			log.Error(err)
+		}
+		if exported == nil {
+			continue
+		}
+		row.Components = append(row.Components, exportLinkButton(fmt.Sprintf("%v. Engagements", idx+1), exported.ExportID))
+		if len(row.Components) == 5 {
+			components = append(components, row)
+			row = discordgo.ActionsRow{}
+		}
+	}
+	if len(row.Components) > 0 {
+		components = append(components, row)
+	}
+	_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Embeds: &[]*discordgo.MessageEmbed{
+			{
+				Title:       title,
+				Description: desc,
+				Color:       6095103,
+			},
+		},
+		Components: &components,
+	})
+	if err != nil {
+		log.Error(errors.WrapAndReport(err, "respond list tweet snapshots"))
+	}
+}
+
+func tweetSnapshotDesc(snapshot *database.TweetSnapshots) string {
+	desc := fmt.Sprintf("**Tweet**:[%v](%v)\n　**Cutoff Time**:<t:%v><t:%v:R>\n　**Required**:%v",
+		ellipsis(strings.ReplaceAll(snapshot.TweetText, "\n", " "), 50), snapshot.TweetURL,
+		snapshot.CutoffAt.Unix(), snapshot.CutoffAt.Unix(), strings.ReplaceAll(snapshot.RequiredActions, ",", ", "))
+	var filters []string
+	if snapshot.ReplyKeywords != "" {
+		filters = append(filters, fmt.Sprintf("keywords `%v`", snapshot.ReplyKeywords))
+	}
+	if snapshot.ReplyMinWords > 0 {
+		filters = append(filters, fmt.Sprintf("at least %v words", snapshot.ReplyMinWords))
+	}
+	if snapshot.ReplyMinMentions > 0 {
+		filters = append(filters, fmt.Sprintf("at least %v mentions", snapshot.ReplyMinMentions))
+	}
+	if len(filters) > 0 {
+		desc += fmt.Sprintf("\n　**Reply Filters**:%v", strings.Join(filters, ", "))
+	}
+	if snapshot.CampaignWhitelistID != "" {
+		desc += fmt.Sprintf("\n　**Whitelist**:`%v`", snapshot.CampaignWhitelistID)
+	}
+	switch snapshot.Status {
+	case database.TweetSnapshotStatusFinished:
+		desc += fmt.Sprintf("\n　**Engagements**:%v likes, %v retweets, %v quotes, %v replies\n　**Qualified**:%v",
+			snapshot.Likers, snapshot.Retweeters, snapshot.Quoters, snapshot.Repliers, snapshot.Qualified)
+	case database.TweetSnapshotStatusFailed:
+		desc += fmt.Sprintf("\n　**Failed**:%v", ellipsis(snapshot.LastError, 100))
+	default:
+		desc += fmt.Sprintf("\n　**Status**:%v", snapshot.Status)
+	}
+	return desc
+}
@@ -0,0 +1,305 @@
+package discord
+
+import (
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"gorm.io/gorm"
+	"moff.io/moff-social/internal/campaign"
+	"moff.io/moff-social/internal/database"
+	"moff.io/moff-social/internal/twitter"
+	"moff.io/moff-social/pkg/errors"
+	"moff.io/moff-social/pkg/log"
+	"strconv"
+	"strings"
+)
+
+const (
+	customTwitterFollowGate = "twitter_follow_gate:"
+)
+
+// createTwitterFollowGate 发送关注验证按钮，账号未指定时使用活动要求中需关注的账号
+func createTwitterFollowGate(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if !IsAdminPermission(i.Member.Permissions) {
+		respondSnapshotError(s, i, "Not allowed:thinking: ")
+		return
+	}
+	var (
+		gate = &database.TwitterFollowGates{
+			GuildID:   i.GuildID,
+			ChannelID: i.ChannelID,
+			CreatedBy: i.Member.User.ID,
+		}
+		accounts []string
+	)
+	for _, option := range i.ApplicationCommandData().Options {
+		switch option.Name {
+		case "accounts":
+			for _, account := range strings.Split(option.StringValue(), ",") {
+				if account = twitter.NormalizeUsername(account); account != "" {
+					accounts = append(accounts, account)
+				}
+			}
+		case "campaign-id":
+			gate.CampaignID = strings.TrimSpace(option.StringValue())
+		case "role":
+			gate.RoleID = option.RoleValue(nil, "").ID
+		case "whitelist-id":
+			gate.WhitelistID = strings.TrimSpace(option.StringValue())
+		case "channel":
+			gate.ChannelID = option.ChannelValue(nil).ID
+		}
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		log.Error(errors.WrapAndReport(err, "quick response to create twitter follow gate"))
+		return
+	}
+	// 活动及白名单须属于本服务器的应用，避免写入其他服务器的白名单
+	var app *database.WhiteLabelingApps
+	if gate.CampaignID != "" || gate.WhitelistID != "" {
+		app, err = database.WhiteLabelingApps{}.SelectOne(i.GuildID)
+		if err != nil {
+			log.Error(err)
+			respondEditSnapshotError(s, i, "Unknown error")
+			return
+		}
+		if app == nil || app.AppID == "" {
+			respondEditSnapshotError(s, i, "This server is not linked to any app")
+			return
+		}
+	}
+	if gate.WhitelistID != "" {
+		owned, err := database.Campaigns{}.AppOwnsWhitelist(app.AppID, gate.WhitelistID)
+		if err != nil {
+			log.Error(err)
+			respondEditSnapshotError(s, i, "Unknown error")
+			return
+		}
+		if !owned {
+			respondEditSnapshotError(s, i, fmt.Sprintf("Whitelist %v not found", gate.WhitelistID))
+			return
+		}
+	}
+	if gate.CampaignID != "" {
+		c, err := database.Campaigns{}.SelectOne(gate.CampaignID)
+		if err != nil {
+			log.Error(err)
+			respondEditSnapshotError(s, i, "Unknown error")
+			return
+		}
+		if c == nil || c.AppID != app.AppID {
+			respondEditSnapshotError(s, i, fmt.Sprintf("Campaign %v not found", gate.CampaignID))
+			return
+		}
+		if len(accounts) == 0 {
+			accounts = campaign.CampaignTwitterFollowAccounts(c.Required)
+		}
+		if gate.WhitelistID == "" {
+			gate.WhitelistID = database.FindCampaignWhitelistID(c.Required)
+		}
+	}
+	if len(accounts) == 0 {
+		respondEditSnapshotError(s, i, "Please provide Twitter accounts to follow, or a campaign requiring them")
+		return
+	}
+	ids, err := twitter.NewClient().LookupUserIDs(accounts)
+	if errors.Is(err, twitter.ErrorTwitterApiNotReady) {
+		respondEditSnapshotError(s, i, "Twitter api not configured")
+		return
+	}
+	if err != nil {
+		log.Error(err)
+		respondEditSnapshotError(s, i, "Unknown error")
+		return
+	}
+	var unknown []string
+	for _, account := range accounts {
+		if ids[account] == "" {
+			unknown = append(unknown, "@"+account)
+		}
+	}
+	if len(unknown) > 0 {
+		respondEditSnapshotError(s, i, fmt.Sprintf("Twitter accounts not found: %v", strings.Join(unknown, ", ")))
+		return
+	}
+	gate.Accounts = strings.Join(accounts, ",")
+	if err := gate.Create(); err != nil {
+		log.Error(err)
+		respondEditSnapshotError(s, i, "Unknown error")
+		return
+	}
+
+	msg, err := s.ChannelMessageSendComplex(gate.ChannelID, twitterFollowGateMessage(gate))
+	if err != nil {
+		log.Error(errors.WrapAndReport(err, "send twitter follow gate"))
+		respondEditSnapshotError(s, i, fmt.Sprintf("Failed to send message to <#%v>, please check my permissions", gate.ChannelID))
+		return
+	}
+	if err := gate.UpdateMessageID(msg.ID); err != nil {
+		log.Error(err)
+	}
+	content := fmt.Sprintf("Follow verification sent to <#%v>", gate.ChannelID)
+	_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Content: &content,
+	})
+	if err != nil {
+		log.Error(errors.WrapAndReport(err, "respond create twitter follow gate"))
+	}
+}
+
+func twitterFollowGateMessage(gate *database.TwitterFollowGates) *discordgo.MessageSend {
+	var (
+		lines   []string
+		buttons = []discordgo.MessageComponent{
+			discordgo.Button{
+				Style:    discordgo.PrimaryButton,
+				Label:    "Verify",
+				CustomID: fmt.Sprintf("%v%v", customTwitterFollowGate, gate.ID),
+				Emoji: discordgo.ComponentEmoji{
+					Name: "✅",
+				},
+			},
+		}
+	)
+	for _, account := range gate.AccountList() {
+		lines = append(lines, fmt.Sprintf("[@%v](https://twitter.com/%v)", account, account))
+		// 每行最多5个按钮
+		if len(buttons) < 5 {
+			buttons = append(buttons, discordgo.Button{
+				Style: discordgo.LinkButton,
+				Label: ellipsis("@"+account, 60),
+				URL:   fmt.Sprintf("https://twitter.com/%v", account),
+			})
+		}
+	}
+	desc := fmt.Sprintf("Follow %v on Twitter, then click **Verify**.", strings.Join(lines, ", "))
+	if gate.RoleID != "" {
+		desc += fmt.Sprintf("\n\nVerified members receive <@&%v>.", gate.RoleID)
+	}
+	desc += "\nLink your Twitter account with `/link-twitter` first."
+	return &discordgo.MessageSend{
+		Embeds: []*discordgo.MessageEmbed{
+			{
+				Title:       "Twitter follow verification",
+				Description: desc,
+				Color:       6095103,
+				Author:      moffAuthor,
+			},
+		},
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{Components: buttons},
+		},
+	}
+}
+
+// verifyTwitterFollowGate 检查已关联的twitter账号是否关注全部账号，通过后授予角色并写入白名单
+func verifyTwitterFollowGate(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		log.Error(errors.WrapAndReport(err, "quick response to verify twitter follow"))
+		return
+	}
+	id, err := strconv.ParseInt(strings.TrimPrefix(i.MessageComponentData().CustomID, customTwitterFollowGate), 10, 64)
+	if err != nil {
+		respondTwitterFollowGate(s, i, "Unknown verification")
+		return
+	}
+	gate, err := database.TwitterFollowGates{}.SelectOne(id)
+	if err != nil {
+		log.Error(err)
+		respondTwitterFollowGate(s, i, "Unknown error")
+		return
+	}
+	if gate == nil {
+		respondTwitterFollowGate(s, i, "This verification is no longer available")
+		return
+	}
+	linked, err := linkedTwitter(i.Member.User.ID)
+	if err != nil {
+		log.Error(err)
+		respondTwitterFollowGate(s, i, "Unknown error")
+		return
+	}
+	if linked == nil {
+		respondTwitterFollowGate(s, i, "Please link your Twitter account with `/link-twitter` first.")
+		return
+	}
+	missing, err := twitter.NewClient().VerifyFollows(linked.Identity, gate.AccountList())
+	if errors.Is(err, twitter.ErrorTwitterApiNotReady) {
+		respondTwitterFollowGate(s, i, "Twitter API not ready, please try again later.")
+		return
+	}
+	if errors.Is(err, twitter.ErrorTwitterApiRateLimited) {
+		respondTwitterFollowGate(s, i, "Twitter is busy right now, please try again in a few minutes.")
+		return
+	}
+	if errors.Is(err, twitter.ErrorTwitterFollowingUnknown) {
+		respondTwitterFollowGate(s, i, fmt.Sprintf("`%v` is following too many accounts to verify, please contact the admins.",
+			twitterAccountName(linked)))
+		return
+	}
+	if err != nil {
+		log.Error(err)
+		respondTwitterFollowGate(s, i, "Unknown error")
+		return
+	}
+	if len(missing) > 0 {
+		for idx, account := range missing {
+			missing[idx] = fmt.Sprintf("[@%v](https://twitter.com/%v)", account, account)
+		}
+		respondTwitterFollowGate(s, i, fmt.Sprintf("`%v` is not following %v yet. Results refresh every 10 minutes, please try again later.",
+			twitterAccountName(linked), strings.Join(missing, ", ")))
+		return
+	}
+
+	if gate.WhitelistID != "" {
+		err := database.PublicPostgres.Transaction(func(tx *gorm.DB) error {
+			if err := (database.Whitelist{}).WriteDiscordIds(tx, gate.WhitelistID, []string{i.Member.User.ID}); err != nil {
+				return err
+			}
+			return database.Whitelist{}.WriteTwitterIds(tx, gate.WhitelistID, []string{linked.Identity})
+		})
+		if err != nil {
+			log.Error(errors.WrapAndReport(err, "write twitter follow whitelist"))
+			respondTwitterFollowGate(s, i, "Unknown error")
+			return
+		}
+	}
+	desc := fmt.Sprintf("`%v` verified!", twitterAccountName(linked))
+	if gate.RoleID != "" {
+		if err := s.GuildMemberRoleAdd(i.GuildID, i.Member.User.ID, gate.RoleID); err != nil {
+			log.Error(errors.WrapAndReport(err, "grant twitter follow role"))
+			respondTwitterFollowGate(s, i, "Verified, but I'm unable to grant the role, please contact the admins.")
+			return
+		}
+		desc += fmt.Sprintf(" You've got <@&%v>.", gate.RoleID)
+	}
+	respondTwitterFollowGate(s, i, desc)
+}
+
+func respondTwitterFollowGate(s *discordgo.Session, i *discordgo.InteractionCreate, desc string) {
+	_, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Embeds: &[]*discordgo.MessageEmbed{
+			{
+				Title:       "Twitter follow verification",
+				Description: desc,
+				Color:       6095103,
+				Author:      moffAuthor,
+			},
+		},
+	})
+	if err != nil {
+		log.Error(errors.WrapAndReport(err, "respond twitter follow verification"))
+	}
+}
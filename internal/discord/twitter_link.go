@@ -0,0 +1,584 @@
+package discord
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+	"html"
+	"moff.io/moff-social/internal/cache"
+	"moff.io/moff-social/internal/database"
+	"moff.io/moff-social/internal/identity"
+	"moff.io/moff-social/internal/twitter"
+	"moff.io/moff-social/pkg/errors"
+	"moff.io/moff-social/pkg/log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	twitterOAuthStateKey = "twitter_oauth_state:"
+	// 交互token有效期为15分钟，授权需在此之前完成以便更新原消息
+	twitterOAuthStateTTL = time.Minute * 10
+)
+
+// twitterOAuthState 授权回调时需要的上下文
+type twitterOAuthState struct {
+	GuildID   string `json:"guild_id"`
+	DiscordID string `json:"discord_id"`
+	Verifier  string `json:"verifier"`
+	AppID     string `json:"app_id"`
+	Token     string `json:"token"`
+}
+
+func linkTwitterCommandHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	linked, err := linkedTwitter(i.Member.User.ID)
+	if err != nil {
+		log.Error(err)
+		respondTwitterLink(s, i, "Unknown error", nil)
+		return
+	}
+	if linked != nil {
+		respondTwitterLink(s, i, fmt.Sprintf("Your Twitter account `%v` is already linked, use `/relink-twitter` to link another account.",
+			twitterAccountName(linked)), nil)
+		return
+	}
+	startTwitterOAuth(s, i)
+}
+
+func relinkTwitterCommandHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	startTwitterOAuth(s, i)
+}
+
+func unlinkTwitterCommandHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	linked, err := linkedTwitter(i.Member.User.ID)
+	if err != nil {
+		log.Error(err)
+		respondTwitterLink(s, i, "Unknown error", nil)
+		return
+	}
+	if linked == nil {
+		respondTwitterLink(s, i, "No Twitter account linked, use `/link-twitter` to link one.", nil)
+		return
+	}
+	unlinked, err := unlinkTwitter(i.Member.User.ID, i.Member.User.ID)
+	if err != nil {
+		log.Error(err)
+		respondTwitterLink(s, i, "Unknown error", nil)
+		return
+	}
+	revokeTwitterSpaceRewards(i.GuildID, i.Member.User.ID, unlinked, "")
+	respondTwitterLink(s, i, fmt.Sprintf("Twitter account `%v` unlinked.", twitterAccountName(linked)), nil)
+}
+
+func startTwitterOAuth(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	req, err := twitter.NewOAuthRequest()
+	if errors.Is(err, twitter.ErrorTwitterOAuthNotConfigured) {
+		respondTwitterLink(s, i, "Twitter linking is not available yet", nil)
+		return
+	}
+	if err != nil {
+		log.Error(err)
+		respondTwitterLink(s, i, "Unknown error", nil)
+		return
+	}
+	state, err := json.Marshal(&twitterOAuthState{
+		GuildID:   i.GuildID,
+		DiscordID: i.Member.User.ID,
+		Verifier:  req.Verifier,
+		AppID:     i.AppID,
+		Token:     i.Token,
+	})
+	if err != nil {
+		log.Error(errors.WrapAndReport(err, "marshal twitter oauth state"))
+		respondTwitterLink(s, i, "Unknown error", nil)
+		return
+	}
+	key := fmt.Sprintf("%v%v", twitterOAuthStateKey, req.State)
+	if err := cache.Redis.Set(context.TODO(), key, string(state), twitterOAuthStateTTL).Err(); err != nil {
+		log.Error(errors.WrapAndReport(err, "cache twitter oauth state"))
+		respondTwitterLink(s, i, "Unknown error", nil)
+		return
+	}
+	respondTwitterLink(s, i, "Authorize moff to read your Twitter profile (valid for 10 minutes).", []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Style: discordgo.LinkButton,
+					Label: "Link Twitter",
+					URL:   req.URL,
+				},
+			},
+		},
+	})
+}
+
+func respondTwitterLink(s *discordgo.Session, i *discordgo.InteractionCreate, desc string, components []discordgo.MessageComponent) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags: discordgo.MessageFlagsEphemeral,
+			Embeds: []*discordgo.MessageEmbed{
+				{
+					Title:       "Twitter account",
+					Description: desc,
+					Color:       6095103,
+					Author:      moffAuthor,
+				},
+			},
+			Components: components,
+		},
+	})
+	if err != nil {
+		log.Error(errors.WrapAndReport(err, "respond twitter link"))
+	}
+}
+
+// TwitterOAuthCallback 处理twitter授权回调，验证账号后关联至发起授权的discord用户
+func TwitterOAuthCallback(ctx *gin.Context) {
+	stateID, code := ctx.Query("state"), ctx.Query("code")
+	if stateID == "" {
+		respondTwitterOAuthPage(ctx, http.StatusBadRequest, "Invalid request.")
+		return
+	}
+	state, err := takeTwitterOAuthState(stateID)
+	if err != nil {
+		log.Error(err)
+		respondTwitterOAuthPage(ctx, http.StatusInternalServerError, "Something went wrong, please try again later.")
+		return
+	}
+	if state == nil {
+		respondTwitterOAuthPage(ctx, http.StatusBadRequest, "This link has expired, please run /link-twitter again in Discord.")
+		return
+	}
+	interaction := &discordgo.Interaction{AppID: state.AppID, Token: state.Token}
+	if code == "" {
+		editTwitterLinkResponse(interaction, "Twitter authorization cancelled.")
+		respondTwitterOAuthPage(ctx, http.StatusOK, "Authorization cancelled, you can close this page.")
+		return
+	}
+	user, err := twitter.VerifyOAuthCode(ctx, code, state.Verifier)
+	if err != nil {
+		log.Error(err)
+		editTwitterLinkResponse(interaction, "Failed to verify your Twitter account, please try again.")
+		respondTwitterOAuthPage(ctx, http.StatusBadGateway, "Failed to verify your Twitter account, please try again.")
+		return
+	}
+	unlinked, err := linkTwitter(state, user.ID, user.UserName)
+	if err != nil {
+		log.Error(err)
+		editTwitterLinkResponse(interaction, "Unknown error")
+		respondTwitterOAuthPage(ctx, http.StatusInternalServerError, "Something went wrong, please try again later.")
+		return
+	}
+	revokeTwitterSpaceRewards(state.GuildID, state.DiscordID, unlinked, user.ID)
+	granted := grantTwitterSpaceRewards(state.GuildID, state.DiscordID, user.ID)
+	desc := fmt.Sprintf("Twitter account `@%v` linked.", user.UserName)
+	if len(granted) > 0 {
+		desc += "\nYou have been granted the following roles for attending Twitter Spaces:"
+		for _, role := range granted {
+			desc += fmt.Sprintf("\n-<@&%v>", role)
+		}
+	}
+	editTwitterLinkResponse(interaction, desc)
+	respondTwitterOAuthPage(ctx, http.StatusOK, fmt.Sprintf("Twitter account @%v linked, you can close this page and return to Discord.", user.UserName))
+}
+
+func takeTwitterOAuthState(stateID string) (*twitterOAuthState, error) {
+	var (
+		ctx = context.TODO()
+		key = fmt.Sprintf("%v%v", twitterOAuthStateKey, stateID)
+		get *redis.StringCmd
+	)
+	// 读取后即删除，授权回调仅能使用一次
+	_, err := cache.Redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.Get(ctx, key)
+		pipe.Del(ctx, key)
+		return nil
+	})
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WrapAndReport(err, "take twitter oauth state")
+	}
+	var state twitterOAuthState
+	if err := json.Unmarshal([]byte(get.Val()), &state); err != nil {
+		return nil, errors.WrapAndReport(err, "unmarshal twitter oauth state")
+	}
+	return &state, nil
+}
+
+func respondTwitterOAuthPage(ctx *gin.Context, status int, msg string) {
+	ctx.Data(status, "text/html; charset=utf-8",
+		[]byte(fmt.Sprintf("<html><head><title>moff</title></head><body><p>%v</p></body></html>", html.EscapeString(msg))))
+}
+
+func editTwitterLinkResponse(interaction *discordgo.Interaction, desc string) {
+	if session == nil {
+		return
+	}
+	_, err := session.InteractionResponseEdit(interaction, &discordgo.WebhookEdit{
+		Embeds: &[]*discordgo.MessageEmbed{
+			{
+				Title:       "Twitter account",
+				Description: desc,
+				Color:       6095103,
+				Author:      moffAuthor,
+			},
+		},
+		Components: &[]discordgo.MessageComponent{},
+	})
+	if err != nil {
+		log.Error(errors.WrapAndReport(err, "edit twitter link response"))
+	}
+}
+
+func linkedTwitter(discordID string) (*database.IdentityLinks, error) {
+	links, err := database.IdentityLinks{}.SelectByDiscordIDs(database.CommunityQuestWhitelistUserIdentityTypeTwitterIds,
+		[]string{discordID})
+	if err != nil || len(links) == 0 {
+		return nil, err
+	}
+	return links[len(links)-1], nil
+}
+
+func twitterAccountName(link *database.IdentityLinks) string {
+	member, err := database.DiscordMember{}.SelectOneByTwitterID(link.DiscordID, link.Identity)
+	if err != nil {
+		log.Error(err)
+	}
+	if member != nil && member.TwitterUsername != "" {
+		return "@" + member.TwitterUsername
+	}
+	return link.Identity
+}
+
+// linkTwitter 每个discord用户仅关联一个twitter账号，重新关联时在同一事务中解除之前的账号，返回解除关联的twitter id
+func linkTwitter(state *twitterOAuthState, twitterID, username string) ([]string, error) {
+	var unlinked []string
+	err := database.CommunityPostgres.Transaction(func(tx *gorm.DB) error {
+		links, err := database.IdentityLinks{}.SelectByDiscordIDs(database.CommunityQuestWhitelistUserIdentityTypeTwitterIds,
+			[]string{state.DiscordID})
+		if err != nil {
+			return err
+		}
+		for _, link := range links {
+			if link.Identity == twitterID {
+				continue
+			}
+			if _, err := identity.UnlinkTx(tx, link.IdentityType, link.Identity, state.DiscordID); err != nil {
+				return err
+			}
+			unlinked = append(unlinked, link.Identity)
+		}
+		_, err = identity.LinkTx(tx, database.IdentityLinks{
+			IdentityType: database.CommunityQuestWhitelistUserIdentityTypeTwitterIds,
+			Identity:     twitterID,
+			DiscordID:    state.DiscordID,
+			Method:       database.IdentityVerifyMethodTwitterOAuth,
+			GuildID:      state.GuildID,
+		}, "@"+username, state.DiscordID)
+		if err != nil {
+			return err
+		}
+		return database.DiscordMember{}.UpdateTwitter(tx, state.DiscordID, twitterID, username)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return unlinked, nil
+}
+
+// unlinkTwitter 在同一事务中解除全部twitter关联，返回解除关联的twitter id
+func unlinkTwitter(discordID, operator string) ([]string, error) {
+	var unlinked []string
+	err := database.CommunityPostgres.Transaction(func(tx *gorm.DB) error {
+		links, err := database.IdentityLinks{}.SelectByDiscordIDs(database.CommunityQuestWhitelistUserIdentityTypeTwitterIds,
+			[]string{discordID})
+		if err != nil {
+			return err
+		}
+		for _, link := range links {
+			if _, err := identity.UnlinkTx(tx, link.IdentityType, link.Identity, operator); err != nil {
+				return err
+			}
+			unlinked = append(unlinked, link.Identity)
+		}
+		return database.DiscordMember{}.UpdateTwitter(tx, discordID, "", "")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return unlinked, nil
+}
+
+// grantTwitterSpaceRewards 新关联的账号补发此前参加space获得的白名单及角色，返回授予的角色
+func grantTwitterSpaceRewards(guildID, discordID, twitterID string) []string {
+	// 包含该twitter账号的白名单同时写入discord id，用于任务资格判断
+	whitelistIDs, err := database.Whitelist{}.SelectWhitelistIDs(database.WhitelistEntityTypeTwitterID, twitterID)
+	if err != nil {
+		log.Error(err)
+	}
+	if len(whitelistIDs) > 0 {
+		err := database.PublicPostgres.Transaction(func(tx *gorm.DB) error {
+			for _, wid := range whitelistIDs {
+				if err := (database.Whitelist{}).WriteDiscordIds(tx, wid, []string{discordID}); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			log.Error(err)
+		}
+	}
+
+	var roles []string
+	for _, roleID := range twitterSpaceRewardRoles(guildID, twitterID) {
+		if err := session.GuildMemberRoleAdd(guildID, discordID, roleID); err != nil {
+			log.Error(errors.WrapAndReport(err, "grant twitter space attendance role"))
+			continue
+		}
+		roles = append(roles, roleID)
+	}
+	return roles
+}
+
+// revokeTwitterSpaceRewards 收回解除关联的账号补发的白名单及角色，当前关联的账号同样可获得的保留
+func revokeTwitterSpaceRewards(guildID, discordID string, oldTwitterIDs []string, twitterID string) {
+	if len(oldTwitterIDs) == 0 {
+		return
+	}
+	var kept = make(map[string]bool)
+	if twitterID != "" {
+		whitelistIDs, err := database.Whitelist{}.SelectWhitelistIDs(database.WhitelistEntityTypeTwitterID, twitterID)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+		for _, wid := range whitelistIDs {
+			kept[wid] = true
+		}
+		for _, roleID := range twitterSpaceRewardRoles(guildID, twitterID) {
+			kept[roleID] = true
+		}
+	}
+
+	var revokeWhitelistIDs []string
+	for _, oldTwitterID := range oldTwitterIDs {
+		whitelistIDs, err := database.Whitelist{}.SelectWhitelistIDs(database.WhitelistEntityTypeTwitterID, oldTwitterID)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		for _, wid := range whitelistIDs {
+			if !kept[wid] {
+				kept[wid] = true
+				revokeWhitelistIDs = append(revokeWhitelistIDs, wid)
+			}
+		}
+	}
+	if len(revokeWhitelistIDs) > 0 {
+		err := database.PublicPostgres.Transaction(func(tx *gorm.DB) error {
+			for _, wid := range revokeWhitelistIDs {
+				if err := (database.Whitelist{}).DeleteDiscordIds(tx, wid, []string{discordID}); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			log.Error(err)
+		}
+	}
+
+	for _, oldTwitterID := range oldTwitterIDs {
+		for _, roleID := range twitterSpaceRewardRoles(guildID, oldTwitterID) {
+			if kept[roleID] {
+				continue
+			}
+			kept[roleID] = true
+			if err := session.GuildMemberRoleRemove(guildID, discordID, roleID); err != nil {
+				log.Error(errors.WrapAndReport(err, "revoke twitter space attendance role"))
+			}
+		}
+	}
+}
+
+// twitterSpaceRewardRoles 该twitter账号参加space后在服务器内可获得的角色
+func twitterSpaceRewardRoles(guildID, twitterID string) []string {
+	configs, err := database.TwitterSpaceAttendanceRoles{}.SelectByGuild(guildID)
+	if err != nil {
+		log.Error(err)
+		return nil
+	}
+	if len(configs) == 0 {
+		return nil
+	}
+	records, err := database.TwitterSpaceParticipantRoles{}.SelectByTwitterID(twitterID)
+	if err != nil {
+		log.Error(err)
+		return nil
+	}
+	var (
+		qualified = make(map[string]bool)
+		roles     []string
+	)
+	for _, record := range records {
+		owner, err := database.TwitterSpaceOwnerships{}.SelectOne(guildID, record.SpaceID)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		if owner == nil || !twitter.IsQualifiedSpaceParticipant(owner, record) {
+			continue
+		}
+		for _, c := range configs {
+			if qualified[c.RoleID] || (c.SpaceID != "" && c.SpaceID != record.SpaceID) {
+				continue
+			}
+			qualified[c.RoleID] = true
+			roles = append(roles, c.RoleID)
+		}
+	}
+	return roles
+}
+
+// grantTwitterSpaceAttendanceRoles 快照结束后为已关联twitter账号且满足条件的参与者授予角色
+func grantTwitterSpaceAttendanceRoles(snapshot *database.TwitterSpaceSnapshots) {
+	owners, err := database.TwitterSpaceOwnerships{}.SelectSpaceOwners(snapshot.SpaceID)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	var records []*database.TwitterSpaceParticipantRoles
+	for _, owner := range owners {
+		configs, err := database.TwitterSpaceAttendanceRoles{}.SelectByGuild(owner.DiscordGuildID)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		var roleIDs []string
+		for _, c := range configs {
+			if c.SpaceID == "" || c.SpaceID == snapshot.SpaceID {
+				roleIDs = append(roleIDs, c.RoleID)
+			}
+		}
+		if len(roleIDs) == 0 {
+			continue
+		}
+		if records == nil {
+			if records, err = (database.TwitterSpaceParticipantRoles{}).SelectBySpace(snapshot.SpaceID); err != nil {
+				log.Error(err)
+				return
+			}
+		}
+		var qualified []string
+		for _, record := range records {
+			if twitter.IsQualifiedSpaceParticipant(owner, record) {
+				qualified = append(qualified, record.TwitterID)
+			}
+		}
+		resolved, err := identity.Resolve(database.CommunityQuestWhitelistUserIdentityTypeTwitterIds, qualified,
+			database.CommunityQuestWhitelistUserIdentityTypeDiscordIds)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		for _, discordID := range resolved.Identities() {
+			for _, roleID := range roleIDs {
+				if err := session.GuildMemberRoleAdd(owner.DiscordGuildID, discordID, roleID); err != nil {
+					log.Error(errors.WrapAndReport(err, "grant twitter space attendance role"))
+				}
+			}
+		}
+		log.Infof("Granted twitter space %v attendance roles to %v linked members of guild %v",
+			snapshot.SpaceID, len(resolved.Identities()), owner.DiscordGuildID)
+	}
+}
+
+// manageTwitterSpaceRoles 设置参加space并满足白名单条件的成员授予的角色
+func manageTwitterSpaceRoles(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if !IsAdminPermission(i.Member.Permissions) {
+		respondSnapshotError(s, i, "Not allowed:thinking: ")
+		return
+	}
+	var (
+		roleID   string
+		spaceURL string
+		remove   bool
+	)
+	for _, option := range i.ApplicationCommandData().Options {
+		switch option.Name {
+		case "role":
+			roleID = option.RoleValue(nil, "").ID
+		case "space-url":
+			spaceURL = option.StringValue()
+		case "remove":
+			remove = option.BoolValue()
+		}
+	}
+	var spaceID string
+	if spaceURL != "" {
+		if spaceID = twitter.SpaceIDFromURL(spaceURL); spaceID == "" {
+			respondSnapshotError(s, i, "Unrecognized twitter space URL")
+			return
+		}
+	}
+	if roleID != "" {
+		var err error
+		if remove {
+			err = database.TwitterSpaceAttendanceRoles{}.Delete(i.GuildID, spaceID, roleID)
+		} else {
+			err = database.TwitterSpaceAttendanceRoles{
+				GuildID:   i.GuildID,
+				SpaceID:   spaceID,
+				RoleID:    roleID,
+				CreatedBy: i.Member.User.ID,
+			}.Save()
+		}
+		if err != nil {
+			log.Error(err)
+			respondSnapshotError(s, i, "Unknown error")
+			return
+		}
+	}
+	configs, err := database.TwitterSpaceAttendanceRoles{}.SelectByGuild(i.GuildID)
+	if err != nil {
+		log.Error(err)
+		respondSnapshotError(s, i, "Unknown error")
+		return
+	}
+	var lines []string
+	for _, c := range configs {
+		scope := "all spaces"
+		if c.SpaceID != "" {
+			scope = fmt.Sprintf("space `%v`", c.SpaceID)
+		}
+		lines = append(lines, fmt.Sprintf("<@&%v> for %v", c.RoleID, scope))
+	}
+	desc := "No roles granted for attending Twitter Spaces."
+	if len(lines) > 0 {
+		desc = "Members with linked Twitter accounts who meet the whitelist requirement receive:\n" + strings.Join(lines, "\n")
+	}
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags: discordgo.MessageFlagsEphemeral,
+			Embeds: []*discordgo.MessageEmbed{
+				{
+					Title:       "Twitter Space roles",
+					Description: desc,
+				},
+			},
+		},
+	})
+	if err != nil {
+		log.Error(errors.WrapAndReport(err, "respond twitter space roles"))
+	}
+}
@@ -1,6 +1,7 @@
 package discord
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/bwmarrin/discordgo"
 	"moff.io/moff-social/internal/database"
@@ -12,12 +13,15 @@ import (
 )
 
 const (
-	customAddTwitterSpaceSnapshot   = "add_twitter_space_snapshot"
-	customTwitterSpaceURL           = "twitter_space_url"
-	customTwitterSnapshotMinSeconds = "twitter_snapshot_min_seconds"
-	customSnapshotCampaignID        = "snapshot_campaign_id"
-	customSnapshotCampaignName      = "snapshot_campaign_name"
-	customRemoveTwitterSpace        = "terminate_twitter_space:"
+	customAddTwitterSpaceSnapshot    = "add_twitter_space_snapshot"
+	customTwitterSpaceURL            = "twitter_space_url"
+	customTwitterSnapshotMinSeconds  = "twitter_snapshot_min_seconds"
+	customSnapshotCampaignID         = "snapshot_campaign_id"
+	customSnapshotCampaignName       = "snapshot_campaign_name"
+	customTwitterSnapshotSource      = "twitter_snapshot_source"
+	customTwitterSnapshotRequirement = "twitter_snapshot_requirement"
+	customRemoveTwitterSpace         = "terminate_twitter_space:"
+	customTwitterSpaceAttendance     = "twitter_space_attendance:"
 )
 
 func removeTwitterSpaceSnapshot(s *discordgo.Session, i *discordgo.InteractionCreate) {
@@ -163,38 +167,94 @@ func listFinishedTwitterSpaceSnapshot(s *discordgo.Session, i *discordgo.Interac
 	}
 	var (
 		title, desc string
+		components  []discordgo.MessageComponent
+		row         discordgo.ActionsRow
+		shown       int
 	)
 	if len(snapshots) == 0 {
 		title = "There are no finished twitter spaces for now.."
 	} else {
 		title = "Latest finished twitter space"
 	}
-	for i, snapshot := range snapshots {
-		var content string
-		if snapshot.ParticipantLink != "" {
-			content = fmt.Sprintf("\n\n**%v. Space**:[%v](%v)\n　[Participants link](%v)", i+1,
-				snapshot.SpaceTitle, snapshot.SpaceURL, snapshot.ParticipantLink)
-		} else {
-			content = fmt.Sprintf("\n\n**%v. Space**:[%v](%v)", i+1,
-				snapshot.SpaceTitle, snapshot.SpaceURL)
+	for idx, snapshot := range snapshots {
+		// 参与者导出为私有文件，按需生成下载链接
+		exported, err := database.ExportObjects{}.SelectLatest(i.GuildID, database.ExportKindTwitterSpace, snapshot.SpaceID)
+		if err != nil {
+			log.Error(err)
+		}
+		content := fmt.Sprintf("\n\n**%v. Space**:[%v](%v)", idx+1, snapshot.SpaceTitle, snapshot.SpaceURL)
+		if exported != nil {
+			content += fmt.Sprintf("\n　**Participants**:use the `%v. Participants` button to get a download link", idx+1)
 		}
 		if snapshot.StartedAt != nil {
 			content += fmt.Sprintf("\n　**Start Time**:<t:%v>", snapshot.StartedAt.Unix())
 		}
 		content += fmt.Sprintf("\n　**Finished Time**:<t:%v>", snapshot.EndedAt.Unix())
+		content += twitterSnapshotAttendanceDesc(&snapshot.TwitterSpaceSnapshots)
+		content += twitterSnapshotRoleDesc(i.GuildID, snapshot.SpaceID)
 		// 检查是否字符超限
 		if len(desc+content) > 4096 {
 			break
 		}
 		desc += content
+		shown++
+		if exported != nil {
+			row.Components = append(row.Components, exportLinkButton(fmt.Sprintf("%v. Participants", idx+1), exported.ExportID))
+			if len(row.Components) == 5 {
+				components = append(components, row)
+				row = discordgo.ActionsRow{}
+			}
+		}
+		if snapshot.ConcurrencySeries != "" {
+			row.Components = append(row.Components, &discordgo.Button{
+				Style:    discordgo.SecondaryButton,
+				Label:    fmt.Sprintf("%v. Attendance", idx+1),
+				CustomID: fmt.Sprintf("%v%v", customTwitterSpaceAttendance, snapshot.SpaceID),
+				Emoji: discordgo.ComponentEmoji{
+					Name: "📈",
+				},
+			})
+			if len(row.Components) == 5 {
+				components = append(components, row)
+				row = discordgo.ActionsRow{}
+			}
+		}
+	}
+	if len(row.Components) > 0 {
+		components = append(components, row)
+	}
+	embed := &discordgo.MessageEmbed{
+		Title:       title,
+		Description: desc,
+	}
+	// 嵌入仅能展示一张图片，附上最近一场space的在线人数曲线，其他场次通过按钮查看
+	var files []*discordgo.File
+	for idx, snapshot := range snapshots[:shown] {
+		if snapshot.ConcurrencySeries == "" {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := twitter.RenderConcurrencyChart(&buf, &snapshot.TwitterSpaceSnapshots); err != nil {
+			log.Error(err)
+			break
+		}
+		embed.Image = &discordgo.MessageEmbedImage{
+			URL: "attachment://attendance.png",
+		}
+		embed.Footer = &discordgo.MessageEmbedFooter{
+			Text: fmt.Sprintf("Attendance of %v. %v", idx+1, ellipsis(snapshot.SpaceTitle, 200)),
+		}
+		files = append(files, &discordgo.File{
+			Name:        "attendance.png",
+			ContentType: "image/png",
+			Reader:      &buf,
+		})
+		break
 	}
 	_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
-		Embeds: &[]*discordgo.MessageEmbed{
-			{
-				Title:       title,
-				Description: desc,
-			},
-		},
+		Embeds:     &[]*discordgo.MessageEmbed{embed},
+		Components: &components,
+		Files:      files,
 	})
 	if err != nil {
 		log.Error(errors.WrapAndReport(err, "quick respond to list twitter spaces"))
@@ -255,6 +315,31 @@ func startTwitterSpaceSnapshot(s *discordgo.Session, i *discordgo.InteractionCre
 						},
 					},
 				},
+				discordgo.ActionsRow{
+					Components: []discordgo.MessageComponent{
+						discordgo.TextInput{
+							CustomID: customTwitterSnapshotSource,
+							Label:    "Data Source",
+							Style:    discordgo.TextInputShort,
+							Placeholder: fmt.Sprintf("Optional,%v(default), %v(listeners included) or %v(hosts and speakers only)",
+								twitter.SpaceSourceAuto, twitter.SpaceSourceWeb, twitter.SpaceSourceApi),
+							Required:  false,
+							MaxLength: 20,
+						},
+					},
+				},
+				discordgo.ActionsRow{
+					Components: []discordgo.MessageComponent{
+						discordgo.TextInput{
+							CustomID:    customTwitterSnapshotRequirement,
+							Label:       "Whitelist Minimum Role And Speaking Seconds",
+							Style:       discordgo.TextInputShort,
+							Placeholder: "Optional,e.g. `speaker 60`, role is one of listener, speaker or host",
+							Required:    false,
+							MaxLength:   50,
+						},
+					},
+				},
 			},
 		},
 	})
@@ -279,6 +364,8 @@ func submitTwitterSnapshot(s *discordgo.Session, i *discordgo.InteractionCreate)
 	spaceURL := data.Components[0].(*discordgo.ActionsRow).Components[0].(*discordgo.TextInput).Value
 	inputSecondStr := data.Components[1].(*discordgo.ActionsRow).Components[0].(*discordgo.TextInput).Value
 	campaignID := data.Components[2].(*discordgo.ActionsRow).Components[0].(*discordgo.TextInput).Value
+	source := strings.ToLower(strings.TrimSpace(data.Components[3].(*discordgo.ActionsRow).Components[0].(*discordgo.TextInput).Value))
+	requirementStr := data.Components[4].(*discordgo.ActionsRow).Components[0].(*discordgo.TextInput).Value
 	snapshotSeconds, err := strconv.ParseInt(inputSecondStr, 10, 64)
 	if err != nil || snapshotSeconds < 0 {
 		respondEditSnapshotError(s, i, "**No valid twitter space minimum entry seconds present**")
@@ -290,6 +377,16 @@ func submitTwitterSnapshot(s *discordgo.Session, i *discordgo.InteractionCreate)
 		respondEditSnapshotError(s, i, "**No valid twitter space URL present**")
 		return
 	}
+	if source != "" && !twitter.IsValidSpaceSource(source) {
+		respondEditSnapshotError(s, i, fmt.Sprintf("**Data source should be one of %v, %v or %v**",
+			twitter.SpaceSourceAuto, twitter.SpaceSourceWeb, twitter.SpaceSourceApi))
+		return
+	}
+	requirement, ok := parseTwitterSnapshotRequirement(requirementStr)
+	if !ok {
+		respondEditSnapshotError(s, i, "**Whitelist requirement should look like `speaker 60`, role is one of listener, speaker or host**")
+		return
+	}
 
 	app, err := database.WhiteLabelingApps{}.SelectOne(i.GuildID)
 	if err != nil {
@@ -347,7 +444,7 @@ func submitTwitterSnapshot(s *discordgo.Session, i *discordgo.InteractionCreate)
 	}
 
 	manager := twitter.NewSpaceManager()
-	ownerships, tips := manager.CreateTwitterSpaceSnapshot(i.GuildID, i.Member.User.ID, spaceURL, campaign)
+	ownerships, tips := manager.CreateTwitterSpaceSnapshot(i.GuildID, i.Member.User.ID, spaceURL, source, campaign)
 	if tips != "" {
 		_ = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 			Type: discordgo.InteractionResponseChannelMessageWithSource,
@@ -358,9 +455,138 @@ func submitTwitterSnapshot(s *discordgo.Session, i *discordgo.InteractionCreate)
 		})
 		return
 	}
+	if requirement != nil {
+		requirement.GuildID = i.GuildID
+		requirement.SpaceID = ownerships.SpaceID
+		requirement.UpdatedBy = i.Member.User.ID
+		if err := requirement.Save(); err != nil {
+			log.Error(err)
+		}
+	}
 	respondEditTwitterSnapshotCreated(s, i, ownerships)
 }
 
+// parseTwitterSnapshotRequirement 解析白名单要求，如`speaker 60`、`host`或`120`
+func parseTwitterSnapshotRequirement(input string) (*database.TwitterSpaceWhitelistRequirements, bool) {
+	fields := strings.Fields(input)
+	if len(fields) == 0 {
+		return nil, true
+	}
+	if len(fields) > 2 {
+		return nil, false
+	}
+	requirement := &database.TwitterSpaceWhitelistRequirements{
+		MinRole: string(twitter.SpaceIdentityListener),
+	}
+	for _, field := range fields {
+		if seconds, err := strconv.ParseInt(field, 10, 64); err == nil && seconds >= 0 {
+			requirement.MinSpeakingSeconds = seconds
+			continue
+		}
+		role, ok := twitter.ParseSpaceIdentity(field)
+		if !ok {
+			return nil, false
+		}
+		requirement.MinRole = string(role)
+	}
+	return requirement, true
+}
+
+func twitterSnapshotAttendanceDesc(snapshot *database.TwitterSpaceSnapshots) string {
+	if snapshot.PeakConcurrency == 0 {
+		return ""
+	}
+	return fmt.Sprintf("\n　**Peak**:`%v` **Average**:`%v` **Unique Listeners**:`%v`\n　**Retention 5/15/30m**:`%v%%/%v%%/%v%%`",
+		snapshot.PeakConcurrency, snapshot.AvgConcurrency, snapshot.UniqueListeners,
+		snapshot.Retention5m, snapshot.Retention15m, snapshot.Retention30m)
+}
+
+func showTwitterSpaceAttendance(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if !IsAdminPermission(i.Member.Permissions) {
+		respondSnapshotError(s, i, "Not allowed:thinking: ")
+		return
+	}
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		log.Error(errors.WrapAndReport(err, "quick response to twitter space attendance"))
+		return
+	}
+
+	spaceID := strings.TrimPrefix(i.MessageComponentData().CustomID, customTwitterSpaceAttendance)
+	snapshot, err := database.TwitterSpaceSnapshotOwns{}.SelectOne(i.GuildID, spaceID)
+	if err != nil {
+		log.Error(err)
+		interactionResponseEditOnError(s, i)
+		return
+	}
+	if snapshot == nil || snapshot.ConcurrencySeries == "" {
+		respondEditSnapshotError(s, i, "`No attendance recorded for this twitter space`")
+		return
+	}
+	var buf bytes.Buffer
+	if err := twitter.RenderConcurrencyChart(&buf, &snapshot.TwitterSpaceSnapshots); err != nil {
+		log.Error(err)
+		interactionResponseEditOnError(s, i)
+		return
+	}
+	_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Embeds: &[]*discordgo.MessageEmbed{
+			{
+				Title:       ellipsis(snapshot.SpaceTitle, 200),
+				URL:         snapshot.SpaceURL,
+				Description: strings.TrimPrefix(twitterSnapshotAttendanceDesc(&snapshot.TwitterSpaceSnapshots), "\n"),
+				Image: &discordgo.MessageEmbedImage{
+					URL: "attachment://attendance.png",
+				},
+			},
+		},
+		Files: []*discordgo.File{
+			{
+				Name:        "attendance.png",
+				ContentType: "image/png",
+				Reader:      &buf,
+			},
+		},
+	})
+	if err != nil {
+		log.Error(errors.WrapAndReport(err, "respond twitter space attendance"))
+	}
+}
+
+func twitterSnapshotRoleDesc(guildID, spaceID string) string {
+	var desc string
+	summary, err := database.TwitterSpaceParticipantRoles{}.SelectSummary(spaceID)
+	if err != nil {
+		log.Error(err)
+	}
+	if summary != nil && summary.Hosts+summary.Speakers+summary.Listeners > 0 {
+		desc += fmt.Sprintf("\n　**Hosts**:`%v` **Speakers**:`%v` **Listeners**:`%v` **Promoted**:`%v` **Speaking Time**:`%vm`",
+			summary.Hosts, summary.Speakers, summary.Listeners, summary.Promoted, summary.SpeakingSeconds/60)
+	}
+	requirement, err := database.TwitterSpaceWhitelistRequirements{}.SelectOne(guildID, spaceID)
+	if err != nil {
+		log.Error(err)
+	}
+	if requirement != nil {
+		role, _ := twitter.ParseSpaceIdentity(requirement.MinRole)
+		desc += fmt.Sprintf("\n　**Whitelist Requirement**:`%v` or above, `%v` seconds speaking",
+			role.DisplayName(), requirement.MinSpeakingSeconds)
+	}
+	gaps, gapMs, err := database.TwitterSpaceMonitorGaps{}.SelectSummary(spaceID)
+	if err != nil {
+		log.Error(err)
+	}
+	if gaps > 0 {
+		desc += fmt.Sprintf("\n　**Monitoring Gaps**:`%v` totalling `%vs`", gaps, gapMs/1000)
+	}
+	return desc
+}
+
 func respondSnapshotError(s *discordgo.Session, i *discordgo.InteractionCreate, tips string) {
 	_ = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
@@ -0,0 +1,229 @@
+package discord
+
+import (
+	"context"
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"moff.io/moff-social/internal/cache"
+	"moff.io/moff-social/internal/config"
+	"moff.io/moff-social/internal/database"
+	"moff.io/moff-social/pkg/errors"
+	"moff.io/moff-social/pkg/log"
+	"sync"
+	"time"
+)
+
+const (
+	discordVoiceKey = database.DiscordExpActionVoice
+
+	voiceExpCheckInterval          = time.Minute
+	defaultVoiceExpIntervalMinutes = 5
+	defaultVoiceExp                = 10
+	// 成员在语音中累计的分钟数、已累计的分钟及当天获得的语音经验
+	voiceExpMinutesKeyPrefix = "exp:voice_minutes"
+	voiceExpTickKeyPrefix    = "exp:voice_tick"
+	voiceExpDailyKeyPrefix   = "exp:voice_daily"
+)
+
+var (
+	initVoiceExpTrackerOnce sync.Once
+	internalVoiceExpTracker *VoiceExpTracker
+)
+
+type discordVoice struct {
+	state     *discordgo.VoiceState
+	member    *discordgo.Member
+	exp       int
+	dailyCap  int
+	grantedAt time.Time
+}
+
+func (in *discordVoice) EventID() string {
+	return fmt.Sprintf("voice:%v:%v:%v", in.state.GuildID, in.state.UserID, in.grantedAt.Truncate(time.Minute).Unix())
+}
+
+func (in *discordVoice) Action() string {
+	return discordVoiceKey
+}
+
+func (in *discordVoice) Exp() int {
+	return in.exp
+}
+
+func (in *discordVoice) Guild() string {
+	return in.state.GuildID
+}
+
+func (in *discordVoice) Channel() string {
+	return in.state.ChannelID
+}
+
+func (in *discordVoice) Member() *discordgo.Member {
+	return in.member
+}
+
+// capExp 按当天已获得的语音经验限制本次经验，使用倍率后的经验计算，忽略的频道不占用上限
+func (in *discordVoice) capExp(ctx context.Context, exp int) (int, error) {
+	if in.dailyCap <= 0 {
+		return exp, nil
+	}
+	dailyKey := fmt.Sprintf("%v:%v:%v:%v", voiceExpDailyKeyPrefix, in.state.GuildID, in.state.UserID,
+		in.grantedAt.UTC().Format("2006-01-02"))
+	total, err := cache.Redis.IncrBy(ctx, dailyKey, int64(exp)).Result()
+	if err != nil {
+		return 0, errors.WrapAndReport(err, "incr member voice daily exp")
+	}
+	if err := cache.Redis.Expire(ctx, dailyKey, time.Hour*48).Err(); err != nil {
+		return 0, errors.WrapAndReport(err, "expire member voice daily exp")
+	}
+	if total > int64(in.dailyCap) {
+		exp -= int(total) - in.dailyCap
+	}
+	if exp < 0 {
+		exp = 0
+	}
+	return exp, nil
+}
+
+// VoiceExpTracker 每分钟检查语音状态，成员在非AFK语音或舞台频道中未静音每满N分钟获得一次经验
+type VoiceExpTracker struct{}
+
+func NewVoiceExpTracker() *VoiceExpTracker {
+	initVoiceExpTrackerOnce.Do(func() {
+		internalVoiceExpTracker = &VoiceExpTracker{}
+	})
+	return internalVoiceExpTracker
+}
+
+func (in *VoiceExpTracker) Start(ctx context.Context) {
+	go in.start(ctx)
+}
+
+func (in *VoiceExpTracker) start(ctx context.Context) {
+	ticker := time.NewTicker(voiceExpCheckInterval)
+	defer ticker.Stop()
+	log.Infof("Voice exp tracker running...")
+	defer log.Infof("Voice exp tracker stopped...")
+	for {
+		select {
+		case <-ticker.C:
+			// 机器人未连接时跳过
+			if session == nil {
+				continue
+			}
+			in.track(ctx, time.Now())
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (in *VoiceExpTracker) track(ctx context.Context, now time.Time) {
+	for _, voice := range activeVoiceMembers() {
+		if err := in.trackMember(ctx, voice, now); err != nil {
+			log.Error(err)
+		}
+	}
+}
+
+// trackMember 累计成员的语音分钟数，满一个周期后按当天上限发放经验
+func (in *VoiceExpTracker) trackMember(ctx context.Context, voice *discordVoice, now time.Time) error {
+	policy, err := loadGuildExpPolicy(voice.state.GuildID)
+	if err != nil {
+		return err
+	}
+	if policy.VoiceDisabled {
+		return nil
+	}
+	interval := policy.VoiceIntervalMinutes
+	if interval <= 0 {
+		interval = defaultVoiceExpIntervalMinutes
+	}
+	// 多个实例同时检查时，每分钟只由一个实例累计
+	tickKey := fmt.Sprintf("%v:%v:%v:%v", voiceExpTickKeyPrefix, voice.state.GuildID, voice.state.UserID,
+		now.Truncate(time.Minute).Unix())
+	counted, err := cache.Redis.SetNX(ctx, tickKey, 1, voiceExpCheckInterval*2).Result()
+	if err != nil {
+		return errors.WrapAndReport(err, "cache member voice tick")
+	}
+	if !counted {
+		return nil
+	}
+	minutesKey := fmt.Sprintf("%v:%v:%v", voiceExpMinutesKeyPrefix, voice.state.GuildID, voice.state.UserID)
+	minutes, err := cache.Redis.Incr(ctx, minutesKey).Result()
+	if err != nil {
+		return errors.WrapAndReport(err, "incr member voice minutes")
+	}
+	// 离开语音超过一个周期后重新计时
+	if err := cache.Redis.Expire(ctx, minutesKey, time.Duration(interval*2)*time.Minute).Err(); err != nil {
+		return errors.WrapAndReport(err, "expire member voice minutes")
+	}
+	if minutes < int64(interval) {
+		return nil
+	}
+	if err := cache.Redis.Del(ctx, minutesKey).Err(); err != nil {
+		return errors.WrapAndReport(err, "reset member voice minutes")
+	}
+
+	voice.exp = policy.VoiceExp
+	if voice.exp <= 0 {
+		voice.exp = config.Global.DiscordExpRule.OnVoiceInterval
+	}
+	if voice.exp <= 0 {
+		voice.exp = defaultVoiceExp
+	}
+	voice.dailyCap = policy.VoiceDailyCap
+	voice.grantedAt = now
+	addMemberExpMessage2SQS(voice)
+	return nil
+}
+
+// activeVoiceMembers 非AFK频道中未静音的成员，舞台频道仅计算发言者，频道中没有其他成员时不计算
+func activeVoiceMembers() []*discordVoice {
+	type guildVoiceStates struct {
+		afkChannelID string
+		states       []*discordgo.VoiceState
+	}
+	var guilds []guildVoiceStates
+	session.State.RLock()
+	for _, guild := range session.State.Guilds {
+		g := guildVoiceStates{afkChannelID: guild.AfkChannelID}
+		for _, state := range guild.VoiceStates {
+			copied := *state
+			g.states = append(g.states, &copied)
+		}
+		guilds = append(guilds, g)
+	}
+	session.State.RUnlock()
+
+	var voices []*discordVoice
+	for _, guild := range guilds {
+		var (
+			candidates []*discordVoice
+			listeners  = make(map[string]int)
+		)
+		for _, state := range guild.states {
+			if state.ChannelID == "" || state.ChannelID == guild.afkChannelID {
+				continue
+			}
+			member := state.Member
+			if member == nil || member.User == nil {
+				member, _ = session.State.Member(state.GuildID, state.UserID)
+			}
+			if member == nil || member.User == nil || member.User.Bot {
+				continue
+			}
+			listeners[state.ChannelID]++
+			if state.Mute || state.SelfMute || state.Deaf || state.SelfDeaf || state.Suppress {
+				continue
+			}
+			candidates = append(candidates, &discordVoice{state: state, member: member})
+		}
+		for _, voice := range candidates {
+			if listeners[voice.state.ChannelID] > 1 {
+				voices = append(voices, voice)
+			}
+		}
+	}
+	return voices
+}
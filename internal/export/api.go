@@ -0,0 +1,36 @@
+package export
+
+import (
+	"github.com/gin-gonic/gin"
+	"moff.io/moff-social/pkg/errors"
+	"moff.io/moff-social/pkg/log"
+	"net/http"
+)
+
+// GetPresignedLink 按需生成导出文件的临时访问链接
+func GetPresignedLink(ctx *gin.Context) {
+	// curl -H 'X-Moff-Export-Token: xxx' http://127.0.0.1:8080/export/link?guild_id=1&export_id=2
+	guildID := ctx.Query("guild_id")
+	exportID := ctx.Query("export_id")
+	if guildID == "" || exportID == "" {
+		ctx.String(http.StatusBadRequest, "guild id or export id not present")
+		return
+	}
+	url, expiredAt, err := PresignedURL(ctx, guildID, exportID)
+	switch {
+	case errors.Is(err, ErrExportNotFound):
+		ctx.String(http.StatusNotFound, "export not found")
+		return
+	case errors.Is(err, ErrExportExpired):
+		ctx.String(http.StatusGone, "export expired")
+		return
+	case err != nil:
+		log.Error(err)
+		ctx.String(http.StatusInternalServerError, "internal error")
+		return
+	}
+	ctx.JSONP(http.StatusOK, map[string]interface{}{
+		"url":        url,
+		"expired_at": expiredAt.Unix(),
+	})
+}
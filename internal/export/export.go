@@ -0,0 +1,150 @@
+package export
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"moff.io/moff-social/internal/aws"
+	"moff.io/moff-social/internal/config"
+	"moff.io/moff-social/internal/database"
+	"moff.io/moff-social/pkg/errors"
+	"time"
+)
+
+const (
+	defaultRetentionDays     = 30
+	defaultLinkExpireMinutes = 10
+	maxLinkExpireMinutes     = 60 * 24 * 7
+)
+
+var (
+	ErrExportNotFound = errors.New("export not found")
+	ErrExportExpired  = errors.New("export expired")
+)
+
+// Policy 服务器导出文件的保留与访问策略
+type Policy struct {
+	RetentionDays     int
+	LinkExpireMinutes int
+}
+
+func (p Policy) Retention() time.Duration {
+	return time.Duration(p.RetentionDays) * 24 * time.Hour
+}
+
+func (p Policy) LinkExpiration() time.Duration {
+	return time.Duration(p.LinkExpireMinutes) * time.Minute
+}
+
+func defaultPolicy() Policy {
+	policy := Policy{
+		RetentionDays:     defaultRetentionDays,
+		LinkExpireMinutes: defaultLinkExpireMinutes,
+	}
+	if config.Global == nil {
+		return policy
+	}
+	if config.Global.Export.DefaultRetentionDays > 0 {
+		policy.RetentionDays = config.Global.Export.DefaultRetentionDays
+	}
+	if config.Global.Export.DefaultLinkExpireMinutes > 0 {
+		policy.LinkExpireMinutes = config.Global.Export.DefaultLinkExpireMinutes
+	}
+	return policy
+}
+
+// GuildPolicy 查询服务器策略，缺省字段回退至全局默认值
+func GuildPolicy(guildID string) (Policy, error) {
+	policy := defaultPolicy()
+	saved, err := database.DiscordExportPolicy{}.SelectOne(guildID)
+	if err != nil {
+		return policy, err
+	}
+	if saved == nil {
+		return policy, nil
+	}
+	if saved.RetentionDays > 0 {
+		policy.RetentionDays = saved.RetentionDays
+	}
+	if saved.LinkExpireMinutes > 0 {
+		policy.LinkExpireMinutes = saved.LinkExpireMinutes
+	}
+	return policy, nil
+}
+
+func SaveGuildPolicy(guildID, operator string, retentionDays, linkExpireMinutes int) error {
+	if retentionDays < 0 || linkExpireMinutes < 0 {
+		return errors.New("export policy values must not be negative")
+	}
+	if linkExpireMinutes > maxLinkExpireMinutes {
+		return errors.Errorf("link expiration must not exceed %v minutes", maxLinkExpireMinutes)
+	}
+	return database.DiscordExportPolicy{
+		GuildID:           guildID,
+		RetentionDays:     retentionDays,
+		LinkExpireMinutes: linkExpireMinutes,
+		UpdatedBy:         operator,
+		UpdatedAt:         time.Now(),
+	}.Save()
+}
+
+// NewObjectKey 生成不可预测的私有对象路径
+func NewObjectKey(kind database.ExportKind, referenceID, ext string) string {
+	return fmt.Sprintf("community/exports/%v/%v/%v.%v", kind, referenceID, uuid.New().String(), ext)
+}
+
+// Publish 为每个服务器登记已上传的私有对象，按各自策略计算过期时间
+func Publish(guildIDs []string, kind database.ExportKind, referenceID, objectKey, createdBy string) ([]*database.ExportObjects, error) {
+	var (
+		now     = time.Now()
+		exports []*database.ExportObjects
+	)
+	for _, guildID := range guildIDs {
+		policy, err := GuildPolicy(guildID)
+		if err != nil {
+			return exports, err
+		}
+		export := &database.ExportObjects{
+			ExportID:    uuid.New().String(),
+			GuildID:     guildID,
+			Kind:        kind,
+			ReferenceID: referenceID,
+			ObjectKey:   objectKey,
+			CreatedBy:   createdBy,
+			CreatedAt:   now,
+			ExpiredAt:   now.Add(policy.Retention()),
+		}
+		if err := export.Create(); err != nil {
+			return exports, err
+		}
+		exports = append(exports, export)
+	}
+	return exports, nil
+}
+
+// PresignedURL 校验导出归属后生成短时效的访问链接
+func PresignedURL(ctx context.Context, guildID, exportID string) (string, time.Time, error) {
+	export, err := database.ExportObjects{}.SelectOne(exportID)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if export == nil || export.GuildID != guildID {
+		return "", time.Time{}, ErrExportNotFound
+	}
+	if time.Now().After(export.ExpiredAt) {
+		return "", time.Time{}, ErrExportExpired
+	}
+	policy, err := GuildPolicy(guildID)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expiration := policy.LinkExpiration()
+	if remain := time.Until(export.ExpiredAt); remain < expiration {
+		expiration = remain
+	}
+	url, err := aws.Client.GetS3PresignedAccessURL(ctx, export.ObjectKey, expiration)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return url, time.Now().Add(expiration), nil
+}
@@ -0,0 +1,98 @@
+package export
+
+import (
+	"context"
+	"moff.io/moff-social/internal/aws"
+	"moff.io/moff-social/internal/cache"
+	"moff.io/moff-social/internal/database"
+	"moff.io/moff-social/pkg/errors"
+	"moff.io/moff-social/pkg/log"
+	"sync"
+	"time"
+)
+
+const (
+	retentionSweeperLockKey = "export_retention_sweeper_lock"
+	retentionSweepInterval  = time.Hour
+	retentionSweepBatch     = 200
+)
+
+var (
+	initRetentionSweeperOnce sync.Once
+	internalRetentionSweeper *RetentionSweeper
+)
+
+// RetentionSweeper 定期删除超过保留期的导出文件
+type RetentionSweeper struct{}
+
+func NewRetentionSweeper() *RetentionSweeper {
+	initRetentionSweeperOnce.Do(func() {
+		internalRetentionSweeper = &RetentionSweeper{}
+	})
+	return internalRetentionSweeper
+}
+
+func (in *RetentionSweeper) Start(ctx context.Context) {
+	go in.start(ctx)
+}
+
+func (in *RetentionSweeper) start(ctx context.Context) {
+	log.Info("Export retention sweeper running...")
+	defer log.Info("Export retention sweeper stopped...")
+	ticker := time.NewTicker(retentionSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := in.sweep(ctx); err != nil {
+				log.Error(err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (in *RetentionSweeper) sweep(ctx context.Context) error {
+	// 多副本时只允许一个副本执行清理
+	locked, err := cache.Redis.SetNX(ctx, retentionSweeperLockKey, time.Now().UnixMilli(), retentionSweepInterval/2).Result()
+	if err != nil {
+		return errors.WrapAndReport(err, "lock export retention sweeper")
+	}
+	if !locked {
+		return nil
+	}
+	for {
+		expired, err := database.ExportObjects{}.SelectExpired(retentionSweepBatch)
+		if err != nil {
+			return err
+		}
+		for _, export := range expired {
+			if err := in.remove(ctx, export); err != nil {
+				return err
+			}
+		}
+		if len(expired) < retentionSweepBatch {
+			return nil
+		}
+	}
+}
+
+func (in *RetentionSweeper) remove(ctx context.Context, export *database.ExportObjects) error {
+	if err := export.Delete(); err != nil {
+		return err
+	}
+	// 仍有其他服务器引用时保留s3对象
+	references, err := database.ExportObjects{}.CountObjectReferences(export.ObjectKey)
+	if err != nil {
+		return err
+	}
+	if references > 0 {
+		return nil
+	}
+	if err := aws.Client.DeleteFileFromS3(ctx, export.ObjectKey); err != nil {
+		return err
+	}
+	log.Infof("Removed expired export %v of guild %v", export.ObjectKey, export.GuildID)
+	return nil
+}
@@ -0,0 +1,163 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"moff.io/moff-social/internal/aws"
+	"moff.io/moff-social/pkg/errors"
+	"strings"
+)
+
+type Format string
+
+const (
+	FormatCSV  = Format("csv")
+	FormatXLSX = Format("xlsx")
+)
+
+func (f Format) IsValid() bool {
+	return f == FormatCSV || f == FormatXLSX
+}
+
+func (f Format) Extension() string {
+	return string(f)
+}
+
+// RowWriter 逐行写入导出内容，不在内存中保留已写入的行
+type RowWriter interface {
+	WriteRow(row []string) error
+	Close() error
+}
+
+// NewRowWriter 创建写入任意io.Writer的行写入器，Close不会关闭底层的writer
+func NewRowWriter(w io.Writer, format Format) (RowWriter, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVRowWriter(w), nil
+	case FormatXLSX:
+		return newXLSXRowWriter(w)
+	default:
+		return nil, errors.Errorf("unsupported export format %v", format)
+	}
+}
+
+// Stream 将rows产生的行写入w
+func Stream(w io.Writer, format Format, rows func(RowWriter) error) error {
+	writer, err := NewRowWriter(w, format)
+	if err != nil {
+		return err
+	}
+	if err := rows(writer); err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+// StreamToS3 将rows产生的行直接分片上传为私有s3对象，失败时放弃上传
+func StreamToS3(ctx context.Context, objectKey string, format Format, rows func(RowWriter) error) error {
+	upload := aws.Client.NewMultipartUploadWriter(ctx, objectKey)
+	if err := Stream(upload, format, rows); err != nil {
+		upload.Abort()
+		return err
+	}
+	return upload.Close()
+}
+
+type csvRowWriter struct {
+	writer *csv.Writer
+}
+
+func newCSVRowWriter(w io.Writer) *csvRowWriter {
+	return &csvRowWriter{writer: csv.NewWriter(w)}
+}
+
+func (in *csvRowWriter) WriteRow(row []string) error {
+	return errors.WrapAndReport(in.writer.Write(row), "write csv row")
+}
+
+func (in *csvRowWriter) Close() error {
+	in.writer.Flush()
+	return errors.WrapAndReport(in.writer.Error(), "flush csv rows")
+}
+
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`
+	xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`
+	xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets></workbook>`
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`
+	xlsxSheetHeader = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+	xlsxSheetFooter = `</sheetData></worksheet>`
+)
+
+// xlsxRowWriter 以内联字符串写入单工作表的xlsx，工作表内容按行流式压缩
+type xlsxRowWriter struct {
+	archive *zip.Writer
+	sheet   *bufio.Writer
+	rowNum  int
+}
+
+func newXLSXRowWriter(w io.Writer) (*xlsxRowWriter, error) {
+	archive := zip.NewWriter(w)
+	parts := []struct {
+		name, content string
+	}{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", xlsxWorkbook},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+	}
+	for _, part := range parts {
+		entry, err := archive.Create(part.name)
+		if err != nil {
+			return nil, errors.WrapAndReport(err, "create xlsx part")
+		}
+		if _, err := io.WriteString(entry, part.content); err != nil {
+			return nil, errors.WrapAndReport(err, "write xlsx part")
+		}
+	}
+	entry, err := archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, errors.WrapAndReport(err, "create xlsx sheet")
+	}
+	sheet := bufio.NewWriter(entry)
+	if _, err := sheet.WriteString(xlsxSheetHeader); err != nil {
+		return nil, errors.WrapAndReport(err, "write xlsx sheet header")
+	}
+	return &xlsxRowWriter{archive: archive, sheet: sheet}, nil
+}
+
+func (in *xlsxRowWriter) WriteRow(row []string) error {
+	in.rowNum++
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf(`<row r="%v">`, in.rowNum))
+	for _, cell := range row {
+		builder.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">`)
+		if err := xml.EscapeText(&builder, []byte(cell)); err != nil {
+			return errors.WrapAndReport(err, "escape xlsx cell")
+		}
+		builder.WriteString(`</t></is></c>`)
+	}
+	builder.WriteString(`</row>`)
+	_, err := in.sheet.WriteString(builder.String())
+	return errors.WrapAndReport(err, "write xlsx row")
+}
+
+func (in *xlsxRowWriter) Close() error {
+	if _, err := in.sheet.WriteString(xlsxSheetFooter); err != nil {
+		return errors.WrapAndReport(err, "write xlsx sheet footer")
+	}
+	if err := in.sheet.Flush(); err != nil {
+		return errors.WrapAndReport(err, "flush xlsx sheet")
+	}
+	return errors.WrapAndReport(in.archive.Close(), "close xlsx archive")
+}
@@ -0,0 +1,30 @@
+package fonts
+
+import (
+	"github.com/golang/freetype"
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"moff.io/moff-social/pkg/errors"
+	"sync"
+)
+
+var (
+	parseFontsOnce sync.Once
+	regular, bold  *truetype.Font
+	errParseFonts  error
+)
+
+// Load 图表及卡片中使用的常规字体与粗体
+func Load() (*truetype.Font, *truetype.Font, error) {
+	parseFontsOnce.Do(func() {
+		regular, errParseFonts = freetype.ParseFont(goregular.TTF)
+		if errParseFonts != nil {
+			errParseFonts = errors.WrapAndReport(errParseFonts, "parse regular font")
+			return
+		}
+		bold, errParseFonts = freetype.ParseFont(gobold.TTF)
+		errParseFonts = errors.WrapAndReport(errParseFonts, "parse bold font")
+	})
+	return regular, bold, errParseFonts
+}
@@ -0,0 +1,26 @@
+package http
+
+import (
+	"crypto/subtle"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+const (
+	exportTokenHeader    = "X-Moff-Export-Token"
+	identityTokenHeader  = "X-Moff-Identity-Token"
+	twitterTokenHeader   = "X-Moff-Admin-Token"
+	analyticsTokenHeader = "X-Moff-Analytics-Token"
+)
+
+// tokenAuth 校验请求头中的令牌，未配置令牌时拒绝全部请求
+func tokenAuth(header, token string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if token == "" || subtle.ConstantTimeCompare([]byte(ctx.GetHeader(header)), []byte(token)) != 1 {
+			ctx.String(http.StatusUnauthorized, "unauthorized")
+			ctx.Abort()
+			return
+		}
+		ctx.Next()
+	}
+}
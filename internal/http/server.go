@@ -1,17 +1,16 @@
 package http
 
 import (
-	"context"
-	"encoding/csv"
 	"github.com/gin-gonic/gin"
-	"moff.io/moff-social/internal/aws"
+	"moff.io/moff-social/internal/config"
 	"moff.io/moff-social/internal/databus"
 	"moff.io/moff-social/internal/discord"
+	"moff.io/moff-social/internal/export"
+	"moff.io/moff-social/internal/identity"
 	"moff.io/moff-social/internal/twitter"
 	"moff.io/moff-social/pkg/errors"
 	"moff.io/moff-social/pkg/log"
 	"net/http"
-	"os"
 )
 
 func NewServer() {
@@ -32,9 +31,30 @@ func NewServer() {
 			"hello": "world",
 		})
 	})
+	var (
+		exportAuth    = tokenAuth(exportTokenHeader, config.Global.Export.ApiToken)
+		identityAuth  = tokenAuth(identityTokenHeader, config.Global.Identity.ApiToken)
+		twitterAuth   = tokenAuth(twitterTokenHeader, config.Global.Twitter.AdminToken)
+		analyticsAuth = tokenAuth(analyticsTokenHeader, config.Global.Analytics.ApiToken)
+	)
 	router.POST("/discord/quiz_game_lottery", discord.SaveQuizGameLottery)
 	router.POST("/discord/quiz_game", discord.SaveQuizGame)
 	router.DELETE("/discord/quiz_game", discord.DeleteQuizGame)
+	router.GET("/discord/campaign_funnels", analyticsAuth, discord.CampaignFunnels)
+	router.GET("/discord/stats/overview", analyticsAuth, discord.MemberStatsOverview)
+	router.GET("/discord/stats/retention", analyticsAuth, discord.MemberStatsRetention)
+	router.GET("/discord/stats/dormant", analyticsAuth, discord.MemberStatsDormant)
+	router.GET("/export/link", exportAuth, export.GetPresignedLink)
+	router.GET("/identity/resolve", identityAuth, identity.GetResolution)
+	router.GET("/identity/nonce", identityAuth, identity.GetLinkNonce)
+	router.GET("/identity/links", identityAuth, identity.GetLinks)
+	router.POST("/identity/links", identityAuth, identity.PostLink)
+	router.DELETE("/identity/links", identityAuth, identity.DeleteLink)
+	router.GET("/twitter/oauth/callback", discord.TwitterOAuthCallback)
+	router.GET("/twitter/authorizations", twitterAuth, twitter.ListAuthorizations)
+	router.POST("/twitter/authorizations", twitterAuth, twitter.AddAuthorization)
+	router.POST("/twitter/authorizations/:id/disable", twitterAuth, twitter.DisableAuthorization)
+	router.POST("/twitter/authorizations/:id/enable", twitterAuth, twitter.EnableAuthorization)
 	router.GET("/twitter/snapshot", func(ctx *gin.Context) {
 		// curl http://127.0.0.1:8080/twitter/snapshot?space_id=1dRKZMeWNLgxB
 		spaceID := ctx.Query("space_id")
@@ -59,79 +79,3 @@ func NewServer() {
 		log.Fatal(err)
 	}
 }
-
-func writeTemp(ctx *gin.Context) {
-	file, err := os.OpenFile("/cache/test.csv", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
-	if err != nil {
-		ctx.JSONP(http.StatusOK, map[string]interface{}{
-			"error": err.Error(),
-		})
-		return
-	}
-	writer := csv.NewWriter(file)
-	if err := writer.Write([]string{"title1", "title2"}); err != nil {
-		ctx.JSONP(http.StatusOK, map[string]interface{}{
-			"error": err.Error(),
-		})
-		return
-	}
-	if err := writer.Write([]string{"content1", "content2"}); err != nil {
-		ctx.JSONP(http.StatusOK, map[string]interface{}{
-			"error": err.Error(),
-		})
-		return
-	}
-	writer.Flush()
-	if err := file.Close(); err != nil {
-		ctx.JSONP(http.StatusOK, map[string]interface{}{
-			"error": err.Error(),
-		})
-		return
-	}
-
-	// 写入s3
-	file, err = os.Open("/cache/test.csv")
-	if err != nil {
-		ctx.JSONP(http.StatusOK, map[string]interface{}{
-			"error": err.Error(),
-		})
-		return
-	}
-	err = aws.Client.PutFileToS3WithPublicRead(context.TODO(), "moff-public",
-		"community/whitelist/discord/2022/11/25/test.csv", file)
-	if err != nil {
-		ctx.JSONP(http.StatusOK, map[string]interface{}{
-			"error": err.Error(),
-		})
-		return
-	}
-
-	ctx.JSONP(http.StatusOK, map[string]interface{}{
-		"success": true,
-	})
-}
-
-func writeToFile(ctx *gin.Context) error {
-	file, err := os.OpenFile("test.csv", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	writer := csv.NewWriter(file)
-	if err := writer.Write([]string{"title1", "title2"}); err != nil {
-		return err
-	}
-	if err := writer.Write([]string{"content1", "content2"}); err != nil {
-		return err
-
-	}
-	writer.Flush()
-	if err := writer.Error(); err != nil {
-		return err
-	}
-	if err := file.Close(); err != nil {
-		return err
-	}
-	return nil
-}
@@ -0,0 +1,144 @@
+package identity
+
+import (
+	"github.com/gin-gonic/gin"
+	"moff.io/moff-social/internal/database"
+	"moff.io/moff-social/pkg/errors"
+	"moff.io/moff-social/pkg/log"
+	"net/http"
+)
+
+// GetResolution 将白名单、twitter space参与者或discord快照解析为目标身份类型
+func GetResolution(ctx *gin.Context) {
+	// curl -H 'X-Moff-Identity-Token: xxx' http://127.0.0.1:8080/identity/resolve?source=twitter_space&id=1dRKZMeWNLgxB&to=wallet_addrs
+	source, id := ctx.Query("source"), ctx.Query("id")
+	if source == "" || id == "" {
+		ctx.String(http.StatusBadRequest, "source or id not present")
+		return
+	}
+	result, err := ResolveSource(source, id, database.CommunityQuestWhitelistUserIdentityType(ctx.Query("to")))
+	switch {
+	case errors.Is(err, ErrUnsupportedSource), errors.Is(err, ErrUnsupportedIdentityType):
+		ctx.String(http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, ErrSourceNotFound):
+		ctx.String(http.StatusNotFound, err.Error())
+		return
+	case err != nil:
+		log.Error(err)
+		ctx.String(http.StatusInternalServerError, "internal error")
+		return
+	}
+	ctx.JSONP(http.StatusOK, result)
+}
+
+// GetLinks 查询discord用户已验证的关联及变更记录
+func GetLinks(ctx *gin.Context) {
+	// curl -H 'X-Moff-Identity-Token: xxx' http://127.0.0.1:8080/identity/links?discord_id=1
+	discordID := ctx.Query("discord_id")
+	if discordID == "" {
+		ctx.String(http.StatusBadRequest, "discord id not present")
+		return
+	}
+	links, err := database.IdentityLinks{}.SelectByDiscordID(discordID)
+	if err != nil {
+		log.Error(err)
+		ctx.String(http.StatusInternalServerError, "internal error")
+		return
+	}
+	audits, err := database.IdentityLinkAudits{}.SelectByDiscordID(discordID)
+	if err != nil {
+		log.Error(err)
+		ctx.String(http.StatusInternalServerError, "internal error")
+		return
+	}
+	ctx.JSONP(http.StatusOK, map[string]interface{}{
+		"links":  links,
+		"audits": audits,
+	})
+}
+
+// GetLinkNonce 签发关联钱包时需签名的消息
+func GetLinkNonce(ctx *gin.Context) {
+	// curl -H 'X-Moff-Identity-Token: xxx' http://127.0.0.1:8080/identity/nonce?discord_id=1&identity=0x
+	discordID, address := ctx.Query("discord_id"), ctx.Query("identity")
+	if discordID == "" || address == "" {
+		ctx.String(http.StatusBadRequest, "discord_id or identity not present")
+		return
+	}
+	msg, err := IssueLinkNonce(ctx, discordID, address)
+	if err != nil {
+		log.Error(err)
+		ctx.String(http.StatusInternalServerError, "internal error")
+		return
+	}
+	ctx.JSONP(http.StatusOK, map[string]interface{}{
+		"sign_msg": msg,
+	})
+}
+
+type linkRequest struct {
+	DiscordID    string                                           `json:"discord_id" binding:"required"`
+	IdentityType database.CommunityQuestWhitelistUserIdentityType `json:"identity_type" binding:"required"`
+	Identity     string                                           `json:"identity" binding:"required"`
+	GuildID      string                                           `json:"guild_id"`
+	Proof        Proof                                            `json:"proof"`
+}
+
+// PostLink 记录用户关联，钱包需签名GetLinkNonce签发的消息，twitter需提供oauth凭据，其他类型不允许关联
+func PostLink(ctx *gin.Context) {
+	// curl -H 'X-Moff-Identity-Token: xxx' -d '{"discord_id":"1","identity_type":"wallet_addrs","identity":"0x","proof":{"sign_msg":"...","signature":"0x"}}' http://127.0.0.1:8080/identity/links
+	var req linkRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.String(http.StatusBadRequest, "discord_id, identity_type and identity are required")
+		return
+	}
+	method, proof, err := VerifyProof(ctx, req.DiscordID, req.IdentityType, req.Identity, req.Proof)
+	switch {
+	case errors.Is(err, ErrUnsupportedIdentityType), errors.Is(err, ErrInvalidProof), errors.Is(err, ErrNoProof):
+		ctx.String(http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		log.Error(err)
+		ctx.String(http.StatusInternalServerError, "internal error")
+		return
+	}
+	action, err := Link(database.IdentityLinks{
+		IdentityType: req.IdentityType,
+		Identity:     req.Identity,
+		DiscordID:    req.DiscordID,
+		Method:       method,
+		GuildID:      req.GuildID,
+	}, proof, ctx.ClientIP())
+	switch {
+	case errors.Is(err, ErrUnsupportedIdentityType):
+		ctx.String(http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		log.Error(err)
+		ctx.String(http.StatusInternalServerError, "internal error")
+		return
+	}
+	ctx.JSONP(http.StatusOK, map[string]interface{}{
+		"action": action,
+	})
+}
+
+// DeleteLink 解除关联
+func DeleteLink(ctx *gin.Context) {
+	// curl -X DELETE -H 'X-Moff-Identity-Token: xxx' http://127.0.0.1:8080/identity/links?identity_type=wallet_addrs&identity=0x
+	unlinked, err := Unlink(database.CommunityQuestWhitelistUserIdentityType(ctx.Query("identity_type")),
+		ctx.Query("identity"), ctx.ClientIP())
+	switch {
+	case errors.Is(err, ErrUnsupportedIdentityType):
+		ctx.String(http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		log.Error(err)
+		ctx.String(http.StatusInternalServerError, "internal error")
+		return
+	}
+	ctx.JSONP(http.StatusOK, map[string]interface{}{
+		"unlinked": unlinked,
+	})
+}
@@ -0,0 +1,293 @@
+package identity
+
+import (
+	"gorm.io/gorm"
+	"moff.io/moff-social/internal/database"
+	"moff.io/moff-social/pkg/errors"
+	"strings"
+	"time"
+)
+
+const (
+	SourceWhitelist       = "whitelist"
+	SourceTwitterSpace    = "twitter_space"
+	SourceDiscordSnapshot = "discord_snapshot"
+)
+
+var (
+	ErrUnsupportedIdentityType = errors.New("unsupported identity type")
+	ErrUnsupportedSource       = errors.New("unsupported identity source")
+	ErrSourceNotFound          = errors.New("identity source not found")
+)
+
+// Hop 解析路径中的一次关联，Method说明该关联的验证方式
+type Hop struct {
+	IdentityType database.CommunityQuestWhitelistUserIdentityType `json:"identity_type"`
+	Identity     string                                           `json:"identity"`
+	Method       database.IdentityVerifyMethod                    `json:"method"`
+	VerifiedAt   time.Time                                        `json:"verified_at"`
+}
+
+// Resolution 单个身份解析为目标类型的结果，经由discord id关联
+type Resolution struct {
+	From      string `json:"from"`
+	DiscordID string `json:"discord_id"`
+	To        string `json:"to"`
+	// Path 从源身份到discord id、再到目标身份的关联
+	Path []*Hop `json:"path"`
+}
+
+type Result struct {
+	FromTypes   []database.CommunityQuestWhitelistUserIdentityType `json:"from_types"`
+	To          database.CommunityQuestWhitelistUserIdentityType   `json:"to"`
+	Resolutions []*Resolution                                      `json:"resolutions"`
+	// Unresolved 未找到已验证关联的源身份
+	Unresolved []string `json:"unresolved"`
+}
+
+func IsValidIdentityType(identityType database.CommunityQuestWhitelistUserIdentityType) bool {
+	switch identityType {
+	case database.CommunityQuestWhitelistUserIdentityTypeUserIds,
+		database.CommunityQuestWhitelistUserIdentityTypeWalletAddrs,
+		database.CommunityQuestWhitelistUserIdentityTypeDiscordIds,
+		database.CommunityQuestWhitelistUserIdentityTypeTwitterIds:
+		return true
+	}
+	return false
+}
+
+// Normalize evm钱包地址大小写不敏感，统一为小写
+func Normalize(identityType database.CommunityQuestWhitelistUserIdentityType, identity string) string {
+	identity = strings.TrimSpace(identity)
+	if identityType == database.CommunityQuestWhitelistUserIdentityTypeWalletAddrs {
+		return strings.ToLower(identity)
+	}
+	return identity
+}
+
+// Link 保存已验证的关联，discord用户自身无需关联；钱包及twitter不能仅凭discord登录关联
+func Link(link database.IdentityLinks, proof, operator string) (database.IdentityLinkAction, error) {
+	return LinkTx(database.CommunityPostgres, link, proof, operator)
+}
+
+// LinkTx 在tx中保存关联，用于与其他修改一起提交
+func LinkTx(tx *gorm.DB, link database.IdentityLinks, proof, operator string) (database.IdentityLinkAction, error) {
+	if !IsValidIdentityType(link.IdentityType) || link.IdentityType == database.CommunityQuestWhitelistUserIdentityTypeDiscordIds {
+		return "", ErrUnsupportedIdentityType
+	}
+	if link.Method == database.IdentityVerifyMethodDiscordUser &&
+		link.IdentityType != database.CommunityQuestWhitelistUserIdentityTypeUserIds {
+		return "", ErrInvalidProof
+	}
+	link.Identity = Normalize(link.IdentityType, link.Identity)
+	return link.Link(tx, proof, operator)
+}
+
+// LinkWallet 钱包签名通过后关联至discord用户
+func LinkWallet(discordID, guildID, address, signMsg, signature string) (database.IdentityLinkAction, error) {
+	return Link(database.IdentityLinks{
+		IdentityType: database.CommunityQuestWhitelistUserIdentityTypeWalletAddrs,
+		Identity:     address,
+		DiscordID:    discordID,
+		Method:       database.IdentityVerifyMethodWalletSignature,
+		GuildID:      guildID,
+	}, signMsg+"\n"+signature, discordID)
+}
+
+func Unlink(identityType database.CommunityQuestWhitelistUserIdentityType, identity, operator string) (bool, error) {
+	return UnlinkTx(database.CommunityPostgres, identityType, identity, operator)
+}
+
+// UnlinkTx 在tx中解除关联，用于与其他修改一起提交
+func UnlinkTx(tx *gorm.DB, identityType database.CommunityQuestWhitelistUserIdentityType, identity, operator string) (bool, error) {
+	if !IsValidIdentityType(identityType) {
+		return false, ErrUnsupportedIdentityType
+	}
+	return database.IdentityLinks{}.Unlink(tx, identityType, Normalize(identityType, identity), operator)
+}
+
+// Resolve 将同一类型的身份解析为目标类型
+func Resolve(fromType database.CommunityQuestWhitelistUserIdentityType, identities []string,
+	toType database.CommunityQuestWhitelistUserIdentityType) (*Result, error) {
+	result := &Result{To: toType}
+	if err := result.resolve(fromType, identities); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ResolveSource 将白名单、twitter space参与者或discord快照白名单解析为目标类型
+func ResolveSource(source, id string, toType database.CommunityQuestWhitelistUserIdentityType) (*Result, error) {
+	groups, err := sourceIdentities(source, id)
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{To: toType}
+	for fromType, identities := range groups {
+		if err := result.resolve(fromType, identities); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func sourceIdentities(source, id string) (map[database.CommunityQuestWhitelistUserIdentityType][]string, error) {
+	groups := make(map[database.CommunityQuestWhitelistUserIdentityType][]string)
+	switch source {
+	case SourceWhitelist:
+		entities, err := database.Whitelist{}.SelectByWhitelistID(id)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entities {
+			identityType := database.CommunityQuestWhitelistUserIdentityType(e.EntityType)
+			groups[identityType] = append(groups[identityType], e.EntityID)
+		}
+		users, err := database.CommunityQuestWhitelistUser{}.SelectByWhitelistID(id)
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range users {
+			groups[u.IdentityType] = append(groups[u.IdentityType], u.Identity)
+		}
+	case SourceTwitterSpace:
+		twitterIDs, err := database.TwitterSpaceParticipantRoles{}.SelectTwitterIDs(id)
+		if err != nil {
+			return nil, err
+		}
+		groups[database.CommunityQuestWhitelistUserIdentityTypeTwitterIds] = twitterIDs
+	case SourceDiscordSnapshot:
+		snapshot, err := database.DiscordSnapshot{}.SelectOne(id)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSourceNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, did := range snapshot.Whitelist {
+			if s, ok := did.(string); ok {
+				groups[database.CommunityQuestWhitelistUserIdentityTypeDiscordIds] = append(
+					groups[database.CommunityQuestWhitelistUserIdentityTypeDiscordIds], s)
+			}
+		}
+	default:
+		return nil, ErrUnsupportedSource
+	}
+	return groups, nil
+}
+
+func (in *Result) resolve(fromType database.CommunityQuestWhitelistUserIdentityType, identities []string) error {
+	if !IsValidIdentityType(fromType) || !IsValidIdentityType(in.To) {
+		return ErrUnsupportedIdentityType
+	}
+	in.FromTypes = append(in.FromTypes, fromType)
+	var (
+		seen       = make(map[string]bool)
+		normalized []string
+	)
+	for _, identity := range identities {
+		identity = Normalize(fromType, identity)
+		if identity == "" || seen[identity] {
+			continue
+		}
+		seen[identity] = true
+		normalized = append(normalized, identity)
+	}
+
+	if in.To == fromType {
+		for _, identity := range normalized {
+			in.Resolutions = append(in.Resolutions, &Resolution{From: identity, To: identity})
+		}
+		return nil
+	}
+
+	// 源身份关联的discord用户
+	var (
+		fromHops   = make(map[string]*Hop)
+		discordIDs = make(map[string]string)
+		dids       []string
+	)
+	if fromType == database.CommunityQuestWhitelistUserIdentityTypeDiscordIds {
+		for _, identity := range normalized {
+			discordIDs[identity] = identity
+			dids = append(dids, identity)
+		}
+	} else {
+		links, err := database.IdentityLinks{}.SelectByIdentities(fromType, normalized)
+		if err != nil {
+			return err
+		}
+		for _, link := range links {
+			fromHops[link.Identity] = linkHop(link)
+			discordIDs[link.Identity] = link.DiscordID
+			dids = append(dids, link.DiscordID)
+		}
+	}
+
+	// discord用户关联的目标身份
+	var toLinks = make(map[string][]*database.IdentityLinks)
+	if in.To != database.CommunityQuestWhitelistUserIdentityTypeDiscordIds {
+		links, err := database.IdentityLinks{}.SelectByDiscordIDs(in.To, dids)
+		if err != nil {
+			return err
+		}
+		for _, link := range links {
+			toLinks[link.DiscordID] = append(toLinks[link.DiscordID], link)
+		}
+	}
+
+	for _, identity := range normalized {
+		discordID, ok := discordIDs[identity]
+		if !ok {
+			in.Unresolved = append(in.Unresolved, identity)
+			continue
+		}
+		var path []*Hop
+		if hop := fromHops[identity]; hop != nil {
+			path = append(path, hop)
+		}
+		if in.To == database.CommunityQuestWhitelistUserIdentityTypeDiscordIds {
+			in.Resolutions = append(in.Resolutions, &Resolution{From: identity, DiscordID: discordID, To: discordID, Path: path})
+			continue
+		}
+		links := toLinks[discordID]
+		if len(links) == 0 {
+			in.Unresolved = append(in.Unresolved, identity)
+			continue
+		}
+		for _, link := range links {
+			in.Resolutions = append(in.Resolutions, &Resolution{
+				From:      identity,
+				DiscordID: discordID,
+				To:        link.Identity,
+				Path:      append(append([]*Hop{}, path...), linkHop(link)),
+			})
+		}
+	}
+	return nil
+}
+
+func linkHop(link *database.IdentityLinks) *Hop {
+	return &Hop{
+		IdentityType: link.IdentityType,
+		Identity:     link.Identity,
+		Method:       link.Method,
+		VerifiedAt:   link.VerifiedAt,
+	}
+}
+
+// Identities 去重后的目标身份
+func (in *Result) Identities() []string {
+	var (
+		seen       = make(map[string]bool)
+		identities []string
+	)
+	for _, r := range in.Resolutions {
+		if seen[r.To] {
+			continue
+		}
+		seen[r.To] = true
+		identities = append(identities, r.To)
+	}
+	return identities
+}
@@ -0,0 +1,119 @@
+package identity
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/g8rswimmer/go-twitter/v2"
+	"github.com/go-redis/redis/v8"
+	"moff.io/moff-social/internal/cache"
+	"moff.io/moff-social/internal/config"
+	"moff.io/moff-social/internal/database"
+	"moff.io/moff-social/internal/walletconnect"
+	"moff.io/moff-social/pkg/errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	linkNonceKeyPrefix = "identity:link_nonce:"
+	linkNonceTTL       = time.Minute * 10
+)
+
+var (
+	ErrInvalidProof = errors.New("invalid identity proof")
+	ErrNoProof      = errors.New("identity type can not be proven")
+
+	// 仅当签名消息与签发的消息一致时删除，保证每个随机数只能使用一次
+	consumeLinkNonce = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+)
+
+// Proof 关联身份的凭据，钱包需提供IssueLinkNonce签发的消息及其签名，twitter需提供用户授权的access token
+type Proof struct {
+	SignMsg     string `json:"sign_msg"`
+	Signature   string `json:"signature"`
+	AccessToken string `json:"access_token"`
+}
+
+// IssueLinkNonce 为discord用户签发待钱包签名的消息，有效期内仅最后签发的消息可用且只能使用一次
+func IssueLinkNonce(ctx context.Context, discordID, address string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.WrapAndReport(err, "generate link nonce")
+	}
+	msg := fmt.Sprintf("Link wallet %v to Discord user %v on moff.io\nNonce: %v\nExpires: %v",
+		strings.ToLower(address), discordID, hex.EncodeToString(b), time.Now().Add(linkNonceTTL).UTC().Format(time.RFC3339))
+	if err := cache.Redis.Set(ctx, linkNonceKeyPrefix+discordID, msg, linkNonceTTL).Err(); err != nil {
+		return "", errors.WrapAndReport(err, "cache link nonce")
+	}
+	return msg, nil
+}
+
+// VerifyProof 校验凭据并返回对应的验证方式，没有验证方式的身份类型不允许关联
+func VerifyProof(ctx context.Context, discordID string, identityType database.CommunityQuestWhitelistUserIdentityType,
+	identity string, proof Proof) (database.IdentityVerifyMethod, string, error) {
+	switch identityType {
+	case database.CommunityQuestWhitelistUserIdentityTypeWalletAddrs:
+		if proof.SignMsg == "" || !walletconnect.VerifySignature(identity, proof.Signature, []byte(proof.SignMsg)) {
+			return "", "", ErrInvalidProof
+		}
+		// 签名消息需与签发的消息完全一致，使用后立即失效，避免他人重放签名
+		consumed, err := consumeLinkNonce.Run(ctx, cache.Redis, []string{linkNonceKeyPrefix + discordID}, proof.SignMsg).Int()
+		if err != nil {
+			return "", "", errors.WrapAndReport(err, "consume link nonce")
+		}
+		if consumed == 0 {
+			return "", "", ErrInvalidProof
+		}
+		return database.IdentityVerifyMethodWalletSignature, proof.SignMsg + "\n" + proof.Signature, nil
+	case database.CommunityQuestWhitelistUserIdentityTypeTwitterIds:
+		if proof.AccessToken == "" {
+			return "", "", ErrInvalidProof
+		}
+		twitterID, err := lookupTwitterOAuthUser(ctx, proof.AccessToken)
+		if err != nil {
+			return "", "", err
+		}
+		if twitterID != identity {
+			return "", "", ErrInvalidProof
+		}
+		// 不保存access token
+		return database.IdentityVerifyMethodTwitterOAuth, "twitter oauth user " + twitterID, nil
+	case database.CommunityQuestWhitelistUserIdentityTypeUserIds:
+		return "", "", errors.WithMessage(ErrNoProof, string(identityType))
+	}
+	return "", "", ErrUnsupportedIdentityType
+}
+
+// lookupTwitterOAuthUser 通过用户授权的token查询授权的twitter账号，token无效时返回ErrInvalidProof
+func lookupTwitterOAuthUser(ctx context.Context, accessToken string) (string, error) {
+	cli := &twitter.Client{
+		Authorizer: bearerAuthorizer(accessToken),
+		Client:     http.DefaultClient,
+		Host:       config.Global.Twitter.ApiURL,
+	}
+	resp, err := cli.AuthUserLookup(ctx, twitter.UserLookupOpts{})
+	if err != nil {
+		var errResp *twitter.ErrorResponse
+		if errors.As(err, &errResp) && (errResp.StatusCode == http.StatusUnauthorized || errResp.StatusCode == http.StatusForbidden) {
+			return "", ErrInvalidProof
+		}
+		return "", errors.WrapAndReport(err, "lookup twitter oauth user")
+	}
+	if resp.Raw == nil || len(resp.Raw.Users) == 0 || resp.Raw.Users[0] == nil {
+		return "", ErrInvalidProof
+	}
+	return resp.Raw.Users[0].ID, nil
+}
+
+type bearerAuthorizer string
+
+func (in bearerAuthorizer) Add(req *http.Request) {
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", string(in)))
+}
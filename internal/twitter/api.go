@@ -0,0 +1,76 @@
+package twitter
+
+import (
+	"github.com/gin-gonic/gin"
+	"moff.io/moff-social/pkg/log"
+	"net/http"
+	"strconv"
+)
+
+// ListAuthorizations 查询凭证池中各凭证的负载、成功率及冷却状态
+func ListAuthorizations(ctx *gin.Context) {
+	// curl -H 'X-Moff-Admin-Token: xxx' http://127.0.0.1:8080/twitter/authorizations
+	statuses, err := NewAuthorizationPool().Statuses()
+	if err != nil {
+		log.Error(err)
+		ctx.String(http.StatusInternalServerError, "internal error")
+		return
+	}
+	ctx.JSONP(http.StatusOK, map[string]interface{}{
+		"authorizations": statuses,
+	})
+}
+
+type addAuthorizationRequest struct {
+	Cookies       string `json:"cookies" binding:"required"`
+	CsrfToken     string `json:"csrf_token" binding:"required"`
+	Authorization string `json:"authorization" binding:"required"`
+}
+
+// AddAuthorization 向凭证池添加网页登录凭证
+func AddAuthorization(ctx *gin.Context) {
+	// curl -H 'X-Moff-Admin-Token: xxx' -d '{"cookies":"","csrf_token":"","authorization":""}' http://127.0.0.1:8080/twitter/authorizations
+	var req addAuthorizationRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.String(http.StatusBadRequest, "cookies, csrf_token and authorization are required")
+		return
+	}
+	id, err := NewAuthorizationPool().Add(req.Cookies, req.CsrfToken, req.Authorization)
+	if err != nil {
+		log.Error(err)
+		ctx.String(http.StatusInternalServerError, "internal error")
+		return
+	}
+	ctx.JSONP(http.StatusOK, map[string]interface{}{
+		"id": id,
+	})
+}
+
+// DisableAuthorization 停用凭证，正在使用的space监控会在下次查询时切换凭证
+func DisableAuthorization(ctx *gin.Context) {
+	// curl -X POST -H 'X-Moff-Admin-Token: xxx' http://127.0.0.1:8080/twitter/authorizations/1/disable?note=banned
+	setAuthorizationDisabled(ctx, true)
+}
+
+// EnableAuthorization 重新启用凭证
+func EnableAuthorization(ctx *gin.Context) {
+	// curl -X POST -H 'X-Moff-Admin-Token: xxx' http://127.0.0.1:8080/twitter/authorizations/1/enable
+	setAuthorizationDisabled(ctx, false)
+}
+
+func setAuthorizationDisabled(ctx *gin.Context, disabled bool) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.String(http.StatusBadRequest, "invalid authorization id")
+		return
+	}
+	operator := ctx.ClientIP()
+	if err := NewAuthorizationPool().SetDisabled(id, disabled, operator, ctx.Query("note")); err != nil {
+		log.Error(err)
+		ctx.String(http.StatusInternalServerError, "internal error")
+		return
+	}
+	ctx.JSONP(http.StatusOK, map[string]interface{}{
+		"success": true,
+	})
+}
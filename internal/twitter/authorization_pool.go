@@ -0,0 +1,319 @@
+package twitter
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"moff.io/moff-social/internal/cache"
+	"moff.io/moff-social/internal/config"
+	"moff.io/moff-social/internal/database"
+	"moff.io/moff-social/pkg/errors"
+	"moff.io/moff-social/pkg/log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	twitterAuthorizationPoolLockKey    = "twitter_web_authorization_pool_lock"
+	twitterAuthorizationScoreKey       = "twitter_web_authorization_scores"
+	twitterAuthorizationCooldownKey    = "twitter_web_authorization_cooldown:"
+	twitterAuthorizationAlertKey       = "twitter_web_authorization_alert"
+	defaultAuthorizationAlertThreshold = 2
+	defaultAuthorizationCooldown       = 15 * time.Minute
+	authorizationAlertInterval         = 30 * time.Minute
+	authorizationPoolLockTTL           = time.Minute
+	authorizationPoolLockRetryInterval = time.Second
+	// AuthorizationPoolLockMaxWait 调用方等待凭证池锁的最长时间
+	AuthorizationPoolLockMaxWait = 30 * time.Second
+)
+
+var (
+	ErrorTwitterAuthorizationExhausted = errors.New("insufficient twitter web authorizations")
+	ErrorTwitterRateLimited            = errors.New("twitter web authorization rate limited")
+
+	initAuthorizationPoolOnce sync.Once
+	internalAuthorizationPool *AuthorizationPool
+)
+
+// AuthorizationPool 网页登录凭证池，按负载及成功率在各space监控之间轮换凭证.
+// 负载为最近一分钟内心跳占用凭证的space数量，成功失败次数及限流冷却保存在redis中供各实例共享.
+type AuthorizationPool struct {
+	lock           sync.RWMutex
+	disabled       map[int64]bool
+	maxLoad        int64
+	alertThreshold int64
+}
+
+// AuthorizationStatus 凭证当前状态，不包含凭证内容
+type AuthorizationStatus struct {
+	ID              int64   `json:"id"`
+	Expired         bool    `json:"expired"`
+	Disabled        bool    `json:"disabled"`
+	Load            int64   `json:"load"`
+	Successes       int64   `json:"successes"`
+	Failures        int64   `json:"failures"`
+	Score           float64 `json:"score"`
+	CooldownSeconds int64   `json:"cooldown_seconds"`
+}
+
+func (s *AuthorizationStatus) usable(maxLoad int64) bool {
+	return !s.Expired && !s.Disabled && s.CooldownSeconds == 0 && s.Load < maxLoad
+}
+
+func NewAuthorizationPool() *AuthorizationPool {
+	initAuthorizationPoolOnce.Do(func() {
+		internalAuthorizationPool = &AuthorizationPool{
+			disabled:       make(map[int64]bool),
+			maxLoad:        database.MaxHeartbeatCount,
+			alertThreshold: defaultAuthorizationAlertThreshold,
+		}
+	})
+	return internalAuthorizationPool
+}
+
+func (in *AuthorizationPool) Apply(conf *config.Configuration) {
+	if conf.Twitter.MaxSpacesPerAuthorization > 0 {
+		in.maxLoad = int64(conf.Twitter.MaxSpacesPerAuthorization)
+	}
+	if conf.Twitter.AuthorizationAlertThreshold > 0 {
+		in.alertThreshold = int64(conf.Twitter.AuthorizationAlertThreshold)
+	}
+}
+
+func (in *AuthorizationPool) Start(ctx context.Context) {
+	in.refresh()
+	go in.start(ctx)
+}
+
+func (in *AuthorizationPool) start(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	log.Infof("Twitter authorization pool running...")
+	defer log.Infof("Twitter authorization pool stopped...")
+	for {
+		select {
+		case <-ticker.C:
+			in.refresh()
+			statuses, err := in.Statuses()
+			if err != nil {
+				log.Error(err)
+				continue
+			}
+			in.checkCapacity(statuses)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// refresh 同步其他实例对凭证的停用设置
+func (in *AuthorizationPool) refresh() {
+	states, err := database.TwitterWebAuthorizationStates{}.SelectAll()
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	disabled := make(map[int64]bool)
+	for _, state := range states {
+		if state.Disabled {
+			disabled[state.AuthorizationID] = true
+		}
+	}
+	in.lock.Lock()
+	in.disabled = disabled
+	in.lock.Unlock()
+}
+
+// Usable 凭证是否仍可继续使用
+func (in *AuthorizationPool) Usable(id int64) bool {
+	in.lock.RLock()
+	defer in.lock.RUnlock()
+	return !in.disabled[id]
+}
+
+func (in *AuthorizationPool) Statuses() ([]*AuthorizationStatus, error) {
+	statuses, _, err := in.collect()
+	return statuses, err
+}
+
+func (in *AuthorizationPool) collect() ([]*AuthorizationStatus, map[int64]*database.TwitterWebAuthorization, error) {
+	loads, err := database.TwitterWebAuthorization{}.SelectLoads()
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx := context.TODO()
+	scores, err := cache.Redis.HGetAll(ctx, twitterAuthorizationScoreKey).Result()
+	if err != nil {
+		return nil, nil, errors.WrapAndReport(err, "query twitter authorization scores")
+	}
+	pipe := cache.Redis.Pipeline()
+	cooldowns := make([]*redis.DurationCmd, len(loads))
+	for idx, load := range loads {
+		cooldowns[idx] = pipe.TTL(ctx, fmt.Sprintf("%v%v", twitterAuthorizationCooldownKey, load.ID))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, nil, errors.WrapAndReport(err, "query twitter authorization cooldowns")
+	}
+
+	in.lock.RLock()
+	defer in.lock.RUnlock()
+	var (
+		statuses       = make([]*AuthorizationStatus, 0, len(loads))
+		authorizations = make(map[int64]*database.TwitterWebAuthorization, len(loads))
+	)
+	for idx, load := range loads {
+		authorizations[load.ID] = &load.TwitterWebAuthorization
+		status := &AuthorizationStatus{
+			ID:       load.ID,
+			Expired:  load.ExpiredTime != nil,
+			Disabled: in.disabled[load.ID],
+			Load:     load.Load,
+		}
+		status.Successes, _ = strconv.ParseInt(scores[fmt.Sprintf("%v:success", load.ID)], 10, 64)
+		status.Failures, _ = strconv.ParseInt(scores[fmt.Sprintf("%v:failure", load.ID)], 10, 64)
+		// 拉普拉斯平滑，新凭证默认0.5
+		status.Score = float64(status.Successes+1) / float64(status.Successes+status.Failures+2)
+		if ttl := cooldowns[idx].Val(); ttl > 0 {
+			status.CooldownSeconds = int64(ttl.Seconds()) + 1
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, authorizations, nil
+}
+
+// Acquire 为holderID选择负载最低、成功率最高的可用凭证，等待锁时可通过ctx取消
+func (in *AuthorizationPool) Acquire(ctx context.Context, holderID string) (*database.TwitterWebAuthorization, error) {
+	// 锁的值为本次调用唯一的标识，超时后被他人获取的锁不会被误删
+	token := newSpaceMonitorHolder()
+	ticker := time.NewTicker(authorizationPoolLockRetryInterval)
+	defer ticker.Stop()
+	for {
+		locked, err := cache.Redis.SetNX(ctx, twitterAuthorizationPoolLockKey, token, authorizationPoolLockTTL).Result()
+		if err != nil {
+			return nil, errors.WrapAndReport(err, "lock twitter authorization pool")
+		}
+		if locked {
+			break
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil, errors.WrapAndReport(ctx.Err(), "wait twitter authorization pool lock")
+		}
+	}
+	defer func() {
+		// 释放锁不使用可能已取消的ctx
+		err := releaseRedisLock.Run(context.Background(), cache.Redis, []string{twitterAuthorizationPoolLockKey}, token).Err()
+		if err != nil {
+			log.Error(errors.WrapAndReport(err, "unlock twitter authorization pool"))
+		}
+	}()
+
+	statuses, authorizations, err := in.collect()
+	if err != nil {
+		return nil, err
+	}
+	var candidates []*AuthorizationStatus
+	for _, status := range statuses {
+		if status.usable(in.maxLoad) {
+			candidates = append(candidates, status)
+		}
+	}
+	if len(candidates) == 0 {
+		in.checkCapacity(statuses)
+		return nil, ErrorTwitterAuthorizationExhausted
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Load != candidates[j].Load {
+			return candidates[i].Load < candidates[j].Load
+		}
+		return candidates[i].Score > candidates[j].Score
+	})
+	chosen := candidates[0]
+	heartbeat := database.TwitterWebAuthorizationHeartbeats{
+		TwitterSpaceID:  holderID,
+		AuthorizationID: chosen.ID,
+	}
+	if err := heartbeat.Beat(); err != nil {
+		return nil, err
+	}
+	chosen.Load++
+	in.checkCapacity(statuses)
+	return authorizations[chosen.ID], nil
+}
+
+func (in *AuthorizationPool) ReportSuccess(id int64) {
+	in.incrScore(id, "success")
+}
+
+func (in *AuthorizationPool) ReportFailure(id int64) {
+	in.incrScore(id, "failure")
+}
+
+func (in *AuthorizationPool) incrScore(id int64, field string) {
+	err := cache.Redis.HIncrBy(context.TODO(), twitterAuthorizationScoreKey, fmt.Sprintf("%v:%v", id, field), 1).Err()
+	if err != nil {
+		log.Error(errors.WrapAndReport(err, "incr twitter authorization score"))
+	}
+}
+
+// Cooldown 凭证被限流，until之前不再分配
+func (in *AuthorizationPool) Cooldown(id int64, until time.Time) {
+	duration := time.Until(until)
+	if duration <= 0 {
+		duration = defaultAuthorizationCooldown
+	}
+	key := fmt.Sprintf("%v%v", twitterAuthorizationCooldownKey, id)
+	if err := cache.Redis.Set(context.TODO(), key, until.Unix(), duration).Err(); err != nil {
+		log.Error(errors.WrapAndReport(err, "cooldown twitter authorization"))
+	}
+	log.Warnf("Twitter web authorization %v cooling down for %v", id, duration)
+}
+
+func (in *AuthorizationPool) Add(cookies, csrfToken, authorization string) (int64, error) {
+	return database.TwitterWebAuthorization{
+		Cookies:       cookies,
+		CsrfToken:     csrfToken,
+		Authorization: authorization,
+	}.Create()
+}
+
+func (in *AuthorizationPool) SetDisabled(id int64, disabled bool, operator, note string) error {
+	err := database.TwitterWebAuthorizationStates{
+		AuthorizationID: id,
+		Disabled:        disabled,
+		Note:            note,
+		UpdatedBy:       operator,
+	}.Save()
+	if err != nil {
+		return err
+	}
+	in.lock.Lock()
+	in.disabled[id] = disabled
+	in.lock.Unlock()
+	return nil
+}
+
+// checkCapacity 剩余可分配的space数量不超过阈值时告警
+func (in *AuthorizationPool) checkCapacity(statuses []*AuthorizationStatus) {
+	var remaining int64
+	for _, status := range statuses {
+		if status.Expired || status.Disabled || status.CooldownSeconds > 0 || status.Load >= in.maxLoad {
+			continue
+		}
+		remaining += in.maxLoad - status.Load
+	}
+	if remaining > in.alertThreshold {
+		return
+	}
+	alerted, err := cache.Redis.SetNX(context.TODO(), twitterAuthorizationAlertKey, remaining, authorizationAlertInterval).Result()
+	if err != nil {
+		log.Error(errors.WrapAndReport(err, "lock twitter authorization alert"))
+		return
+	}
+	if !alerted {
+		return
+	}
+	log.Error(errors.ErrorfAndReport("Twitter web authorizations nearly exhausted, %v space slots remaining", remaining))
+}
@@ -1,18 +1,28 @@
 package twitter
 
 import (
+	"context"
 	"fmt"
 	"github.com/g8rswimmer/go-twitter/v2"
 	"github.com/tidwall/gjson"
+	"go.uber.org/atomic"
 	"io/ioutil"
 	"moff.io/moff-social/internal/config"
 	"moff.io/moff-social/pkg/errors"
+	"moff.io/moff-social/pkg/log"
 	"net/http"
 	"sync"
+	"time"
+)
+
+const (
+	tokenRetryInterval = time.Minute
 )
 
 type Client struct {
 	cli            *twitter.Client
+	ready          atomic.Bool
+	tokenLock      sync.RWMutex
 	accessToken    string
 	tokenRefresher *tokenRefresher
 }
@@ -29,32 +39,70 @@ func NewClient() *Client {
 	return internalClient
 }
 
+// Apply 未配置官方接口时仅记录日志，官方接口数据来源不可用
 func (in *Client) Apply(conf *config.Configuration) {
-	in.checkConfiguration(conf)
-	in.tokenRefresher = newTokenRefresher(conf.Twitter.ApiKey, conf.Twitter.ApiSecret, conf.Twitter.RefreshTokenURL)
-	if err := in.RefreshAccessToken(); err != nil {
-		panic(err)
+	if err := in.checkConfiguration(conf); err != nil {
+		log.Warnf("Twitter api client disabled:%v", err)
+		return
 	}
+	in.tokenRefresher = newTokenRefresher(conf.Twitter.ApiKey, conf.Twitter.ApiSecret, conf.Twitter.RefreshTokenURL)
 	in.cli = &twitter.Client{
 		Authorizer: in,
 		Client:     http.DefaultClient,
 		Host:       conf.Twitter.ApiURL,
 	}
+	if err := in.RefreshAccessToken(); err != nil {
+		log.Errorf("Refresh twitter api access token, retry later:%v", err)
+		return
+	}
+	in.ready.Store(true)
 }
 
-func (in *Client) checkConfiguration(conf *config.Configuration) {
+// Start 启动时获取token失败的，定时重试直至成功
+func (in *Client) Start(ctx context.Context) {
+	if in.tokenRefresher == nil || in.IsReady() {
+		log.Infof("Twitter api client ready:%v", in.IsReady())
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(tokenRetryInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := in.RefreshAccessToken(); err != nil {
+					log.Error(err)
+					continue
+				}
+				in.ready.Store(true)
+				log.Infof("Twitter api client ready...")
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// IsReady 是否已完成配置并获取到token
+func (in *Client) IsReady() bool {
+	return in.ready.Load()
+}
+
+func (in *Client) checkConfiguration(conf *config.Configuration) error {
 	if conf.Twitter.ApiURL == "" {
-		panic("twitter api url not configured")
+		return errors.New("twitter api url not configured")
 	}
 	if conf.Twitter.ApiKey == "" {
-		panic("twitter api key not configured")
+		return errors.New("twitter api key not configured")
 	}
 	if conf.Twitter.ApiSecret == "" {
-		panic("twitter api secret not configured")
+		return errors.New("twitter api secret not configured")
 	}
 	if conf.Twitter.RefreshTokenURL == "" {
-		panic("twitter refresh token url not configured")
+		return errors.New("twitter refresh token url not configured")
 	}
+	return nil
 }
 
 func (in *Client) RefreshAccessToken() error {
@@ -62,11 +110,15 @@ func (in *Client) RefreshAccessToken() error {
 	if err != nil {
 		return err
 	}
+	in.tokenLock.Lock()
 	in.accessToken = token
+	in.tokenLock.Unlock()
 	return nil
 }
 
 func (in *Client) Add(req *http.Request) {
+	in.tokenLock.RLock()
+	defer in.tokenLock.RUnlock()
 	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", in.accessToken))
 }
 
@@ -0,0 +1,194 @@
+package twitter
+
+import (
+	"context"
+	"fmt"
+	"github.com/g8rswimmer/go-twitter/v2"
+	"github.com/go-redis/redis/v8"
+	"moff.io/moff-social/internal/cache"
+	"moff.io/moff-social/pkg/errors"
+	"strings"
+	"time"
+)
+
+const (
+	twitterUserIDKey  = "twitter_user_id:"
+	twitterFollowKey  = "twitter_follow:"
+	twitterUserIDTTL  = time.Hour * 24 * 7
+	followingCacheTTL = time.Hour * 24
+	// 未关注的结果缓存较短，用户关注后可尽快重新验证
+	notFollowingCacheTTL = time.Minute * 10
+	followingPageSize    = 1000
+	// 关注列表接口限流严格，关注数过多的用户只检查最近关注的账号
+	followingMaxPages = 5
+)
+
+// ErrorTwitterFollowingUnknown 用户关注的账号过多，最近关注的账号中未找到目标，无法确定是否关注
+var ErrorTwitterFollowingUnknown = errors.New("twitter following too many accounts to verify")
+
+// NormalizeUsername 去除@前缀并转为小写
+func NormalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(username), "@"))
+}
+
+// LookupUserIDs 查询用户名对应的用户ID，结果按用户名缓存；不存在的用户名不出现在结果中
+func (in *Client) LookupUserIDs(usernames []string) (map[string]string, error) {
+	var (
+		ctx     = context.TODO()
+		ids     = make(map[string]string, len(usernames))
+		missing []string
+	)
+	for _, username := range usernames {
+		username = NormalizeUsername(username)
+		if username == "" {
+			continue
+		}
+		id, err := cache.Redis.Get(ctx, twitterUserIDKey+username).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return nil, errors.WrapAndReport(err, "query cache twitter user id")
+		}
+		if id != "" {
+			ids[username] = id
+			continue
+		}
+		missing = append(missing, username)
+	}
+	if len(missing) == 0 {
+		return ids, nil
+	}
+	if !in.IsReady() {
+		return nil, ErrorTwitterApiNotReady
+	}
+	var response *twitter.UserLookupResponse
+	err := in.call(func(ctx context.Context) (err error) {
+		response, err = in.cli.UserNameLookup(ctx, missing, twitter.UserLookupOpts{})
+		return err
+	})
+	if err != nil {
+		return nil, errors.WithMessage(err, "lookup twitter usernames")
+	}
+	if response.Raw == nil {
+		return ids, nil
+	}
+	for _, user := range response.Raw.Users {
+		if user == nil {
+			continue
+		}
+		username := NormalizeUsername(user.UserName)
+		ids[username] = user.ID
+		if err := cache.Redis.Set(ctx, twitterUserIDKey+username, user.ID, twitterUserIDTTL).Err(); err != nil {
+			return nil, errors.WrapAndReport(err, "cache twitter user id")
+		}
+	}
+	return ids, nil
+}
+
+// Follows 检查用户是否关注各目标账号，结果按TTL缓存；关注列表超过检查上限时，未找到的目标无法确定，不出现在结果中且不缓存
+func (in *Client) Follows(twitterID string, targetIDs []string) (map[string]bool, error) {
+	var (
+		ctx       = context.TODO()
+		follows   = make(map[string]bool, len(targetIDs))
+		uncached  = make(map[string]bool)
+		remaining int
+	)
+	for _, targetID := range targetIDs {
+		val, err := cache.Redis.Get(ctx, fmt.Sprintf("%v%v:%v", twitterFollowKey, twitterID, targetID)).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return nil, errors.WrapAndReport(err, "query cache twitter follow")
+		}
+		if val != "" {
+			follows[targetID] = val == "1"
+			continue
+		}
+		if !uncached[targetID] {
+			uncached[targetID] = true
+			remaining++
+		}
+	}
+	if remaining == 0 {
+		return follows, nil
+	}
+	if !in.IsReady() {
+		return nil, ErrorTwitterApiNotReady
+	}
+	var (
+		token    string
+		complete bool
+	)
+	for page := 0; page < followingMaxPages; page++ {
+		var response *twitter.UserFollowingLookupResponse
+		err := in.call(func(ctx context.Context) (err error) {
+			response, err = in.cli.UserFollowingLookup(ctx, twitterID, twitter.UserFollowingLookupOpts{
+				MaxResults:      followingPageSize,
+				PaginationToken: token,
+			})
+			return err
+		})
+		if err != nil {
+			return nil, errors.WithMessage(err, "lookup twitter following")
+		}
+		if response.Raw != nil {
+			for _, user := range response.Raw.Users {
+				if user != nil && uncached[user.ID] && !follows[user.ID] {
+					follows[user.ID] = true
+					remaining--
+				}
+			}
+		}
+		if remaining == 0 || response.Meta == nil || response.Meta.NextToken == "" {
+			complete = true
+			break
+		}
+		token = response.Meta.NextToken
+	}
+	for targetID := range uncached {
+		val, ttl := "0", notFollowingCacheTTL
+		if follows[targetID] {
+			val, ttl = "1", followingCacheTTL
+		} else if !complete {
+			continue
+		} else {
+			follows[targetID] = false
+		}
+		key := fmt.Sprintf("%v%v:%v", twitterFollowKey, twitterID, targetID)
+		if err := cache.Redis.Set(ctx, key, val, ttl).Err(); err != nil {
+			return nil, errors.WrapAndReport(err, "cache twitter follow")
+		}
+	}
+	return follows, nil
+}
+
+// VerifyFollows 返回用户未关注的账号，不存在的账号视为未关注；其余账号无法确定时返回ErrorTwitterFollowingUnknown
+func (in *Client) VerifyFollows(twitterID string, usernames []string) (missing []string, err error) {
+	ids, err := in.LookupUserIDs(usernames)
+	if err != nil {
+		return nil, err
+	}
+	var targetIDs []string
+	for _, id := range ids {
+		targetIDs = append(targetIDs, id)
+	}
+	follows, err := in.Follows(twitterID, targetIDs)
+	if err != nil {
+		return nil, err
+	}
+	var unknown bool
+	for _, username := range usernames {
+		id, ok := ids[NormalizeUsername(username)]
+		if ok {
+			following, known := follows[id]
+			if !known {
+				unknown = true
+				continue
+			}
+			if following {
+				continue
+			}
+		}
+		missing = append(missing, NormalizeUsername(username))
+	}
+	if len(missing) == 0 && unknown {
+		return nil, ErrorTwitterFollowingUnknown
+	}
+	return missing, nil
+}
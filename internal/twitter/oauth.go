@@ -0,0 +1,111 @@
+package twitter
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"github.com/g8rswimmer/go-twitter/v2"
+	"golang.org/x/oauth2"
+	"moff.io/moff-social/internal/config"
+	"moff.io/moff-social/pkg/errors"
+	"net/http"
+)
+
+const (
+	oauthAuthorizeURL = "https://twitter.com/i/oauth2/authorize"
+	oauthTokenURL     = "https://api.twitter.com/2/oauth2/token"
+)
+
+var (
+	ErrorTwitterOAuthNotConfigured = errors.New("twitter oauth not configured")
+)
+
+// OAuthRequest 一次PKCE授权请求，Verifier需保存至回调时使用
+type OAuthRequest struct {
+	URL      string
+	State    string
+	Verifier string
+}
+
+func oauthConfig() (*oauth2.Config, error) {
+	conf := config.Global.Twitter
+	if conf.OAuthClientID == "" || conf.OAuthRedirectURL == "" {
+		return nil, ErrorTwitterOAuthNotConfigured
+	}
+	return &oauth2.Config{
+		ClientID:     conf.OAuthClientID,
+		ClientSecret: conf.OAuthClientSecret,
+		RedirectURL:  conf.OAuthRedirectURL,
+		Scopes:       []string{"users.read", "tweet.read"},
+		Endpoint: oauth2.Endpoint{
+			AuthURL:   oauthAuthorizeURL,
+			TokenURL:  oauthTokenURL,
+			AuthStyle: oauth2.AuthStyleInHeader,
+		},
+	}, nil
+}
+
+// NewOAuthRequest 生成带有PKCE code challenge的授权链接
+func NewOAuthRequest() (*OAuthRequest, error) {
+	conf, err := oauthConfig()
+	if err != nil {
+		return nil, err
+	}
+	state, err := randomURLString(24)
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := randomURLString(48)
+	if err != nil {
+		return nil, err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+	url := conf.AuthCodeURL(state,
+		oauth2.SetAuthURLParam("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:])),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	)
+	return &OAuthRequest{URL: url, State: state, Verifier: verifier}, nil
+}
+
+// VerifyOAuthCode 使用授权码换取用户token，并通过v2接口确认授权的twitter账号
+func VerifyOAuthCode(ctx context.Context, code, verifier string) (*twitter.UserObj, error) {
+	conf, err := oauthConfig()
+	if err != nil {
+		return nil, err
+	}
+	token, err := conf.Exchange(ctx, code, oauth2.SetAuthURLParam("code_verifier", verifier))
+	if err != nil {
+		return nil, errors.WrapAndReport(err, "exchange twitter oauth code")
+	}
+	cli := &twitter.Client{
+		Authorizer: userAuthorizer(token.AccessToken),
+		Client:     http.DefaultClient,
+		Host:       config.Global.Twitter.ApiURL,
+	}
+	resp, err := cli.AuthUserLookup(ctx, twitter.UserLookupOpts{
+		UserFields: []twitter.UserField{twitter.UserFieldUserName, twitter.UserFieldName},
+	})
+	if err != nil {
+		return nil, errors.WrapAndReport(err, "lookup twitter oauth user")
+	}
+	if resp.Raw == nil || len(resp.Raw.Users) == 0 || resp.Raw.Users[0] == nil {
+		return nil, errors.NewWithReport("twitter oauth user not found")
+	}
+	return resp.Raw.Users[0], nil
+}
+
+type userAuthorizer string
+
+func (in userAuthorizer) Add(req *http.Request) {
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", string(in)))
+}
+
+func randomURLString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.WrapAndReport(err, "generate random string")
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
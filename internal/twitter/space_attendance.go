@@ -0,0 +1,141 @@
+package twitter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"moff.io/moff-social/internal/cache"
+	"moff.io/moff-social/internal/chart"
+	"moff.io/moff-social/internal/database"
+	"moff.io/moff-social/pkg/errors"
+	"moff.io/moff-social/pkg/log"
+	"time"
+)
+
+const (
+	twitterSpaceConcurrencyKey = "twitter_space_concurrency:"
+)
+
+// SpaceConcurrency 单次轮询时的同时在线人数
+type SpaceConcurrency struct {
+	At    int64 `json:"t"`
+	Count int   `json:"c"`
+}
+
+func (in *SpaceMonitor) recordConcurrency(at int64, count int) {
+	var (
+		ctx = context.TODO()
+		key = fmt.Sprintf("%v%v", twitterSpaceConcurrencyKey, in.snapshot.SpaceID)
+	)
+	b, err := json.Marshal(&SpaceConcurrency{At: at, Count: count})
+	if err != nil {
+		log.Error(errors.WrapAndReport(err, "marshal twitter space concurrency"))
+		return
+	}
+	if err := cache.Redis.RPush(ctx, key, string(b)).Err(); err != nil {
+		log.Error(errors.WrapAndReport(err, "cache twitter space concurrency"))
+		return
+	}
+	cache.Redis.Expire(ctx, key, time.Hour*24*3)
+}
+
+func (in *SpaceMonitor) loadConcurrency() ([]*SpaceConcurrency, error) {
+	key := fmt.Sprintf("%v%v", twitterSpaceConcurrencyKey, in.snapshot.SpaceID)
+	values, err := cache.Redis.LRange(context.TODO(), key, 0, -1).Result()
+	if err != nil {
+		return nil, errors.WrapAndReport(err, "query cache twitter space concurrency")
+	}
+	series := make([]*SpaceConcurrency, 0, len(values))
+	for _, val := range values {
+		var c SpaceConcurrency
+		if err := json.Unmarshal([]byte(val), &c); err != nil {
+			log.Error(errors.WrapAndReport(err, "unmarshal twitter space concurrency"))
+			continue
+		}
+		series = append(series, &c)
+	}
+	return series, nil
+}
+
+// calcAttendance 计算峰值、平均在线人数，去重听众及5/15/30分钟留存
+func (in *SpaceMonitor) calcAttendance() {
+	series, err := in.loadConcurrency()
+	if err != nil {
+		log.Error(err)
+	}
+	var total int
+	for _, c := range series {
+		total += c.Count
+		if c.Count > in.snapshot.PeakConcurrency {
+			in.snapshot.PeakConcurrency = c.Count
+		}
+	}
+	if len(series) > 0 {
+		in.snapshot.AvgConcurrency = math.Round(float64(total)/float64(len(series))*10) / 10
+		b, err := json.Marshal(series)
+		if err != nil {
+			log.Error(errors.WrapAndReport(err, "marshal twitter space concurrency series"))
+		} else {
+			in.snapshot.ConcurrencySeries = string(b)
+		}
+	}
+
+	var retained5m, retained15m, retained30m int
+	for _, p := range in.spaceParticipants {
+		if p.wasListener() {
+			in.snapshot.UniqueListeners++
+		}
+		switch {
+		case p.PresenceMs >= int64(30*time.Minute/time.Millisecond):
+			retained30m++
+			fallthrough
+		case p.PresenceMs >= int64(15*time.Minute/time.Millisecond):
+			retained15m++
+			fallthrough
+		case p.PresenceMs >= int64(5*time.Minute/time.Millisecond):
+			retained5m++
+		}
+	}
+	if participants := len(in.spaceParticipants); participants > 0 {
+		in.snapshot.Retention5m = percentage(retained5m, participants)
+		in.snapshot.Retention15m = percentage(retained15m, participants)
+		in.snapshot.Retention30m = percentage(retained30m, participants)
+	}
+}
+
+func (p *SpaceParticipant) wasListener() bool {
+	if len(p.Transitions) == 0 {
+		return p.Role == "" || p.Role == SpaceIdentityListener
+	}
+	for _, t := range p.Transitions {
+		if t.Identity == SpaceIdentityListener {
+			return true
+		}
+	}
+	return false
+}
+
+func percentage(n, total int) float64 {
+	return math.Round(float64(n)/float64(total)*1000) / 10
+}
+
+// RenderConcurrencyChart 绘制快照的在线人数曲线
+func RenderConcurrencyChart(w io.Writer, snapshot *database.TwitterSpaceSnapshots) error {
+	if snapshot.ConcurrencySeries == "" {
+		return errors.Errorf("twitter space %v has no concurrency series", snapshot.SpaceID)
+	}
+	var series []*SpaceConcurrency
+	if err := json.Unmarshal([]byte(snapshot.ConcurrencySeries), &series); err != nil {
+		return errors.WrapAndReport(err, "unmarshal twitter space concurrency series")
+	}
+	points := make([]chart.Point, 0, len(series))
+	for _, c := range series {
+		points = append(points, chart.Point{X: c.At, Y: float64(c.Count)})
+	}
+	return chart.Line{
+		Title:  "Concurrent participants (UTC)",
+		Points: points,
+	}.Render(w)
+}
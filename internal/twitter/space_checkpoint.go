@@ -0,0 +1,288 @@
+package twitter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"moff.io/moff-social/internal/cache"
+	"moff.io/moff-social/internal/database"
+	"moff.io/moff-social/pkg/errors"
+	"moff.io/moff-social/pkg/log"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	twitterSpaceCheckpointKey  = "twitter_space_checkpoint:"
+	spaceMonitorInterval       = time.Second * 10
+	spaceCheckpointInterval    = time.Minute
+	spaceBackupReplayBatchSize = 500
+)
+
+var (
+	// 仅当锁仍由当前持有者持有时续期或释放
+	extendSpaceMonitorLock = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+	releaseRedisLock = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+)
+
+// spaceCheckpointMeta 与参与者缓存在同一事务中写入redis，标识缓存对应的观测时间
+type spaceCheckpointMeta struct {
+	Sequence   int64  `json:"sequence"`
+	ObservedAt int64  `json:"observed_at"`
+	Holder     string `json:"holder"`
+}
+
+// spaceResume 接管监控后待处理的中断，observedAt为中断前最后一次观测时间
+type spaceResume struct {
+	observedAt int64
+	from       string
+}
+
+func newSpaceMonitorHolder() string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%v:%v:%v", hostname, os.Getpid(), time.Now().UnixNano())
+}
+
+// restore 从redis缓存、数据库检查点中序号较大者恢复监控状态，二者均不存在时通过原始响应备份重放
+func (in *SpaceMonitor) restore() error {
+	spaceID := in.snapshot.SpaceID
+	participants, err := in.loadSpaceParticipants(spaceID)
+	if err != nil {
+		return err
+	}
+	meta, err := in.loadCheckpointMeta()
+	if err != nil {
+		return err
+	}
+	checkpoint, err := database.TwitterSpaceCheckpoints{}.SelectOne(spaceID)
+	if err != nil {
+		return err
+	}
+
+	var from string
+	switch {
+	case checkpoint != nil && (meta == nil || checkpoint.Sequence > meta.Sequence):
+		restored := make(map[string]*SpaceParticipant)
+		if err := json.Unmarshal([]byte(checkpoint.Participants), &restored); err != nil {
+			return errors.WrapAndReport(err, "unmarshal twitter space checkpoint")
+		}
+		in.spaceParticipants = restored
+		in.sequence, in.observedAt = checkpoint.Sequence, checkpoint.ObservedAt
+		from = fmt.Sprintf("database checkpoint of %v", checkpoint.Holder)
+	case meta != nil:
+		in.spaceParticipants = participants
+		in.sequence, in.observedAt = meta.Sequence, meta.ObservedAt
+		from = fmt.Sprintf("cache checkpoint of %v", meta.Holder)
+	case len(participants) > 0:
+		// 未记录观测时间的旧缓存，无法计算中断时间
+		in.spaceParticipants = participants
+		from = "legacy cache"
+	case in.snapshot.StartedAt != nil:
+		replayed, err := in.replayBackups(in.snapshot.StartedAt.Add(-spaceCheckpointInterval))
+		if err != nil {
+			return err
+		}
+		if replayed == 0 {
+			return nil
+		}
+		from = fmt.Sprintf("%v backups", replayed)
+	default:
+		return nil
+	}
+	in.persistedAt = in.observedAt
+
+	var open int
+	for _, p := range in.spaceParticipants {
+		if p.Presence != nil {
+			open++
+		}
+	}
+	if in.observedAt > 0 && open > 0 {
+		in.resume = &spaceResume{observedAt: in.observedAt, from: from}
+	}
+	log.Infof("Twitter space %v monitor restored %v participants(%v present) from %v, sequence %v observed at %v",
+		spaceID, len(in.spaceParticipants), open, from, in.sequence, time.UnixMilli(in.observedAt).UTC())
+	return nil
+}
+
+func (in *SpaceMonitor) loadCheckpointMeta() (*spaceCheckpointMeta, error) {
+	key := fmt.Sprintf("%v%v", twitterSpaceCheckpointKey, in.snapshot.SpaceID)
+	val, err := cache.Redis.Get(context.TODO(), key).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WrapAndReport(err, "query cache twitter space checkpoint")
+	}
+	var meta spaceCheckpointMeta
+	if err := json.Unmarshal([]byte(val), &meta); err != nil {
+		log.Error(errors.WrapAndReport(err, "unmarshal twitter space checkpoint"))
+		return nil, nil
+	}
+	return &meta, nil
+}
+
+// replayBackups 按时间顺序重放since之后的原始响应，重建参与者状态
+func (in *SpaceMonitor) replayBackups(since time.Time) (replayed int, err error) {
+	series, err := in.loadConcurrency()
+	if err != nil {
+		return 0, err
+	}
+	var (
+		recordSeries = len(series) == 0
+		afterID      int64
+	)
+	for {
+		backups, err := database.TwitterSpaceBackups{}.SelectSince(in.snapshot.SpaceID, afterID, since, spaceBackupReplayBatchSize)
+		if err != nil {
+			return replayed, err
+		}
+		for _, backup := range backups {
+			afterID = backup.ID
+			if strings.Contains(backup.Response, "BadRequest") {
+				continue
+			}
+			var resp spaceResponse
+			if err := json.Unmarshal([]byte(backup.Response), &resp); err != nil {
+				continue
+			}
+			at := backup.CreatedTime.UnixMilli()
+			space := calcTwitterSpaceParticipants(&resp, at)
+			if !space.IsRunning() || at <= in.observedAt {
+				continue
+			}
+			count := in.observeSpace(space, at)
+			if recordSeries {
+				in.recordConcurrency(at, count)
+			}
+			in.sequence++
+			in.observedAt = at
+			replayed++
+		}
+		if len(backups) < spaceBackupReplayBatchSize {
+			return replayed, nil
+		}
+	}
+}
+
+// reconcileGap 接管后首次观测时结算中断期间的参与时间：
+// 中断前后均在场且加入时间未变化的视为持续在场；中断期间重新加入的，之前的参与截止至中断开始；
+// 恢复后已不在场的，无法确定退出时间，参与截止至中断开始.
+func (in *SpaceMonitor) reconcileGap(space *Space, now int64) {
+	var (
+		from       = in.resume.observedAt
+		present    = make(map[string]*SpacePresence, len(space.Presences))
+		continued  int
+		rejoined   int
+		left       int
+		reportedBy = now - int64(spaceMonitorInterval/time.Millisecond)
+	)
+	for _, presence := range space.Presences {
+		present[presence.TwitterID] = presence
+	}
+	for twitterID, p := range in.spaceParticipants {
+		presence := present[twitterID]
+		if p.Presence == nil {
+			// 中断前已退出，本次加入不早于中断开始
+			if presence != nil && presence.Since < from {
+				presence.Since = from
+			}
+			continue
+		}
+		switch {
+		case presence == nil:
+			p.leave(from)
+			left++
+		// 未返回加入时间的参与者以查询时间代替，不能据此判断重新加入
+		case presence.Since > from && presence.Since < reportedBy:
+			p.leave(from)
+			rejoined++
+		default:
+			continued++
+		}
+	}
+	err := database.TwitterSpaceMonitorGaps{
+		SpaceID:   in.snapshot.SpaceID,
+		FromAt:    from,
+		ToAt:      now,
+		Holder:    in.holder,
+		Continued: continued,
+		Rejoined:  rejoined,
+		Left:      left,
+	}.Create()
+	if err != nil {
+		log.Error(err)
+	}
+	log.Infof("Twitter space %v monitor resumed from %v after %v gap, %v continued, %v rejoined, %v left",
+		in.snapshot.SpaceID, in.resume.from, time.Duration(now-from)*time.Millisecond, continued, rejoined, left)
+	in.resume = nil
+}
+
+// checkpoint 每次观测后写入redis，每分钟写入数据库；数据库已有更新的检查点时说明监控已被其他实例接管
+func (in *SpaceMonitor) checkpoint(now int64) (owned bool) {
+	in.sequence++
+	in.observedAt = now
+	var (
+		ctx         = context.TODO()
+		presenceKey = fmt.Sprintf("twitter_space_presence:%v", in.snapshot.SpaceID)
+		metaKey     = fmt.Sprintf("%v%v", twitterSpaceCheckpointKey, in.snapshot.SpaceID)
+		values      []interface{}
+	)
+	for twitterID, p := range in.spaceParticipants {
+		values = append(values, twitterID, p.Marshal())
+	}
+	meta, err := json.Marshal(&spaceCheckpointMeta{Sequence: in.sequence, ObservedAt: now, Holder: in.holder})
+	if err != nil {
+		log.Error(errors.WrapAndReport(err, "marshal twitter space checkpoint"))
+		return true
+	}
+	for i := 0; i < 3; i++ {
+		_, err = cache.Redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			if len(values) > 0 {
+				pipe.HSet(ctx, presenceKey, values...)
+			}
+			pipe.Set(ctx, metaKey, string(meta), time.Hour*24*3)
+			return nil
+		})
+		if err == nil {
+			break
+		}
+		log.Error(errors.WrapAndReport(err, "cache twitter space checkpoint"))
+	}
+
+	if now-in.persistedAt < int64(spaceCheckpointInterval/time.Millisecond) {
+		return true
+	}
+	participants, err := json.Marshal(in.spaceParticipants)
+	if err != nil {
+		log.Error(errors.WrapAndReport(err, "marshal twitter space participants"))
+		return true
+	}
+	saved, err := database.TwitterSpaceCheckpoints{
+		SpaceID:      in.snapshot.SpaceID,
+		Sequence:     in.sequence,
+		Holder:       in.holder,
+		ObservedAt:   now,
+		Participants: string(participants),
+	}.Save()
+	if err != nil {
+		log.Error(err)
+		return true
+	}
+	if !saved {
+		log.Warnf("Twitter space %v checkpoint %v superseded, monitor taken over", in.snapshot.SpaceID, in.sequence)
+		return false
+	}
+	in.persistedAt = now
+	return true
+}
@@ -3,7 +3,6 @@ package twitter
 import (
 	"context"
 	"fmt"
-	"moff.io/moff-social/internal/cache"
 	"moff.io/moff-social/internal/database"
 	"moff.io/moff-social/pkg/errors"
 	"moff.io/moff-social/pkg/log"
@@ -14,9 +13,8 @@ import (
 )
 
 const (
-	defaultManagerSpaceID      = "twitter_space_manager"
-	twitterSpaceManagerLockKey = "twitter_space_manager_lock"
-	spaceManagerAutomation     = "twitter_space_manager_automation"
+	defaultManagerSpaceID  = "twitter_space_manager"
+	spaceManagerAutomation = "twitter_space_manager_automation"
 )
 
 var (
@@ -25,21 +23,32 @@ var (
 )
 
 type SpaceManager struct {
-	authorization *database.TwitterWebAuthorization
+	// 用于检查space状态，各来源共用同一个网页登录凭证
+	web, api SpaceSource
 }
 
 func NewSpaceManager() *SpaceManager {
 	initSpaceManagerOnce.Do(func() {
-		internalSpaceManager = &SpaceManager{}
-		authorization, err := internalSpaceManager.nextTwitterAuthorization(defaultManagerSpaceID)
-		if err != nil {
-			log.Fatal(err)
+		internalSpaceManager = &SpaceManager{
+			web: newWebSpaceSource(defaultManagerSpaceID),
+			api: newApiSpaceSource(),
 		}
-		internalSpaceManager.authorization = authorization
 	})
 	return internalSpaceManager
 }
 
+// spaceSource 自动选择时每次查询单独选择来源，顺序与newSpaceSource一致
+func (in *SpaceManager) spaceSource(source string) SpaceSource {
+	switch source {
+	case SpaceSourceWeb:
+		return in.web
+	case SpaceSourceApi:
+		return in.api
+	default:
+		return newFallbackSpaceSource(in.api, in.web)
+	}
+}
+
 func (in *SpaceManager) Start(ctx context.Context) {
 	notStarted, waitStarted, monitoring, ended, err := in.filterSnapshots(true)
 	if err != nil {
@@ -72,6 +81,9 @@ func (in *SpaceManager) cleanupBackups(ctx context.Context) {
 			if err != nil {
 				log.Error(err)
 			}
+			if err := (database.TwitterSpaceCheckpoints{}).DeleteBefore(history); err != nil {
+				log.Error(err)
+			}
 		case <-ctx.Done():
 			return
 		}
@@ -147,7 +159,7 @@ func (in *SpaceManager) authAddCampaignTwitterSpaceSnapshots() (autoAdded int64,
 			continue
 		}
 		autoAdded++
-		_, tips := in.CreateTwitterSpaceSnapshot(app.DiscordGuildId, spaceManagerAutomation, campaign.ParticipateLink, campaign)
+		_, tips := in.CreateTwitterSpaceSnapshot(app.DiscordGuildId, spaceManagerAutomation, campaign.ParticipateLink, "", campaign)
 		if tips != "" {
 			log.Warnf("Twitter space manager create snapshot got tips %v", tips)
 		}
@@ -166,7 +178,7 @@ func (in *SpaceManager) filterSnapshots(ignoreMonitoring bool) (notStarted, wait
 
 	// 检查快照状态
 	for _, snapshot := range ongoing {
-		monitor := NewSpaceMonitor(in.authorization, snapshot)
+		monitor := NewSpaceMonitor(in.spaceSource(snapshotSpaceSource(snapshot.SpaceID)), snapshot)
 		isMonitoring, err := monitor.IsMonitoring()
 		if err != nil {
 			log.Error(err)
@@ -180,7 +192,7 @@ func (in *SpaceManager) filterSnapshots(ignoreMonitoring bool) (notStarted, wait
 		// 检查space最新状态
 		space, err := monitor.QueryTwitterSpace()
 		if err != nil {
-			in.handleSpaceQueryError(err)
+			log.Error(err)
 			continue
 		}
 		if space == nil {
@@ -212,13 +224,21 @@ func (in *SpaceManager) filterSnapshots(ignoreMonitoring bool) (notStarted, wait
 	return
 }
 
-func (in *SpaceManager) CreateTwitterSpaceSnapshot(discordGuildId, starterId, spaceURL string, campaign *database.Campaigns) (
+// CreateTwitterSpaceSnapshot source为空时沿用space已有的设置，否则覆盖该space的数据来源
+func (in *SpaceManager) CreateTwitterSpaceSnapshot(discordGuildId, starterId, spaceURL, source string, campaign *database.Campaigns) (
 	owns *database.TwitterSpaceSnapshotOwns, tips string) {
 	spaceURL = strings.ReplaceAll(spaceURL, " ", "")
 	spaceId := SpaceIDFromURL(spaceURL)
 	if spaceId == "" {
 		return nil, "Unrecognized twitter space URL"
 	}
+	if source != "" && !IsValidSpaceSource(source) {
+		return nil, fmt.Sprintf("Unrecognized data source %v, should be one of %v, %v or %v", source,
+			SpaceSourceAuto, SpaceSourceWeb, SpaceSourceApi)
+	}
+	if source == "" {
+		source = snapshotSpaceSource(spaceId)
+	}
 	snapshot := &database.TwitterSpaceSnapshotOwns{
 		TwitterSpaceSnapshots: database.TwitterSpaceSnapshots{
 			SpaceID:  spaceId,
@@ -237,11 +257,9 @@ func (in *SpaceManager) CreateTwitterSpaceSnapshot(discordGuildId, starterId, sp
 		snapshot.CampaignWhitelistID = database.FindCampaignWhitelistID(campaign.Required)
 	}
 
-	space, err := NewSpaceMonitor(in.authorization, &snapshot.TwitterSpaceSnapshots).QueryTwitterSpace()
-	if err != nil {
-		in.handleSpaceQueryError(err)
-	}
+	space, err := in.spaceSource(source).QuerySpace(spaceId)
 	if err != nil {
+		log.Error(err)
 		return nil, "Unknown error"
 	}
 	if space == nil {
@@ -257,6 +275,14 @@ func (in *SpaceManager) CreateTwitterSpaceSnapshot(discordGuildId, starterId, sp
 		log.Error(err)
 		return nil, "Unknown error"
 	}
+	err = database.TwitterSpaceSnapshotSources{
+		SpaceID:   spaceId,
+		Source:    source,
+		UpdatedBy: starterId,
+	}.Save()
+	if err != nil {
+		log.Error(err)
+	}
 	if space.IsGoingRunning() {
 		in.runMonitor(&snapshot.TwitterSpaceSnapshots)
 	}
@@ -264,36 +290,13 @@ func (in *SpaceManager) CreateTwitterSpaceSnapshot(discordGuildId, starterId, sp
 }
 
 func (in *SpaceManager) runMonitor(snapshot *database.TwitterSpaceSnapshots) {
-	authorization, err := in.nextTwitterAuthorization(snapshot.SpaceID)
-	if err != nil {
-		log.Error(err)
-		return
-	}
-	err = NewSpaceMonitor(authorization, snapshot).Run()
-	if err != nil {
+	source := newSpaceSource(snapshotSpaceSource(snapshot.SpaceID), snapshot.SpaceID)
+	if err := NewSpaceMonitor(source, snapshot).Run(); err != nil {
 		log.Error(err)
 		return
 	}
 }
 
-func (in *SpaceManager) handleSpaceQueryError(spaceErr error) {
-	if spaceErr == nil {
-		return
-	}
-	if errors.Is(spaceErr, ErrorTwitterUnauthorized) {
-		if err := in.authorization.Expire(); err != nil {
-			log.Error(err)
-		}
-		authorization, err := in.nextTwitterAuthorization(defaultManagerSpaceID)
-		if err != nil {
-			log.Error(err)
-			return
-		}
-		in.authorization = authorization
-	}
-	log.Error(spaceErr)
-}
-
 func (in *SpaceManager) endSnapshot(snapshot *database.TwitterSpaceSnapshots) {
 	now := time.Now()
 	snapshot.EndedAt = &now
@@ -304,48 +307,6 @@ func (in *SpaceManager) endSnapshot(snapshot *database.TwitterSpaceSnapshots) {
 	log.Infof("Twitter snapshot %v ended", snapshot.SpaceURL)
 }
 
-func (in *SpaceManager) holdAuthorization(spaceID string, auth *database.TwitterWebAuthorization) error {
-	heartbeats := database.TwitterWebAuthorizationHeartbeats{
-		TwitterSpaceID:  spaceID,
-		AuthorizationID: auth.ID,
-	}
-	return heartbeats.Beat()
-}
-
-func (in *SpaceManager) nextTwitterAuthorization(spaceID string) (*database.TwitterWebAuthorization, error) {
-	var (
-		ctx = context.TODO()
-	)
-	defer cache.Redis.Del(ctx, twitterSpaceManagerLockKey)
-	for {
-		locked, err := cache.Redis.SetNX(ctx, twitterSpaceManagerLockKey, 1, time.Minute).Result()
-		if err != nil {
-			return nil, errors.WrapAndReport(err, "lock twitter space manager")
-		}
-		if !locked {
-			// 等待获取锁
-			time.Sleep(time.Second)
-			continue
-		}
-
-		authorizations, err := database.TwitterWebAuthorization{}.FindHeartbeatableAndNotExpired()
-		if err != nil {
-			return nil, err
-		}
-		if len(authorizations) == 0 {
-			return nil, errors.NewWithReport("insufficient twitter web authorizations")
-		}
-
-		// 取第一个有效token
-		authorization := authorizations[0]
-		err = in.holdAuthorization(spaceID, authorization)
-		if err != nil {
-			return nil, err
-		}
-		return authorization, nil
-	}
-}
-
 func SpaceIDFromURL(twitterURL string) string {
 	spaceURL, err := url.Parse(twitterURL)
 	if err != nil {
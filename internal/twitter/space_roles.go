@@ -0,0 +1,210 @@
+package twitter
+
+import (
+	"fmt"
+	"moff.io/moff-social/internal/database"
+	"moff.io/moff-social/pkg/log"
+	"strings"
+	"time"
+)
+
+// SpaceRoleTransition 参与者在某一时刻切换为新的身份
+type SpaceRoleTransition struct {
+	Identity SpaceIdentity
+	At       int64
+}
+
+var spaceIdentityRanks = map[SpaceIdentity]int{
+	SpaceIdentityListener: 1,
+	SpaceIdentitySpeaker:  2,
+	SpaceIdentityAdmin:    3,
+}
+
+// ParseSpaceIdentity 识别用户输入的身份，host视为admin
+func ParseSpaceIdentity(name string) (SpaceIdentity, bool) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "host", "admin":
+		return SpaceIdentityAdmin, true
+	case "speaker":
+		return SpaceIdentitySpeaker, true
+	case "listener":
+		return SpaceIdentityListener, true
+	}
+	return "", false
+}
+
+func (i SpaceIdentity) DisplayName() string {
+	if i == SpaceIdentityAdmin {
+		return "host"
+	}
+	return string(i)
+}
+
+// AtLeast 身份是否不低于target
+func (i SpaceIdentity) AtLeast(target SpaceIdentity) bool {
+	return spaceIdentityRanks[i] >= spaceIdentityRanks[target]
+}
+
+// observe 记录本轮查询到的参与者，身份变化时开始新的身份时段
+func (p *SpaceParticipant) observe(presence *SpacePresence, now int64) {
+	if p.Presence == nil {
+		p.Presence = presence
+		p.switchRole(presence.Identity, presence.Since)
+		return
+	}
+	// 兼容未记录身份的缓存
+	if p.Role == "" {
+		p.switchRole(p.Presence.Identity, p.Presence.Since)
+	}
+	if p.Role != presence.Identity {
+		p.switchRole(presence.Identity, now)
+	}
+	p.Presence.Identity = presence.Identity
+}
+
+// leave 参与者已退出，累计其参与时间
+func (p *SpaceParticipant) leave(now int64) {
+	if p.Presence == nil {
+		return
+	}
+	p.PresenceMs += now - p.Presence.Since
+	p.closeRole(now)
+	p.Presence = nil
+}
+
+func (p *SpaceParticipant) switchRole(identity SpaceIdentity, at int64) {
+	p.closeRole(at)
+	p.Role = identity
+	p.RoleSince = at
+	if n := len(p.Transitions); n > 0 && p.Transitions[n-1].Identity == identity {
+		return
+	}
+	p.Transitions = append(p.Transitions, &SpaceRoleTransition{Identity: identity, At: at})
+}
+
+func (p *SpaceParticipant) closeRole(at int64) {
+	if p.Role == "" || p.RoleSince == 0 {
+		return
+	}
+	if p.RoleMs == nil {
+		p.RoleMs = make(map[SpaceIdentity]int64)
+	}
+	if at > p.RoleSince {
+		p.RoleMs[p.Role] += at - p.RoleSince
+	}
+	p.RoleSince = 0
+}
+
+func (p *SpaceParticipant) HighestRole() SpaceIdentity {
+	highest := p.Role
+	for _, t := range p.Transitions {
+		if spaceIdentityRanks[t.Identity] > spaceIdentityRanks[highest] {
+			highest = t.Identity
+		}
+	}
+	if highest == "" {
+		return SpaceIdentityListener
+	}
+	return highest
+}
+
+// SpeakingMs 作为主持人或发言人的时间
+func (p *SpaceParticipant) SpeakingMs() int64 {
+	return p.RoleMs[SpaceIdentityAdmin] + p.RoleMs[SpaceIdentitySpeaker]
+}
+
+func (p *SpaceParticipant) TransitionsDesc() string {
+	var items []string
+	for _, t := range p.Transitions {
+		items = append(items, fmt.Sprintf("%v@%v", t.Identity.DisplayName(), time.UnixMilli(t.At).UTC().Format(time.RFC3339)))
+	}
+	return strings.Join(items, " > ")
+}
+
+// spaceWhitelistRule 参与者写入白名单的条件
+type spaceWhitelistRule struct {
+	minPresenceMs int64
+	minSpeakingMs int64
+	minRole       SpaceIdentity
+}
+
+func newSpaceWhitelistRule(owner *database.TwitterSpaceOwnerships) spaceWhitelistRule {
+	rule := spaceWhitelistRule{
+		minPresenceMs: owner.SnapshotMinSeconds * 1000,
+		minRole:       SpaceIdentityListener,
+	}
+	requirement, err := database.TwitterSpaceWhitelistRequirements{}.SelectOne(owner.DiscordGuildID, owner.TwitterSpaceID)
+	if err != nil {
+		log.Error(err)
+		return rule
+	}
+	if requirement == nil {
+		return rule
+	}
+	if role, ok := ParseSpaceIdentity(requirement.MinRole); ok {
+		rule.minRole = role
+	}
+	rule.minSpeakingMs = requirement.MinSpeakingSeconds * 1000
+	return rule
+}
+
+func (r spaceWhitelistRule) qualified(p *SpaceParticipant) bool {
+	return p.PresenceMs >= r.minPresenceMs && p.HighestRole().AtLeast(r.minRole) && p.SpeakingMs() >= r.minSpeakingMs
+}
+
+// IsQualifiedSpaceParticipant 根据快照结束时保存的参与者统计判断是否满足owner的白名单条件
+func IsQualifiedSpaceParticipant(owner *database.TwitterSpaceOwnerships, record *database.TwitterSpaceParticipantRoles) bool {
+	rule := newSpaceWhitelistRule(owner)
+	role, ok := ParseSpaceIdentity(record.HighestRole)
+	if !ok {
+		role = SpaceIdentityListener
+	}
+	return record.PresenceSeconds*1000 >= rule.minPresenceMs && role.AtLeast(rule.minRole) &&
+		(record.HostSeconds+record.SpeakerSeconds)*1000 >= rule.minSpeakingMs
+}
+
+func (in *SpaceMonitor) writeParticipantRoles() {
+	var (
+		entities    []*database.TwitterSpaceParticipantRoles
+		transitions []*database.TwitterSpaceRoleTransitions
+		now         = time.Now()
+	)
+	for twitterID, p := range in.spaceParticipants {
+		entities = append(entities, &database.TwitterSpaceParticipantRoles{
+			SpaceID:         in.snapshot.SpaceID,
+			TwitterID:       twitterID,
+			HighestRole:     string(p.HighestRole()),
+			PresenceSeconds: p.PresenceMs / 1000,
+			HostSeconds:     p.RoleMs[SpaceIdentityAdmin] / 1000,
+			SpeakerSeconds:  p.RoleMs[SpaceIdentitySpeaker] / 1000,
+			ListenerSeconds: p.RoleMs[SpaceIdentityListener] / 1000,
+			CreatedAt:       now,
+		})
+		transitions = append(transitions, p.roleTransitions(in.snapshot.SpaceID, twitterID)...)
+	}
+	if err := (database.TwitterSpaceParticipantRoles{}).SaveBatch(entities); err != nil {
+		log.Error(err)
+	}
+	if err := (database.TwitterSpaceRoleTransitions{}).ReplaceBySpace(in.snapshot.SpaceID, transitions); err != nil {
+		log.Error(err)
+	}
+}
+
+// roleTransitions 参与者的身份变化记录，首次出现的身份FromRole为空
+func (p *SpaceParticipant) roleTransitions(spaceID, twitterID string) []*database.TwitterSpaceRoleTransitions {
+	var (
+		entities []*database.TwitterSpaceRoleTransitions
+		from     SpaceIdentity
+	)
+	for _, t := range p.Transitions {
+		entities = append(entities, &database.TwitterSpaceRoleTransitions{
+			SpaceID:   spaceID,
+			TwitterID: twitterID,
+			FromRole:  string(from),
+			ToRole:    string(t.Identity),
+			At:        time.UnixMilli(t.At),
+		})
+		from = t.Identity
+	}
+	return entities
+}
@@ -0,0 +1,467 @@
+package twitter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/g8rswimmer/go-twitter/v2"
+	"io/ioutil"
+	"moff.io/moff-social/internal/database"
+	"moff.io/moff-social/pkg/errors"
+	"moff.io/moff-social/pkg/log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// SpaceSourceAuto 优先使用官方接口，不可用时使用网页接口
+	SpaceSourceAuto = "auto"
+	// SpaceSourceWeb 网页GraphQL接口，依赖网页登录凭证，可获取听众
+	SpaceSourceWeb = "web"
+	// SpaceSourceApi 官方v2接口，仅能获取主持人及发言人
+	SpaceSourceApi = "api"
+)
+
+var (
+	ErrorTwitterApiNotReady    = errors.New("twitter api client not configured")
+	ErrorTwitterApiRateLimited = errors.New("twitter api rate limited")
+	errTwitterSpaceResponse    = errors.New("unexpected twitter space response")
+)
+
+// SpaceSource 获取twitter space的当前状态及参与者
+type SpaceSource interface {
+	Type() string
+	QuerySpace(spaceID string) (*Space, error)
+	Heartbeat()
+}
+
+func IsValidSpaceSource(source string) bool {
+	switch source {
+	case SpaceSourceAuto, SpaceSourceWeb, SpaceSourceApi:
+		return true
+	}
+	return false
+}
+
+// newSpaceSource holderID用于标识占用网页登录凭证的一方
+func newSpaceSource(source, holderID string) SpaceSource {
+	switch source {
+	case SpaceSourceWeb:
+		return newWebSpaceSource(holderID)
+	case SpaceSourceApi:
+		return newApiSpaceSource()
+	default:
+		return newFallbackSpaceSource(newApiSpaceSource(), newWebSpaceSource(holderID))
+	}
+}
+
+// snapshotSpaceSource 查询快照设置的数据来源，未设置时自动选择
+func snapshotSpaceSource(spaceID string) string {
+	source, err := database.TwitterSpaceSnapshotSources{}.SelectOne(spaceID)
+	if err != nil {
+		log.Error(err)
+		return SpaceSourceAuto
+	}
+	if source == nil || !IsValidSpaceSource(source.Source) {
+		return SpaceSourceAuto
+	}
+	return source.Source
+}
+
+// fallbackSpaceSource 按顺序尝试各个数据来源，每个space选定来源后在spacePinTTL内固定使用；
+// 官方接口不返回听众，切换来源会使听众被视为全部退出，因此固定期间查询失败时跳过本次查询，
+// 进行中的space没有听众时尝试下一个来源
+type fallbackSpaceSource struct {
+	lock    sync.Mutex
+	sources []SpaceSource
+	pinned  map[string]*pinnedSpaceSource
+}
+
+type pinnedSpaceSource struct {
+	source   SpaceSource
+	expireAt time.Time
+}
+
+const (
+	spacePinTTL = time.Minute * 10
+)
+
+func newFallbackSpaceSource(sources ...SpaceSource) *fallbackSpaceSource {
+	return &fallbackSpaceSource{sources: sources, pinned: make(map[string]*pinnedSpaceSource)}
+}
+
+func (in *fallbackSpaceSource) Type() string {
+	return SpaceSourceAuto
+}
+
+func (in *fallbackSpaceSource) QuerySpace(spaceID string) (*Space, error) {
+	in.lock.Lock()
+	defer in.lock.Unlock()
+	now := time.Now()
+	if pinned := in.pinned[spaceID]; pinned != nil && now.Before(pinned.expireAt) {
+		return pinned.source.QuerySpace(spaceID)
+	}
+	var (
+		lastErr   error
+		candidate *Space
+		chosen    SpaceSource
+	)
+	for idx, source := range in.sources {
+		space, err := source.QuerySpace(spaceID)
+		if err != nil {
+			lastErr = err
+			if idx < len(in.sources)-1 {
+				log.Warnf("Twitter space %v %v source failed, falling back:%v", spaceID, source.Type(), err)
+			}
+			continue
+		}
+		// 后面的来源同样没有听众时以后面的结果为准
+		candidate, chosen = space, source
+		if space == nil || !space.IsRunning() || space.hasListeners() {
+			break
+		}
+		if idx < len(in.sources)-1 {
+			log.Warnf("Twitter space %v %v source returned no listeners, trying next source", spaceID, source.Type())
+		}
+	}
+	if chosen == nil {
+		return nil, lastErr
+	}
+	if pinned := in.pinned[spaceID]; pinned == nil || pinned.source != chosen {
+		log.Infof("Twitter space %v pinned to %v source", spaceID, chosen.Type())
+	}
+	in.pinned[spaceID] = &pinnedSpaceSource{source: chosen, expireAt: now.Add(spacePinTTL)}
+	return candidate, nil
+}
+
+// Heartbeat 仅保持被固定的来源，尚未固定时保持全部来源
+func (in *fallbackSpaceSource) Heartbeat() {
+	in.lock.Lock()
+	var sources []SpaceSource
+	for _, pinned := range in.pinned {
+		if !containsSpaceSource(sources, pinned.source) {
+			sources = append(sources, pinned.source)
+		}
+	}
+	if len(sources) == 0 {
+		sources = in.sources
+	}
+	in.lock.Unlock()
+	for _, source := range sources {
+		source.Heartbeat()
+	}
+}
+
+func containsSpaceSource(sources []SpaceSource, source SpaceSource) bool {
+	for _, s := range sources {
+		if s == source {
+			return true
+		}
+	}
+	return false
+}
+
+// webSpaceSource 通过网页登录凭证请求GraphQL接口，凭证失效、限流或停用后在下次查询时更换
+type webSpaceSource struct {
+	lock          sync.Mutex
+	holderID      string
+	authorization *database.TwitterWebAuthorization
+}
+
+func newWebSpaceSource(holderID string) *webSpaceSource {
+	return &webSpaceSource{holderID: holderID}
+}
+
+func (in *webSpaceSource) Type() string {
+	return SpaceSourceWeb
+}
+
+func (in *webSpaceSource) Heartbeat() {
+	in.lock.Lock()
+	defer in.lock.Unlock()
+	if in.authorization == nil {
+		return
+	}
+	heartbeat := database.TwitterWebAuthorizationHeartbeats{
+		AuthorizationID: in.authorization.ID,
+		TwitterSpaceID:  in.holderID,
+	}
+	if err := heartbeat.Beat(); err != nil {
+		log.Error(err)
+	}
+}
+
+func (in *webSpaceSource) QuerySpace(spaceID string) (*Space, error) {
+	in.lock.Lock()
+	defer in.lock.Unlock()
+	pool := NewAuthorizationPool()
+	if in.authorization != nil && !pool.Usable(in.authorization.ID) {
+		in.authorization = nil
+	}
+	if in.authorization == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), AuthorizationPoolLockMaxWait)
+		authorization, err := pool.Acquire(ctx, in.holderID)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		in.authorization = authorization
+	}
+	space, err := in.query(spaceID)
+	switch {
+	case err == nil:
+		pool.ReportSuccess(in.authorization.ID)
+	case errors.Is(err, ErrorTwitterUnauthorized):
+		pool.ReportFailure(in.authorization.ID)
+		if err := in.authorization.Expire(); err != nil {
+			log.Error(err)
+		}
+		in.authorization = nil
+	case errors.Is(err, ErrorTwitterRateLimited):
+		in.authorization = nil
+	case errors.Is(err, errTwitterSpaceResponse):
+		pool.ReportFailure(in.authorization.ID)
+	}
+	return space, err
+}
+
+func (in *webSpaceSource) buildSpaceRequest(spaceID string) (*http.Request, error) {
+	url := "https://api.twitter.com/graphql/i3Y4qgl8Xth8VLHTbMC9Hw/AudioSpaceById?variables=%7B%22id%22%3A%22" + spaceID + "%22%2C%22isMetatagsQuery%22%3Atrue%2C%22withSuperFollowsUserFields%22%3Atrue%2C%22withDownvotePerspective%22%3Afalse%2C%22withReactionsMetadata%22%3Afalse%2C%22withReactionsPerspective%22%3Afalse%2C%22withSuperFollowsTweetFields%22%3Atrue%2C%22withReplays%22%3Atrue%7D&features=%7B%22spaces_2022_h2_clipping%22%3Atrue%2C%22spaces_2022_h2_spaces_communities%22%3Atrue%2C%22responsive_web_twitter_blue_verified_badge_is_enabled%22%3Atrue%2C%22responsive_web_graphql_exclude_directive_enabled%22%3Afalse%2C%22verified_phone_label_enabled%22%3Afalse%2C%22responsive_web_graphql_skip_user_profile_image_extensions_enabled%22%3Afalse%2C%22longform_notetweets_consumption_enabled%22%3Atrue%2C%22tweetypie_unmention_optimization_enabled%22%3Atrue%2C%22vibe_api_enabled%22%3Atrue%2C%22responsive_web_edit_tweet_api_enabled%22%3Atrue%2C%22graphql_is_translatable_rweb_tweet_is_translatable_enabled%22%3Atrue%2C%22view_counts_everywhere_api_enabled%22%3Atrue%2C%22freedom_of_speech_not_reach_appeal_label_enabled%22%3Afalse%2C%22standardized_nudges_misinfo%22%3Atrue%2C%22tweet_with_visibility_results_prefer_gql_limited_actions_policy_enabled%22%3Afalse%2C%22responsive_web_graphql_timeline_navigation_enabled%22%3Atrue%2C%22interactive_text_enabled%22%3Atrue%2C%22responsive_web_text_conversations_enabled%22%3Afalse%2C%22responsive_web_enhance_cards_enabled%22%3Afalse%7D"
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errors.WrapAndReport(err, "create new request")
+	}
+	request.Header.Set("referer", "https://twitter.com/i/spaces/"+spaceID)
+	request.Header.Set("content-type", "application/json")
+	request.Header.Set("authorization", in.authorization.Authorization)
+	request.Header.Set("user-agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/106.0.0.0 Safari/537.36")
+	request.Header.Set("x-twitter-active-user", "yes")
+	request.Header.Set("x-twitter-auth-type", "OAuth2Session")
+	request.Header.Set("cookie", in.authorization.Cookies)
+	request.Header.Set("x-csrf-token", in.authorization.CsrfToken)
+	return request, nil
+}
+
+func (in *webSpaceSource) query(spaceID string) (*Space, error) {
+	request, err := in.buildSpaceRequest(spaceID)
+	if err != nil {
+		return nil, err
+	}
+	// 15分钟，500个请求, 即一个token最多支持5个twitter space的间隔10秒的请求
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, errors.WrapAndReport(err, "request to twitter space api")
+	}
+
+	defer response.Body.Close()
+
+	// 判断当前是否已限流，限流的凭证冷却至重置时间后再分配
+	rateLimit := response.Header.Get("x-rate-limit-remaining")
+	if rateLimit == "0" || response.StatusCode == http.StatusTooManyRequests {
+		var resetAt time.Time
+		if reset, err := strconv.ParseInt(response.Header.Get("x-rate-limit-reset"), 10, 64); err == nil {
+			resetAt = time.Unix(reset, 0)
+		}
+		NewAuthorizationPool().Cooldown(in.authorization.ID, resetAt)
+		return nil, ErrorTwitterRateLimited
+	}
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, errors.WrapAndReport(err, "read twitter space response")
+	}
+	e := database.TwitterSpaceBackups{
+		SpaceID:     spaceID,
+		Response:    string(body),
+		CreatedTime: time.Now().UTC(),
+	}.Create()
+	if e != nil {
+		log.Error(e)
+	}
+	if response.StatusCode != http.StatusOK {
+		if response.StatusCode == http.StatusUnauthorized {
+			return nil, ErrorTwitterUnauthorized
+		}
+		return nil, errors.WithMessageAndReport(errTwitterSpaceResponse, fmt.Sprintf("status %v:%v", response.Status, string(body)))
+	}
+	if strings.Contains(string(body), "BadRequest") {
+		log.Warn(string(body))
+		return nil, nil
+	}
+	var space spaceResponse
+	if err := json.Unmarshal(body, &space); err != nil {
+		return nil, errors.WrapAndReport(err, "unmarshal twitter participants")
+	}
+	return calcTwitterSpaceParticipants(&space, time.Now().UnixMilli()), nil
+}
+
+// calcTwitterSpaceParticipants now为响应时间，参与者未返回加入时间时以此代替
+func calcTwitterSpaceParticipants(space *spaceResponse, now int64) *Space {
+	var presences []*SpacePresence
+	admins := space.Data.AudioSpace.Participants.Admins
+	speakers := space.Data.AudioSpace.Participants.Speakers
+	listeners := space.Data.AudioSpace.Participants.Listeners
+	for _, admin := range admins {
+		presence := &SpacePresence{
+			Identity:  SpaceIdentityAdmin,
+			TwitterID: firstNonDefault(admin.User.RestID, admin.UserResults.RestID),
+			Since:     now,
+		}
+		if admin.Start > 0 {
+			presence.Since = admin.Start
+		}
+		presences = append(presences, presence)
+	}
+	for _, speaker := range speakers {
+		presence := &SpacePresence{
+			Identity:  SpaceIdentitySpeaker,
+			TwitterID: firstNonDefault(speaker.User.RestID, speaker.UserResults.RestID),
+			Since:     now,
+		}
+		if speaker.Start > 0 {
+			presence.Since = speaker.Start
+		}
+		presences = append(presences, presence)
+	}
+	for _, listener := range listeners {
+		presence := &SpacePresence{
+			Identity:  SpaceIdentityListener,
+			TwitterID: firstNonDefault(listener.User.RestID, listener.UserResults.RestID),
+			Since:     now,
+		}
+		if listener.Start > 0 {
+			presence.Since = listener.Start
+		}
+		presences = append(presences, presence)
+	}
+	return &Space{
+		State:              space.Data.AudioSpace.Metadata.State,
+		Title:              space.Data.AudioSpace.Metadata.Title,
+		ScheduledStartedAt: space.Data.AudioSpace.Metadata.ScheduledStartedAt,
+		StartedAt:          space.Data.AudioSpace.Metadata.StartedAt,
+		UpdatedAt:          space.Data.AudioSpace.Metadata.UpdatedAt,
+		Presences:          presences,
+	}
+}
+
+// apiSpaceSource 通过官方v2接口查询space，接口不返回听众，参与者仅包含主持人及发言人
+type apiSpaceSource struct {
+	client *Client
+}
+
+func newApiSpaceSource() *apiSpaceSource {
+	return &apiSpaceSource{client: NewClient()}
+}
+
+func (in *apiSpaceSource) Type() string {
+	return SpaceSourceApi
+}
+
+func (in *apiSpaceSource) Heartbeat() {}
+
+func (in *apiSpaceSource) QuerySpace(spaceID string) (*Space, error) {
+	if !in.client.IsReady() {
+		return nil, ErrorTwitterApiNotReady
+	}
+	response, err := in.lookup(spaceID)
+	var responseErr *twitter.ErrorResponse
+	if errors.As(err, &responseErr) && responseErr.StatusCode == http.StatusUnauthorized {
+		if err := in.client.RefreshAccessToken(); err != nil {
+			return nil, err
+		}
+		response, err = in.lookup(spaceID)
+	}
+	if err != nil {
+		return nil, errors.WrapAndReport(err, "lookup twitter space")
+	}
+	if response.Raw == nil || len(response.Raw.Spaces) == 0 || response.Raw.Spaces[0] == nil {
+		if response.Raw != nil && len(response.Raw.Errors) > 0 {
+			log.Warnf("Twitter space %v lookup errors:%v", spaceID, response.Raw.Errors[0].Detail)
+		}
+		return nil, nil
+	}
+	return convertSpaceObj(response.Raw.Spaces[0]), nil
+}
+
+func (in *apiSpaceSource) lookup(spaceID string) (*twitter.SpacesLookupResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	return in.client.cli.SpacesLookup(ctx, []string{spaceID}, twitter.SpacesLookupOpts{
+		SpaceFields: []twitter.SpaceField{
+			twitter.SpaceFieldState,
+			twitter.SpaceFieldTitle,
+			twitter.SpaceFieldHostIDs,
+			twitter.SpaceFieldSpeakerIDs,
+			twitter.SpaceFieldScheduledStart,
+			twitter.SpaceFieldStartedAt,
+			twitter.SpaceFieldEndedAt,
+			twitter.SpaceFieldUpdatedAt,
+			twitter.SpaceFieldParticipantCount,
+		},
+	})
+}
+
+func convertSpaceObj(obj *twitter.SpaceObj) *Space {
+	space := &Space{
+		Title:              obj.Title,
+		ScheduledStartedAt: parseSpaceObjTime(obj.ScheduledStart),
+		StartedAt:          parseSpaceObjTime(obj.StartedAt),
+		UpdatedAt:          parseSpaceObjTime(obj.UpdatedAt),
+	}
+	switch obj.State {
+	case "live":
+		space.State = SpaceRunning
+	case "scheduled":
+		space.State = SpaceNotStarted
+	case "ended":
+		space.State = SpaceEnded
+	default:
+		space.State = obj.State
+	}
+	var (
+		now   = time.Now().UnixMilli()
+		since = now
+		added = make(map[string]bool)
+	)
+	if space.StartedAt > 0 && space.StartedAt < now {
+		since = space.StartedAt
+	}
+	for _, hostID := range obj.HostIDs {
+		if added[hostID] {
+			continue
+		}
+		added[hostID] = true
+		space.Presences = append(space.Presences, &SpacePresence{
+			Identity:  SpaceIdentityAdmin,
+			TwitterID: hostID,
+			Since:     since,
+		})
+	}
+	for _, speakerID := range obj.SpeakerIDs {
+		if added[speakerID] {
+			continue
+		}
+		added[speakerID] = true
+		space.Presences = append(space.Presences, &SpacePresence{
+			Identity:  SpaceIdentitySpeaker,
+			TwitterID: speakerID,
+			Since:     now,
+		})
+	}
+	return space
+}
+
+func parseSpaceObjTime(value string) int64 {
+	if value == "" {
+		return 0
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		log.Warnf("Parse twitter space time %v:%v", value, err)
+		return 0
+	}
+	return t.UnixMilli()
+}
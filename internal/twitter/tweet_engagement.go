@@ -0,0 +1,354 @@
+package twitter
+
+import (
+	"context"
+	"fmt"
+	"github.com/g8rswimmer/go-twitter/v2"
+	"moff.io/moff-social/internal/database"
+	"moff.io/moff-social/pkg/errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	tweetEngagementPageSize = 100
+)
+
+// apiRateLimitError 接口限流，resetAt后可重新请求
+type apiRateLimitError struct {
+	resetAt time.Time
+}
+
+func (e *apiRateLimitError) Error() string {
+	return fmt.Sprintf("twitter api rate limited until %v", e.resetAt.UTC())
+}
+
+func (e *apiRateLimitError) Is(target error) bool {
+	return target == ErrorTwitterApiRateLimited
+}
+
+// call 访问令牌过期时刷新后重试一次
+func (in *Client) call(fn func(ctx context.Context) error) error {
+	err := in.callWithTimeout(fn)
+	var responseErr *twitter.ErrorResponse
+	if errors.As(err, &responseErr) && responseErr.StatusCode == http.StatusUnauthorized {
+		if err := in.RefreshAccessToken(); err != nil {
+			return err
+		}
+		err = in.callWithTimeout(fn)
+	}
+	if limit, ok := twitter.RateLimitFromError(err); ok && limit.Remaining == 0 {
+		return &apiRateLimitError{resetAt: limit.Reset.Time()}
+	}
+	return err
+}
+
+func (in *Client) callWithTimeout(fn func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+	return fn(ctx)
+}
+
+// LookupTweet 查询推文作者、内容及发布时间，推文不存在时返回nil
+func (in *Client) LookupTweet(tweetID string) (*twitter.TweetObj, error) {
+	if !in.IsReady() {
+		return nil, ErrorTwitterApiNotReady
+	}
+	var response *twitter.TweetLookupResponse
+	err := in.call(func(ctx context.Context) (err error) {
+		response, err = in.cli.TweetLookup(ctx, []string{tweetID}, twitter.TweetLookupOpts{
+			TweetFields: []twitter.TweetField{twitter.TweetFieldAuthorID, twitter.TweetFieldCreatedAt},
+		})
+		return err
+	})
+	if err != nil {
+		return nil, errors.WrapAndReport(err, "lookup tweet")
+	}
+	if response.Raw == nil || len(response.Raw.Tweets) == 0 || response.Raw.Tweets[0] == nil {
+		return nil, nil
+	}
+	return response.Raw.Tweets[0], nil
+}
+
+// tweetEngager 同一用户对推文的全部互动
+type tweetEngager struct {
+	twitterID string
+	username  string
+	actions   map[database.TweetEngagementAction]*database.TweetEngagements
+}
+
+// tweetEngagementCollector 收集截止时间前的互动；点赞与转推接口不返回时间，以收集时的状态为准
+type tweetEngagementCollector struct {
+	client   *Client
+	snapshot *database.TweetSnapshots
+	keywords []string
+	engagers map[string]*tweetEngager
+	counts   map[database.TweetEngagementAction]int
+}
+
+func newTweetEngagementCollector(snapshot *database.TweetSnapshots) *tweetEngagementCollector {
+	return &tweetEngagementCollector{
+		client:   NewClient(),
+		snapshot: snapshot,
+		keywords: snapshot.Keywords(),
+		engagers: make(map[string]*tweetEngager),
+		counts:   make(map[database.TweetEngagementAction]int),
+	}
+}
+
+func (in *tweetEngagementCollector) collect() error {
+	if !in.client.IsReady() {
+		return ErrorTwitterApiNotReady
+	}
+	if err := in.collectLikes(); err != nil {
+		return err
+	}
+	if err := in.collectRetweets(); err != nil {
+		return err
+	}
+	if err := in.collectQuotes(); err != nil {
+		return err
+	}
+	return in.collectReplies()
+}
+
+func (in *tweetEngagementCollector) collectLikes() error {
+	var token string
+	for {
+		var response *twitter.TweetLikesLookupResponse
+		err := in.client.call(func(ctx context.Context) (err error) {
+			response, err = in.client.cli.TweetLikesLookup(ctx, in.snapshot.TweetID, twitter.TweetLikesLookupOpts{
+				MaxResults:      tweetEngagementPageSize,
+				PaginationToken: token,
+			})
+			return err
+		})
+		if err != nil {
+			return errors.WithMessage(err, "lookup tweet likes")
+		}
+		if response.Raw != nil {
+			for _, user := range response.Raw.Users {
+				in.add(user, &database.TweetEngagements{Action: database.TweetEngagementLike, Qualified: true})
+			}
+		}
+		if response.Meta == nil || response.Meta.NextToken == "" {
+			return nil
+		}
+		token = response.Meta.NextToken
+	}
+}
+
+func (in *tweetEngagementCollector) collectRetweets() error {
+	var token string
+	for {
+		var response *twitter.UserRetweetLookupResponse
+		err := in.client.call(func(ctx context.Context) (err error) {
+			response, err = in.client.cli.UserRetweetLookup(ctx, in.snapshot.TweetID, twitter.UserRetweetLookupOpts{
+				MaxResults:      tweetEngagementPageSize,
+				PaginationToken: token,
+			})
+			return err
+		})
+		if err != nil {
+			return errors.WithMessage(err, "lookup tweet retweets")
+		}
+		if response.Raw != nil {
+			for _, user := range response.Raw.Users {
+				in.add(user, &database.TweetEngagements{Action: database.TweetEngagementRetweet, Qualified: true})
+			}
+		}
+		if response.Meta == nil || response.Meta.NextToken == "" {
+			return nil
+		}
+		token = response.Meta.NextToken
+	}
+}
+
+func (in *tweetEngagementCollector) collectQuotes() error {
+	var token string
+	for {
+		var response *twitter.QuoteTweetsLookupResponse
+		err := in.client.call(func(ctx context.Context) (err error) {
+			response, err = in.client.cli.QuoteTweetsLookup(ctx, in.snapshot.TweetID, twitter.QuoteTweetsLookupOpts{
+				MaxResults:      tweetEngagementPageSize,
+				PaginationToken: token,
+				TweetFields:     []twitter.TweetField{twitter.TweetFieldAuthorID, twitter.TweetFieldCreatedAt},
+				Expansions:      []twitter.Expansion{twitter.ExpansionAuthorID},
+			})
+			return err
+		})
+		if err != nil {
+			return errors.WithMessage(err, "lookup quote tweets")
+		}
+		in.addTweets(response.Raw, database.TweetEngagementQuote)
+		if response.Meta == nil || response.Meta.NextToken == "" {
+			return nil
+		}
+		token = response.Meta.NextToken
+	}
+}
+
+// collectReplies 通过最近搜索查询会话中的回复，仅能查询到7天内的回复
+func (in *tweetEngagementCollector) collectReplies() error {
+	var (
+		query = fmt.Sprintf("conversation_id:%v is:reply", in.snapshot.TweetID)
+		token string
+		opts  = twitter.TweetRecentSearchOpts{
+			MaxResults:  tweetEngagementPageSize,
+			TweetFields: []twitter.TweetField{twitter.TweetFieldAuthorID, twitter.TweetFieldCreatedAt, twitter.TweetFieldEntities},
+			Expansions:  []twitter.Expansion{twitter.ExpansionAuthorID},
+		}
+	)
+	// 结束时间需早于请求时间至少10秒
+	if in.snapshot.CutoffAt.Before(time.Now().Add(-time.Minute)) {
+		opts.EndTime = in.snapshot.CutoffAt
+	}
+	for {
+		opts.NextToken = token
+		var response *twitter.TweetRecentSearchResponse
+		err := in.client.call(func(ctx context.Context) (err error) {
+			response, err = in.client.cli.TweetRecentSearch(ctx, query, opts)
+			return err
+		})
+		if err != nil {
+			return errors.WithMessage(err, "search tweet replies")
+		}
+		in.addTweets(response.Raw, database.TweetEngagementReply)
+		if response.Meta == nil || response.Meta.NextToken == "" {
+			return nil
+		}
+		token = response.Meta.NextToken
+	}
+}
+
+func (in *tweetEngagementCollector) addTweets(raw *twitter.TweetRaw, action database.TweetEngagementAction) {
+	if raw == nil {
+		return
+	}
+	users := make(map[string]*twitter.UserObj)
+	if raw.Includes != nil {
+		for _, user := range raw.Includes.Users {
+			users[user.ID] = user
+		}
+	}
+	for _, tweet := range raw.Tweets {
+		createdAt, err := time.Parse(time.RFC3339, tweet.CreatedAt)
+		if err != nil || createdAt.After(in.snapshot.CutoffAt) {
+			continue
+		}
+		user := users[tweet.AuthorID]
+		if user == nil {
+			user = &twitter.UserObj{ID: tweet.AuthorID}
+		}
+		qualified := true
+		if action == database.TweetEngagementReply {
+			qualified = in.qualifiedReply(tweet)
+		}
+		in.add(user, &database.TweetEngagements{
+			Action:            action,
+			EngagementTweetID: tweet.ID,
+			Text:              tweet.Text,
+			Qualified:         qualified,
+			EngagedAt:         &createdAt,
+		})
+	}
+}
+
+// add 推文作者本人的互动不计入；同一用户多次回复时保留首个满足条件的回复
+func (in *tweetEngagementCollector) add(user *twitter.UserObj, engagement *database.TweetEngagements) {
+	if user.ID == "" || user.ID == in.snapshot.AuthorID {
+		return
+	}
+	engager := in.engagers[user.ID]
+	if engager == nil {
+		engager = &tweetEngager{
+			twitterID: user.ID,
+			actions:   make(map[database.TweetEngagementAction]*database.TweetEngagements),
+		}
+		in.engagers[user.ID] = engager
+	}
+	if user.UserName != "" {
+		engager.username = user.UserName
+	}
+	engagement.TwitterID = user.ID
+	engagement.Username = engager.username
+	existing := engager.actions[engagement.Action]
+	if existing == nil {
+		in.counts[engagement.Action]++
+	}
+	if existing == nil || (!existing.Qualified && engagement.Qualified) {
+		engager.actions[engagement.Action] = engagement
+	}
+}
+
+// qualifiedReply 检查回复是否包含任一关键词、满足最少字数及提及其他用户的数量
+func (in *tweetEngagementCollector) qualifiedReply(tweet *twitter.TweetObj) bool {
+	var (
+		mentions int
+		words    int
+		text     = strings.ToLower(tweet.Text)
+	)
+	if tweet.Entities != nil {
+		mentions = len(tweet.Entities.Mentions) - leadingMentions(tweet)
+	}
+	for _, word := range strings.Fields(text) {
+		if !strings.HasPrefix(word, "@") {
+			words++
+		}
+	}
+	if words < in.snapshot.ReplyMinWords || mentions < in.snapshot.ReplyMinMentions {
+		return false
+	}
+	if len(in.keywords) == 0 {
+		return true
+	}
+	for _, keyword := range in.keywords {
+		if strings.Contains(text, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// leadingMentions 回复时自动带上的开头连续提及（作者及会话中的其他用户）数量，不计入提及数量
+func leadingMentions(tweet *twitter.TweetObj) int {
+	mentions := make([]twitter.EntityMentionObj, len(tweet.Entities.Mentions))
+	copy(mentions, tweet.Entities.Mentions)
+	sort.Slice(mentions, func(i, j int) bool {
+		return mentions[i].Start < mentions[j].Start
+	})
+	var (
+		runes = []rune(tweet.Text)
+		pos   int
+		count int
+	)
+	for _, mention := range mentions {
+		for pos < len(runes) && unicode.IsSpace(runes[pos]) {
+			pos++
+		}
+		if mention.Start != pos {
+			break
+		}
+		pos = mention.End
+		count++
+	}
+	return count
+}
+
+// qualified 完成全部要求的互动，未设置要求时任一互动即可
+func (in *tweetEngagementCollector) qualified(engager *tweetEngager) bool {
+	actions := in.snapshot.Actions()
+	if len(actions) == 0 {
+		return len(engager.actions) > 0
+	}
+	for _, action := range actions {
+		engagement := engager.actions[action]
+		if engagement == nil || !engagement.Qualified {
+			return false
+		}
+	}
+	return true
+}
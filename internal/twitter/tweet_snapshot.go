@@ -0,0 +1,374 @@
+package twitter
+
+import (
+	"context"
+	"fmt"
+	"moff.io/moff-social/internal/database"
+	"moff.io/moff-social/internal/export"
+	"moff.io/moff-social/pkg/errors"
+	"moff.io/moff-social/pkg/log"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	tweetSnapshotAutomation   = "tweet_snapshot_automation"
+	tweetSnapshotMaxAttempts  = 5
+	tweetSnapshotStaleTimeout = time.Minute * 30
+	tweetSnapshotBatchSize    = 20
+)
+
+var (
+	initTweetSnapshotManagerOnce sync.Once
+	internalTweetSnapshotManager *TweetSnapshotManager
+	tweetIDPattern               = regexp.MustCompile(`^\d+$`)
+	// DefaultTweetActions 未指定时要求点赞并转推
+	DefaultTweetActions = []database.TweetEngagementAction{database.TweetEngagementLike, database.TweetEngagementRetweet}
+)
+
+// TweetSnapshotRequest 创建推文互动快照的参数
+type TweetSnapshotRequest struct {
+	GuildID          string
+	StarterID        string
+	TweetURL         string
+	CutoffAt         time.Time
+	WhitelistID      string
+	RequiredActions  []database.TweetEngagementAction
+	ReplyKeywords    []string
+	ReplyMinWords    int
+	ReplyMinMentions int
+}
+
+type TweetSnapshotManager struct {
+}
+
+func NewTweetSnapshotManager() *TweetSnapshotManager {
+	initTweetSnapshotManagerOnce.Do(func() {
+		internalTweetSnapshotManager = &TweetSnapshotManager{}
+	})
+	return internalTweetSnapshotManager
+}
+
+func (in *TweetSnapshotManager) Start(ctx context.Context) {
+	// 失败时在下次定时释放时重试
+	released, err := database.TweetSnapshots{}.ReleaseStale(time.Now().Add(-tweetSnapshotStaleTimeout))
+	if err != nil {
+		log.Error(err)
+	}
+	if released > 0 {
+		log.Infof("Tweet snapshot manager released %v stale snapshots", released)
+	}
+	go in.start(ctx)
+}
+
+func (in *TweetSnapshotManager) start(ctx context.Context) {
+	var (
+		autoAddSnapshotTicker = time.NewTicker(time.Minute * 2)
+		collectSnapshotTicker = time.NewTicker(time.Minute)
+		releaseSnapshotTicker = time.NewTicker(time.Minute * 10)
+	)
+	log.Infof("Tweet snapshot manager running...")
+	defer log.Infof("Tweet snapshot manager stopped...")
+	for {
+		select {
+		case <-collectSnapshotTicker.C:
+			in.collectDue()
+		case <-autoAddSnapshotTicker.C:
+			autoAdded, err := in.autoAddCampaignTweetSnapshots()
+			if err != nil {
+				log.Error(err)
+				continue
+			}
+			if autoAdded > 0 {
+				log.Infof("Tweet snapshot manager auto added %v snapshots", autoAdded)
+			}
+		case <-releaseSnapshotTicker.C:
+			if _, err := (database.TweetSnapshots{}).ReleaseStale(time.Now().Add(-tweetSnapshotStaleTimeout)); err != nil {
+				log.Error(err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// autoAddCampaignTweetSnapshots 参与链接为推文的活动在结束时收集互动，需应用开启推文自动快照
+func (in *TweetSnapshotManager) autoAddCampaignTweetSnapshots() (autoAdded int64, err error) {
+	campaigns, err := database.Campaigns{}.QueryOngoingTweets()
+	if err != nil {
+		return 0, err
+	}
+	if len(campaigns) == 0 {
+		return 0, nil
+	}
+	apps, err := queryCampaignApps(campaigns)
+	if err != nil {
+		return 0, err
+	}
+	for _, campaign := range campaigns {
+		app := apps[campaign.AppID]
+		if app == nil || !app.AutoSnapshotTweetEnabled {
+			continue
+		}
+		tweetID := TweetIDFromURL(campaign.ParticipateLink)
+		if tweetID == "" {
+			continue
+		}
+		snapshot, err := database.TweetSnapshots{}.SelectOne(app.DiscordGuildId, tweetID)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		if snapshot != nil {
+			continue
+		}
+		_, tips := in.CreateTweetSnapshot(&TweetSnapshotRequest{
+			GuildID:   app.DiscordGuildId,
+			StarterID: tweetSnapshotAutomation,
+			TweetURL:  campaign.ParticipateLink,
+		}, campaign)
+		if tips != "" {
+			log.Warnf("Tweet snapshot manager create snapshot for campaign %v got tips %v", campaign.CampaignID, tips)
+			continue
+		}
+		autoAdded++
+	}
+	return autoAdded, nil
+}
+
+// CreateTweetSnapshot 创建推文互动快照，关联活动时默认在活动结束时收集并写入活动白名单
+func (in *TweetSnapshotManager) CreateTweetSnapshot(req *TweetSnapshotRequest, campaign *database.Campaigns) (
+	snapshot *database.TweetSnapshots, tips string) {
+	tweetURL := strings.ReplaceAll(req.TweetURL, " ", "")
+	tweetID := TweetIDFromURL(tweetURL)
+	if tweetID == "" {
+		return nil, "Unrecognized tweet URL"
+	}
+	actions := req.RequiredActions
+	if len(actions) == 0 {
+		actions = DefaultTweetActions
+	}
+	var requiredActions []string
+	for _, action := range actions {
+		if !database.IsValidTweetEngagementAction(string(action)) {
+			return nil, fmt.Sprintf("Unrecognized engagement %v", action)
+		}
+		requiredActions = append(requiredActions, string(action))
+	}
+	snapshot = &database.TweetSnapshots{
+		GuildID:             req.GuildID,
+		TweetID:             tweetID,
+		TweetURL:            tweetURL,
+		CampaignWhitelistID: req.WhitelistID,
+		RequiredActions:     strings.Join(requiredActions, ","),
+		ReplyKeywords:       strings.Join(req.ReplyKeywords, ","),
+		ReplyMinWords:       req.ReplyMinWords,
+		ReplyMinMentions:    req.ReplyMinMentions,
+		CutoffAt:            req.CutoffAt,
+		StarterDiscordID:    req.StarterID,
+	}
+	if campaign != nil {
+		snapshot.LinkedCampaignID = campaign.CampaignID
+		if snapshot.CampaignWhitelistID == "" {
+			snapshot.CampaignWhitelistID = database.FindCampaignWhitelistID(campaign.Required)
+		}
+		if snapshot.CutoffAt.IsZero() {
+			snapshot.CutoffAt = time.UnixMilli(campaign.EndDate)
+		}
+	}
+	if snapshot.CutoffAt.IsZero() {
+		snapshot.CutoffAt = time.Now()
+	}
+
+	tweet, err := NewClient().LookupTweet(tweetID)
+	if errors.Is(err, ErrorTwitterApiNotReady) {
+		return nil, "Twitter api not configured"
+	}
+	if err != nil {
+		log.Error(err)
+		return nil, "Unknown error"
+	}
+	if tweet == nil {
+		return nil, fmt.Sprintf("Tweet not found from %s", tweetURL)
+	}
+	snapshot.AuthorID = tweet.AuthorID
+	snapshot.TweetText = tweet.Text
+
+	created, err := snapshot.Create()
+	if err != nil {
+		log.Error(err)
+		return nil, "Unknown error"
+	}
+	if !created {
+		return nil, "A snapshot for this tweet already exists"
+	}
+	log.Infof("Tweet snapshot %v of guild %v created by %v, cutoff at %v", tweetID, req.GuildID, req.StarterID,
+		snapshot.CutoffAt.UTC())
+	return snapshot, ""
+}
+
+func (in *TweetSnapshotManager) collectDue() {
+	snapshots, err := database.TweetSnapshots{}.SelectDue(time.Now(), tweetSnapshotBatchSize)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	for _, snapshot := range snapshots {
+		claimed, err := snapshot.Claim()
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		in.collect(snapshot)
+	}
+}
+
+func (in *TweetSnapshotManager) collect(snapshot *database.TweetSnapshots) {
+	collector := newTweetEngagementCollector(snapshot)
+	if err := collector.collect(); err != nil {
+		in.retry(snapshot, err)
+		return
+	}
+	var (
+		engagements []*database.TweetEngagements
+		qualified   []string
+	)
+	for _, engager := range collector.engagers {
+		for _, engagement := range engager.actions {
+			engagements = append(engagements, engagement)
+		}
+		if collector.qualified(engager) {
+			qualified = append(qualified, engager.twitterID)
+		}
+	}
+	if err := (database.TweetEngagements{}).Replace(snapshot.ID, engagements); err != nil {
+		in.retry(snapshot, err)
+		return
+	}
+	if snapshot.CampaignWhitelistID != "" && len(qualified) > 0 {
+		if err := writeWhitelistIdentities(map[string][]string{snapshot.CampaignWhitelistID: qualified}); err != nil {
+			in.retry(snapshot, err)
+			return
+		}
+	}
+	// 可能失败重试的步骤完成后再上传，避免重试时重复上传导出文件
+	in.writeToS3(snapshot, collector)
+
+	now := time.Now()
+	snapshot.Status = database.TweetSnapshotStatusFinished
+	snapshot.FinishedAt = &now
+	snapshot.RetryAt = nil
+	snapshot.LastError = ""
+	snapshot.Likers = collector.counts[database.TweetEngagementLike]
+	snapshot.Retweeters = collector.counts[database.TweetEngagementRetweet]
+	snapshot.Quoters = collector.counts[database.TweetEngagementQuote]
+	snapshot.Repliers = collector.counts[database.TweetEngagementReply]
+	snapshot.Qualified = len(qualified)
+	if err := snapshot.Update(); err != nil {
+		log.Error(err)
+		return
+	}
+	log.Infof("Tweet snapshot %v of guild %v finished, %v likers, %v retweeters, %v quoters, %v repliers, %v qualified",
+		snapshot.TweetID, snapshot.GuildID, snapshot.Likers, snapshot.Retweeters, snapshot.Quoters, snapshot.Repliers,
+		snapshot.Qualified)
+}
+
+// retry 限流时在重置后重试且不计入次数，其他错误按次数退避，超过上限后标记失败
+func (in *TweetSnapshotManager) retry(snapshot *database.TweetSnapshots, err error) {
+	var (
+		now         = time.Now()
+		retryAt     = now.Add(time.Minute * 5 * time.Duration(snapshot.Attempts))
+		rateLimited *apiRateLimitError
+	)
+	snapshot.Status = database.TweetSnapshotStatusPending
+	snapshot.LastError = err.Error()
+	switch {
+	case errors.As(err, &rateLimited):
+		snapshot.Attempts--
+		retryAt = rateLimited.resetAt
+		log.Warnf("Tweet snapshot %v of guild %v %v", snapshot.TweetID, snapshot.GuildID, err)
+	case snapshot.Attempts >= tweetSnapshotMaxAttempts:
+		snapshot.Status = database.TweetSnapshotStatusFailed
+		log.Error(errors.WithMessageAndReport(err, fmt.Sprintf("collect tweet snapshot %v", snapshot.TweetID)))
+	default:
+		log.Error(errors.WithMessage(err, fmt.Sprintf("collect tweet snapshot %v", snapshot.TweetID)))
+	}
+	snapshot.RetryAt = &retryAt
+	if err := snapshot.Update(); err != nil {
+		log.Error(err)
+	}
+}
+
+func (in *TweetSnapshotManager) writeToS3(snapshot *database.TweetSnapshots, collector *tweetEngagementCollector) {
+	if len(collector.engagers) == 0 {
+		return
+	}
+	var (
+		referenceID = strconv.FormatInt(snapshot.ID, 10)
+		objectKey   = export.NewObjectKey(database.ExportKindTweet, referenceID, export.FormatCSV.Extension())
+	)
+	err := export.StreamToS3(context.TODO(), objectKey, export.FormatCSV, func(w export.RowWriter) error {
+		header := []string{"twitter id", "username", "liked", "retweeted", "quoted", "replied", "reply qualified",
+			"reply", "qualified"}
+		if err := w.WriteRow(header); err != nil {
+			return err
+		}
+		for _, engager := range collector.engagers {
+			var (
+				reply          = engager.actions[database.TweetEngagementReply]
+				replyText      string
+				replyQualified bool
+			)
+			if reply != nil {
+				replyText, replyQualified = reply.Text, reply.Qualified
+			}
+			row := []string{
+				engager.twitterID,
+				engager.username,
+				strconv.FormatBool(engager.actions[database.TweetEngagementLike] != nil),
+				strconv.FormatBool(engager.actions[database.TweetEngagementRetweet] != nil),
+				strconv.FormatBool(engager.actions[database.TweetEngagementQuote] != nil),
+				strconv.FormatBool(reply != nil),
+				strconv.FormatBool(replyQualified),
+				replyText,
+				strconv.FormatBool(collector.qualified(engager)),
+			}
+			if err := w.WriteRow(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	if _, err := export.Publish([]string{snapshot.GuildID}, database.ExportKindTweet, referenceID, objectKey, ""); err != nil {
+		log.Error(err)
+	}
+}
+
+// TweetIDFromURL 解析推文链接中的推文ID，如 https://twitter.com/moff/status/1634567890123456789
+func TweetIDFromURL(tweetURL string) string {
+	u, err := url.Parse(strings.TrimSpace(tweetURL))
+	if err != nil {
+		return ""
+	}
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	for idx, segment := range segments {
+		if segment != "status" && segment != "statuses" {
+			continue
+		}
+		if idx+1 < len(segments) && tweetIDPattern.MatchString(segments[idx+1]) {
+			return segments[idx+1]
+		}
+	}
+	return ""
+}
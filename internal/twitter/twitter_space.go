@@ -6,15 +6,14 @@ import (
 	"fmt"
 	"github.com/go-redis/redis/v8"
 	"gorm.io/gorm"
-	"io/ioutil"
 	"moff.io/moff-social/internal/cache"
-	"moff.io/moff-social/internal/csv"
 	"moff.io/moff-social/internal/database"
+	"moff.io/moff-social/internal/export"
+	"moff.io/moff-social/internal/identity"
 	"moff.io/moff-social/pkg/errors"
 	"moff.io/moff-social/pkg/log"
-	"net/http"
 	"strconv"
-	"strings"
+	"sync"
 	"time"
 )
 
@@ -35,6 +34,15 @@ func (in *Space) IsRunning() bool {
 	return in.State == SpaceRunning
 }
 
+func (in *Space) hasListeners() bool {
+	for _, presence := range in.Presences {
+		if presence.Identity == SpaceIdentityListener {
+			return true
+		}
+	}
+	return false
+}
+
 func (in *Space) IsGoingRunning() bool {
 	if in.ScheduledStartedAt == 0 {
 		return false
@@ -85,6 +93,11 @@ const (
 type SpaceParticipant struct {
 	Presence   *SpacePresence
 	PresenceMs int64
+	// 当前身份及开始时间，各身份累计时间
+	Role        SpaceIdentity
+	RoleSince   int64
+	RoleMs      map[SpaceIdentity]int64
+	Transitions []*SpaceRoleTransition
 }
 
 func (p *SpaceParticipant) Marshal() string {
@@ -96,12 +109,16 @@ func (p *SpaceParticipant) Marshal() string {
 }
 
 type SpaceMonitor struct {
-	authorization          *database.TwitterWebAuthorization
-	authorizationHeartbeat *database.TwitterWebAuthorizationHeartbeats
-	snapshot               *database.TwitterSpaceSnapshots
+	source   SpaceSource
+	snapshot *database.TwitterSpaceSnapshots
 
-	spaceRequest      *http.Request
 	spaceParticipants map[string]*SpaceParticipant
+	// 检查点状态，holder标识持有监控锁的实例
+	holder      string
+	sequence    int64
+	observedAt  int64
+	persistedAt int64
+	resume      *spaceResume
 }
 
 const (
@@ -116,41 +133,31 @@ const (
 
 var (
 	ErrorTwitterUnauthorized = errors.New("twitter web authorization expired")
+
+	spaceFinalizedHooksLock sync.RWMutex
+	spaceFinalizedHooks     []func(snapshot *database.TwitterSpaceSnapshots)
 )
 
-func NewSpaceMonitor(authorization *database.TwitterWebAuthorization, snapshot *database.TwitterSpaceSnapshots) *SpaceMonitor {
+// OnSpaceFinalized 注册快照结束后的回调，注册前已结束的快照不会回调
+func OnSpaceFinalized(fn func(snapshot *database.TwitterSpaceSnapshots)) {
+	spaceFinalizedHooksLock.Lock()
+	defer spaceFinalizedHooksLock.Unlock()
+	spaceFinalizedHooks = append(spaceFinalizedHooks, fn)
+}
+
+func NewSpaceMonitor(source SpaceSource, snapshot *database.TwitterSpaceSnapshots) *SpaceMonitor {
 	monitor := SpaceMonitor{
-		authorization: authorization,
-		authorizationHeartbeat: &database.TwitterWebAuthorizationHeartbeats{
-			AuthorizationID: authorization.ID,
-			TwitterSpaceID:  snapshot.SpaceID,
-		},
+		source:            source,
 		snapshot:          snapshot,
 		spaceParticipants: make(map[string]*SpaceParticipant),
+		holder:            newSpaceMonitorHolder(),
 	}
 	return &monitor
 }
 
-func (in *SpaceMonitor) buildSpaceRequest() (*http.Request, error) {
-	url := "https://api.twitter.com/graphql/i3Y4qgl8Xth8VLHTbMC9Hw/AudioSpaceById?variables=%7B%22id%22%3A%22" + in.snapshot.SpaceID + "%22%2C%22isMetatagsQuery%22%3Atrue%2C%22withSuperFollowsUserFields%22%3Atrue%2C%22withDownvotePerspective%22%3Afalse%2C%22withReactionsMetadata%22%3Afalse%2C%22withReactionsPerspective%22%3Afalse%2C%22withSuperFollowsTweetFields%22%3Atrue%2C%22withReplays%22%3Atrue%7D&features=%7B%22spaces_2022_h2_clipping%22%3Atrue%2C%22spaces_2022_h2_spaces_communities%22%3Atrue%2C%22responsive_web_twitter_blue_verified_badge_is_enabled%22%3Atrue%2C%22responsive_web_graphql_exclude_directive_enabled%22%3Afalse%2C%22verified_phone_label_enabled%22%3Afalse%2C%22responsive_web_graphql_skip_user_profile_image_extensions_enabled%22%3Afalse%2C%22longform_notetweets_consumption_enabled%22%3Atrue%2C%22tweetypie_unmention_optimization_enabled%22%3Atrue%2C%22vibe_api_enabled%22%3Atrue%2C%22responsive_web_edit_tweet_api_enabled%22%3Atrue%2C%22graphql_is_translatable_rweb_tweet_is_translatable_enabled%22%3Atrue%2C%22view_counts_everywhere_api_enabled%22%3Atrue%2C%22freedom_of_speech_not_reach_appeal_label_enabled%22%3Afalse%2C%22standardized_nudges_misinfo%22%3Atrue%2C%22tweet_with_visibility_results_prefer_gql_limited_actions_policy_enabled%22%3Afalse%2C%22responsive_web_graphql_timeline_navigation_enabled%22%3Atrue%2C%22interactive_text_enabled%22%3Atrue%2C%22responsive_web_text_conversations_enabled%22%3Afalse%2C%22responsive_web_enhance_cards_enabled%22%3Afalse%7D"
-	request, err := http.NewRequest(http.MethodGet, url, nil)
-	if err != nil {
-		return nil, errors.WrapAndReport(err, "create new request")
-	}
-	request.Header.Set("referer", "https://twitter.com/i/spaces/"+in.snapshot.SpaceID)
-	request.Header.Set("content-type", "application/json")
-	request.Header.Set("authorization", in.authorization.Authorization)
-	request.Header.Set("user-agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/106.0.0.0 Safari/537.36")
-	request.Header.Set("x-twitter-active-user", "yes")
-	request.Header.Set("x-twitter-auth-type", "OAuth2Session")
-	request.Header.Set("cookie", in.authorization.Cookies)
-	request.Header.Set("x-csrf-token", in.authorization.CsrfToken)
-	return request, nil
-}
-
 func (in *SpaceMonitor) Run() error {
 	key := fmt.Sprintf("%v%v", twitterSpaceLockKey, in.snapshot.SpaceID)
-	locked, err := cache.Redis.SetNX(context.TODO(), key, time.Now().UnixMilli(), time.Minute).Result()
+	locked, err := cache.Redis.SetNX(context.TODO(), key, in.holder, time.Minute).Result()
 	if err != nil {
 		return errors.WrapAndReport(err, "lock twitter snapshot monitor")
 	}
@@ -158,11 +165,10 @@ func (in *SpaceMonitor) Run() error {
 		log.Warn(errors.ErrorfAndReport("Seems twitter %v snapshot running...", in.snapshot.SpaceID))
 		return nil
 	}
-	participants, err := in.loadSpaceParticipants(in.snapshot.SpaceID)
-	if err != nil {
+	if err := in.restore(); err != nil {
+		in.try2UnlockSpaceMonitor()
 		return err
 	}
-	in.spaceParticipants = participants
 	go in.run()
 	return nil
 }
@@ -214,7 +220,7 @@ func (in *SpaceMonitor) try2UnlockSpaceMonitor() {
 	)
 	for i := 0; i < maxTry; i++ {
 		cache.Redis.Expire(ctx, presenceKey, time.Hour*24*3)
-		if err := cache.Redis.Del(ctx, key).Err(); err != nil {
+		if err := releaseRedisLock.Run(ctx, cache.Redis, []string{key}, in.holder).Err(); err != nil {
 			log.Error(errors.WrapAndReport(err, "unlock twitter space monitor"))
 			continue
 		}
@@ -223,21 +229,27 @@ func (in *SpaceMonitor) try2UnlockSpaceMonitor() {
 	}
 }
 
-func (in *SpaceMonitor) heartbeat(snapshot *database.TwitterSpaceSnapshots) {
+// heartbeat 续期监控锁，锁已过期并被其他实例获取时返回false
+func (in *SpaceMonitor) heartbeat(snapshot *database.TwitterSpaceSnapshots) bool {
 	key := fmt.Sprintf("%v%v", twitterSpaceLockKey, snapshot.SpaceID)
-	if err := cache.Redis.Set(context.TODO(), key, time.Now().UnixMilli(), time.Minute).Err(); err != nil {
+	extended, err := extendSpaceMonitorLock.Run(context.TODO(), cache.Redis, []string{key}, in.holder,
+		time.Minute.Milliseconds()).Int()
+	if err != nil {
 		log.Error(errors.WrapAndReport(err, "monitor lock ttl"))
+		return true
 	}
-
-	if err := in.authorizationHeartbeat.Beat(); err != nil {
-		log.Error(err)
+	if extended == 0 {
+		return false
 	}
+
+	in.source.Heartbeat()
+	return true
 }
 
 func (in *SpaceMonitor) run() {
 	defer in.try2UnlockSpaceMonitor()
 	var (
-		ticker                = time.NewTicker(time.Second * 10)
+		ticker                = time.NewTicker(spaceMonitorInterval)
 		logScheduledStartedAt bool
 		shouldFinalize        bool
 		snapshot              = in.snapshot
@@ -250,25 +262,13 @@ func (in *SpaceMonitor) run() {
 			log.Infof("Twitter space monitor self destructing as no owner")
 			return
 		}
-		in.heartbeat(snapshot)
+		if !in.heartbeat(snapshot) {
+			log.Warnf("Twitter space %v monitor lock lost, stopping", snapshot.SpaceID)
+			return
+		}
 		// 获取space信息
 		space, err := in.QueryTwitterSpace()
 		if err != nil {
-			if errors.Is(err, ErrorTwitterUnauthorized) {
-				if err := in.authorization.Expire(); err != nil {
-					log.Fatal(err)
-				}
-				authorization, err := NewSpaceManager().nextTwitterAuthorization(in.snapshot.SpaceID)
-				if err != nil {
-					log.Error(err)
-					return
-				}
-				if authorization == nil {
-					log.Fatal("Insufficient twitter web authorizations")
-				}
-				in.authorization = authorization
-				in.spaceRequest = nil
-			}
 			log.Error(err)
 			<-ticker.C
 			continue
@@ -287,6 +287,10 @@ func (in *SpaceMonitor) run() {
 			<-ticker.C
 			continue
 		case SpaceEnded, SpaceCanceled, SpaceTimeout:
+			if in.resume != nil {
+				// 中断期间space已结束
+				in.reconcileGap(&Space{}, time.Now().UnixMilli())
+			}
 			if shouldFinalize {
 				in.finalize()
 				return
@@ -302,47 +306,55 @@ func (in *SpaceMonitor) run() {
 
 		in.recordSpaceStarted()
 		log.Infof("Current twitter space %v participants %v", snapshot.SpaceID, len(space.Presences))
-		var (
-			currParticipants  = make(map[string]*SpaceParticipant)
-			newParticipantNum int64
-		)
-		for _, p := range space.Presences {
-			participant := &SpaceParticipant{Presence: p}
-			currParticipants[p.TwitterID] = participant
-			// 添加新增的参与者
-			if in.spaceParticipants[p.TwitterID] == nil {
-				newParticipantNum++
-				in.spaceParticipants[p.TwitterID] = participant
-				continue
-			}
-			// 既有参与者，检查是否退出后加入房间
-			// 此处偷懒，未校验他们的start的值
-			if in.spaceParticipants[p.TwitterID].Presence == nil {
-				in.spaceParticipants[p.TwitterID].Presence = p
-			}
+		now := time.Now().UnixMilli()
+		if in.resume != nil {
+			in.reconcileGap(space, now)
 		}
+		count := in.observeSpace(space, now)
+		in.recordConcurrency(now, count)
+		if !in.checkpoint(now) {
+			return
+		}
+		<-ticker.C
+	}
+}
 
-		//if newParticipantNum > 0 {
-		//	log.Infof("New participants:%v", newParticipantNum)
-		//}
+// observeSpace 根据本次查询结果更新参与者状态，返回当前在场人数
+func (in *SpaceMonitor) observeSpace(space *Space, now int64) int {
+	var (
+		currParticipants  = make(map[string]*SpaceParticipant)
+		newParticipantNum int64
+	)
+	for _, p := range space.Presences {
+		participant := in.spaceParticipants[p.TwitterID]
+		// 添加新增的参与者
+		if participant == nil {
+			newParticipantNum++
+			participant = &SpaceParticipant{}
+			in.spaceParticipants[p.TwitterID] = participant
+		}
+		// 既有参与者，检查是否退出后加入房间或身份变化
+		// 此处偷懒，未校验他们的start的值
+		participant.observe(p, now)
+		currParticipants[p.TwitterID] = participant
+	}
 
-		// 计算退出用户的参与时间
-		now := time.Now().UnixMilli()
-		for _, p := range in.spaceParticipants {
-			if p.Presence == nil {
-				continue
-			}
-			if currParticipants[p.Presence.TwitterID] != nil {
-				continue
-			}
-			// 用户已退出，计算其参与时间
-			p.PresenceMs += now - p.Presence.Since
-			p.Presence = nil
+	//if newParticipantNum > 0 {
+	//	log.Infof("New participants:%v", newParticipantNum)
+	//}
+
+	// 计算退出用户的参与时间
+	for _, p := range in.spaceParticipants {
+		if p.Presence == nil {
+			continue
 		}
-		// 执行缓存
-		in.cacheSpaceParticipants(context.TODO(), snapshot.SpaceID, in.spaceParticipants)
-		<-ticker.C
+		if currParticipants[p.Presence.TwitterID] != nil {
+			continue
+		}
+		// 用户已退出，计算其参与时间
+		p.leave(now)
 	}
+	return len(currParticipants)
 }
 
 func (in *SpaceMonitor) recordSpaceStarted() {
@@ -359,8 +371,10 @@ func (in *SpaceMonitor) recordSpaceStarted() {
 
 func (in *SpaceMonitor) finalize() {
 	in.calcUserPresences()
+	in.writeParticipantRoles()
 	in.writeToS3()
 	in.writeWhitelists()
+	in.calcAttendance()
 	now := time.Now()
 	in.snapshot.TotalParticipants = len(in.spaceParticipants)
 	in.snapshot.EndedAt = &now
@@ -369,14 +383,22 @@ func (in *SpaceMonitor) finalize() {
 		log.Error(err)
 	}
 	log.Infof("Finalized twitter space %v", in.snapshot.SpaceID)
+	spaceFinalizedHooksLock.RLock()
+	hooks := spaceFinalizedHooks
+	spaceFinalizedHooksLock.RUnlock()
+	for _, hook := range hooks {
+		hook(in.snapshot)
+	}
 }
 
+// calcUserPresences 仍在场的参与者截止至最后一次观测到space进行中的时间
 func (in *SpaceMonitor) calcUserPresences() {
-	nowMs := time.Now().UnixMilli()
+	endMs := in.observedAt
+	if endMs == 0 {
+		endMs = time.Now().UnixMilli()
+	}
 	for _, p := range in.spaceParticipants {
-		if p.Presence != nil {
-			p.PresenceMs += nowMs - p.Presence.Since
-		}
+		p.leave(endMs)
 	}
 }
 
@@ -385,23 +407,45 @@ func (in *SpaceMonitor) writeToS3() {
 		return
 	}
 
-	var (
-		records = [][]string{
-			{"twitter id", "seconds"},
-		}
-		now = time.Now()
-	)
-	for twitterID, p := range in.spaceParticipants {
-		records = append(records, []string{twitterID, strconv.Itoa(int(p.PresenceMs / 1000))})
+	owners, err := database.TwitterSpaceOwnerships{}.SelectSpaceOwners(in.snapshot.SpaceID)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	var guildIDs []string
+	for _, owner := range owners {
+		guildIDs = append(guildIDs, owner.DiscordGuildID)
 	}
-	objectKey := fmt.Sprintf("community/whitelist/twitter/%v/%v/%v/%v.csv",
-		now.Year(), now.Month(), now.Day(), in.snapshot.SpaceID)
-	err := csv.WriteCsvAndUploadToS3(objectKey, records)
+	objectKey := export.NewObjectKey(database.ExportKindTwitterSpace, in.snapshot.SpaceID, export.FormatCSV.Extension())
+	err = export.StreamToS3(context.TODO(), objectKey, export.FormatCSV, func(w export.RowWriter) error {
+		header := []string{"twitter id", "seconds", "highest role", "host seconds", "speaker seconds",
+			"listener seconds", "role transitions"}
+		if err := w.WriteRow(header); err != nil {
+			return err
+		}
+		for twitterID, p := range in.spaceParticipants {
+			row := []string{
+				twitterID,
+				strconv.Itoa(int(p.PresenceMs / 1000)),
+				p.HighestRole().DisplayName(),
+				strconv.Itoa(int(p.RoleMs[SpaceIdentityAdmin] / 1000)),
+				strconv.Itoa(int(p.RoleMs[SpaceIdentitySpeaker] / 1000)),
+				strconv.Itoa(int(p.RoleMs[SpaceIdentityListener] / 1000)),
+				p.TransitionsDesc(),
+			}
+			if err := w.WriteRow(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 	if err != nil {
 		log.Error(err)
 		return
 	}
-	in.snapshot.ParticipantLink = fmt.Sprintf("https://public.moff.io/%s", objectKey)
+	if _, err := export.Publish(guildIDs, database.ExportKindTwitterSpace, in.snapshot.SpaceID, objectKey, ""); err != nil {
+		log.Error(err)
+	}
 }
 
 func (in *SpaceMonitor) writeWhitelists() {
@@ -415,27 +459,58 @@ func (in *SpaceMonitor) writeWhitelists() {
 		return
 	}
 	var (
-		whitelists  = make(map[string][]string)
-		whitelistMs = make(map[string]int64)
+		whitelists     = make(map[string][]string)
+		whitelistRules = make(map[string]spaceWhitelistRule)
 	)
 	for _, owner := range owners {
 		if owner.CampaignWhitelistID == "" {
 			continue
 		}
 		whitelists[owner.CampaignWhitelistID] = make([]string, 0)
-		whitelistMs[owner.CampaignWhitelistID] = owner.SnapshotMinSeconds * 1000
+		whitelistRules[owner.CampaignWhitelistID] = newSpaceWhitelistRule(owner)
 	}
 	// 计算白名单
 	for twitterID, p := range in.spaceParticipants {
 		for wid, _ := range whitelists {
-			if p.PresenceMs < whitelistMs[wid] {
+			if !whitelistRules[wid].qualified(p) {
 				continue
 			}
 			whitelists[wid] = append(whitelists[wid], twitterID)
 		}
 	}
+	if err := writeWhitelistIdentities(whitelists); err != nil {
+		log.Error(err)
+	}
+}
+
+// writeWhitelistIdentities 按批写入twitter id白名单，已关联twitter账号的discord用户同时写入
+func writeWhitelistIdentities(whitelists map[string][]string) error {
+	discordIds := make(map[string][]string)
+	for wid, twitterIds := range whitelists {
+		if len(twitterIds) == 0 {
+			continue
+		}
+		resolved, err := identity.Resolve(database.CommunityQuestWhitelistUserIdentityTypeTwitterIds, twitterIds,
+			database.CommunityQuestWhitelistUserIdentityTypeDiscordIds)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		discordIds[wid] = resolved.Identities()
+	}
 	// 写入白名单
-	err = database.PublicPostgres.Transaction(func(tx *gorm.DB) error {
+	err := database.PublicPostgres.Transaction(func(tx *gorm.DB) error {
+		for wid, ids := range discordIds {
+			for start := 0; start < len(ids); start += 2000 {
+				end := start + 2000
+				if end > len(ids) {
+					end = len(ids)
+				}
+				if err := (database.Whitelist{}).WriteDiscordIds(tx, wid, ids[start:end]); err != nil {
+					return err
+				}
+			}
+		}
 		for wid, twitterIds := range whitelists {
 			if len(twitterIds) == 0 {
 				continue
@@ -446,7 +521,7 @@ func (in *SpaceMonitor) writeWhitelists() {
 			)
 			for i, tid := range twitterIds {
 				batch = append(batch, tid)
-				if len(batch) < batchSize && i < len(whitelists)-1 {
+				if len(batch) < batchSize && i < len(twitterIds)-1 {
 					continue
 				}
 				// 按批写入
@@ -459,135 +534,12 @@ func (in *SpaceMonitor) writeWhitelists() {
 		}
 		return nil
 	})
-	if err != nil {
-		log.Error(errors.WrapAndReport(err, "write whitelists"))
-	}
-}
-
-func (in *SpaceMonitor) cacheSpaceParticipants(ctx context.Context, spaceID string, participants map[string]*SpaceParticipant) {
-	var (
-		presenceKey    = fmt.Sprintf("twitter_space_presence:%v", spaceID)
-		presenceValues []interface{}
-	)
-	for twitterID, p := range participants {
-		presenceValues = append(presenceValues, twitterID, p.Marshal())
-	}
-	for i := 0; i < 3; i++ {
-		err := cache.Redis.HMSet(ctx, presenceKey, presenceValues...).Err()
-		if err != nil {
-			log.Error(errors.WrapAndReport(err, "cache twitter space presence values"))
-			continue
-		}
-		return
-	}
-	log.Error("Failed to cache twitter space presence values")
+	return errors.WrapAndReport(err, "write whitelists")
 }
 
+// QueryTwitterSpace 通过快照选定的数据来源查询space
 func (in *SpaceMonitor) QueryTwitterSpace() (*Space, error) {
-	if in.spaceRequest == nil {
-		request, err := in.buildSpaceRequest()
-		if err != nil {
-			return nil, err
-		}
-		in.spaceRequest = request
-	}
-	// 15分钟，500个请求, 即一个token最多支持5个twitter space的间隔10秒的请求
-	response, err := http.DefaultClient.Do(in.spaceRequest)
-	if err != nil {
-		return nil, errors.WrapAndReport(err, "request to twitter space api")
-	}
-
-	defer response.Body.Close()
-
-	// 判断当前是否已限流
-	rateLimit := response.Header.Get("x-rate-limit-remaining")
-	if rateLimit == "0" {
-		resetAtStr := response.Header.Get("x-rate-limit-reset")
-		resetAt, err := strconv.ParseInt(resetAtStr, 10, 64)
-		if err != nil {
-			return nil, errors.WrapAndReport(err, "parse reset at")
-		}
-		seconds := resetAt - time.Now().Unix()
-		time.Sleep(time.Second * time.Duration(seconds))
-		return nil, errors.WrapAndReport(err, "rate limited")
-	}
-
-	body, err := ioutil.ReadAll(response.Body)
-	if err != nil {
-		return nil, errors.WrapAndReport(err, "read twitter space response")
-	}
-	e := database.TwitterSpaceBackups{
-		SpaceID:     in.snapshot.SpaceID,
-		Response:    string(body),
-		CreatedTime: time.Now().UTC(),
-	}.Create()
-	if e != nil {
-		log.Error(err)
-	}
-	if response.StatusCode != http.StatusOK {
-		if response.StatusCode == http.StatusUnauthorized {
-			return nil, ErrorTwitterUnauthorized
-		}
-		return nil, errors.ErrorfAndReport("twitter space response status %v:%v", response.Status, string(body))
-	}
-	if strings.Contains(string(body), "BadRequest") {
-		log.Warn(string(body))
-		return nil, nil
-	}
-	var space spaceResponse
-	if err := json.Unmarshal(body, &space); err != nil {
-		return nil, errors.WrapAndReport(err, "unmarshal twitter participants")
-	}
-	return in.calcTwitterSpaceParticipants(&space), nil
-}
-
-func (in *SpaceMonitor) calcTwitterSpaceParticipants(space *spaceResponse) *Space {
-	var presences []*SpacePresence
-	admins := space.Data.AudioSpace.Participants.Admins
-	speakers := space.Data.AudioSpace.Participants.Speakers
-	listeners := space.Data.AudioSpace.Participants.Listeners
-	now := time.Now().UnixMilli()
-	for _, admin := range admins {
-		presence := &SpacePresence{
-			Identity:  SpaceIdentityAdmin,
-			TwitterID: firstNonDefault(admin.User.RestID, admin.UserResults.RestID),
-			Since:     now,
-		}
-		if admin.Start > 0 {
-			presence.Since = admin.Start
-		}
-		presences = append(presences, presence)
-	}
-	for _, speaker := range speakers {
-		presence := &SpacePresence{
-			Identity:  SpaceIdentitySpeaker,
-			TwitterID: firstNonDefault(speaker.User.RestID, speaker.UserResults.RestID),
-			Since:     now,
-		}
-		if speaker.Start > 0 {
-			presence.Since = speaker.Start
-		}
-		presences = append(presences, presence)
-	}
-	for _, listener := range listeners {
-		presence := &SpacePresence{
-			Identity:  SpaceIdentityListener,
-			TwitterID: firstNonDefault(listener.User.RestID, listener.UserResults.RestID),
-			Since:     now,
-		}
-		if listener.Start > 0 {
-			presence.Since = listener.Start
-		}
-		presences = append(presences, presence)
-	}
-	return &Space{
-		State:              space.Data.AudioSpace.Metadata.State,
-		Title:              space.Data.AudioSpace.Metadata.Title,
-		ScheduledStartedAt: space.Data.AudioSpace.Metadata.ScheduledStartedAt,
-		StartedAt:          space.Data.AudioSpace.Metadata.StartedAt,
-		UpdatedAt:          space.Data.AudioSpace.Metadata.UpdatedAt,
-		Presences:          presences,
-	}
+	return in.source.QuerySpace(in.snapshot.SpaceID)
 }
 
 type spaceResponse struct {
@@ -343,6 +343,9 @@ func (c *client) checkSignMessageResponse() error {
 	log.Debugf("wallet connect - sign message response:%v", signResult)
 	signatureHex := gjson.Get(signResult, "result").String()
 	c.wallet.signed = c.verifyEthSignature(c.wallet.Accounts[0], signatureHex, []byte(c.signMsg))
+	if c.wallet.signed {
+		c.wallet.signature = signatureHex
+	}
 	return nil
 }
 
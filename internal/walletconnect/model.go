@@ -16,7 +16,8 @@ type Wallet struct {
 	// approved or rejected
 	approved bool
 	// signed or rejected
-	signed bool
+	signed    bool
+	signature string
 }
 
 func (in *Wallet) Confirmed() bool {
@@ -31,6 +32,11 @@ func (in *Wallet) Signed() bool {
 	return in.signed
 }
 
+// Signature 用户对验证消息的签名
+func (in *Wallet) Signature() string {
+	return in.signature
+}
+
 type wcMessagePayload struct {
 	Data string `json:"data"`
 	Hmac string `json:"hmac"`
@@ -4,19 +4,23 @@ import (
 	"github.com/ethereum/go-ethereum/accounts"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/crypto"
+	"strings"
 )
 
-func verifySignature(signAddrHex, signatureHex string, msg []byte) bool {
+// VerifySignature 校验personal_sign签名是否由指定地址签发，地址不区分大小写
+func VerifySignature(signAddrHex, signatureHex string, msg []byte) bool {
 	sig, err := hexutil.Decode(signatureHex)
-	if err != nil {
+	if err != nil || len(sig) != crypto.SignatureLength {
 		return false
 	}
 	msg = accounts.TextHash(msg)
-	sig[crypto.RecoveryIDOffset] -= 27 // Transform yellow paper V from 27/28 to 0/1
+	if sig[crypto.RecoveryIDOffset] >= 27 {
+		sig[crypto.RecoveryIDOffset] -= 27 // Transform yellow paper V from 27/28 to 0/1
+	}
 	recovered, err := crypto.SigToPub(msg, sig)
 	if err != nil {
 		return false
 	}
 	recoveredAddr := crypto.PubkeyToAddress(*recovered)
-	return signAddrHex == recoveredAddr.Hex()
+	return strings.EqualFold(signAddrHex, recoveredAddr.Hex())
 }